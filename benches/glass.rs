@@ -0,0 +1,50 @@
+#![feature(test)]
+
+extern crate test;
+
+use ray_tracer_challenge::{
+    math::{Form, Geometry, Matrix, Point, Transformable, Vector},
+    scene::presets,
+    world::{light, Camera, Color, Light, Ray, World},
+};
+use test::{black_box, Bencher};
+
+/// glass spheres nested inside each other, like the layers of an onion, each a
+/// little denser than the one around it.
+fn onion(layers: usize) -> World {
+    let objects = (0..layers)
+        .map(|layer| {
+            let radius = (layers - layer) as f64;
+            let mut material = presets::glass(Color::white());
+            material.refractive_index = 1.1 + 0.1 * layer as f64;
+            Geometry::default()
+                .with_form(Form::Sphere)
+                .with_material(material)
+                .transformed(Matrix::scaling(radius, radius, radius))
+        })
+        .collect();
+    let light = Light::point(light::Point::new(
+        Point::new(-10.0, 10.0, -10.0),
+        Color::white(),
+    ));
+    World::new(objects, vec![light])
+}
+
+#[bench]
+fn refractive_indices_nested_glass(b: &mut Bencher) {
+    let world = onion(8);
+    let ray = Ray::new(Point::new(0.0, 0.0, -20.0), Vector::new(0.0, 0.0, 1.0));
+    let xs = world.hit(ray).unwrap();
+    b.iter(|| {
+        for intersection in xs.iter() {
+            black_box(intersection.compute_within(&xs, 1e-5));
+        }
+    });
+}
+
+#[bench]
+fn render_nested_glass(b: &mut Bencher) {
+    let world = onion(8);
+    let camera = Camera::new(16, 16, std::f64::consts::PI / 3.0).framed_world(&world, 0.1);
+    b.iter(|| black_box(camera.render(&world)));
+}
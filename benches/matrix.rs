@@ -0,0 +1,63 @@
+#![feature(stmt_expr_attributes, test)]
+
+extern crate test;
+
+use ray_tracer_challenge::math::{Matrix, Point, Vector};
+use test::{black_box, Bencher};
+
+fn transform() -> Matrix {
+    Matrix::translation(1.0, -2.0, 3.0)
+        * Matrix::rotation(Vector::new(1.0, 2.0, 3.0), 0.7)
+        * Matrix::scaling(2.0, 0.5, 1.5)
+}
+
+/// the product of the rows of `m` with the point, one element at a time, to compare
+/// against the column-wise product used by `Matrix`.
+fn by_rows(m: &Matrix, p: Point) -> Point {
+    #[rustfmt::skip]
+    Point::new(
+        m[(0, 0)] * p[0] + m[(0, 1)] * p[1] + m[(0, 2)] * p[2] + m.translation[0],
+        m[(1, 0)] * p[0] + m[(1, 1)] * p[1] + m[(1, 2)] * p[2] + m.translation[1],
+        m[(2, 0)] * p[0] + m[(2, 1)] * p[1] + m[(2, 2)] * p[2] + m.translation[2],
+    )
+}
+
+#[bench]
+fn matrix_times_point(b: &mut Bencher) {
+    let m = transform();
+    let points: Vec<Point> = (0..1000)
+        .map(|i| Point::new(i as f64, 1.0 - i as f64, 0.5 * i as f64))
+        .collect();
+    b.iter(|| {
+        for &p in points.iter() {
+            black_box(black_box(m) * p);
+        }
+    });
+}
+
+#[bench]
+fn matrix_times_point_by_rows(b: &mut Bencher) {
+    let m = transform();
+    let points: Vec<Point> = (0..1000)
+        .map(|i| Point::new(i as f64, 1.0 - i as f64, 0.5 * i as f64))
+        .collect();
+    b.iter(|| {
+        for &p in points.iter() {
+            black_box(by_rows(&black_box(m), p));
+        }
+    });
+}
+
+#[bench]
+fn matrix_times_vector(b: &mut Bencher) {
+    let m = transform();
+    let v = Vector::new(1.0, 2.0, 3.0);
+    b.iter(|| black_box(m) * black_box(v));
+}
+
+#[bench]
+fn matrix_times_matrix(b: &mut Bencher) {
+    let m = transform();
+    let n = transform().inverse();
+    b.iter(|| black_box(m) * black_box(n));
+}
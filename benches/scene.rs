@@ -0,0 +1,50 @@
+#![feature(test)]
+
+extern crate test;
+
+use ray_tracer_challenge::{
+    math::{Point, Vector},
+    scene::RandomScene,
+    world::{Camera, Ray},
+};
+use test::{black_box, Bencher};
+
+/// rays fanning out from in front of the cube of spheres.
+fn rays() -> Vec<Ray> {
+    let origin = Point::new(0.0, 0.0, -30.0);
+    (0..1000)
+        .map(|i| {
+            let (x, y) = ((i % 40) as f64 / 40.0 - 0.5, (i / 40) as f64 / 25.0 - 0.5);
+            Ray::new(origin, Vector::new(x, y, 1.0).normalized())
+        })
+        .collect()
+}
+
+#[bench]
+fn hit_random_spheres_flat(b: &mut Bencher) {
+    let world = RandomScene::new(500, 1).build();
+    let rays = rays();
+    b.iter(|| {
+        for &ray in rays.iter() {
+            black_box(world.hit(ray));
+        }
+    });
+}
+
+#[bench]
+fn hit_random_spheres_divided(b: &mut Bencher) {
+    let world = RandomScene::new(500, 1).with_divide(4).build();
+    let rays = rays();
+    b.iter(|| {
+        for &ray in rays.iter() {
+            black_box(world.hit(ray));
+        }
+    });
+}
+
+#[bench]
+fn render_random_spheres(b: &mut Bencher) {
+    let world = RandomScene::new(100, 1).with_divide(4).build();
+    let camera = Camera::new(32, 32, std::f64::consts::PI / 3.0).framed_world(&world, 0.1);
+    b.iter(|| black_box(camera.render(&world)));
+}
@@ -0,0 +1,221 @@
+# writes the images used by the png and jpeg tests in src/world/canvas.rs, along
+# with the ppm images they should decode to: python3 generate.py resources/fixtures
+import math, struct, zlib, sys, os
+OUT = sys.argv[1]
+os.makedirs(OUT, exist_ok=True)
+
+def ppm(name, w, h, px, maxval=255):
+    # px: list of rows of (r,g,b) ints
+    data = bytearray()
+    for row in px:
+        for c in row:
+            for v in c:
+                data += bytes([v]) if maxval < 256 else struct.pack('>H', v)
+    open(os.path.join(OUT, name), 'wb').write(b'P6\n%d %d\n%d\n' % (w, h, maxval) + bytes(data))
+
+# ---------------- png ----------------
+def chunk(kind, data):
+    return struct.pack('>I', len(data)) + kind + data + struct.pack('>I', zlib.crc32(kind + data) & 0xffffffff)
+
+def paeth(a, b, c):
+    p = a + b - c; pa, pb, pc = abs(p - a), abs(p - b), abs(p - c)
+    return a if pa <= pb and pa <= pc else (b if pb <= pc else c)
+
+def filt(ftype, line, prev, bpp):
+    out = bytearray()
+    for i, x in enumerate(line):
+        a = line[i - bpp] if i >= bpp else 0
+        b = prev[i]
+        c = prev[i - bpp] if i >= bpp else 0
+        pred = [0, a, b, (a + b) // 2, paeth(a, b, c)][ftype]
+        out.append((x - pred) & 0xff)
+    return bytes(out)
+
+def pack(samples, depth):
+    if depth == 8: return bytes(samples)
+    if depth == 16: return b''.join(struct.pack('>H', s) for s in samples)
+    out = bytearray(); acc = 0; n = 0
+    for s in samples:
+        acc = (acc << depth) | s; n += depth
+        if n == 8: out.append(acc); acc = 0; n = 0
+    if n: out.append(acc << (8 - n))
+    return bytes(out)
+
+def png(name, w, h, ctype, depth, samples, palette=None, interlace=False):
+    # samples(x, y) -> list of channel values
+    channels = {0: 1, 2: 3, 3: 1, 4: 2, 6: 4}[ctype]
+    bpp = max(1, channels * depth // 8)
+    passes = [(0, 0, 8, 8), (4, 0, 8, 8), (0, 4, 4, 8), (2, 0, 4, 4), (0, 2, 2, 4), (1, 0, 2, 2), (0, 1, 1, 2)] if interlace else [(0, 0, 1, 1)]
+    raw = bytearray(); n = 0
+    for x0, y0, dx, dy in passes:
+        xs = list(range(x0, w, dx)); ys = list(range(y0, h, dy))
+        if not xs or not ys: continue
+        prev = bytes(len(pack([0] * len(xs) * channels, depth)))
+        for y in ys:
+            line = pack([v for x in xs for v in samples(x, y)], depth)
+            f = n % 5; n += 1
+            raw += bytes([f]) + filt(f, line, prev, bpp)
+            prev = line
+    data = b'\x89PNG\r\n\x1a\n' + chunk(b'IHDR', struct.pack('>IIBBBBB', w, h, depth, ctype, 0, 0, 1 if interlace else 0))
+    if palette: data += chunk(b'PLTE', bytes(v for c in palette for v in c))
+    data += chunk(b'tEXt', b'Comment\x00ancillary chunks are skipped')
+    z = zlib.compress(bytes(raw), 9)
+    data += chunk(b'IDAT', z[:len(z) // 2]) + chunk(b'IDAT', z[len(z) // 2:]) + chunk(b'IEND', b'')
+    open(os.path.join(OUT, name), 'wb').write(data)
+
+# rgb, 8 bit, every filter type
+W, H = 13, 11
+rgb = lambda x, y: [x * 19 % 256, y * 23 % 256, (x * y * 7 + 40) % 256]
+png('rgb.png', W, H, 2, 8, rgb)
+ppm('rgb.ppm', W, H, [[tuple(rgb(x, y)) for x in range(W)] for y in range(H)])
+
+# rgba, 16 bit, interlaced
+rgba16 = lambda x, y: [x * 4099 % 65536, y * 5003 % 65536, (x + y) * 2999 % 65536, 1234]
+png('rgba16-interlaced.png', W, H, 6, 16, rgba16, interlace=True)
+ppm('rgba16-interlaced.ppm', W, H, [[tuple(rgba16(x, y)[:3]) for x in range(W)] for y in range(H)], 65535)
+
+# palette, 2 bit
+pal = [(255, 0, 0), (0, 255, 0), (0, 0, 255), (200, 100, 50)]
+idx = lambda x, y: [(x + 2 * y) % 4]
+png('palette.png', W, H, 3, 2, idx, palette=pal)
+ppm('palette.ppm', W, H, [[pal[idx(x, y)[0]] for x in range(W)] for y in range(H)])
+
+# gray, 1 bit, interlaced
+bit = lambda x, y: [(x ^ y) & 1]
+png('gray1-interlaced.png', W, H, 0, 1, bit, interlace=True)
+ppm('gray1-interlaced.ppm', W, H, [[(255 * bit(x, y)[0],) * 3 for x in range(W)] for y in range(H)])
+
+# ---------------- jpeg ----------------
+ZIGZAG = [0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5, 12, 19, 26, 33, 40, 48, 41, 34, 27, 20,
+          13, 6, 7, 14, 21, 28, 35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51, 58, 59,
+          52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63]
+# tables from annex k of the standard
+DC_L = ([0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0], list(range(12)))
+DC_C = ([0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0], list(range(12)))
+AC_L = ([0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 0x7d], bytes.fromhex(
+    '01020300041105122131410613516107227114328191a1082342b1c11552d1f02433627282090a161718191a25262728292a3435363738393a434445464748494a535455565758595a636465666768696a737475767778797a838485868788898a92939495969798999aa2a3a4a5a6a7a8a9aab2b3b4b5b6b7b8b9bac2c3c4c5c6c7c8c9cad2d3d4d5d6d7d8d9dae1e2e3e4e5e6e7e8e9eaf1f2f3f4f5f6f7f8f9fa'))
+AC_C = ([0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 0x77], bytes.fromhex(
+    '000102031104052131061241510761711322328108144291a1b1c109233352f0156272d10a162434e125f11718191a262728292a35363738393a434445464748494a535455565758595a636465666768696a737475767778797a82838485868788898a92939495969798999aa2a3a4a5a6a7a8a9aab2b3b4b5b6b7b8b9bac2c3c4c5c6c7c8c9cad2d3d4d5d6d7d8d9dae2e3e4e5e6e7e8e9eaf2f3f4f5f6f7f8f9fa'))
+
+def codes(table):
+    counts, symbols = table
+    out = {}; code = 0; k = 0
+    for length in range(1, 17):
+        for _ in range(counts[length - 1]):
+            out[symbols[k]] = (code, length); code += 1; k += 1
+        code <<= 1
+    return out
+
+class Writer:
+    def __init__(self): self.out = bytearray(); self.acc = 0; self.n = 0
+    def bits(self, value, length):
+        for i in range(length - 1, -1, -1):
+            self.acc = (self.acc << 1) | ((value >> i) & 1); self.n += 1
+            if self.n == 8:
+                self.out.append(self.acc)
+                if self.acc == 0xff: self.out.append(0)
+                self.acc = 0; self.n = 0
+    def flush(self):
+        if self.n: self.bits((1 << (8 - self.n)) - 1, 8 - self.n)
+
+def fdct(block):
+    out = [0.0] * 64
+    for v in range(8):
+        for u in range(8):
+            s = 0.0
+            for y in range(8):
+                for x in range(8):
+                    s += block[y * 8 + x] * math.cos((2 * x + 1) * u * math.pi / 16) * math.cos((2 * y + 1) * v * math.pi / 16)
+            cu = 1 / math.sqrt(2) if u == 0 else 1
+            cv = 1 / math.sqrt(2) if v == 0 else 1
+            out[v * 8 + u] = 0.25 * cu * cv * s
+    return out
+
+def category(v):
+    v = abs(v); n = 0
+    while v: v >>= 1; n += 1
+    return n
+
+def jpeg(name, w, h, planes, sampling, restart=0, adobe=None, extra_marker=False):
+    # planes: list of functions (x, y) -> sample at that component's resolution
+    ncomp = len(planes)
+    max_h = max(s[0] for s in sampling); max_v = max(s[1] for s in sampling)
+    mcux = (w + 8 * max_h - 1) // (8 * max_h); mcuy = (h + 8 * max_v - 1) // (8 * max_v)
+    cw = [(w * s[0] + max_h - 1) // max_h for s in sampling]
+    ch = [(h * s[1] + max_v - 1) // max_v for s in sampling]
+    tabs = [(codes(DC_L), codes(AC_L)) if i == 0 else (codes(DC_C), codes(AC_C)) for i in range(ncomp)]
+    wr = Writer(); pred = [0] * ncomp
+    def block(c, bx, by):
+        samples = []
+        for y in range(8):
+            for x in range(8):
+                # edge samples are repeated out to the block
+                px = min(bx * 8 + x, cw[c] - 1); py = min(by * 8 + y, ch[c] - 1)
+                samples.append(planes[c](px, py) - 128)
+        coef = [round(v) for v in fdct(samples)]
+        dc_t, ac_t = tabs[c]
+        diff = coef[0] - pred[c]; pred[c] = coef[0]
+        s = category(diff); code, l = dc_t[s]; wr.bits(code, l)
+        if s: wr.bits(diff if diff > 0 else diff + (1 << s) - 1, s)
+        run = 0
+        for k in range(1, 64):
+            v = coef[ZIGZAG[k]]
+            if v == 0: run += 1; continue
+            while run > 15:
+                code, l = ac_t[0xf0]; wr.bits(code, l); run -= 16
+            s = category(v); code, l = ac_t[(run << 4) | s]; wr.bits(code, l)
+            wr.bits(v if v > 0 else v + (1 << s) - 1, s); run = 0
+        if run:
+            code, l = ac_t[0]; wr.bits(code, l)
+    n = 0; rst = 0
+    for my in range(mcuy):
+        for mx in range(mcux):
+            if restart and n and n % restart == 0:
+                wr.flush(); wr.out += bytes([0xff, 0xd0 + rst % 8]); rst += 1; pred = [0] * ncomp
+            for c in range(ncomp):
+                for v in range(sampling[c][1]):
+                    for hh in range(sampling[c][0]):
+                        block(c, mx * sampling[c][0] + hh, my * sampling[c][1] + v)
+            n += 1
+    wr.flush()
+
+    def seg(marker, data): return bytes([0xff, marker]) + struct.pack('>H', len(data) + 2) + data
+    out = b'\xff\xd8' + seg(0xe0, b'JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00')
+    if adobe is not None: out += seg(0xee, b'Adobe' + struct.pack('>HHHB', 100, 0, 0, adobe))
+    if extra_marker: out += seg(0xfe, b'comments are skipped') + b'\xff'
+    # 16 bit quantization table of ones, to exercise those too
+    out += seg(0xdb, b'\x10' + b'\x00\x01' * 64)
+    out += seg(0xc0, struct.pack('>BHHB', 8, h, w, ncomp) + b''.join(bytes([i + 1, (s[0] << 4) | s[1], 0]) for i, s in enumerate(sampling)))
+    def dht(cls, idx, t): return bytes([(cls << 4) | idx]) + bytes(t[0]) + bytes(t[1])
+    out += seg(0xc4, dht(0, 0, DC_L) + dht(1, 0, AC_L) + dht(0, 1, DC_C) + dht(1, 1, AC_C))
+    if restart: out += seg(0xdd, struct.pack('>H', restart))
+    out += seg(0xda, bytes([ncomp]) + b''.join(bytes([i + 1, 0x00 if i == 0 else 0x11]) for i in range(ncomp)) + b'\x00\x3f\x00')
+    out += bytes(wr.out) + b'\xff\xd9'
+    open(os.path.join(OUT, name), 'wb').write(out)
+
+clamp = lambda v: max(0, min(255, round(v)))
+def rgb_of(y, cb, cr):
+    cb -= 128; cr -= 128
+    return (clamp(y + 1.402 * cr), clamp(y - 0.344136 * cb - 0.714136 * cr), clamp(y + 1.772 * cb))
+
+W, H = 21, 19
+# 4:4:4 luma and chroma
+yf = lambda x, y: 40 + x * 7 + y * 3
+cbf = lambda x, y: 100 + x * 2
+crf = lambda x, y: 150 - y * 2
+jpeg('ycbcr.jpg', W, H, [yf, cbf, crf], [(1, 1), (1, 1), (1, 1)], extra_marker=True)
+ppm('ycbcr.ppm', W, H, [[rgb_of(yf(x, y), cbf(x, y), crf(x, y)) for x in range(W)] for y in range(H)])
+
+# 4:2:0, so each chroma sample covers two by two pixels
+jpeg('ycbcr-420.jpg', W, H, [yf, cbf, crf], [(2, 2), (1, 1), (1, 1)], restart=2)
+ppm('ycbcr-420.ppm', W, H, [[rgb_of(yf(x, y), cbf(x // 2, y // 2), crf(x // 2, y // 2)) for x in range(W)] for y in range(H)])
+
+# rgb, as marked by an adobe segment
+rf = lambda x, y: x * 12; gf = lambda x, y: y * 13; bf = lambda x, y: 200 - x - y
+jpeg('adobe-rgb.jpg', W, H, [rf, gf, bf], [(1, 1), (1, 1), (1, 1)], adobe=0)
+ppm('adobe-rgb.ppm', W, H, [[(rf(x, y), gf(x, y), bf(x, y)) for x in range(W)] for y in range(H)])
+
+# grayscale, restarting after every block
+gf2 = lambda x, y: (x * 11 + y * 5) % 256
+jpeg('gray.jpg', W, H, [gf2], [(1, 1)], restart=1)
+ppm('gray.ppm', W, H, [[(gf2(x, y),) * 3 for x in range(W)] for y in range(H)])
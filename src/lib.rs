@@ -1,4 +1,5 @@
 #![feature(stmt_expr_attributes)]
 
 pub mod math;
+pub mod scene;
 pub mod world;
@@ -1,20 +1,125 @@
 #![feature(stmt_expr_attributes)]
 
-use std::f64::consts;
-
-mod math;
-mod world;
+use std::{
+    env,
+    f64::consts,
+    fmt::Display,
+    fs, process,
+    str::FromStr,
+    sync::atomic::{AtomicBool, Ordering},
+    thread,
+    time::{Duration, Instant},
+};
 
-use crate::{
+use ray_tracer_challenge::{
     math::{Form, Geometry, Matrix, Point, Transformable, Vector},
+    scene::{manifest::Settings, Manifest},
     world::{
+        camera::{Schedule, Tile},
         light::{self, Light},
         pattern::{Gradient, Grid, Stripe},
-        Camera, Color, Pattern, Texture, View, World,
+        Camera, Canvas, Color, Format, Pattern, Quality, Session, Texture, View, World,
     },
 };
 
-fn main() {
+/// the options that can be given on the command line.
+struct Options {
+    quality: Quality,
+    /// the settings of the world to render with in place of those of the quality
+    /// preset, when rerunning a render.
+    settings: Option<Settings>,
+    /// the most reflections to follow, in place of the quality preset's.
+    max_depth: Option<usize>,
+    /// the most reflected and refracted rays to follow for each pixel, if limited.
+    ray_budget: Option<usize>,
+    schedule: Schedule,
+    format: Format,
+    /// the exposure compensation, in stops, of each image to write instead of
+    /// printing one.
+    bracket: Option<Vec<f64>>,
+    /// the number of seconds to spend refining the image, if limited.
+    budget: Option<f64>,
+    /// whether to count the rays tested against each object, which slows the render.
+    stats: bool,
+    /// where to write the manifest of the render, if anywhere.
+    manifest: Option<String>,
+}
+
+/// parses `value` as the value of the command line option `name`, or exits.
+fn parse_or_exit<T: FromStr>(name: &str, value: &str) -> T
+where
+    T::Err: Display,
+{
+    match value.parse() {
+        Ok(value) => value,
+        Err(e) => {
+            eprintln!("invalid value for {}: {}", name, e);
+            process::exit(2);
+        }
+    }
+}
+
+/// reads the `--quality <preset>`, `--max-depth <count>`, `--ray-budget <count>`,
+/// `--workers <count>`, `--tile-size <pixels>`, `--order <order>`,
+/// `--format <ppm|csv|json>`, `--bracket <stops,...>`, `--budget <seconds>`, and
+/// `--manifest <path>` options from the command line, if present. each may also be
+/// given as `--name=value`. `--stats` takes no value.
+fn options_from_args() -> Options {
+    let mut args = env::args().skip(1);
+    let mut options = Options {
+        quality: Quality::default(),
+        settings: None,
+        max_depth: None,
+        ray_budget: None,
+        schedule: Schedule::default(),
+        format: Format::default(),
+        bracket: None,
+        budget: None,
+        stats: false,
+        manifest: None,
+    };
+
+    while let Some(arg) = args.next() {
+        if arg == "--stats" {
+            options.stats = true;
+            continue;
+        }
+
+        let (name, value) = match arg.find('=') {
+            Some(i) => (arg[..i].to_string(), arg[(i + 1)..].to_string()),
+            None => (arg.clone(), args.next().unwrap_or_default()),
+        };
+
+        match name.as_str() {
+            "--quality" => options.quality = parse_or_exit(&name, &value),
+            "--max-depth" => options.max_depth = Some(parse_or_exit(&name, &value)),
+            "--ray-budget" => options.ray_budget = Some(parse_or_exit(&name, &value)),
+            "--workers" => options.schedule.workers = parse_or_exit(&name, &value),
+            "--tile-size" => options.schedule.tile_size = parse_or_exit(&name, &value),
+            "--order" => options.schedule.order = parse_or_exit(&name, &value),
+            "--format" => options.format = parse_or_exit(&name, &value),
+            "--budget" => options.budget = Some(parse_or_exit(&name, &value)),
+            "--manifest" => options.manifest = Some(value),
+            "--bracket" => {
+                options.bracket = Some(
+                    value
+                        .split(',')
+                        .map(|stops| parse_or_exit(&name, stops.trim()))
+                        .collect(),
+                )
+            }
+            _ => {
+                eprintln!("unrecognized argument: {}", arg);
+                process::exit(2);
+            }
+        }
+    }
+
+    options
+}
+
+/// the scene that is rendered.
+fn scene() -> (World, Camera) {
     let mut floor = Geometry::default().with_form(Form::Plane);
     floor.material.texture = Texture::pattern(Pattern::grid(Grid::new(
         Color::new(0.5, 0.1, 0.5),
@@ -73,7 +178,250 @@ fn main() {
         Vector::new(0.0, 1.0, 0.0),
     );
 
-    let canvas = camera.render(&world);
+    (world, camera)
+}
+
+/// set once the user interrupts the program (with ctrl-c).
+static INTERRUPTED: AtomicBool = AtomicBool::new(false);
+
+#[cfg(unix)]
+mod interrupt {
+    use super::*;
+
+    const SIGINT: i32 = 2;
+    const SIG_DFL: usize = 0;
+
+    extern "C" {
+        fn signal(signum: i32, handler: usize) -> usize;
+    }
+
+    extern "C" fn interrupted(_: i32) {
+        INTERRUPTED.store(true, Ordering::Relaxed);
+        // a second interrupt stops the program at once.
+        unsafe {
+            signal(SIGINT, SIG_DFL);
+        }
+    }
+
+    /// records interrupts in `INTERRUPTED` instead of stopping the program.
+    pub fn catch() {
+        unsafe {
+            signal(SIGINT, interrupted as extern "C" fn(i32) as usize);
+        }
+    }
+}
+
+#[cfg(not(unix))]
+mod interrupt {
+    /// interrupts are not caught on this platform, so they stop the program.
+    pub fn catch() {}
+}
+
+/// fills each of `tiles` with a checkerboard of magenta and black, so that the parts
+/// of an interrupted render which were never rendered stand out.
+fn mark_unrendered(canvas: &mut Canvas, tiles: &[Tile]) {
+    let marker = Color::new(1.0, 0.0, 1.0);
+    for tile in tiles {
+        let mut view = canvas.sub(tile.x, tile.y, tile.width, tile.height);
+        for y in 0..tile.height {
+            for x in 0..tile.width {
+                let odd = ((tile.x + x) / 4 + (tile.y + y) / 4) % 2 == 1;
+                view[(x, y)] = if odd { marker } else { Color::black() };
+            }
+        }
+    }
+}
+
+/// renders the scene as `options` say, returning the image and the manifest of the
+/// render, which is finished by filling in the exposure and digest of each image
+/// that is written. if the render is interrupted, the image is as far as it got
+/// (with the unrendered tiles marked, unless it was being refined within a budget),
+/// and there is no manifest.
+fn render(world: World, camera: Camera, options: &Options) -> (Canvas, Option<Manifest>) {
+    let scene = Manifest::scene_hash(&world, &camera);
+    let seed = camera.frame;
+    let mut session = Session::new(world, camera)
+        .with_quality(options.quality)
+        .with_schedule(options.schedule);
+    if let Some(max_depth) = options.max_depth {
+        session.world.max_depth = max_depth;
+    }
+    if options.ray_budget.is_some() {
+        session.world.ray_budget = options.ray_budget;
+    }
+    if let Some(settings) = &options.settings {
+        settings.apply(&mut session.world);
+    }
+    let settings = Settings::of(&session.world);
+    if options.stats {
+        session = session.with_stats();
+    }
+
+    // cancel the render once the user interrupts it. the render checks in between
+    // tiles (or rows, when refining within a budget), so this only needs to look now
+    // and then.
+    let canceller = session.canceller();
+    thread::spawn(move || loop {
+        if INTERRUPTED.load(Ordering::Relaxed) {
+            canceller.cancel();
+            break;
+        }
+        thread::sleep(Duration::from_millis(50));
+    });
+
+    let start = Instant::now();
+    let canvas = match options.budget {
+        Some(seconds) => {
+            let canvas = session.render_within(16, Duration::from_secs_f64(seconds.max(0.0)));
+            if INTERRUPTED.load(Ordering::Relaxed) {
+                eprintln!("interrupted: the image was not refined any further");
+                return (canvas, None);
+            }
+            canvas
+        }
+        None => {
+            let (mut canvas, missing) = session.render_partial(|_| {});
+            if !missing.is_empty() {
+                let total = options.schedule.tiles(canvas.width, canvas.height).len();
+                eprintln!(
+                    "interrupted: {} of {} tiles were not rendered",
+                    missing.len(),
+                    total
+                );
+                mark_unrendered(&mut canvas, &missing);
+                return (canvas, None);
+            }
+            canvas
+        }
+    };
+
+    let manifest = Manifest {
+        version: env!("CARGO_PKG_VERSION").to_string(),
+        scene,
+        seed,
+        quality: options.quality,
+        settings,
+        schedule: options.schedule,
+        format: options.format,
+        exposure: 0.0,
+        budget: options.budget,
+        elapsed: start.elapsed(),
+        image: canvas.hash(),
+        stats: session.stats(),
+    };
+    (canvas, Some(manifest))
+}
+
+fn write_or_exit(path: &str, contents: String) {
+    if let Err(e) = fs::write(path, contents) {
+        eprintln!("could not write {}: {}", path, e);
+        process::exit(1);
+    }
+}
+
+/// renders the scene again with the settings recorded in the manifest at `path`,
+/// printing the image, and exits with an error if it does not match the original.
+fn rerun(path: &str) {
+    let manifest = match fs::read_to_string(path)
+        .map_err(|e| e.to_string())
+        .and_then(|source| Manifest::parse(&source).map_err(|e| e.to_string()))
+    {
+        Ok(manifest) => manifest,
+        Err(e) => {
+            eprintln!("could not read {}: {}", path, e);
+            process::exit(1);
+        }
+    };
+
+    let (world, mut camera) = scene();
+    if Manifest::scene_hash(&world, &camera) != manifest.scene {
+        eprintln!("the scene has changed since {} was written", path);
+        process::exit(1);
+    }
+    if manifest.version != env!("CARGO_PKG_VERSION") {
+        eprintln!(
+            "warning: {} was written by version {}, not {}",
+            path,
+            manifest.version,
+            env!("CARGO_PKG_VERSION")
+        );
+    }
+    camera.frame = manifest.seed;
+
+    let options = Options {
+        quality: manifest.quality,
+        settings: Some(manifest.settings.clone()),
+        max_depth: None,
+        ray_budget: None,
+        schedule: manifest.schedule,
+        format: manifest.format,
+        bracket: None,
+        budget: manifest.budget,
+        stats: manifest.stats.is_some(),
+        manifest: None,
+    };
+    let (canvas, rendered) = render(world, camera, &options);
+    let image = canvas.exposed(manifest.exposure);
+    print!("{}", image.export(manifest.format));
+    if rendered.is_none() {
+        process::exit(130);
+    }
+
+    if image.hash() != manifest.image {
+        eprintln!("the image differs from the one recorded in {}", path);
+        if manifest.budget.is_some() {
+            eprintln!("(renders limited by a time budget cannot be repeated exactly)");
+        }
+        process::exit(1);
+    }
+}
+
+fn main() {
+    let mut args = env::args().skip(1);
+    if let Some("rerun") = args.next().as_deref() {
+        match args.next() {
+            Some(path) => rerun(&path),
+            None => {
+                eprintln!("usage: rerun <manifest>");
+                process::exit(2);
+            }
+        }
+        return;
+    }
+
+    let options = options_from_args();
+    interrupt::catch();
+    let (world, camera) = scene();
+    let (canvas, manifest) = render(world, camera, &options);
+
+    if let Some(stops) = &options.bracket {
+        for &stop in stops {
+            let image = canvas.exposed(stop);
+            let path = format!("bracket{:+}", stop);
+            let manifest = manifest.as_ref().map(|manifest| Manifest {
+                exposure: stop,
+                image: image.hash(),
+                ..manifest.clone()
+            });
+            let comments = manifest.as_ref().map_or(vec![], Manifest::comments);
+            write_or_exit(
+                &format!("{}.{}", path, options.format.extension()),
+                image.export_with_comments(options.format, &comments),
+            );
+            if let Some(manifest) = &manifest {
+                write_or_exit(&format!("{}.manifest.json", path), manifest.to_json());
+            }
+        }
+    } else {
+        let comments = manifest.as_ref().map_or(vec![], Manifest::comments);
+        print!("{}", canvas.export_with_comments(options.format, &comments));
+        if let (Some(manifest), Some(path)) = (&manifest, &options.manifest) {
+            write_or_exit(path, manifest.to_json());
+        }
+    }
 
-    println!("{}", canvas.to_ppm());
+    if manifest.is_none() {
+        // the usual status of a program stopped by an interrupt.
+        process::exit(130);
+    }
 }
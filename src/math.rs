@@ -1,12 +1,20 @@
+pub mod bounds;
+pub use bounds::Bounds;
+
 pub mod geometry;
-pub use geometry::{Form, Geometry, Hittable, Transformable};
+pub use geometry::{Form, Geometry, Hittable, Transformable, Visibility};
 
 pub mod matrix;
-pub use matrix::Matrix;
+pub use matrix::{Decomposition, Matrix, Matrix2, Matrix3};
 
 pub mod point;
 pub use point::Point;
 
+pub mod quaternion;
+pub use quaternion::Quaternion;
+
+pub mod roots;
+
 pub mod vector;
 pub use vector::Vector;
 
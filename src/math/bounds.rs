@@ -0,0 +1,282 @@
+use super::{matrix::Matrix, point::Point, EPSILON};
+use crate::world::Ray;
+
+/// an axis-aligned box, given by its least and greatest corners. the box may reach
+/// infinitely far along some axes (like the box around a plane), or be empty (like
+/// the box around nothing at all), in which case `min` is greater than `max`.
+#[derive(Copy, Clone, Debug)]
+pub struct Bounds {
+    pub min: Point,
+    pub max: Point,
+}
+
+impl Bounds {
+    pub fn new(min: Point, max: Point) -> Bounds {
+        Bounds { min, max }
+    }
+
+    /// the box around nothing, which leaves any box it is merged with unchanged.
+    pub fn empty() -> Bounds {
+        let (inf, neg_inf) = (f64::INFINITY, f64::NEG_INFINITY);
+        Bounds::new(
+            Point::new(inf, inf, inf),
+            Point::new(neg_inf, neg_inf, neg_inf),
+        )
+    }
+
+    /// the box reaching `radius` out from `center` along each axis.
+    pub fn around(center: Point, radius: f64) -> Bounds {
+        Bounds::new(
+            Point::new(center[0] - radius, center[1] - radius, center[2] - radius),
+            Point::new(center[0] + radius, center[1] + radius, center[2] + radius),
+        )
+    }
+
+    pub fn is_empty(&self) -> bool {
+        (0..3).any(|i| self.max[i] < self.min[i])
+    }
+
+    /// whether the box is neither empty nor infinitely large.
+    pub fn is_finite(&self) -> bool {
+        !self.is_empty() && (0..3).all(|i| self.min[i].is_finite() && self.max[i].is_finite())
+    }
+
+    /// the smallest box containing both this box and `point`.
+    pub fn including(self, point: Point) -> Bounds {
+        self.merged(Bounds::new(point, point))
+    }
+
+    /// the smallest box containing both boxes.
+    pub fn merged(self, other: Bounds) -> Bounds {
+        Bounds::new(
+            Point::new(
+                self.min[0].min(other.min[0]),
+                self.min[1].min(other.min[1]),
+                self.min[2].min(other.min[2]),
+            ),
+            Point::new(
+                self.max[0].max(other.max[0]),
+                self.max[1].max(other.max[1]),
+                self.max[2].max(other.max[2]),
+            ),
+        )
+    }
+
+    /// whether all of `other` is inside this box.
+    pub fn contains(&self, other: &Bounds) -> bool {
+        (0..3).all(|i| self.min[i] <= other.min[i] && other.max[i] <= self.max[i])
+    }
+
+    /// cuts the box in half across its longest side.
+    pub fn split(&self) -> (Bounds, Bounds) {
+        // the first of the longest sides, when there is a tie.
+        let length = |axis: usize| self.max[axis] - self.min[axis];
+        let axis = (1..3).fold(0, |longest, axis| {
+            if length(longest) < length(axis) {
+                axis
+            } else {
+                longest
+            }
+        });
+        let middle = (self.min[axis] + self.max[axis]) / 2.0;
+
+        let (mut left_max, mut right_min) = (self.max, self.min);
+        left_max[axis] = middle;
+        right_min[axis] = middle;
+        (
+            Bounds::new(self.min, left_max),
+            Bounds::new(right_min, self.max),
+        )
+    }
+
+    pub fn center(&self) -> Point {
+        Point::new(
+            (self.min[0] + self.max[0]) / 2.0,
+            (self.min[1] + self.max[1]) / 2.0,
+            (self.min[2] + self.max[2]) / 2.0,
+        )
+    }
+
+    /// the times at which `ray` enters and leaves the box, which may be negative if
+    /// the box is behind the ray (or the ray starts inside of it). this is the "slab"
+    /// method: the ray is clipped against the pair of planes on each axis in turn.
+    pub fn hit(&self, ray: Ray) -> Option<(f64, f64)> {
+        if self.is_empty() {
+            return None;
+        }
+
+        let mut t_min = f64::NEG_INFINITY;
+        let mut t_max = f64::INFINITY;
+
+        for axis in 0..3 {
+            // a zero component divides to an infinity, which correctly leaves the range
+            // unbounded unless the origin is outside the slab.
+            let inverse = 1.0 / ray.direction[axis];
+            let mut t0 = (self.min[axis] - ray.origin[axis]) * inverse;
+            let mut t1 = (self.max[axis] - ray.origin[axis]) * inverse;
+            if t1 < t0 {
+                std::mem::swap(&mut t0, &mut t1);
+            }
+            if t0.is_nan() || t1.is_nan() {
+                return None;
+            }
+            t_min = t_min.max(t0);
+            t_max = t_max.min(t1);
+        }
+
+        if t_min <= t_max {
+            Some((t_min, t_max))
+        } else {
+            None
+        }
+    }
+
+    /// whether any part of the box is in front of `ray`.
+    pub fn is_hit_by(&self, ray: Ray) -> bool {
+        match self.hit(ray) {
+            Some((_, leave)) => 0.0 < leave,
+            None => false,
+        }
+    }
+
+    /// whether any part of the box is along `ray` between the times `t_min` and
+    /// `t_max`.
+    pub fn is_hit_between(&self, ray: Ray, t_min: f64, t_max: f64) -> bool {
+        match self.hit(ray) {
+            Some((enter, leave)) => t_min < leave && enter <= t_max,
+            None => false,
+        }
+    }
+
+    /// the box around this box once it has been transformed by `transform`. rather
+    /// than transforming the eight corners, each axis of the new box is found from the
+    /// least and greatest contribution of each axis of this box (from "transforming
+    /// axis-aligned bounding boxes" by jim arvo), which also works for infinite boxes.
+    pub fn transformed(self, transform: Matrix) -> Bounds {
+        if self.is_empty() {
+            return self;
+        }
+
+        let mut min = transform.translation;
+        let mut max = transform.translation;
+        for i in 0..3 {
+            for j in 0..3 {
+                let scale = transform[(i, j)];
+                // an axis that does not contribute must not turn infinity into nan.
+                if scale == 0.0 {
+                    continue;
+                }
+                let (a, b) = (scale * self.min[j], scale * self.max[j]);
+                min[i] += a.min(b);
+                max[i] += a.max(b);
+            }
+        }
+
+        Bounds::new(min, max)
+    }
+}
+
+impl PartialEq for Bounds {
+    /// test for equality using approximate comparison of floating point numbers, where
+    /// infinities are equal to themselves.
+    fn eq(&self, other: &Self) -> bool {
+        let close = |a: f64, b: f64| a == b || (a - b).abs() < EPSILON;
+        (0..3).all(|i| close(self.min[i], other.min[i]) && close(self.max[i], other.max[i]))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::Vector;
+    use std::f64::consts;
+
+    #[test]
+    fn empty_box() {
+        assert!(Bounds::empty().is_empty());
+        assert!(!Bounds::empty().is_finite());
+        let point = Point::new(1.0, 2.0, 3.0);
+        assert_eq!(Bounds::empty().including(point), Bounds::new(point, point));
+    }
+
+    #[test]
+    fn merging() {
+        let a = Bounds::new(Point::new(-1.0, 0.0, 0.0), Point::new(1.0, 1.0, 1.0));
+        let b = Bounds::new(Point::new(0.0, -2.0, 0.5), Point::new(3.0, 0.5, 0.75));
+        assert_eq!(
+            a.merged(b),
+            Bounds::new(Point::new(-1.0, -2.0, 0.0), Point::new(3.0, 1.0, 1.0))
+        );
+        assert_eq!(a.merged(Bounds::empty()), a);
+    }
+
+    #[test]
+    fn splitting_box() {
+        let b = Bounds::new(Point::new(-1.0, -2.0, -3.0), Point::new(9.0, 5.5, 3.0));
+        let (left, right) = b.split();
+        assert_eq!(
+            left,
+            Bounds::new(Point::new(-1.0, -2.0, -3.0), Point::new(4.0, 5.5, 3.0))
+        );
+        assert_eq!(
+            right,
+            Bounds::new(Point::new(4.0, -2.0, -3.0), Point::new(9.0, 5.5, 3.0))
+        );
+        assert!(b.contains(&left) && b.contains(&right));
+        assert!(!left.contains(&b));
+    }
+
+    #[test]
+    fn ray_hits_box() {
+        let cube = Bounds::around(Point::zero(), 1.0);
+        let r = Ray::new(Point::new(-5.0, 0.5, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert_eq!(cube.hit(r), Some((4.0, 6.0)));
+        assert!(cube.is_hit_by(r));
+
+        let behind = Ray::new(Point::new(5.0, 0.5, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert!(!cube.is_hit_by(behind));
+        let miss = Ray::new(Point::new(-5.0, 2.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert!(cube.hit(miss).is_none());
+        assert!(!Bounds::empty().is_hit_by(r));
+
+        assert!(cube.is_hit_between(r, 0.0, 4.0));
+        assert!(cube.is_hit_between(r, 5.0, 10.0));
+        assert!(!cube.is_hit_between(r, 0.0, 3.0));
+        assert!(!cube.is_hit_between(r, 6.0, 10.0));
+    }
+
+    #[test]
+    fn ray_hits_infinite_box() {
+        let (inf, neg_inf) = (f64::INFINITY, f64::NEG_INFINITY);
+        let plane = Bounds::new(Point::new(neg_inf, 0.0, neg_inf), Point::new(inf, 0.0, inf));
+        let down = Ray::new(Point::new(3.0, 2.0, 7.0), Vector::new(0.0, -1.0, 0.0));
+        assert_eq!(plane.hit(down), Some((2.0, 2.0)));
+    }
+
+    #[test]
+    fn transforming() {
+        let cube = Bounds::around(Point::zero(), 1.0);
+        let turned = cube
+            .transformed(Matrix::translation(1.0, 0.0, 0.0) * Matrix::rotation_y(consts::PI / 4.0));
+        let half = f64::from(2.0).sqrt();
+        assert_eq!(
+            turned,
+            Bounds::new(
+                Point::new(1.0 - half, -1.0, -half),
+                Point::new(1.0 + half, 1.0, half)
+            )
+        );
+    }
+
+    #[test]
+    fn transforming_infinite_box() {
+        let (inf, neg_inf) = (f64::INFINITY, f64::NEG_INFINITY);
+        let plane = Bounds::new(Point::new(neg_inf, 0.0, neg_inf), Point::new(inf, 0.0, inf));
+        let raised = plane.transformed(Matrix::translation(0.0, 2.0, 0.0));
+        assert_eq!(
+            raised,
+            Bounds::new(Point::new(neg_inf, 2.0, neg_inf), Point::new(inf, 2.0, inf))
+        );
+        assert!(!raised.is_finite());
+    }
+}
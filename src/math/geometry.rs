@@ -1,42 +1,173 @@
+pub mod billboard;
+pub use billboard::Billboard;
+
+pub mod disk;
+pub use disk::Disk;
+
+pub mod group;
+pub use group::Group;
+
+pub mod heightfield;
+pub use heightfield::Heightfield;
+
+pub mod march;
+
+pub mod metaballs;
+pub use metaballs::Metaballs;
+
 pub mod plane;
 pub use plane::Plane;
 
+pub mod quad;
+pub use quad::Quad;
+
+pub mod rounded_box;
+pub use rounded_box::RoundedBox;
+
+pub mod sdf;
+pub use sdf::Sdf;
+
 pub mod sphere;
 pub use sphere::Sphere;
 
+pub mod test_shape;
+pub use test_shape::TestShape;
+
+pub mod torus;
+pub use torus::Torus;
+
+pub mod tube;
+pub use tube::Tube;
+
+use std::sync::Arc;
+
 use crate::{
-    math::{Matrix, Point, Vector},
+    math::{Bounds, Matrix, Point, Vector},
     world::{Color, Intersection, Intersections, Material, Ray, Textured},
 };
 
-use std::cmp::Reverse;
-
 pub trait Transformable {
     fn transformed(self, transform: Matrix) -> Self;
     fn transform(&mut self, transform: Matrix) -> &mut Self;
 }
 
 /// enum representing the possible geometry objects.
-#[derive(Copy, Clone, Debug, PartialEq)]
+#[derive(Clone, Debug, PartialEq)]
 pub enum Form {
     Plane,
     Sphere,
+    /// a disk of the given radius in the xz plane.
+    Disk {
+        radius: f64,
+    },
+    /// a rectangle in the xz plane, `width` along x and `depth` along z.
+    Quad {
+        width: f64,
+        depth: f64,
+    },
+    /// a cube from -1 to 1 along each axis, with edges rounded off to the given radius.
+    RoundedBox {
+        radius: f64,
+    },
+    /// a terrain whose height is sampled on a grid over the square from 0 to 1 along
+    /// the x and z axes.
+    Heightfield(Heightfield),
+    /// a surface described by a signed distance function, found by ray marching.
+    Sdf(Sdf),
+    /// spheres which blend smoothly into each other, found by ray marching.
+    Metaballs(Metaballs),
+    /// a tube swept along a line through a list of points.
+    Tube(Tube),
+    /// a ring around the y axis, whose tube of radius `minor` runs around a circle of
+    /// radius `major`.
+    Torus {
+        major: f64,
+        minor: f64,
+    },
+    /// an upright rectangle cut out of a sprite, which turns to face a point.
+    Billboard(Billboard),
+    /// other objects, transformed together.
+    Group(Group),
+    /// a form which is never hit, but records the rays sent to it; see `TestShape`.
+    Test(TestShape),
     None,
 }
 
+impl Form {
+    /// the box around the form, in object space.
+    pub fn bounds(&self) -> Bounds {
+        let (inf, neg_inf) = (f64::INFINITY, f64::NEG_INFINITY);
+        match *self {
+            Form::Plane => {
+                Bounds::new(Point::new(neg_inf, 0.0, neg_inf), Point::new(inf, 0.0, inf))
+            }
+            Form::Sphere | Form::RoundedBox { .. } => Bounds::around(Point::zero(), 1.0),
+            Form::Disk { radius } => Bounds::new(
+                Point::new(-radius, 0.0, -radius),
+                Point::new(radius, 0.0, radius),
+            ),
+            Form::Quad { width, depth } => Bounds::new(
+                Point::new(-width / 2.0, 0.0, -depth / 2.0),
+                Point::new(width / 2.0, 0.0, depth / 2.0),
+            ),
+            Form::Heightfield(ref heightfield) => heightfield.bounds(),
+            Form::Sdf(ref sdf) => Bounds::around(Point::zero(), sdf.bound),
+            Form::Metaballs(ref metaballs) => metaballs.bounds(),
+            Form::Tube(ref tube) => tube.bounds(),
+            Form::Torus { major, minor } => Torus::new(major, minor).bounds(),
+            Form::Billboard(ref billboard) => billboard.bounds(),
+            Form::Group(ref group) => group.bounds(),
+            Form::Test(ref shape) => shape.bounds(),
+            Form::None => Bounds::empty(),
+        }
+    }
+}
+
 /// trait outlining the functionality of a geometry object.
 pub trait Hittable {
-    fn hit(self, object_space_ray: Ray) -> Option<Intersections>;
-    fn normal_at(self, object_space_point: Point) -> Option<Vector>;
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections>;
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector>;
 }
 
-/// encapsulates the geometry variant along with associated data.
+/// which kinds of rays can see an object. everything is visible by default; turning
+/// these off lets an object, for example, cast a shadow without being seen itself.
 #[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Visibility {
+    /// whether rays from the camera hit the object.
+    pub camera: bool,
+    /// whether the object blocks light from reaching other objects.
+    pub shadows: bool,
+    /// whether the object shows up in reflections.
+    pub reflections: bool,
+}
+
+impl Default for Visibility {
+    fn default() -> Visibility {
+        Visibility {
+            camera: true,
+            shadows: true,
+            reflections: true,
+        }
+    }
+}
+
+/// encapsulates the geometry variant along with associated data.
+///
+/// the inverse of the transform, and its transpose for normals, are worked out once
+/// whenever the transform is set, rather than for every ray.
+#[derive(Clone, Debug, PartialEq)]
 pub struct Geometry {
     pub form: Form,
     pub transform: Matrix,
     pub inverse: Matrix,
+    /// the transpose of `inverse`, which carries normals from object space into
+    /// world space.
+    pub normal_transform: Matrix,
     pub material: Material,
+    pub visibility: Visibility,
+    /// a name for the object, so that it can be found again (see `World::find`) and
+    /// recognized in reports.
+    pub name: Option<Arc<str>>,
 }
 
 impl Geometry {
@@ -45,51 +176,149 @@ impl Geometry {
             form,
             transform,
             inverse,
+            normal_transform: inverse.transposed(),
             material,
+            visibility: Visibility::default(),
+            name: None,
         }
     }
 
     pub fn with_form(self, form: Form) -> Geometry {
-        Geometry {
-            form,
-            transform: self.transform,
-            inverse: self.inverse,
-            material: self.material,
-        }
+        Geometry { form, ..self }
     }
 
     pub fn change_form(&mut self, form: Form) -> &mut Geometry {
-        *self = self.with_form(form);
+        self.form = form;
         self
     }
 
     pub fn with_material(self, material: Material) -> Geometry {
-        Geometry {
-            material,
-            transform: self.transform,
-            inverse: self.inverse,
-            form: self.form,
-        }
+        Geometry { material, ..self }
     }
 
     pub fn change_material(&mut self, material: Material) -> &mut Geometry {
-        *self = self.with_material(material);
+        self.material = material;
         self
     }
+
+    pub fn with_visibility(self, visibility: Visibility) -> Geometry {
+        Geometry { visibility, ..self }
+    }
+
+    pub fn with_name(self, name: &str) -> Geometry {
+        Geometry {
+            name: Some(name.into()),
+            ..self
+        }
+    }
+
+    /// the box around the object, in world space.
+    pub fn bounds(&self) -> Bounds {
+        self.form.bounds().transformed(self.transform)
+    }
+
+    /// this object as it is placed in the world when it is a child of `parent`: its
+    /// transform is followed by the parent's. the inverse is composed from the two
+    /// inverses, so nothing needs to be inverted again. it is only visible to the
+    /// rays which can see both it and the parent.
+    pub fn within(self, parent: &Geometry) -> Geometry {
+        let inverse = self.inverse * parent.inverse;
+        Geometry {
+            transform: parent.transform * self.transform,
+            inverse,
+            normal_transform: inverse.transposed(),
+            visibility: Visibility {
+                camera: self.visibility.camera && parent.visibility.camera,
+                shadows: self.visibility.shadows && parent.visibility.shadows,
+                reflections: self.visibility.reflections && parent.visibility.reflections,
+            },
+            ..self
+        }
+    }
+
+    /// like `hit`, but only the intersections between `t_min` and `t_max` are wanted,
+    /// and the ray goes no further than an object for which `stops` returns `true`.
+    /// `t_max` is brought in to the first such intersection after `t_min` that is
+    /// found, and the children of groups whose boxes are not between the two are not
+    /// tested. some intersections outside of the two may still be returned.
+    pub fn hit_until(
+        &self,
+        world_space_ray: Ray,
+        t_min: f64,
+        t_max: &mut f64,
+        stops: &dyn Fn(&Geometry) -> bool,
+    ) -> Option<Intersections> {
+        match self.form {
+            // the children are judged as they are placed within this group, so that
+            // they are as visible as it is.
+            Form::Group(ref group) => group
+                .hit_until(
+                    world_space_ray.transformed(self.inverse),
+                    t_min,
+                    t_max,
+                    &|child: &Geometry| stops(&child.clone().within(self)),
+                )
+                .map(|intersections| self.placed(world_space_ray, &intersections)),
+            _ => {
+                let intersections = self.hit(world_space_ray)?;
+                if let Some(first) = intersections.hit_after(t_min) {
+                    if stops(self) {
+                        *t_max = t_max.min(first.time);
+                    }
+                }
+                Some(intersections)
+            }
+        }
+    }
+
+    /// the intersections of the form, which were found with the ray in object space,
+    /// as intersections of this object with `world_space_ray`.
+    fn placed(&self, world_space_ray: Ray, intersections: &Intersections) -> Intersections {
+        Intersections::with(
+            intersections
+                .iter()
+                .map(|intersection| Intersection {
+                    ray: world_space_ray,
+                    // the children of a group were hit, not the group itself.
+                    object: match self.form {
+                        Form::Group(_) => intersection.object.clone().within(self),
+                        _ => self.clone(),
+                    },
+                    ..intersection.clone()
+                })
+                .collect(),
+        )
+    }
+
+    /// turns a billboard to face `world_space_point`, such as the position of the
+    /// camera. since the point is converted into object space, this must be done
+    /// after the object is transformed. other forms are left as they are.
+    pub fn facing(self, world_space_point: Point) -> Geometry {
+        match self.form {
+            Form::Billboard(ref billboard) => {
+                let billboard = billboard.clone().facing(self.inverse * world_space_point);
+                self.with_form(Form::Billboard(billboard))
+            }
+            _ => self,
+        }
+    }
 }
 
 impl Transformable for Geometry {
     fn transformed(self, transform: Matrix) -> Geometry {
+        let inverse = transform.inverse();
         Geometry {
             transform,
-            form: self.form,
-            inverse: transform.inverse(),
-            material: self.material,
+            inverse,
+            normal_transform: inverse.transposed(),
+            ..self
         }
     }
 
     fn transform(&mut self, transform: Matrix) -> &mut Geometry {
-        *self = self.transformed(transform);
+        self.transform = transform;
+        self.inverse = transform.inverse();
+        self.normal_transform = self.inverse.transposed();
         self
     }
 }
@@ -102,37 +331,51 @@ impl Textured for Geometry {
 }
 
 impl Hittable for Geometry {
-    fn hit(self, world_space_ray: Ray) -> Option<Intersections> {
+    fn hit(&self, world_space_ray: Ray) -> Option<Intersections> {
         let object_space_ray = world_space_ray.transformed(self.inverse);
 
         if let Some(intersections) = match self.form {
             Form::Sphere => Sphere::new().hit(object_space_ray),
             Form::Plane => Plane::new().hit(object_space_ray),
+            Form::Disk { radius } => Disk::new(radius).hit(object_space_ray),
+            Form::Quad { width, depth } => Quad::new(width, depth).hit(object_space_ray),
+            Form::RoundedBox { radius } => RoundedBox::new(radius).hit(object_space_ray),
+            Form::Heightfield(ref heightfield) => heightfield.hit(object_space_ray),
+            Form::Sdf(ref sdf) => sdf.hit(object_space_ray),
+            Form::Metaballs(ref metaballs) => metaballs.hit(object_space_ray),
+            Form::Tube(ref tube) => tube.hit(object_space_ray),
+            Form::Torus { major, minor } => Torus::new(major, minor).hit(object_space_ray),
+            Form::Billboard(ref billboard) => billboard.hit(object_space_ray),
+            Form::Group(ref group) => group.hit(object_space_ray),
+            Form::Test(ref shape) => shape.hit(object_space_ray),
             Form::None => None,
         } {
-            Some(Intersections::with(
-                intersections
-                    .heap
-                    .iter()
-                    .map(|&Reverse(intersection)| {
-                        Intersection::new(intersection.time, world_space_ray, self)
-                    })
-                    .collect(),
-            ))
+            Some(self.placed(world_space_ray, &intersections))
         } else {
             None
         }
     }
 
-    fn normal_at(self, world_space_point: Point) -> Option<Vector> {
+    fn normal_at(&self, world_space_point: Point) -> Option<Vector> {
         let object_space_point = self.inverse * world_space_point;
 
         if let Some(normal) = match self.form {
             Form::Sphere => Sphere::new().normal_at(object_space_point),
             Form::Plane => Plane::new().normal_at(object_space_point),
+            Form::Disk { radius } => Disk::new(radius).normal_at(object_space_point),
+            Form::Quad { width, depth } => Quad::new(width, depth).normal_at(object_space_point),
+            Form::RoundedBox { radius } => RoundedBox::new(radius).normal_at(object_space_point),
+            Form::Heightfield(ref heightfield) => heightfield.normal_at(object_space_point),
+            Form::Sdf(ref sdf) => sdf.normal_at(object_space_point),
+            Form::Metaballs(ref metaballs) => metaballs.normal_at(object_space_point),
+            Form::Tube(ref tube) => tube.normal_at(object_space_point),
+            Form::Torus { major, minor } => Torus::new(major, minor).normal_at(object_space_point),
+            Form::Billboard(ref billboard) => billboard.normal_at(object_space_point),
+            Form::Group(ref group) => group.normal_at(object_space_point),
+            Form::Test(ref shape) => shape.normal_at(object_space_point),
             Form::None => None,
         } {
-            Some((self.inverse.transposed() * normal).normalized())
+            Some((self.normal_transform * normal).normalized())
         } else {
             None
         }
@@ -145,7 +388,10 @@ impl Default for Geometry {
             form: Form::None,
             transform: Matrix::identity(),
             inverse: Matrix::identity(),
+            normal_transform: Matrix::identity(),
             material: Material::default(),
+            visibility: Visibility::default(),
+            name: None,
         }
     }
 }
@@ -167,6 +413,23 @@ mod tests {
         let s = Geometry::default().transformed(m);
         assert_eq!(s.transform, m);
         assert_eq!(s.inverse, m.inverse());
+        assert_eq!(s.normal_transform, m.inverse().transposed());
+    }
+
+    #[test]
+    fn bounds_are_transformed() {
+        let s = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(1.0, 2.0, 3.0) * Matrix::scaling(2.0, 1.0, 1.0));
+        assert_eq!(
+            s.bounds(),
+            Bounds::new(Point::new(-1.0, 1.0, 2.0), Point::new(3.0, 3.0, 4.0))
+        );
+        assert!(Geometry::default().bounds().is_empty());
+        assert!(!Geometry::default()
+            .with_form(Form::Plane)
+            .bounds()
+            .is_finite());
     }
 
     #[test]
@@ -179,7 +442,7 @@ mod tests {
     fn assigning_material() {
         let mut m = Material::default();
         m.ambient = 1.0;
-        let s = Geometry::default().with_material(m);
+        let s = Geometry::default().with_material(m.clone());
         assert_eq!(s.material, m);
     }
 }
@@ -0,0 +1,164 @@
+use crate::{
+    math::{Bounds, Form, Geometry, Hittable, Point, Vector, EPSILON},
+    world::{Intersection, Intersections, Ray, Sprite},
+};
+
+/// an upright rectangle centered at the origin, which turns around the y axis to face
+/// a point (usually the camera), and is cut out of a sprite: wherever the sprite is
+/// less opaque than the `cutoff`, rays pass straight through. useful for dressing a
+/// scene with flat pictures of trees and grass.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Billboard {
+    pub sprite: Sprite,
+    pub width: f64,
+    pub height: f64,
+    /// the least alpha which is still solid.
+    pub cutoff: f64,
+    /// the point (in object space) that the front of the billboard turns towards.
+    pub facing: Point,
+}
+
+impl Billboard {
+    /// faces along the z axis, and cuts out anything which is less than half opaque.
+    pub fn new(sprite: Sprite, width: f64, height: f64) -> Billboard {
+        Billboard {
+            sprite,
+            width,
+            height,
+            cutoff: 0.5,
+            facing: Point::new(0.0, 0.0, 1.0),
+        }
+    }
+
+    pub fn with_cutoff(self, cutoff: f64) -> Billboard {
+        Billboard { cutoff, ..self }
+    }
+
+    pub fn facing(self, facing: Point) -> Billboard {
+        Billboard { facing, ..self }
+    }
+
+    /// the box around the billboard however it is turned.
+    pub fn bounds(&self) -> Bounds {
+        let (x, y) = (self.width / 2.0, self.height / 2.0);
+        Bounds::new(Point::new(-x, -y, -x), Point::new(x, y, x))
+    }
+
+    /// the direction the front of the billboard faces, which is always horizontal.
+    fn front(&self) -> Vector {
+        let front = Vector::new(self.facing[0], 0.0, self.facing[2]);
+        if front.magnitude() < EPSILON {
+            // looking straight down on the billboard, so any direction will do.
+            Vector::new(0.0, 0.0, 1.0)
+        } else {
+            front.normalized()
+        }
+    }
+}
+
+impl Hittable for Billboard {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        let front = self.front();
+        let speed = object_space_ray.direction.dot(&front);
+        if speed.abs() < EPSILON {
+            return None;
+        }
+
+        let t = -(object_space_ray.origin - Point::zero()).dot(&front) / speed;
+        let point = object_space_ray.at(t) - Point::zero();
+
+        // the direction which is to the right when looking at the front.
+        let right = Vector::new(0.0, 1.0, 0.0).cross(&front);
+        let u = point.dot(&right) / self.width + 0.5;
+        let v = point[1] / self.height + 0.5;
+        if t < 0.0 || !(0.0..=1.0).contains(&u) || !(0.0..=1.0).contains(&v) {
+            return None;
+        }
+
+        let (_, alpha) = self.sprite.sample(u, v);
+        if alpha < self.cutoff {
+            return None;
+        }
+
+        Some(Intersections::with(vec![Intersection::new(
+            t,
+            object_space_ray,
+            Geometry::default().with_form(Form::Billboard(self.clone())),
+        )
+        .with_uv(u, v)]))
+    }
+
+    fn normal_at(&self, _object_space_point: Point) -> Option<Vector> {
+        Some(self.front())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        math::{Matrix, Transformable},
+        world::Color,
+    };
+
+    /// a solid left half, and a see-through right half.
+    fn half() -> Billboard {
+        let sprite = Sprite::from_fn(2, 1, |x, _| {
+            if x == 0 {
+                (Color::new(1.0, 0.0, 0.0), 1.0)
+            } else {
+                (Color::white(), 0.2)
+            }
+        });
+        Billboard::new(sprite, 2.0, 2.0)
+    }
+
+    #[test]
+    fn ray_hits_solid_part() {
+        // seen from -z, the left of the billboard is towards +x.
+        let billboard = half().facing(Point::new(0.0, 0.0, -5.0));
+        let r = Ray::new(Point::new(0.5, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let hit = billboard.hit(r).unwrap().closest().unwrap();
+        assert_eq!(hit.time, 5.0);
+        assert_eq!(hit.uv, Some((0.25, 0.5)));
+    }
+
+    #[test]
+    fn ray_passes_through_cut_out_part() {
+        let billboard = half().facing(Point::new(0.0, 0.0, -5.0));
+        let r = Ray::new(Point::new(-0.5, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert!(billboard.hit(r).is_none());
+        assert!(billboard.with_cutoff(0.1).hit(r).is_some());
+    }
+
+    #[test]
+    fn ray_misses_beyond_edges() {
+        let billboard = half().facing(Point::new(0.0, 0.0, -5.0));
+        let r = Ray::new(Point::new(1.5, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert!(billboard.hit(r).is_none());
+    }
+
+    #[test]
+    fn turns_to_face_point() {
+        let billboard = half().facing(Point::new(5.0, 3.0, 0.0));
+        let r = Ray::new(Point::new(5.0, 0.0, 0.5), Vector::new(-1.0, 0.0, 0.0));
+        let hit = billboard.hit(r).unwrap().closest().unwrap();
+        assert_eq!(hit.uv, Some((0.25, 0.5)));
+        assert_eq!(
+            billboard.normal_at(Point::zero()),
+            Some(Vector::new(1.0, 0.0, 0.0))
+        );
+    }
+
+    #[test]
+    fn geometry_faces_world_space_point() {
+        let billboard = Geometry::default()
+            .with_form(Form::Billboard(half()))
+            .transformed(Matrix::translation(2.0, 0.0, 0.0))
+            .facing(Point::new(7.0, 1.0, 0.0));
+        assert_eq!(
+            billboard.normal_at(Point::new(2.0, 0.0, 0.0)),
+            Some(Vector::new(1.0, 0.0, 0.0))
+        );
+    }
+}
@@ -0,0 +1,107 @@
+use crate::{
+    math::{Form, Geometry, Hittable, Point, Vector, EPSILON},
+    world::{Intersection, Intersections, Ray},
+};
+
+/// a flat, round disk lying in the xz plane and centered at the origin.
+pub struct Disk {
+    pub radius: f64,
+}
+
+impl Disk {
+    pub fn new(radius: f64) -> Disk {
+        Disk { radius }
+    }
+
+    /// maps a point on the disk to its surface coordinates. `u` is the angle around
+    /// the center and `v` is the distance from the center, both scaled to be between
+    /// 0 and 1.
+    pub fn uv_at(&self, object_space_point: Point) -> (f64, f64) {
+        let (x, z) = (object_space_point[0], object_space_point[2]);
+        let theta = x.atan2(z);
+
+        (
+            (theta / (2.0 * std::f64::consts::PI)).rem_euclid(1.0),
+            (x * x + z * z).sqrt() / self.radius,
+        )
+    }
+}
+
+impl Hittable for Disk {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        if object_space_ray.direction[1].abs() < EPSILON {
+            return None;
+        }
+
+        let t = -object_space_ray.origin[1] / object_space_ray.direction[1];
+        let point = object_space_ray.at(t);
+        let (x, z) = (point[0], point[2]);
+
+        if t < 0.0 || self.radius * self.radius < x * x + z * z {
+            None
+        } else {
+            let (u, v) = self.uv_at(point);
+            Some(Intersections::with(vec![Intersection::new(
+                t,
+                object_space_ray,
+                Geometry::default().with_form(Form::Disk {
+                    radius: self.radius,
+                }),
+            )
+            .with_uv(u, v)]))
+        }
+    }
+
+    fn normal_at(&self, _object_space_point: Point) -> Option<Vector> {
+        Some(Vector::new(0.0, 1.0, 0.0))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::{Matrix, Transformable};
+
+    fn disk() -> Geometry {
+        Geometry::default().with_form(Form::Disk { radius: 2.0 })
+    }
+
+    #[test]
+    fn ray_hits_disk() {
+        let r = Ray::new(Point::new(1.0, 1.0, 1.0), Vector::new(0.0, -1.0, 0.0));
+        let mut xs = disk().hit(r).unwrap();
+        assert_eq!(xs.count(), 1);
+        assert_eq!(xs.pop().unwrap().time, 1.0);
+    }
+
+    #[test]
+    fn ray_misses_outside_radius() {
+        let r = Ray::new(Point::new(1.5, 1.0, 1.5), Vector::new(0.0, -1.0, 0.0));
+        assert!(disk().hit(r).is_none());
+    }
+
+    #[test]
+    fn ray_parallel_to_disk() {
+        let r = Ray::new(Point::new(-5.0, 0.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert!(disk().hit(r).is_none());
+    }
+
+    #[test]
+    fn transformed_disk() {
+        let d = disk().transformed(Matrix::rotation_x(std::f64::consts::PI / 2.0));
+        let r = Ray::new(Point::new(0.0, 1.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let mut xs = d.hit(r).unwrap();
+        assert_eq!(xs.pop().unwrap().time, 5.0);
+        let n = d.normal_at(Point::new(0.0, 1.0, 0.0)).unwrap();
+        assert_eq!(n, Vector::new(0.0, 0.0, 1.0));
+    }
+
+    #[test]
+    fn disk_surface_coordinates() {
+        let d = Disk::new(2.0);
+        let (u, v) = d.uv_at(Point::new(1.0, 0.0, 0.0));
+        assert!((u - 0.25).abs() < EPSILON);
+        assert!((v - 0.5).abs() < EPSILON);
+        assert_eq!(d.uv_at(Point::new(0.0, 0.0, 2.0)), (0.0, 1.0));
+    }
+}
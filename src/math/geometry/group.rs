@@ -0,0 +1,353 @@
+use std::sync::Arc;
+
+use crate::{
+    math::{Bounds, Form, Geometry, Hittable, Point, Vector},
+    world::{Intersections, Ray},
+};
+
+/// a collection of objects which are transformed together. each child's transform
+/// places it within the group, and the group's own transform places the whole
+/// collection in the world; groups may be nested. the children keep their own
+/// materials.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Group {
+    children: Arc<[Geometry]>,
+    bounds: Bounds,
+}
+
+impl Group {
+    pub fn new(children: Vec<Geometry>) -> Group {
+        let bounds = children
+            .iter()
+            .map(Geometry::bounds)
+            .fold(Bounds::empty(), Bounds::merged);
+
+        Group {
+            children: children.into(),
+            bounds,
+        }
+    }
+
+    pub fn children(&self) -> &[Geometry] {
+        &self.children
+    }
+
+    /// the box around every child, in the group's object space.
+    pub fn bounds(&self) -> Bounds {
+        self.bounds
+    }
+
+    /// the same objects, rearranged into a hierarchy of smaller groups so that a ray
+    /// only needs to be tested against the children near it. a group with at least
+    /// `threshold` children has its box cut in half, and the children which fit in
+    /// either half are moved into a new group for that half, which is divided in
+    /// turn; the children which cross the middle (or reach infinitely far) stay. the
+    /// children which are groups themselves are also divided.
+    pub fn divided(&self, threshold: usize) -> Group {
+        let mut children: Vec<Geometry> = self
+            .children
+            .iter()
+            .map(|child| match child.form {
+                Form::Group(ref group) => child
+                    .clone()
+                    .with_form(Form::Group(group.divided(threshold))),
+                _ => child.clone(),
+            })
+            .collect();
+
+        let bounds = children
+            .iter()
+            .map(Geometry::bounds)
+            .filter(Bounds::is_finite)
+            .fold(Bounds::empty(), Bounds::merged);
+        if children.len() < threshold.max(1) || bounds.is_empty() {
+            return Group::new(children);
+        }
+
+        let (left, right) = bounds.split();
+        let (in_left, rest): (Vec<Geometry>, Vec<Geometry>) = children
+            .into_iter()
+            .partition(|child| left.contains(&child.bounds()));
+        let (in_right, mut rest): (Vec<Geometry>, Vec<Geometry>) = rest
+            .into_iter()
+            .partition(|child| right.contains(&child.bounds()));
+
+        // the children cannot be divided any further if they all fit in one half,
+        // which happens when their boxes have no size at all.
+        if rest.is_empty() && (in_left.is_empty() || in_right.is_empty()) {
+            children = in_left;
+            children.extend(in_right);
+            return Group::new(children);
+        }
+
+        for mut half in vec![in_left, in_right] {
+            match half.len() {
+                0 => {}
+                1 => rest.push(half.remove(0)),
+                _ => rest.push(
+                    Geometry::default().with_form(Form::Group(Group::new(half).divided(threshold))),
+                ),
+            }
+        }
+
+        Group::new(rest)
+    }
+
+    /// like `hit`, but stops testing the children once they cannot be hit between
+    /// `t_min` and `t_max`; see `Geometry::hit_until`.
+    pub fn hit_until(
+        &self,
+        object_space_ray: Ray,
+        t_min: f64,
+        t_max: &mut f64,
+        stops: &dyn Fn(&Geometry) -> bool,
+    ) -> Option<Intersections> {
+        if !self.bounds.is_hit_between(object_space_ray, t_min, *t_max) {
+            return None;
+        }
+
+        let mut intersections = Intersections::default();
+        for child in self.children.iter() {
+            if let Some(hits) = child.hit_until(object_space_ray, t_min, t_max, stops) {
+                intersections.merge(hits);
+            }
+        }
+
+        if intersections.is_empty() {
+            None
+        } else {
+            Some(intersections)
+        }
+    }
+}
+
+impl Hittable for Group {
+    /// the intersections with each of the children. the objects of the intersections
+    /// are the children as they are placed within the group (see `Geometry::within`).
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        // none of the children can be hit if the box around them is missed.
+        if !self.bounds.is_hit_by(object_space_ray) {
+            return None;
+        }
+
+        let mut intersections = Intersections::default();
+        for child in self.children.iter() {
+            if let Some(hits) = child.hit(object_space_ray) {
+                intersections.merge(hits);
+            }
+        }
+
+        if intersections.is_empty() {
+            None
+        } else {
+            Some(intersections)
+        }
+    }
+
+    /// groups have no surface of their own; the normal is found on the child which
+    /// was hit.
+    fn normal_at(&self, _object_space_point: Point) -> Option<Vector> {
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::{Form, Matrix, Transformable, Visibility};
+    use std::f64::consts;
+
+    fn sphere() -> Geometry {
+        Geometry::default().with_form(Form::Sphere)
+    }
+
+    #[test]
+    fn empty_group() {
+        let group = Group::new(vec![]);
+        assert!(group.children().is_empty());
+        assert!(group.bounds().is_empty());
+        let r = Ray::new(Point::zero(), Vector::new(0.0, 0.0, 1.0));
+        assert!(group.hit(r).is_none());
+    }
+
+    #[test]
+    fn intersecting_children() {
+        let s1 = sphere();
+        let s2 = sphere().transformed(Matrix::translation(0.0, 0.0, -3.0));
+        let s3 = sphere().transformed(Matrix::translation(5.0, 0.0, 0.0));
+        let group = Group::new(vec![s1.clone(), s2.clone(), s3]);
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let objects: Vec<Geometry> = group
+            .hit(r)
+            .unwrap()
+            .iter()
+            .map(|i| i.object.clone())
+            .collect();
+        assert_eq!(objects, [s2.clone(), s2, s1.clone(), s1]);
+    }
+
+    #[test]
+    fn intersecting_transformed_group() {
+        let s = sphere().transformed(Matrix::translation(5.0, 0.0, 0.0));
+        let group = Geometry::default()
+            .with_form(Form::Group(Group::new(vec![s])))
+            .transformed(Matrix::scaling(2.0, 2.0, 2.0));
+        let r = Ray::new(Point::new(10.0, 0.0, -10.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(group.hit(r).unwrap().count(), 2);
+    }
+
+    #[test]
+    fn normal_on_child_in_nested_groups() {
+        let s = sphere().transformed(Matrix::translation(5.0, 0.0, 0.0));
+        let inner = Geometry::default()
+            .with_form(Form::Group(Group::new(vec![s.clone()])))
+            .transformed(Matrix::scaling(1.0, 2.0, 3.0));
+        let outer = Geometry::default()
+            .with_form(Form::Group(Group::new(vec![inner.clone()])))
+            .transformed(Matrix::rotation_y(consts::PI / 2.0));
+
+        // the child, as it is placed in the world.
+        let placed = s.within(&inner).within(&outer);
+        let n = placed
+            .normal_at(Point::new(1.7321, 1.1547, -5.5774))
+            .unwrap();
+        assert_eq!(n, Vector::new(0.2857, 0.4286, -0.8571));
+
+        let r = Ray::new(Point::new(0.0, 0.0, -20.0), Vector::new(0.0, 0.0, 1.0));
+        let hit = outer.hit(r).unwrap().closest().unwrap();
+        assert!((hit.time - 14.0).abs() < 1e-9);
+        assert_eq!(hit.object, placed);
+    }
+
+    #[test]
+    fn children_are_as_visible_as_group() {
+        let hidden = Visibility {
+            camera: false,
+            ..Visibility::default()
+        };
+        let group = Geometry::default()
+            .with_form(Form::Group(Group::new(vec![sphere()])))
+            .with_visibility(hidden);
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let hit = group.hit(r).unwrap().closest().unwrap();
+        assert_eq!(hit.object.visibility, hidden);
+
+        // a shadow ray stops at the child only if the group casts shadows too.
+        let unshadowed = group.clone().with_visibility(Visibility {
+            shadows: false,
+            ..Visibility::default()
+        });
+        let mut t_max = f64::INFINITY;
+        unshadowed.hit_until(r, 0.0, &mut t_max, &|object: &Geometry| {
+            object.visibility.shadows
+        });
+        assert_eq!(t_max, f64::INFINITY);
+        group.hit_until(r, 0.0, &mut t_max, &|object: &Geometry| {
+            object.visibility.shadows
+        });
+        assert_eq!(t_max, 4.0);
+    }
+
+    #[test]
+    fn missing_bounds_skips_children() {
+        let group = Group::new(vec![
+            sphere().transformed(Matrix::translation(5.0, 0.0, 0.0))
+        ]);
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert!(group.hit(r).is_none());
+    }
+
+    #[test]
+    fn dividing_group() {
+        let s1 = sphere().transformed(Matrix::translation(-2.0, 0.0, 0.0));
+        let s2 = sphere().transformed(Matrix::translation(2.0, 0.0, 0.0));
+        let s3 = sphere().transformed(Matrix::scaling(4.0, 4.0, 4.0));
+        let group = Group::new(vec![s1.clone(), s2.clone(), s3.clone()]).divided(1);
+        assert_eq!(group.children().len(), 3);
+        assert_eq!(group.children()[0], s3);
+        assert_eq!(group.children()[1..], [s1.clone(), s2.clone()]);
+
+        let s4 = sphere().transformed(Matrix::translation(-2.0, 0.0, 0.0));
+        let group = Group::new(vec![s1.clone(), s2.clone(), s4.clone()]).divided(2);
+        assert_eq!(group.children()[1], s2);
+        match group.children()[0].form {
+            Form::Group(ref subgroup) => assert_eq!(subgroup.children(), [s1, s4]),
+            _ => panic!("expected a subgroup"),
+        }
+    }
+
+    #[test]
+    fn dividing_keeps_what_is_hit() {
+        let spheres: Vec<Geometry> = (0..16)
+            .map(|i| {
+                sphere().transformed(
+                    Matrix::translation((i % 4) as f64 * 3.0, (i / 4) as f64 * 3.0, 0.0)
+                        * Matrix::scaling(0.5, 0.5, 0.5),
+                )
+            })
+            .collect();
+        let flat = Group::new(spheres);
+        let divided = flat.divided(2);
+        assert_ne!(divided.children().len(), 16);
+
+        for i in 0..16 {
+            let origin = Point::new((i % 4) as f64 * 3.0 + 0.25, (i / 4) as f64 * 3.0, -5.0);
+            let r = Ray::new(origin, Vector::new(0.0, 0.0, 1.0));
+            let times = |group: &Group| -> Vec<f64> {
+                group.hit(r).unwrap().iter().map(|i| i.time).collect()
+            };
+            assert_eq!(times(&flat), times(&divided));
+        }
+    }
+
+    #[test]
+    fn hitting_until_skips_children_beyond() {
+        let spheres: Vec<Geometry> = (0..8)
+            .map(|i| {
+                sphere().transformed(
+                    Matrix::translation(i as f64 * 3.0, 0.0, 0.0) * Matrix::scaling(0.5, 0.5, 0.5),
+                )
+            })
+            .collect();
+        let divided = Group::new(spheres).divided(2);
+        let r = Ray::new(Point::new(-5.0, 0.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert_eq!(divided.hit(r).unwrap().count(), 16);
+
+        let mut t_max = f64::INFINITY;
+        let xs = divided
+            .hit_until(r, 0.0, &mut t_max, &|_: &Geometry| true)
+            .unwrap();
+        // only the first subgroup is tested, since the others start beyond the stop.
+        assert_eq!(t_max, 4.5);
+        assert_eq!(xs.closest().unwrap().time, 4.5);
+        assert_eq!(xs.count(), 4);
+
+        // nothing is hit before the ray starts.
+        let mut t_max = f64::INFINITY;
+        let xs = divided
+            .hit_until(r, 6.0, &mut t_max, &|_: &Geometry| true)
+            .unwrap();
+        assert_eq!(t_max, 7.5);
+        assert_eq!(xs.hit_after(6.0).unwrap().time, 7.5);
+        assert_eq!(xs.count(), 4);
+    }
+
+    #[test]
+    fn dividing_leaves_infinite_children() {
+        let plane = Geometry::default().with_form(Form::Plane);
+        let group = Group::new(vec![plane.clone(), sphere(), sphere()]).divided(1);
+        assert_eq!(group.children(), [plane, sphere(), sphere()]);
+    }
+
+    #[test]
+    fn bounds_cover_children() {
+        let group = Group::new(vec![
+            sphere().transformed(Matrix::translation(2.0, 0.0, 0.0)),
+            sphere().transformed(Matrix::scaling(1.0, 3.0, 1.0)),
+        ]);
+        assert_eq!(
+            group.bounds(),
+            Bounds::new(Point::new(-1.0, -3.0, -1.0), Point::new(3.0, 3.0, 1.0))
+        );
+    }
+}
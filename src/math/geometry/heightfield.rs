@@ -0,0 +1,291 @@
+use std::sync::Arc;
+
+use crate::{
+    math::{geometry::march, Bounds, Form, Geometry, Hittable, Point, Vector, EPSILON},
+    world::{Canvas, Intersection, Intersections, Ray},
+};
+
+/// a terrain covering the square from 0 to 1 along the x and z axes, whose height is
+/// sampled on a grid of `columns` by `rows` points. between the samples, each cell of
+/// the grid is split into two flat triangles.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Heightfield {
+    pub columns: usize,
+    pub rows: usize,
+    heights: Arc<[f64]>,
+    /// the lowest and highest samples.
+    low: f64,
+    high: f64,
+}
+
+impl Heightfield {
+    /// `heights` are listed row by row, with `x` increasing along each row and `z`
+    /// increasing from row to row. panics if there are fewer than 2 columns or rows,
+    /// or if the number of heights does not match.
+    pub fn new(columns: usize, rows: usize, heights: Vec<f64>) -> Heightfield {
+        assert!(
+            2 <= columns && 2 <= rows,
+            "a heightfield needs at least 2 by 2 samples, got {} by {}",
+            columns,
+            rows
+        );
+        assert_eq!(
+            heights.len(),
+            columns * rows,
+            "a {} by {} heightfield needs {} heights",
+            columns,
+            rows,
+            columns * rows
+        );
+
+        let (low, high) = heights
+            .iter()
+            .fold((f64::INFINITY, f64::NEG_INFINITY), |(low, high), &h| {
+                (low.min(h), high.max(h))
+            });
+
+        Heightfield {
+            columns,
+            rows,
+            heights: heights.into(),
+            low,
+            high,
+        }
+    }
+
+    /// samples the height `f(x, z)` at each point of the grid, such as from a noise
+    /// function.
+    pub fn from_fn<F: Fn(f64, f64) -> f64>(columns: usize, rows: usize, f: F) -> Heightfield {
+        let heights = (0..(columns * rows))
+            .map(|i| {
+                let x = (i % columns) as f64 / (columns - 1).max(1) as f64;
+                let z = (i / columns) as f64 / (rows - 1).max(1) as f64;
+                f(x, z)
+            })
+            .collect();
+
+        Heightfield::new(columns, rows, heights)
+    }
+
+    /// uses the brightness of each pixel of a grayscale image as a height, with black
+    /// at 0 and white at 1. the top row of the image is at `z = 0`.
+    pub fn from_canvas(canvas: &Canvas) -> Heightfield {
+        Heightfield::from_fn(canvas.width, canvas.height, |x, z| {
+            let pixel = canvas[(
+                (x * (canvas.width - 1) as f64).round() as usize,
+                (z * (canvas.height - 1) as f64).round() as usize,
+            )];
+            (pixel.red() + pixel.green() + pixel.blue()) / 3.0
+        })
+    }
+
+    /// the height of the sample in the given column and row.
+    pub fn height(&self, column: usize, row: usize) -> f64 {
+        self.heights[row * self.columns + column]
+    }
+
+    /// the box from the lowest sample to the highest, over the unit square.
+    pub fn bounds(&self) -> Bounds {
+        Bounds::new(
+            Point::new(0.0, self.low, 0.0),
+            Point::new(1.0, self.high, 1.0),
+        )
+    }
+
+    /// the point on the surface above the sample in the given column and row.
+    fn vertex(&self, column: usize, row: usize) -> Point {
+        Point::new(
+            column as f64 / (self.columns - 1) as f64,
+            self.height(column, row),
+            row as f64 / (self.rows - 1) as f64,
+        )
+    }
+
+    /// the two triangles which make up the cell with the given column and row as its
+    /// lower corner. the first covers the half of the cell where `x` is further along
+    /// than `z`.
+    fn triangles(&self, column: usize, row: usize) -> [[Point; 3]; 2] {
+        let p00 = self.vertex(column, row);
+        let p10 = self.vertex(column + 1, row);
+        let p01 = self.vertex(column, row + 1);
+        let p11 = self.vertex(column + 1, row + 1);
+
+        [[p00, p10, p11], [p00, p11, p01]]
+    }
+
+    /// the column and row of the cell which contains `point`, when seen from above.
+    fn cell_at(&self, point: Point) -> (usize, usize) {
+        let clamp = |value: f64, cells: usize| (value.max(0.0) as usize).min(cells - 1);
+        (
+            clamp(point[0] * (self.columns - 1) as f64, self.columns - 1),
+            clamp(point[2] * (self.rows - 1) as f64, self.rows - 1),
+        )
+    }
+}
+
+/// intersects a ray with a triangle, using the möller-trumbore algorithm.
+fn hit_triangle(ray: Ray, [a, b, c]: [Point; 3]) -> Option<f64> {
+    let e1 = b - a;
+    let e2 = c - a;
+    let p = ray.direction.cross(&e2);
+    let determinant = e1.dot(&p);
+    if determinant.abs() < EPSILON * EPSILON {
+        return None;
+    }
+
+    let f = 1.0 / determinant;
+    let s = ray.origin - a;
+    let u = f * s.dot(&p);
+    if !(0.0..=1.0).contains(&u) {
+        return None;
+    }
+    let q = s.cross(&e1);
+    let v = f * ray.direction.dot(&q);
+    if v < 0.0 || 1.0 < u + v {
+        return None;
+    }
+
+    Some(f * e2.dot(&q))
+}
+
+impl Hittable for Heightfield {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        let (start, end) = march::slab(
+            object_space_ray,
+            Point::new(0.0, self.low - EPSILON, 0.0),
+            Point::new(1.0, self.high + EPSILON, 1.0),
+        )?;
+        if end < 0.0 {
+            return None;
+        }
+
+        // walk through the cells under the ray in order (a 2d dda), so that only the
+        // cells it passes over are tested, and the first hit found is the closest.
+        let cells = [self.columns - 1, self.rows - 1];
+        let size = [1.0 / cells[0] as f64, 1.0 / cells[1] as f64];
+        let mut t = start.max(0.0);
+        let (column, row) = self.cell_at(object_space_ray.at(t));
+        let mut cell = [column as i64, row as i64];
+
+        let mut step = [0; 2];
+        let mut t_next = [f64::INFINITY; 2];
+        let mut t_delta = [f64::INFINITY; 2];
+        for (i, &axis) in [0, 2].iter().enumerate() {
+            let direction = object_space_ray.direction[axis];
+            if direction.abs() < EPSILON * EPSILON {
+                continue;
+            }
+            step[i] = direction.signum() as i64;
+            let boundary = (cell[i] + (step[i] + 1) / 2) as f64 * size[i];
+            t_next[i] = (boundary - object_space_ray.origin[axis]) / direction;
+            t_delta[i] = size[i] / direction.abs();
+        }
+
+        while t <= end {
+            let exit = t_next[0].min(t_next[1]).min(end);
+            let triangles = self.triangles(cell[0] as usize, cell[1] as usize);
+            let closest = triangles
+                .iter()
+                .filter_map(|&triangle| hit_triangle(object_space_ray, triangle))
+                .filter(|&time| t - EPSILON <= time && time <= exit + EPSILON && 0.0 < time)
+                .fold(None, |closest: Option<f64>, time| {
+                    Some(closest.map_or(time, |c| c.min(time)))
+                });
+
+            if let Some(time) = closest {
+                let point = object_space_ray.at(time);
+                return Some(Intersections::with(vec![Intersection::new(
+                    time,
+                    object_space_ray,
+                    Geometry::default().with_form(Form::Heightfield(self.clone())),
+                )
+                .with_uv(point[0], point[2])]));
+            }
+
+            let axis = if t_next[0] < t_next[1] { 0 } else { 1 };
+            cell[axis] += step[axis];
+            if cell[axis] < 0 || cells[axis] as i64 <= cell[axis] {
+                return None;
+            }
+            t = t_next[axis];
+            t_next[axis] += t_delta[axis];
+        }
+
+        None
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        let (column, row) = self.cell_at(object_space_point);
+        let x = object_space_point[0] * (self.columns - 1) as f64 - column as f64;
+        let z = object_space_point[2] * (self.rows - 1) as f64 - row as f64;
+        let [a, b, c] = self.triangles(column, row)[if z <= x { 0 } else { 1 }];
+
+        Some((c - a).cross(&(b - a)).normalized())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::world::Color;
+
+    fn ramp() -> Geometry {
+        // rises from a height of 0 at x = 0 to a height of 1 at x = 1.
+        Geometry::default().with_form(Form::Heightfield(Heightfield::from_fn(5, 3, |x, _| x)))
+    }
+
+    #[test]
+    fn sample_function_on_grid() {
+        let h = Heightfield::from_fn(3, 2, |x, z| x + 10.0 * z);
+        assert_eq!(h.height(0, 0), 0.0);
+        assert_eq!(h.height(1, 0), 0.5);
+        assert_eq!(h.height(2, 1), 11.0);
+    }
+
+    #[test]
+    fn sample_canvas_brightness() {
+        let canvas = Canvas::from_fn(2, 2, |x, y| {
+            if (x, y) == (1, 0) {
+                Color::white()
+            } else {
+                Color::new(0.0, 0.3, 0.6)
+            }
+        });
+        let h = Heightfield::from_canvas(&canvas);
+        assert_eq!(h.height(1, 0), 1.0);
+        assert!((h.height(0, 1) - 0.3).abs() < EPSILON);
+    }
+
+    #[test]
+    fn ray_from_above_hits_ramp() {
+        let r = Ray::new(Point::new(0.3, 5.0, 0.6), Vector::new(0.0, -1.0, 0.0));
+        let mut xs = ramp().hit(r).unwrap();
+        assert_eq!(xs.count(), 1);
+        let hit = xs.pop().unwrap();
+        assert!((hit.time - 4.7).abs() < EPSILON);
+        assert_eq!(hit.uv, Some((0.3, 0.6)));
+    }
+
+    #[test]
+    fn ray_across_ramp_walks_cells() {
+        // travels along x from the high end, and hits once it is low enough.
+        let r = Ray::new(Point::new(2.0, 0.5, 0.5), Vector::new(-1.0, 0.0, 0.0));
+        let hit = ramp().hit(r).unwrap().closest().unwrap();
+        assert!((hit.time - 1.5).abs() < EPSILON);
+    }
+
+    #[test]
+    fn ray_misses_outside_grid() {
+        let beside = Ray::new(Point::new(1.5, 5.0, 0.5), Vector::new(0.0, -1.0, 0.0));
+        let above = Ray::new(Point::new(-1.0, 2.0, 0.5), Vector::new(1.0, 0.0, 0.0));
+        assert!(ramp().hit(beside).is_none());
+        assert!(ramp().hit(above).is_none());
+    }
+
+    #[test]
+    fn normal_of_ramp() {
+        let n = ramp().normal_at(Point::new(0.4, 0.4, 0.7)).unwrap();
+        let half = f64::from(2.0).sqrt() / 2.0;
+        assert_eq!(n, Vector::new(-half, half, 0.0));
+    }
+}
@@ -0,0 +1,137 @@
+use crate::{
+    math::{Bounds, Point, Vector},
+    world::Ray,
+};
+
+/// the most steps that are taken along a ray before giving up on finding a surface.
+const MAX_STEPS: usize = 256;
+
+/// how close to a surface (as measured by its distance function) a point must be to
+/// count as being on it.
+const SURFACE_DISTANCE: f64 = 1e-6;
+
+/// intersects a ray with the axis-aligned box between `min` and `max`, returning
+/// the times at which the ray enters and leaves it; see `Bounds::hit`.
+pub fn slab(ray: Ray, min: Point, max: Point) -> Option<(f64, f64)> {
+    Bounds::new(min, max).hit(ray)
+}
+
+/// sphere traces along `ray` from time `start` to time `end`, returning the first time
+/// at which the surface described by the signed distance function `sdf` is reached.
+/// the ray must start outside of the surface.
+pub fn march<F: Fn(Point) -> f64>(sdf: F, ray: Ray, start: f64, end: f64) -> Option<f64> {
+    march_with(sdf, ray, start, end, SURFACE_DISTANCE, MAX_STEPS)
+}
+
+/// like `march`, but a point counts as being on the surface once it is within
+/// `epsilon` of it, and the search gives up after `max_steps`.
+pub fn march_with<F: Fn(Point) -> f64>(
+    sdf: F,
+    ray: Ray,
+    start: f64,
+    end: f64,
+    epsilon: f64,
+    max_steps: usize,
+) -> Option<f64> {
+    let speed = ray.direction.magnitude();
+    let mut t = start;
+
+    for _ in 0..max_steps {
+        if end < t {
+            return None;
+        }
+        let distance = sdf(ray.at(t));
+        if distance < epsilon {
+            return Some(t);
+        }
+        // nothing is closer than `distance`, so it is safe to move that far.
+        t += distance / speed;
+    }
+
+    None
+}
+
+/// finds the times at which `ray` enters and leaves the convex surface described by
+/// `sdf`, which lies entirely within the times `start` and `end`. marches forwards
+/// to find the entrance, and backwards from `end` to find the exit.
+pub fn march_convex<F: Fn(Point) -> f64>(
+    sdf: F,
+    ray: Ray,
+    start: f64,
+    end: f64,
+) -> Option<(f64, f64)> {
+    let entrance = march(&sdf, ray, start, end)?;
+    let backwards = Ray::new(ray.at(end), -ray.direction);
+    let exit = end - march(&sdf, backwards, 0.0, end - entrance)?;
+    Some((entrance, exit))
+}
+
+/// estimates the direction in which `sdf` increases the fastest at `point`, which is
+/// the (unnormalized) normal of the surface there.
+pub fn gradient<F: Fn(Point) -> f64>(sdf: F, point: Point) -> Vector {
+    let h = 1e-5;
+    let dx = Vector::new(h, 0.0, 0.0);
+    let dy = Vector::new(0.0, h, 0.0);
+    let dz = Vector::new(0.0, 0.0, h);
+
+    Vector::new(
+        sdf(point + dx) - sdf(point - dx),
+        sdf(point + dy) - sdf(point - dy),
+        sdf(point + dz) - sdf(point - dz),
+    )
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::EPSILON;
+
+    fn unit_sphere(p: Point) -> f64 {
+        (p - Point::zero()).magnitude() - 1.0
+    }
+
+    #[test]
+    fn ray_through_box() {
+        let r = Ray::new(Point::new(-5.0, 0.5, 0.0), Vector::new(1.0, 0.0, 0.0));
+        let (t0, t1) = slab(r, Point::new(-1.0, -1.0, -1.0), Point::new(1.0, 1.0, 1.0)).unwrap();
+        assert_eq!((t0, t1), (4.0, 6.0));
+    }
+
+    #[test]
+    fn ray_misses_box() {
+        let r = Ray::new(Point::new(-5.0, 2.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert!(slab(r, Point::new(-1.0, -1.0, -1.0), Point::new(1.0, 1.0, 1.0)).is_none());
+    }
+
+    #[test]
+    fn march_to_sphere() {
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 2.0));
+        let t = march(unit_sphere, r, 0.0, 10.0).unwrap();
+        assert!((t - 2.0).abs() < EPSILON);
+        assert!(march(unit_sphere, r, 0.0, 1.0).is_none());
+    }
+
+    #[test]
+    fn march_gives_up_after_max_steps() {
+        // each step only covers the distance to the nearest surface, so a ray grazing
+        // the sphere takes many steps.
+        let r = Ray::new(Point::new(-5.0, 1.001, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert!(march_with(unit_sphere, r, 0.0, 10.0, 1e-6, 256).is_none());
+        assert!(march_with(unit_sphere, r, 0.0, 10.0, 0.01, 256).is_some());
+        assert!(march_with(unit_sphere, r, 0.0, 10.0, 0.01, 2).is_none());
+    }
+
+    #[test]
+    fn march_through_sphere() {
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let (t0, t1) = march_convex(unit_sphere, r, 3.0, 7.0).unwrap();
+        assert!((t0 - 4.0).abs() < EPSILON);
+        assert!((t1 - 6.0).abs() < EPSILON);
+    }
+
+    #[test]
+    fn gradient_of_sphere() {
+        let n = gradient(unit_sphere, Point::new(0.0, 1.0, 0.0)).normalized();
+        assert_eq!(n, Vector::new(0.0, 1.0, 0.0));
+    }
+}
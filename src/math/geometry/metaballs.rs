@@ -0,0 +1,173 @@
+use std::sync::Arc;
+
+use crate::{
+    math::{
+        geometry::march::{self, gradient, march},
+        Bounds, Form, Geometry, Hittable, Point, Vector,
+    },
+    world::{Intersection, Intersections, Ray},
+};
+
+/// the steepest slope of the falloff of a ball with a blend radius of 1, `(1 - x²)²`,
+/// which is reached at `x = 1 / sqrt(3)`.
+const STEEPEST_FALLOFF: f64 = 1.5396;
+
+/// spheres which melt into each other as they get close. each ball has a field which
+/// is 1 at its center and falls off smoothly to 0 at its blend radius, and the surface
+/// is wherever the sum of the fields reaches the threshold. alone, a ball of blend
+/// radius `r` is a sphere of radius `r * sqrt(1 - sqrt(threshold))`.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Metaballs {
+    /// the center and blend radius of each ball.
+    balls: Arc<[(Point, f64)]>,
+    /// the strength of the field at the surface, between 0 and 1. lower thresholds
+    /// give bigger balls which blend together from further apart.
+    pub threshold: f64,
+}
+
+impl Metaballs {
+    pub fn new(balls: Vec<(Point, f64)>, threshold: f64) -> Metaballs {
+        Metaballs {
+            balls: balls.into(),
+            threshold,
+        }
+    }
+
+    /// the center and blend radius of each ball.
+    pub fn balls(&self) -> &[(Point, f64)] {
+        &self.balls
+    }
+
+    /// the box around every ball's blend radius, outside of which there is no field.
+    pub fn bounds(&self) -> Bounds {
+        self.balls
+            .iter()
+            .fold(Bounds::empty(), |bounds, &(center, radius)| {
+                bounds.merged(Bounds::around(center, radius))
+            })
+    }
+
+    /// the strength of the combined field of the balls at `point`.
+    pub fn field(&self, point: Point) -> f64 {
+        self.balls
+            .iter()
+            .map(|&(center, radius)| {
+                let x = (point - center).magnitude() / radius;
+                if x < 1.0 {
+                    (1.0 - x * x).powi(2)
+                } else {
+                    0.0
+                }
+            })
+            .sum()
+    }
+
+    /// a lower bound on the distance from `point` to the surface, which is negative
+    /// inside of it.
+    pub fn distance(&self, point: Point) -> f64 {
+        let steepest: f64 = self
+            .balls
+            .iter()
+            .map(|&(_, radius)| STEEPEST_FALLOFF / radius)
+            .sum();
+        let estimate = (self.threshold - self.field(point)) / steepest;
+
+        // the field changes slowly, so far from every ball it is quicker to skip
+        // straight to the nearest one.
+        let nearest = self
+            .balls
+            .iter()
+            .map(|&(center, radius)| (point - center).magnitude() - radius)
+            .fold(f64::INFINITY, f64::min);
+
+        if estimate < 0.0 {
+            estimate
+        } else {
+            estimate.max(nearest)
+        }
+    }
+}
+
+impl Hittable for Metaballs {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        let bounds = self.bounds();
+        let (start, end) = march::slab(object_space_ray, bounds.min, bounds.max)?;
+        let start = start.max(0.0);
+
+        // a ray starting inside of the surface marches towards the way out instead.
+        let time = if self.distance(object_space_ray.at(start)) < 0.0 {
+            march(|p| -self.distance(p), object_space_ray, start, end)
+        } else {
+            march(|p| self.distance(p), object_space_ray, start, end)
+        }?;
+
+        let hits = Intersections::with(vec![Intersection::new(
+            time,
+            object_space_ray,
+            Geometry::default().with_form(Form::Metaballs(self.clone())),
+        )]);
+
+        if hits.count() == 0 {
+            None
+        } else {
+            Some(hits)
+        }
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        // the field is strongest inside, so the surface faces the way it weakens.
+        Some(-gradient(|p| self.field(p), object_space_point).normalized())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::EPSILON;
+
+    fn pair(separation: f64) -> Geometry {
+        Geometry::default().with_form(Form::Metaballs(Metaballs::new(
+            vec![
+                (Point::new(-separation / 2.0, 0.0, 0.0), 1.0),
+                (Point::new(separation / 2.0, 0.0, 0.0), 1.0),
+            ],
+            0.25,
+        )))
+    }
+
+    #[test]
+    fn lone_ball_is_sphere() {
+        let ball = Geometry::default().with_form(Form::Metaballs(Metaballs::new(
+            vec![(Point::zero(), 2.0)],
+            0.25,
+        )));
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let hit = ball.hit(r).unwrap().closest().unwrap();
+        let radius = 2.0 * (1.0 - f64::from(0.25).sqrt()).sqrt();
+        assert!((hit.time - (5.0 - radius)).abs() < EPSILON);
+    }
+
+    #[test]
+    fn close_balls_blend_together() {
+        // halfway between the balls, neither is strong enough alone to reach the
+        // threshold, but together they are.
+        let r = Ray::new(Point::new(0.0, -5.0, 0.0), Vector::new(0.0, 1.0, 0.0));
+        assert!(pair(1.6).hit(r).is_some());
+        assert!(pair(2.4).hit(r).is_none());
+    }
+
+    #[test]
+    fn ray_from_inside() {
+        let r = Ray::new(Point::new(0.8, 0.0, 0.0), Vector::new(0.0, 1.0, 0.0));
+        let hit = pair(1.6).hit(r).unwrap().closest().unwrap();
+        assert!(0.0 < hit.time && hit.time < 1.0);
+    }
+
+    #[test]
+    fn normal_faces_away_from_center() {
+        let r = Ray::new(Point::new(5.0, 0.0, 0.0), Vector::new(-1.0, 0.0, 0.0));
+        let hit = pair(1.6).hit(r).unwrap().closest().unwrap();
+        let n = pair(1.6).normal_at(r.at(hit.time)).unwrap();
+        assert_eq!(n, Vector::new(1.0, 0.0, 0.0));
+    }
+}
@@ -9,10 +9,19 @@ impl Plane {
     pub fn new() -> Plane {
         Plane {}
     }
+
+    /// maps a point on the plane to its surface coordinates. the plane is infinite,
+    /// so the coordinates repeat every unit along the x and z axes.
+    pub fn uv_at(&self, object_space_point: Point) -> (f64, f64) {
+        (
+            object_space_point[0].rem_euclid(1.0),
+            object_space_point[2].rem_euclid(1.0),
+        )
+    }
 }
 
 impl Hittable for Plane {
-    fn hit(self, object_space_ray: Ray) -> Option<Intersections> {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
         if object_space_ray.direction[1].abs() < EPSILON {
             None
         } else {
@@ -20,16 +29,18 @@ impl Hittable for Plane {
             if t < 0.0 {
                 None
             } else {
+                let (u, v) = self.uv_at(object_space_ray.at(t));
                 Some(Intersections::with(vec![Intersection::new(
                     t,
                     object_space_ray,
                     Geometry::default().with_form(Form::Plane),
-                )]))
+                )
+                .with_uv(u, v)]))
             }
         }
     }
 
-    fn normal_at(self, _object_space_point: Point) -> Option<Vector> {
+    fn normal_at(&self, _object_space_point: Point) -> Option<Vector> {
         Some(Vector::new(0.0, 1.0, 0.0))
     }
 }
@@ -38,6 +49,14 @@ impl Hittable for Plane {
 mod tests {
     use super::*;
 
+    #[test]
+    fn planar_surface_coordinates() {
+        let plane = Plane::new();
+        assert_eq!(plane.uv_at(Point::new(0.25, 0.0, 0.5)), (0.25, 0.5));
+        assert_eq!(plane.uv_at(Point::new(1.25, 0.0, 0.5)), (0.25, 0.5));
+        assert_eq!(plane.uv_at(Point::new(-0.25, 0.0, -1.5)), (0.75, 0.5));
+    }
+
     #[test]
     fn normal_is_constant() {
         let p = Geometry::default().with_form(Form::Plane);
@@ -71,7 +90,7 @@ mod tests {
         let r = Ray::new(Point::new(0.0, 1.0, 0.0), Vector::new(0.0, -1.0, 0.0));
         let mut xs = p.hit(r).unwrap();
         assert_eq!(xs.count(), 1);
-        assert_eq!(xs.pop().unwrap(), Intersection::new(1.0, r, p));
+        assert_eq!(*xs.pop().unwrap(), Intersection::new(1.0, r, p));
     }
 
     #[test]
@@ -80,6 +99,6 @@ mod tests {
         let r = Ray::new(Point::new(0.0, -1.0, 0.0), Vector::new(0.0, 1.0, 0.0));
         let mut xs = p.hit(r).unwrap();
         assert_eq!(xs.count(), 1);
-        assert_eq!(xs.pop().unwrap(), Intersection::new(1.0, r, p));
+        assert_eq!(*xs.pop().unwrap(), Intersection::new(1.0, r, p));
     }
 }
@@ -0,0 +1,92 @@
+use crate::{
+    math::{Form, Geometry, Hittable, Point, Vector, EPSILON},
+    world::{Intersection, Intersections, Ray},
+};
+
+/// a flat rectangle lying in the xz plane and centered at the origin, which is
+/// `width` long along the x axis and `depth` long along the z axis.
+pub struct Quad {
+    pub width: f64,
+    pub depth: f64,
+}
+
+impl Quad {
+    pub fn new(width: f64, depth: f64) -> Quad {
+        Quad { width, depth }
+    }
+
+    /// maps a point on the rectangle to its surface coordinates, which go from 0
+    /// to 1 along the width and the depth.
+    pub fn uv_at(&self, object_space_point: Point) -> (f64, f64) {
+        (
+            (object_space_point[0] / self.width) + 0.5,
+            (object_space_point[2] / self.depth) + 0.5,
+        )
+    }
+}
+
+impl Hittable for Quad {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        if object_space_ray.direction[1].abs() < EPSILON {
+            return None;
+        }
+
+        let t = -object_space_ray.origin[1] / object_space_ray.direction[1];
+        let point = object_space_ray.at(t);
+
+        if t < 0.0 || (self.width / 2.0) < point[0].abs() || (self.depth / 2.0) < point[2].abs() {
+            None
+        } else {
+            let (u, v) = self.uv_at(point);
+            Some(Intersections::with(vec![Intersection::new(
+                t,
+                object_space_ray,
+                Geometry::default().with_form(Form::Quad {
+                    width: self.width,
+                    depth: self.depth,
+                }),
+            )
+            .with_uv(u, v)]))
+        }
+    }
+
+    fn normal_at(&self, _object_space_point: Point) -> Option<Vector> {
+        Some(Vector::new(0.0, 1.0, 0.0))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn quad() -> Geometry {
+        Geometry::default().with_form(Form::Quad {
+            width: 4.0,
+            depth: 2.0,
+        })
+    }
+
+    #[test]
+    fn ray_hits_quad() {
+        let r = Ray::new(Point::new(1.5, -2.0, 0.5), Vector::new(0.0, 1.0, 0.0));
+        let mut xs = quad().hit(r).unwrap();
+        assert_eq!(xs.count(), 1);
+        let hit = xs.pop().unwrap();
+        assert_eq!(hit.time, 2.0);
+        assert_eq!(hit.uv, Some((0.875, 0.75)));
+    }
+
+    #[test]
+    fn ray_misses_beyond_edges() {
+        let beyond_width = Ray::new(Point::new(2.5, 1.0, 0.0), Vector::new(0.0, -1.0, 0.0));
+        let beyond_depth = Ray::new(Point::new(0.0, 1.0, 1.5), Vector::new(0.0, -1.0, 0.0));
+        assert!(quad().hit(beyond_width).is_none());
+        assert!(quad().hit(beyond_depth).is_none());
+    }
+
+    #[test]
+    fn normal_is_constant() {
+        let n = quad().normal_at(Point::new(1.0, 0.0, -0.5)).unwrap();
+        assert_eq!(n, Vector::new(0.0, 1.0, 0.0));
+    }
+}
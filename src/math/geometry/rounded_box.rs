@@ -0,0 +1,128 @@
+use crate::{
+    math::{
+        geometry::march::{self, gradient, march_convex},
+        Form, Geometry, Hittable, Point, Vector,
+    },
+    world::{Intersection, Intersections, Ray},
+};
+
+/// a cube from -1 to 1 along each axis, with its edges and corners rounded off to
+/// the given radius. a radius of 0 is a sharp cube, and a radius of 1 is a sphere.
+pub struct RoundedBox {
+    pub radius: f64,
+}
+
+impl RoundedBox {
+    pub fn new(radius: f64) -> RoundedBox {
+        RoundedBox {
+            radius: radius.max(0.0).min(1.0),
+        }
+    }
+
+    /// the signed distance from `point` to the surface, which is negative inside.
+    pub fn distance(&self, point: Point) -> f64 {
+        // the distance to a box shrunk by the radius, less the radius.
+        let inner = 1.0 - self.radius;
+        let q = Vector::new(
+            point[0].abs() - inner,
+            point[1].abs() - inner,
+            point[2].abs() - inner,
+        );
+        let outside = Vector::new(q[0].max(0.0), q[1].max(0.0), q[2].max(0.0));
+        let inside = q[0].max(q[1]).max(q[2]).min(0.0);
+
+        outside.magnitude() + inside - self.radius
+    }
+}
+
+impl Hittable for RoundedBox {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        let (start, end) = march::slab(
+            object_space_ray,
+            Point::new(-1.0, -1.0, -1.0),
+            Point::new(1.0, 1.0, 1.0),
+        )?;
+        let (entrance, exit) = march_convex(|p| self.distance(p), object_space_ray, start, end)?;
+
+        let object = Geometry::default().with_form(Form::RoundedBox {
+            radius: self.radius,
+        });
+        let hits = Intersections::with(vec![
+            Intersection::new(entrance, object_space_ray, object.clone()),
+            Intersection::new(exit, object_space_ray, object),
+        ]);
+
+        if hits.count() == 0 {
+            None
+        } else {
+            Some(hits)
+        }
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        Some(gradient(|p| self.distance(p), object_space_point).normalized())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::EPSILON;
+
+    fn rounded_box() -> Geometry {
+        Geometry::default().with_form(Form::RoundedBox { radius: 0.25 })
+    }
+
+    #[test]
+    fn ray_hits_face() {
+        let r = Ray::new(Point::new(0.0, 0.5, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let mut xs = rounded_box().hit(r).unwrap();
+        assert_eq!(xs.count(), 2);
+        assert!((xs.pop().unwrap().time - 4.0).abs() < EPSILON);
+        assert!((xs.pop().unwrap().time - 6.0).abs() < EPSILON);
+    }
+
+    #[test]
+    fn ray_misses_rounded_corner() {
+        // this ray would clip the corner of a sharp cube.
+        let r = Ray::new(Point::new(0.95, 0.95, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert!(rounded_box().hit(r).is_none());
+        let sharp = Geometry::default().with_form(Form::RoundedBox { radius: 0.0 });
+        assert!(sharp.hit(r).is_some());
+    }
+
+    #[test]
+    fn ray_from_inside() {
+        let r = Ray::new(Point::zero(), Vector::new(1.0, 0.0, 0.0));
+        let mut xs = rounded_box().hit(r).unwrap();
+        assert_eq!(xs.count(), 1);
+        assert!((xs.pop().unwrap().time - 1.0).abs() < EPSILON);
+    }
+
+    #[test]
+    fn normals() {
+        let b = rounded_box();
+        assert_eq!(
+            b.normal_at(Point::new(1.0, 0.2, -0.3)).unwrap(),
+            Vector::new(1.0, 0.0, 0.0)
+        );
+        assert_eq!(
+            b.normal_at(Point::new(0.5, -1.0, 0.0)).unwrap(),
+            Vector::new(0.0, -1.0, 0.0)
+        );
+        // on the rounded edge, halfway between the two faces.
+        let edge = 0.75 + 0.25 * f64::from(0.5).sqrt();
+        let half = f64::from(2.0).sqrt() / 2.0;
+        assert_eq!(
+            b.normal_at(Point::new(edge, edge, 0.0)).unwrap(),
+            Vector::new(half, half, 0.0)
+        );
+    }
+
+    #[test]
+    fn radius_is_clamped() {
+        assert_eq!(RoundedBox::new(2.0).radius, 1.0);
+        assert_eq!(RoundedBox::new(-1.0).radius, 0.0);
+        assert!((RoundedBox::new(1.0).distance(Point::new(0.0, 2.0, 0.0)) - 1.0).abs() < EPSILON);
+    }
+}
@@ -0,0 +1,148 @@
+use crate::{
+    math::{
+        geometry::march::{self, gradient, march_with},
+        Form, Geometry, Hittable, Point, Vector,
+    },
+    world::{Intersection, Intersections, Ray},
+};
+
+/// a surface described by a signed distance function, which gives the distance from
+/// any point to the nearest point on the surface (negative inside of it). the function
+/// may underestimate the distance, but never overestimate it.
+#[derive(Copy, Clone, Debug)]
+pub struct Sdf {
+    pub distance: fn(Point) -> f64,
+    /// the surface lies within the cube from `-bound` to `bound` along each axis.
+    pub bound: f64,
+    /// how close to the surface a point must be to count as being on it.
+    pub epsilon: f64,
+    /// the most steps taken along a ray before giving up on finding the surface.
+    pub max_steps: usize,
+}
+
+impl Sdf {
+    /// the surface must lie within the cube from -1 to 1 along each axis, unless
+    /// given a different `bound`.
+    pub fn new(distance: fn(Point) -> f64) -> Sdf {
+        Sdf {
+            distance,
+            bound: 1.0,
+            epsilon: 1e-6,
+            max_steps: 256,
+        }
+    }
+
+    pub fn with_bound(self, bound: f64) -> Sdf {
+        Sdf { bound, ..self }
+    }
+
+    pub fn with_epsilon(self, epsilon: f64) -> Sdf {
+        Sdf { epsilon, ..self }
+    }
+
+    pub fn with_max_steps(self, max_steps: usize) -> Sdf {
+        Sdf { max_steps, ..self }
+    }
+}
+
+impl PartialEq for Sdf {
+    /// functions are only equal when they are the same function.
+    fn eq(&self, other: &Self) -> bool {
+        self.distance as usize == other.distance as usize
+            && self.bound == other.bound
+            && self.epsilon == other.epsilon
+            && self.max_steps == other.max_steps
+    }
+}
+
+impl Hittable for Sdf {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        let (start, end) = march::slab(
+            object_space_ray,
+            Point::new(-self.bound, -self.bound, -self.bound),
+            Point::new(self.bound, self.bound, self.bound),
+        )?;
+        let start = start.max(0.0);
+        let distance = self.distance;
+
+        // a ray starting inside of the surface marches towards the way out instead.
+        let time = if distance(object_space_ray.at(start)) < 0.0 {
+            march_with(
+                |p| -distance(p),
+                object_space_ray,
+                start,
+                end,
+                self.epsilon,
+                self.max_steps,
+            )
+        } else {
+            march_with(
+                distance,
+                object_space_ray,
+                start,
+                end,
+                self.epsilon,
+                self.max_steps,
+            )
+        }?;
+
+        Some(Intersections::with(vec![Intersection::new(
+            time,
+            object_space_ray,
+            Geometry::default().with_form(Form::Sdf(*self)),
+        )]))
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        Some(gradient(self.distance, object_space_point).normalized())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::EPSILON;
+
+    fn torus(p: Point) -> f64 {
+        let ring = Vector::new(p[0], 0.0, p[2]).magnitude() - 0.75;
+        Vector::new(ring, p[1], 0.0).magnitude() - 0.25
+    }
+
+    fn sdf() -> Geometry {
+        Geometry::default().with_form(Form::Sdf(Sdf::new(torus)))
+    }
+
+    #[test]
+    fn ray_hits_surface() {
+        let r = Ray::new(Point::new(-5.0, 0.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        let hit = sdf().hit(r).unwrap().closest().unwrap();
+        assert!((hit.time - 4.0).abs() < EPSILON);
+    }
+
+    #[test]
+    fn ray_through_hole_misses() {
+        let r = Ray::new(Point::new(0.0, -5.0, 0.0), Vector::new(0.0, 1.0, 0.0));
+        assert!(sdf().hit(r).is_none());
+    }
+
+    #[test]
+    fn ray_from_inside() {
+        let r = Ray::new(Point::new(0.75, 0.0, 0.0), Vector::new(0.0, 1.0, 0.0));
+        let hit = sdf().hit(r).unwrap().closest().unwrap();
+        assert!((hit.time - 0.25).abs() < EPSILON);
+    }
+
+    #[test]
+    fn surface_beyond_bound_is_cut_off() {
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let narrow = Geometry::default().with_form(Form::Sdf(Sdf::new(torus).with_bound(0.25)));
+        assert!(sdf().hit(r).is_some());
+        assert!(narrow.hit(r).is_none());
+    }
+
+    #[test]
+    fn normal_of_surface() {
+        let n = sdf().normal_at(Point::new(0.75, 0.25, 0.0)).unwrap();
+        assert_eq!(n, Vector::new(0.0, 1.0, 0.0));
+    }
+}
@@ -1,3 +1,5 @@
+use std::f64::consts;
+
 use crate::{
     math::{Form, Geometry, Hittable, Matrix, Point, Vector},
     world::{Intersection, Intersections, Material, Ray},
@@ -9,10 +11,29 @@ impl Sphere {
     pub fn new() -> Sphere {
         Sphere {}
     }
+
+    /// maps a point on the sphere to its longitude `u` and latitude `v`, which are
+    /// both between 0 and 1. `u` increases counter-clockwise when looking down from
+    /// +y, and `v` increases from the south pole to the north pole.
+    pub fn uv_at(&self, object_space_point: Point) -> (f64, f64) {
+        let (x, y, z) = (
+            object_space_point[0],
+            object_space_point[1],
+            object_space_point[2],
+        );
+        let radius = (x * x + y * y + z * z).sqrt();
+        let theta = x.atan2(z);
+        let phi = (y / radius).acos();
+
+        (
+            1.0 - ((theta / (2.0 * consts::PI)) + 0.5),
+            1.0 - (phi / consts::PI),
+        )
+    }
 }
 
 impl Hittable for Sphere {
-    fn hit(self, object_space_ray: Ray) -> Option<Intersections> {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
         let origin = Point::zero();
         let displacement = object_space_ray.origin - origin;
         let a = object_space_ray.direction.dot(&object_space_ray.direction);
@@ -29,11 +50,13 @@ impl Hittable for Sphere {
                     .iter()
                     .filter(|t| t.is_sign_positive())
                     .map(|&t| {
+                        let (u, v) = self.uv_at(object_space_ray.at(t));
                         Intersection::new(
                             t,
                             object_space_ray,
                             Geometry::default().with_form(Form::Sphere),
                         )
+                        .with_uv(u, v)
                     })
                     .collect(),
             );
@@ -47,7 +70,7 @@ impl Hittable for Sphere {
         }
     }
 
-    fn normal_at(self, object_space_point: Point) -> Option<Vector> {
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
         Some(object_space_point - Point::zero())
     }
 }
@@ -55,8 +78,7 @@ impl Hittable for Sphere {
 #[cfg(test)]
 mod tests {
     use super::*;
-    use crate::math::Transformable;
-    use std::f64::consts;
+    use crate::math::{Transformable, EPSILON};
 
     #[test]
     fn ray_intersects_sphere_twice() {
@@ -101,6 +123,37 @@ mod tests {
         assert!(sphere.hit(ray).is_none());
     }
 
+    #[test]
+    fn spherical_surface_coordinates() {
+        let sphere = Sphere::new();
+        let half = f64::from(2.0).sqrt() / 2.0;
+        let cases = [
+            (Point::new(0.0, 0.0, -1.0), (0.0, 0.5)),
+            (Point::new(1.0, 0.0, 0.0), (0.25, 0.5)),
+            (Point::new(0.0, 0.0, 1.0), (0.5, 0.5)),
+            (Point::new(-1.0, 0.0, 0.0), (0.75, 0.5)),
+            (Point::new(0.0, 1.0, 0.0), (0.5, 1.0)),
+            (Point::new(0.0, -1.0, 0.0), (0.5, 0.0)),
+            (Point::new(half, half, 0.0), (0.25, 0.75)),
+        ];
+        for &(point, (u, v)) in cases.iter() {
+            let (actual_u, actual_v) = sphere.uv_at(point);
+            assert!((actual_u - u).abs() < EPSILON);
+            assert!((actual_v - v).abs() < EPSILON);
+        }
+    }
+
+    #[test]
+    fn hits_carry_surface_coordinates() {
+        let ray = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let sphere = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::scaling(2.0, 2.0, 2.0));
+        let mut xs = sphere.hit(ray).unwrap();
+        assert_eq!(xs.pop().unwrap().uv, Some((0.0, 0.5)));
+        assert_eq!(xs.pop().unwrap().uv, Some((0.5, 0.5)));
+    }
+
     #[test]
     fn default_transformation() {
         let s = Geometry::default().with_form(Form::Sphere);
@@ -228,7 +281,7 @@ mod tests {
         let mut s = Geometry::default().with_form(Form::Sphere);
         let mut m = Material::default();
         m.ambient = 1.0;
-        s.material = m;
+        s.material = m.clone();
         assert_eq!(s.material, m);
     }
 }
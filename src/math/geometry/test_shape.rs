@@ -0,0 +1,125 @@
+use std::sync::{Arc, Mutex};
+
+use crate::{
+    math::{Bounds, Hittable, Point, Vector},
+    world::{Intersections, Ray},
+};
+
+/// a form which is never hit, but remembers the last ray it was asked about, for
+/// checking that a ray reaches a form in its object space, as "the ray tracer
+/// challenge" does with its test shape. its normal at any point is the vector from
+/// the origin to that point, so that the conversion of normals into world space can
+/// be checked too. clones of a test shape share the ray.
+#[derive(Clone, Debug)]
+pub struct TestShape {
+    saved_ray: Arc<Mutex<Option<Ray>>>,
+}
+
+impl TestShape {
+    pub fn new() -> TestShape {
+        TestShape {
+            saved_ray: Arc::new(Mutex::new(None)),
+        }
+    }
+
+    /// the last ray that the form was asked to intersect, in object space.
+    pub fn saved_ray(&self) -> Option<Ray> {
+        *self.saved_ray.lock().unwrap()
+    }
+
+    /// the box around the form, which is the same as a unit sphere's.
+    pub fn bounds(&self) -> Bounds {
+        Bounds::around(Point::zero(), 1.0)
+    }
+}
+
+impl Default for TestShape {
+    fn default() -> TestShape {
+        TestShape::new()
+    }
+}
+
+impl PartialEq for TestShape {
+    /// test shapes are only equal to their own clones.
+    fn eq(&self, other: &Self) -> bool {
+        Arc::ptr_eq(&self.saved_ray, &other.saved_ray)
+    }
+}
+
+impl Hittable for TestShape {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        *self.saved_ray.lock().unwrap() = Some(object_space_ray);
+        None
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        Some(Vector::new(
+            object_space_point[0],
+            object_space_point[1],
+            object_space_point[2],
+        ))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::{Form, Geometry, Matrix, Transformable};
+    use std::f64::consts;
+
+    #[test]
+    fn intersecting_scaled_shape() {
+        let shape = TestShape::new();
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let s = Geometry::default()
+            .with_form(Form::Test(shape.clone()))
+            .transformed(Matrix::scaling(2.0, 2.0, 2.0));
+        assert!(shape.saved_ray().is_none());
+        assert!(s.hit(r).is_none());
+
+        let saved = shape.saved_ray().unwrap();
+        assert_eq!(saved.origin, Point::new(0.0, 0.0, -2.5));
+        assert_eq!(saved.direction, Vector::new(0.0, 0.0, 0.5));
+    }
+
+    #[test]
+    fn intersecting_translated_shape() {
+        let shape = TestShape::new();
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let s = Geometry::default()
+            .with_form(Form::Test(shape.clone()))
+            .transformed(Matrix::translation(5.0, 0.0, 0.0));
+        s.hit(r);
+
+        let saved = shape.saved_ray().unwrap();
+        assert_eq!(saved.origin, Point::new(-5.0, 0.0, -5.0));
+        assert_eq!(saved.direction, Vector::new(0.0, 0.0, 1.0));
+    }
+
+    #[test]
+    fn normal_on_translated_shape() {
+        let s = Geometry::default()
+            .with_form(Form::Test(TestShape::new()))
+            .transformed(Matrix::translation(0.0, 1.0, 0.0));
+        let n = s.normal_at(Point::new(0.0, 1.70711, -0.70711)).unwrap();
+        assert_eq!(n, Vector::new(0.0, 0.70711, -0.70711));
+    }
+
+    #[test]
+    fn normal_on_transformed_shape() {
+        let s = Geometry::default()
+            .with_form(Form::Test(TestShape::new()))
+            .transformed(Matrix::scaling(1.0, 0.5, 1.0) * Matrix::rotation_z(consts::PI / 5.0));
+        let root = 2.0_f64.sqrt() / 2.0;
+        let n = s.normal_at(Point::new(0.0, root, -root)).unwrap();
+        assert_eq!(n, Vector::new(0.0, 0.97014, -0.24254));
+    }
+
+    #[test]
+    fn clones_are_equal() {
+        let shape = TestShape::new();
+        let copy = shape.clone();
+        assert_eq!(shape, copy);
+        assert_ne!(shape, TestShape::new());
+    }
+}
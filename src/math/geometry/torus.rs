@@ -0,0 +1,192 @@
+use std::f64::consts;
+
+use crate::{
+    math::{roots, Bounds, Form, Geometry, Hittable, Point, Vector},
+    world::{Intersection, Intersections, Ray},
+};
+
+/// a ring around the y axis, centered at the origin: a tube of radius `minor` whose
+/// center runs around a circle of radius `major` in the xz plane.
+pub struct Torus {
+    pub major: f64,
+    pub minor: f64,
+}
+
+impl Torus {
+    pub fn new(major: f64, minor: f64) -> Torus {
+        Torus { major, minor }
+    }
+
+    pub fn bounds(&self) -> Bounds {
+        let outer = self.major + self.minor;
+        Bounds::new(
+            Point::new(-outer, -self.minor, -outer),
+            Point::new(outer, self.minor, outer),
+        )
+    }
+
+    /// maps a point on the torus to its surface coordinates. `u` is the angle around
+    /// the y axis and `v` is the angle around the tube, starting from its outside
+    /// edge, both scaled to be between 0 and 1.
+    pub fn uv_at(&self, object_space_point: Point) -> (f64, f64) {
+        let (x, y, z) = (
+            object_space_point[0],
+            object_space_point[1],
+            object_space_point[2],
+        );
+        let around = x.atan2(z);
+        let across = y.atan2((x * x + z * z).sqrt() - self.major);
+
+        (
+            (around / (2.0 * consts::PI)).rem_euclid(1.0),
+            (across / (2.0 * consts::PI)).rem_euclid(1.0),
+        )
+    }
+}
+
+impl Hittable for Torus {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        // the coefficients of the quartic grow with the distance of the ray's origin,
+        // which costs precision, so the ray is started where it enters the box around
+        // the torus instead.
+        let (enter, _) = self.bounds().hit(object_space_ray)?;
+        let start = enter.max(0.0);
+        let origin = object_space_ray.at(start);
+        let direction = object_space_ray.direction;
+
+        // a point is on the torus where
+        //   (x^2 + y^2 + z^2 + major^2 - minor^2)^2 = 4 major^2 (x^2 + z^2),
+        // which is a quartic in the time along the ray.
+        let m = direction.dot(&direction);
+        let n = Vector::new(origin[0], origin[1], origin[2]).dot(&direction);
+        let o = origin[0] * origin[0] + origin[1] * origin[1] + origin[2] * origin[2];
+        let q = o + self.major * self.major - self.minor * self.minor;
+        let ring = 4.0 * self.major * self.major;
+
+        let times = roots::quartic(
+            m * m,
+            4.0 * m * n,
+            4.0 * n * n + 2.0 * m * q
+                - ring * (direction[0] * direction[0] + direction[2] * direction[2]),
+            4.0 * n * q - 2.0 * ring * (origin[0] * direction[0] + origin[2] * direction[2]),
+            q * q - ring * (origin[0] * origin[0] + origin[2] * origin[2]),
+        );
+
+        let object = Geometry::default().with_form(Form::Torus {
+            major: self.major,
+            minor: self.minor,
+        });
+        let hits: Vec<Intersection> = times
+            .into_iter()
+            .filter(|&t| 0.0 <= t)
+            .map(|t| {
+                let (u, v) = self.uv_at(object_space_ray.at(start + t));
+                Intersection::new(start + t, object_space_ray, object.clone()).with_uv(u, v)
+            })
+            .collect();
+
+        if hits.is_empty() {
+            None
+        } else {
+            Some(Intersections::with(hits))
+        }
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        let (x, y, z) = (
+            object_space_point[0],
+            object_space_point[1],
+            object_space_point[2],
+        );
+        let sum = x * x + y * y + z * z;
+        let (major2, minor2) = (self.major * self.major, self.minor * self.minor);
+
+        Some(
+            Vector::new(
+                x * (sum - major2 - minor2),
+                y * (sum + major2 - minor2),
+                z * (sum - major2 - minor2),
+            )
+            .normalized(),
+        )
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::{Matrix, Transformable, EPSILON};
+
+    fn torus() -> Geometry {
+        Geometry::default().with_form(Form::Torus {
+            major: 2.0,
+            minor: 0.5,
+        })
+    }
+
+    fn times(intersections: Intersections) -> Vec<f64> {
+        intersections.iter().map(|i| i.time).collect()
+    }
+
+    #[test]
+    fn ray_passes_through_both_sides() {
+        let r = Ray::new(Point::new(-5.0, 0.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        let hits = times(torus().hit(r).unwrap());
+        assert_eq!(hits.len(), 4);
+        for (hit, expected) in hits.iter().zip(&[2.5, 3.5, 6.5, 7.5]) {
+            assert!((hit - expected).abs() < EPSILON);
+        }
+    }
+
+    #[test]
+    fn ray_through_hole_misses() {
+        let r = Ray::new(Point::new(0.0, 5.0, 0.0), Vector::new(0.0, -1.0, 0.0));
+        assert!(torus().hit(r).is_none());
+        let r = Ray::new(Point::new(-5.0, 1.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert!(torus().hit(r).is_none());
+    }
+
+    #[test]
+    fn ray_from_far_away() {
+        let r = Ray::new(Point::new(2.0, 1000.0, 0.0), Vector::new(0.0, -1.0, 0.0));
+        let hits = times(torus().hit(r).unwrap());
+        assert_eq!(hits.len(), 2);
+        assert!((hits[0] - 999.5).abs() < EPSILON);
+        assert!((hits[1] - 1000.5).abs() < EPSILON);
+    }
+
+    #[test]
+    fn ray_from_inside_tube() {
+        let r = Ray::new(Point::new(2.0, 0.0, 0.0), Vector::new(0.0, 1.0, 0.0));
+        let hits = times(torus().hit(r).unwrap());
+        assert_eq!(hits.len(), 1);
+        assert!((hits[0] - 0.5).abs() < EPSILON);
+    }
+
+    #[test]
+    fn normals_on_torus() {
+        let normal = |x, y, z| Torus::new(2.0, 0.5).normal_at(Point::new(x, y, z)).unwrap();
+        assert_eq!(normal(2.5, 0.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        assert_eq!(normal(0.0, 0.0, 1.5), Vector::new(0.0, 0.0, -1.0));
+        assert_eq!(normal(0.0, 0.5, -2.0), Vector::new(0.0, 1.0, 0.0));
+    }
+
+    #[test]
+    fn transformed_torus() {
+        let t = torus().transformed(Matrix::rotation_x(consts::PI / 2.0));
+        let r = Ray::new(Point::new(0.0, 2.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let hit = t.hit(r).unwrap().closest().unwrap();
+        assert!((hit.time - 4.5).abs() < EPSILON);
+        let n = t.normal_at(r.at(hit.time)).unwrap();
+        assert_eq!(n, Vector::new(0.0, 0.0, -1.0));
+    }
+
+    #[test]
+    fn torus_surface_coordinates() {
+        let t = Torus::new(2.0, 0.5);
+        assert_eq!(t.uv_at(Point::new(0.0, 0.0, 2.5)), (0.0, 0.0));
+        let (u, v) = t.uv_at(Point::new(2.0, 0.5, 0.0));
+        assert!((u - 0.25).abs() < EPSILON);
+        assert!((v - 0.25).abs() < EPSILON);
+    }
+}
@@ -0,0 +1,291 @@
+use std::sync::Arc;
+
+use crate::{
+    math::{Bounds, Form, Geometry, Hittable, Point, Vector, EPSILON},
+    world::{Intersection, Intersections, Ray},
+};
+
+/// a tube swept along a line through a list of points, made up of capsules (cylinders
+/// with round ends) joining each point to the next. each segment has its own radius,
+/// so tubes can taper, like a strand of hair, or bulge, like a string of beads.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Tube {
+    points: Arc<[Point]>,
+    radii: Arc<[f64]>,
+}
+
+impl Tube {
+    /// `radii[i]` is the radius of the segment from `points[i]` to `points[i + 1]`.
+    /// panics unless there is one fewer radius than there are points.
+    pub fn new(points: Vec<Point>, radii: Vec<f64>) -> Tube {
+        assert!(
+            !points.is_empty() && radii.len() + 1 == points.len(),
+            "a tube through {} points needs {} radii, got {}",
+            points.len(),
+            points.len().max(1) - 1,
+            radii.len()
+        );
+
+        Tube {
+            points: points.into(),
+            radii: radii.into(),
+        }
+    }
+
+    /// the same radius all of the way along.
+    pub fn uniform(points: Vec<Point>, radius: f64) -> Tube {
+        let radii = vec![radius; points.len().max(1) - 1];
+        Tube::new(points, radii)
+    }
+
+    pub fn points(&self) -> &[Point] {
+        &self.points
+    }
+
+    pub fn radii(&self) -> &[f64] {
+        &self.radii
+    }
+
+    /// the box around the round ends of every segment.
+    pub fn bounds(&self) -> Bounds {
+        self.segments()
+            .fold(Bounds::empty(), |bounds, (a, b, radius)| {
+                bounds
+                    .merged(Bounds::around(a, radius))
+                    .merged(Bounds::around(b, radius))
+            })
+    }
+
+    /// each segment, as its start, end, and radius.
+    fn segments(&self) -> impl Iterator<Item = (Point, Point, f64)> + '_ {
+        self.points
+            .windows(2)
+            .zip(self.radii.iter())
+            .map(|(ends, &radius)| (ends[0], ends[1], radius))
+    }
+}
+
+/// the point on the line segment from `a` to `b` which is closest to `point`.
+fn closest_on_segment(point: Point, a: Point, b: Point) -> Point {
+    let axis = b - a;
+    let length = axis.dot(&axis);
+    if length < EPSILON * EPSILON {
+        return a;
+    }
+    let along = ((point - a).dot(&axis) / length).max(0.0).min(1.0);
+    a + axis * along
+}
+
+/// the times at which a ray enters and leaves a sphere.
+fn sphere_span(ray: Ray, center: Point, radius: f64) -> Option<(f64, f64)> {
+    let offset = ray.origin - center;
+    let a = ray.direction.dot(&ray.direction);
+    let b = ray.direction.dot(&offset);
+    let c = offset.dot(&offset) - radius * radius;
+    let discriminant = b * b - a * c;
+
+    if discriminant < 0.0 {
+        None
+    } else {
+        let root = discriminant.sqrt();
+        Some(((-b - root) / a, (-b + root) / a))
+    }
+}
+
+/// the times at which a ray enters and leaves the cylinder around the line segment
+/// from `a` to `b`, without its ends.
+fn cylinder_span(ray: Ray, a: Point, b: Point, radius: f64) -> Option<(f64, f64)> {
+    let length = (b - a).magnitude();
+    if length < EPSILON {
+        return None;
+    }
+    let axis = (b - a) / length;
+
+    // the parts of the ray across the axis, and along it.
+    let offset = ray.origin - a;
+    let across_origin = offset - axis * offset.dot(&axis);
+    let across_direction = ray.direction - axis * ray.direction.dot(&axis);
+
+    let qa = across_direction.dot(&across_direction);
+    let qb = across_direction.dot(&across_origin);
+    let qc = across_origin.dot(&across_origin) - radius * radius;
+    let (mut t0, mut t1) = if qa < EPSILON * EPSILON {
+        // parallel to the axis, so either always inside of the cylinder, or never.
+        if 0.0 < qc {
+            return None;
+        }
+        (f64::NEG_INFINITY, f64::INFINITY)
+    } else {
+        let discriminant = qb * qb - qa * qc;
+        if discriminant < 0.0 {
+            return None;
+        }
+        let root = discriminant.sqrt();
+        ((-qb - root) / qa, (-qb + root) / qa)
+    };
+
+    // cut off the parts of the ray beyond the ends of the segment.
+    let speed = ray.direction.dot(&axis);
+    let start = offset.dot(&axis);
+    if speed.abs() < EPSILON * EPSILON {
+        if start < 0.0 || length < start {
+            return None;
+        }
+    } else {
+        let (mut s0, mut s1) = (-start / speed, (length - start) / speed);
+        if s1 < s0 {
+            std::mem::swap(&mut s0, &mut s1);
+        }
+        t0 = t0.max(s0);
+        t1 = t1.min(s1);
+    }
+
+    if t0 <= t1 {
+        Some((t0, t1))
+    } else {
+        None
+    }
+}
+
+impl Hittable for Tube {
+    fn hit(&self, object_space_ray: Ray) -> Option<Intersections> {
+        // a capsule is convex, so the ray passes through it in one span, which joins
+        // the spans through its cylinder and its two round ends.
+        let mut spans: Vec<(f64, f64)> = self
+            .segments()
+            .filter_map(|(a, b, radius)| {
+                vec![
+                    sphere_span(object_space_ray, a, radius),
+                    sphere_span(object_space_ray, b, radius),
+                    cylinder_span(object_space_ray, a, b, radius),
+                ]
+                .into_iter()
+                .flatten()
+                .fold(None, |joined: Option<(f64, f64)>, (t0, t1)| {
+                    Some(joined.map_or((t0, t1), |(j0, j1)| (j0.min(t0), j1.max(t1))))
+                })
+            })
+            .collect();
+
+        // neighboring capsules overlap where they meet, so merge overlapping spans to
+        // leave only the outside of the tube.
+        spans.sort_by(|a, b| a.0.total_cmp(&b.0));
+        let mut merged: Vec<(f64, f64)> = vec![];
+        for (t0, t1) in spans {
+            match merged.last_mut() {
+                Some(last) if t0 <= last.1 => last.1 = last.1.max(t1),
+                _ => merged.push((t0, t1)),
+            }
+        }
+
+        let object = Geometry::default().with_form(Form::Tube(self.clone()));
+        let hits = Intersections::with(
+            merged
+                .iter()
+                .flat_map(|&(t0, t1)| vec![t0, t1])
+                .map(|t| Intersection::new(t, object_space_ray, object.clone()))
+                .collect(),
+        );
+
+        if hits.count() == 0 {
+            None
+        } else {
+            Some(hits)
+        }
+    }
+
+    fn normal_at(&self, object_space_point: Point) -> Option<Vector> {
+        // the point is on the surface of whichever capsule it is least inside of.
+        let (_, closest) = self
+            .segments()
+            .map(|(a, b, radius)| {
+                let closest = closest_on_segment(object_space_point, a, b);
+                ((object_space_point - closest).magnitude() - radius, closest)
+            })
+            .fold(
+                None,
+                |best: Option<(f64, Point)>, (distance, closest)| match best {
+                    Some((d, _)) if d <= distance => best,
+                    _ => Some((distance, closest)),
+                },
+            )?;
+
+        Some((object_space_point - closest).normalized())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn bent() -> Geometry {
+        // runs along x, then turns to run along y, getting thinner as it goes.
+        Geometry::default().with_form(Form::Tube(Tube::new(
+            vec![
+                Point::new(-2.0, 0.0, 0.0),
+                Point::zero(),
+                Point::new(0.0, 2.0, 0.0),
+            ],
+            vec![0.5, 0.25],
+        )))
+    }
+
+    fn times(mut xs: Intersections) -> Vec<f64> {
+        let mut times = vec![];
+        while let Some(x) = xs.pop() {
+            times.push(x.time);
+        }
+        times
+    }
+
+    #[test]
+    fn ray_through_side_of_segment() {
+        let r = Ray::new(Point::new(-1.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let xs = bent().hit(r).unwrap();
+        assert_eq!(times(xs), vec![4.5, 5.5]);
+    }
+
+    #[test]
+    fn ray_through_round_end() {
+        let r = Ray::new(Point::new(-5.0, 0.0, 0.0), Vector::new(1.0, 0.0, 0.0));
+        let xs = bent().hit(r).unwrap();
+        assert_eq!(times(xs), vec![2.5, 5.5]);
+    }
+
+    #[test]
+    fn ray_along_thinner_segment() {
+        let r = Ray::new(Point::new(0.0, 1.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let xs = bent().hit(r).unwrap();
+        assert_eq!(times(xs), vec![4.75, 5.25]);
+    }
+
+    #[test]
+    fn ray_misses_tube() {
+        let r = Ray::new(Point::new(1.0, 1.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert!(bent().hit(r).is_none());
+    }
+
+    #[test]
+    fn joint_has_no_inner_surfaces() {
+        // passes through where the segments overlap, but only crosses the outside.
+        let r = Ray::new(Point::new(0.0, 0.1, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(bent().hit(r).unwrap().count(), 2);
+    }
+
+    #[test]
+    fn normals() {
+        let tube = bent();
+        assert_eq!(
+            tube.normal_at(Point::new(-1.0, 0.5, 0.0)).unwrap(),
+            Vector::new(0.0, 1.0, 0.0)
+        );
+        assert_eq!(
+            tube.normal_at(Point::new(-2.5, 0.0, 0.0)).unwrap(),
+            Vector::new(-1.0, 0.0, 0.0)
+        );
+        assert_eq!(
+            tube.normal_at(Point::new(0.25, 1.0, 0.0)).unwrap(),
+            Vector::new(1.0, 0.0, 0.0)
+        );
+    }
+}
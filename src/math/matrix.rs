@@ -1,6 +1,9 @@
 use std::ops::{Add, AddAssign, Index, IndexMut, Mul, Sub, SubAssign};
 
-use super::{point::Point, vector::Vector, EPSILON};
+use super::{point::Point, quaternion::Quaternion, vector::Vector, EPSILON};
+
+pub mod small;
+pub use small::{Matrix2, Matrix3};
 
 /// 4-by-4 matrix that represents both a transformation and a translation by using
 /// homogeneous coordinates (https://en.wikipedia.org/wiki/Homogeneous_coordinates).
@@ -8,7 +11,8 @@ use super::{point::Point, vector::Vector, EPSILON};
 /// is stored as a sequence of three vectors (the first three columns) followed by
 /// a point (the final column). the first three column vectors create a 3-by-3
 /// sub-matrix representing the transformation, and the final column represents the
-/// translation.
+/// translation. like the columns, two matrices are equal when each of their elements
+/// are within `EPSILON` of each other.
 #[derive(Copy, Clone, Debug, PartialEq)]
 pub struct Matrix {
     a: Vector,
@@ -126,6 +130,98 @@ impl Matrix {
         self
     }
 
+    /// moves each component of a point in proportion to the other two components;
+    /// for example, `xy` is how far x moves in proportion to y.
+    pub fn shearing(xy: f64, xz: f64, yx: f64, yz: f64, zx: f64, zy: f64) -> Matrix {
+        #[rustfmt::skip]
+        Matrix::new(
+            1.0, xy,  xz,  0.0,
+            yx,  1.0, yz,  0.0,
+            zx,  zy,  1.0, 0.0,
+        )
+    }
+
+    pub fn shear(&mut self, xy: f64, xz: f64, yx: f64, yz: f64, zx: f64, zy: f64) -> &mut Matrix {
+        *self = Matrix::shearing(xy, xz, yx, yz, zx, zy) * *self;
+        self
+    }
+
+    /// rotation around an arbitrary `axis` passing through the origin. like the
+    /// rotations around the coordinate axes, positive angles follow the right-hand rule.
+    pub fn rotation(axis: Vector, radians: f64) -> Matrix {
+        let u = axis.normalized();
+        let (x, y, z) = (u[0], u[1], u[2]);
+        let (s, c) = radians.sin_cos();
+        let t = 1.0 - c;
+
+        #[rustfmt::skip]
+        Matrix::new(
+            t * x * x + c,     t * x * y - s * z, t * x * z + s * y, 0.0,
+            t * x * y + s * z, t * y * y + c,     t * y * z - s * x, 0.0,
+            t * x * z - s * y, t * y * z + s * x, t * z * z + c,     0.0,
+        )
+    }
+
+    pub fn rotate(&mut self, axis: Vector, radians: f64) -> &mut Matrix {
+        *self = Matrix::rotation(axis, radians) * *self;
+        self
+    }
+
+    /// rotation around an `axis` passing through `point` instead of the origin. the
+    /// point is moved to the origin, rotated around, and then moved back.
+    pub fn rotation_around(point: Point, axis: Vector, radians: f64) -> Matrix {
+        let p = point - Point::zero();
+        Matrix::translation(p[0], p[1], p[2])
+            * Matrix::rotation(axis, radians)
+            * Matrix::translation(-p[0], -p[1], -p[2])
+    }
+
+    pub fn rotate_around(&mut self, point: Point, axis: Vector, radians: f64) -> &mut Matrix {
+        *self = Matrix::rotation_around(point, axis, radians) * *self;
+        self
+    }
+
+    /// scaling which leaves `point` fixed in place instead of the origin.
+    pub fn scaling_about(point: Point, dx: f64, dy: f64, dz: f64) -> Matrix {
+        let p = point - Point::zero();
+        Matrix::translation(p[0], p[1], p[2])
+            * Matrix::scaling(dx, dy, dz)
+            * Matrix::translation(-p[0], -p[1], -p[2])
+    }
+
+    pub fn scale_about(&mut self, point: Point, dx: f64, dy: f64, dz: f64) -> &mut Matrix {
+        *self = Matrix::scaling_about(point, dx, dy, dz) * *self;
+        self
+    }
+
+    /// splits this matrix into translation, rotation, and scale components. the matrix
+    /// must be invertible. a reflection is represented by a negative scale along the x
+    /// axis. any shearing cannot be represented, and is lost; in that case recomposing
+    /// the components gives the closest matrix without shearing.
+    pub fn decompose(&self) -> Decomposition {
+        let mut a = self[0];
+        let b = self[1];
+        let c = self[2];
+
+        // flip one axis of a reflection so that the remainder is a proper rotation.
+        let sign = if self.determinant() < 0.0 { -1.0 } else { 1.0 };
+        a *= sign;
+
+        let scale = Vector::new(sign * a.magnitude(), b.magnitude(), c.magnitude());
+
+        // gram-schmidt orthonormalization of the columns, which removes any shearing.
+        let x = a.normalized();
+        let y = (b - (x * x.dot(&b))).normalized();
+        let z = x.cross(&y);
+        let rotation = Matrix::with_columns(x, y, z, Point::zero());
+
+        Decomposition {
+            translation: self.translation - Point::zero(),
+            rotation: Quaternion::from_rotation(&rotation),
+            scale,
+        }
+    }
+
     /// a specialized way to find the inverse of matrices of this specific form.
     /// taken from "foundations of game engine development; volume 1: mathematics"
     /// by eric lengyel.
@@ -179,12 +275,55 @@ impl Matrix {
         self
     }
 
+    /// the 3-by-3 transformation sub-matrix, without the translation.
+    pub fn linear(&self) -> Matrix3 {
+        let mut rows = [[0.0; 3]; 3];
+        for (i, row) in rows.iter_mut().enumerate() {
+            for (j, n) in row.iter_mut().enumerate() {
+                *n = self[(i, j)];
+            }
+        }
+        Matrix3::new(rows)
+    }
+
+    /// the 3-by-3 matrix left over after removing the given row and column from the
+    /// full 4-by-4 matrix, including the translation column and the implied fourth
+    /// row. removing both of those leaves `linear`.
+    pub fn submatrix(&self, row: usize, column: usize) -> Matrix3 {
+        let element = |i: usize, j: usize| match (i, j) {
+            (3, 3) => 1.0,
+            (3, _) => 0.0,
+            (_, 3) => self.translation[i],
+            _ => self[(i, j)],
+        };
+
+        let mut rows = [[0.0; 3]; 3];
+        for (i, r) in (0..4).filter(|&r| r != row).enumerate() {
+            for (j, c) in (0..4).filter(|&c| c != column).enumerate() {
+                rows[i][j] = element(r, c);
+            }
+        }
+        Matrix3::new(rows)
+    }
+
     /// calculates the determinant by finding the equivalent determinant of the 3-by-3
-    /// transformation sub-matrix.
+    /// transformation sub-matrix (which is what is left after expanding along the
+    /// implied fourth row), expanding along its first row.
     pub fn determinant(&self) -> f64 {
-        self[(0, 0)] * (self[(1, 1)] * self[(2, 2)] - self[(1, 2)] * self[(2, 1)])
-            + self[(0, 1)] * (self[(1, 2)] * self[(2, 0)] - self[(1, 0)] * self[(2, 2)])
-            + self[(0, 2)] * (self[(1, 0)] * self[(2, 1)] - self[(1, 1)] * self[(2, 0)])
+        self.linear().determinant()
+    }
+
+    /// the determinant of the 2-by-2 matrix left over after removing the given row and
+    /// column from the 3-by-3 transformation sub-matrix. removing the fourth row and
+    /// the translation column is what leaves the 3-by-3 sub-matrix in the first place,
+    /// so they cannot be removed here.
+    pub fn minor(&self, row: usize, column: usize) -> f64 {
+        self.linear().minor(row, column)
+    }
+
+    /// the minor, negated when the row and column add up to an odd number.
+    pub fn cofactor(&self, row: usize, column: usize) -> f64 {
+        self.linear().cofactor(row, column)
     }
 
     /// uses the determinant to say if an inverse exists.
@@ -193,6 +332,26 @@ impl Matrix {
     }
 }
 
+/// a transformation split into a scaling, followed by a rotation, followed by a
+/// translation. produced by `Matrix::decompose`.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Decomposition {
+    pub translation: Vector,
+    pub rotation: Quaternion,
+    pub scale: Vector,
+}
+
+impl Decomposition {
+    /// recombines the components into a single matrix.
+    pub fn to_matrix(&self) -> Matrix {
+        let t = self.translation;
+        let s = self.scale;
+        Matrix::translation(t[0], t[1], t[2])
+            * self.rotation.to_matrix()
+            * Matrix::scaling(s[0], s[1], s[2])
+    }
+}
+
 /* indexing operations */
 
 impl Index<(usize, usize)> for Matrix {
@@ -296,24 +455,13 @@ impl SubAssign for Matrix {
 impl Mul for Matrix {
     type Output = Self;
 
+    /// each column of the product is `self` applied to the matching column of `other`.
     fn mul(self, other: Self) -> Self::Output {
-        #[rustfmt::skip]
-        Matrix::new(
-            // first row
-            self[(0, 0)] * other[(0, 0)] + self[(0, 1)] * other[(1, 0)] + self[(0, 2)] * other[(2, 0)],
-            self[(0, 0)] * other[(0, 1)] + self[(0, 1)] * other[(1, 1)] + self[(0, 2)] * other[(2, 1)],
-            self[(0, 0)] * other[(0, 2)] + self[(0, 1)] * other[(1, 2)] + self[(0, 2)] * other[(2, 2)],
-            self[(0, 0)] * other.translation[0] + self[(0, 1)] * other.translation[1] + self[(0, 2)] * other.translation[2] + self.translation[0],
-            // second row
-            self[(1, 0)] * other[(0, 0)] + self[(1, 1)] * other[(1, 0)] + self[(1, 2)] * other[(2, 0)],
-            self[(1, 0)] * other[(0, 1)] + self[(1, 1)] * other[(1, 1)] + self[(1, 2)] * other[(2, 1)],
-            self[(1, 0)] * other[(0, 2)] + self[(1, 1)] * other[(1, 2)] + self[(1, 2)] * other[(2, 2)],
-            self[(1, 0)] * other.translation[0] + self[(1, 1)] * other.translation[1] + self[(1, 2)] * other.translation[2] + self.translation[1],
-            // third row
-            self[(2, 0)] * other[(0, 0)] + self[(2, 1)] * other[(1, 0)] + self[(2, 2)] * other[(2, 0)],
-            self[(2, 0)] * other[(0, 1)] + self[(2, 1)] * other[(1, 1)] + self[(2, 2)] * other[(2, 1)],
-            self[(2, 0)] * other[(0, 2)] + self[(2, 1)] * other[(1, 2)] + self[(2, 2)] * other[(2, 2)],
-            self[(2, 0)] * other.translation[0] + self[(2, 1)] * other.translation[1] + self[(2, 2)] * other.translation[2] + self.translation[2],
+        Matrix::with_columns(
+            self * other.a,
+            self * other.b,
+            self * other.c,
+            self * other.translation,
         )
     }
 }
@@ -323,13 +471,12 @@ impl Mul for Matrix {
 impl Mul<Vector> for Matrix {
     type Output = Vector;
 
+    /// sums the columns, weighted by the components of the vector. working a column
+    /// at a time (rather than taking the dot product of each row) keeps the three
+    /// components of each term together, which the compiler can turn into simd
+    /// instructions.
     fn mul(self, vector: Vector) -> Self::Output {
-        #[rustfmt::skip]
-        Vector::new(
-            self[(0, 0)] * vector[0] + self[(0, 1)] * vector[1] + self[(0, 2)] * vector[2],
-            self[(1, 0)] * vector[0] + self[(1, 1)] * vector[1] + self[(1, 2)] * vector[2],
-            self[(2, 0)] * vector[0] + self[(2, 1)] * vector[1] + self[(2, 2)] * vector[2],
-        )
+        self.a * vector[0] + self.b * vector[1] + self.c * vector[2]
     }
 }
 
@@ -338,13 +485,9 @@ impl Mul<Vector> for Matrix {
 impl Mul<Point> for Matrix {
     type Output = Point;
 
+    /// like a vector, but also moved by the translation column.
     fn mul(self, point: Point) -> Self::Output {
-        #[rustfmt::skip]
-        Point::new(
-            self[(0, 0)] * point[0] + self[(0, 1)] * point[1] + self[(0, 2)] * point[2] + self.translation[0],
-            self[(1, 0)] * point[0] + self[(1, 1)] * point[1] + self[(1, 2)] * point[2] + self.translation[1],
-            self[(2, 0)] * point[0] + self[(2, 1)] * point[1] + self[(2, 2)] * point[2] + self.translation[2],
-        )
+        self.translation + (self.a * point[0] + self.b * point[1] + self.c * point[2])
     }
 }
 
@@ -386,6 +529,21 @@ mod tests {
         assert_eq!(a, b);
     }
 
+    #[test]
+    fn matrix_approximate_equality() {
+        let a = Matrix::rotation_y(0.5) * Matrix::translation(1.0, 2.0, 3.0);
+        let mut b = a;
+        b[(1, 2)] += EPSILON / 10.0;
+        b.translation = Point::new(
+            a.translation[0],
+            a.translation[1] - EPSILON / 10.0,
+            a.translation[2],
+        );
+        assert_eq!(a, b);
+        b[(0, 0)] += EPSILON * 10.0;
+        assert_ne!(a, b);
+    }
+
     #[test]
     fn matrix_inequality() {
         #[rustfmt::skip]
@@ -481,6 +639,61 @@ mod tests {
         assert_eq!(Matrix::identity().transposed(), Matrix::identity());
     }
 
+    #[test]
+    fn minor_of_matrix() {
+        #[rustfmt::skip]
+        let a = Matrix::new(
+            3.0, 5.0,  0.0,  0.0,
+            2.0, -1.0, -7.0, 0.0,
+            6.0, -1.0, 5.0,  0.0,
+        );
+        assert_eq!(a.minor(1, 0), 25.0);
+    }
+
+    #[test]
+    fn cofactor_of_matrix() {
+        #[rustfmt::skip]
+        let a = Matrix::new(
+            3.0, 5.0,  0.0,  0.0,
+            2.0, -1.0, -7.0, 0.0,
+            6.0, -1.0, 5.0,  0.0,
+        );
+        assert_eq!(a.minor(0, 0), -12.0);
+        assert_eq!(a.cofactor(0, 0), -12.0);
+        assert_eq!(a.minor(1, 0), 25.0);
+        assert_eq!(a.cofactor(1, 0), -25.0);
+    }
+
+    #[test]
+    fn determinant_by_cofactors() {
+        #[rustfmt::skip]
+        let a = Matrix::new(
+            1.0,  2.0, 6.0,  0.0,
+            -5.0, 8.0, -4.0, 0.0,
+            2.0,  6.0, 4.0,  0.0,
+        );
+        assert_eq!(a.cofactor(0, 0), 56.0);
+        assert_eq!(a.cofactor(0, 1), 12.0);
+        assert_eq!(a.cofactor(0, 2), -46.0);
+        assert_eq!(a.determinant(), -196.0);
+    }
+
+    #[test]
+    fn submatrix_of_matrix() {
+        #[rustfmt::skip]
+        let a = Matrix::new(
+            -6.0, 1.0, 1.0,  6.0,
+            -8.0, 5.0, 8.0,  6.0,
+            -1.0, 0.0, 8.0,  2.0,
+        );
+        assert_eq!(
+            a.submatrix(2, 1),
+            Matrix3::new([[-6.0, 1.0, 6.0], [-8.0, 8.0, 6.0], [0.0, 0.0, 1.0]])
+        );
+        assert_eq!(a.submatrix(3, 3), a.linear());
+        assert_eq!(a.submatrix(3, 3).determinant(), a.determinant());
+    }
+
     #[test]
     fn invertible_matrix_determinant() {
         #[rustfmt::skip]
@@ -666,6 +879,171 @@ mod tests {
         assert_eq!(full_quarter * p, Point::new(-1.0, 0.0, 0.0));
     }
 
+    #[test]
+    fn shearing() {
+        let p = Point::new(2.0, 3.0, 4.0);
+        let cases = [
+            (
+                Matrix::shearing(1.0, 0.0, 0.0, 0.0, 0.0, 0.0),
+                Point::new(5.0, 3.0, 4.0),
+            ),
+            (
+                Matrix::shearing(0.0, 1.0, 0.0, 0.0, 0.0, 0.0),
+                Point::new(6.0, 3.0, 4.0),
+            ),
+            (
+                Matrix::shearing(0.0, 0.0, 1.0, 0.0, 0.0, 0.0),
+                Point::new(2.0, 5.0, 4.0),
+            ),
+            (
+                Matrix::shearing(0.0, 0.0, 0.0, 1.0, 0.0, 0.0),
+                Point::new(2.0, 7.0, 4.0),
+            ),
+            (
+                Matrix::shearing(0.0, 0.0, 0.0, 0.0, 1.0, 0.0),
+                Point::new(2.0, 3.0, 6.0),
+            ),
+            (
+                Matrix::shearing(0.0, 0.0, 0.0, 0.0, 0.0, 1.0),
+                Point::new(2.0, 3.0, 7.0),
+            ),
+        ];
+        for &(transform, expected) in cases.iter() {
+            assert_eq!(transform * p, expected);
+        }
+    }
+
+    #[test]
+    fn shearing_composes_in_order() {
+        let p = Point::new(1.0, 1.0, 0.0);
+        let shear_then_scale =
+            Matrix::scaling(2.0, 1.0, 1.0) * Matrix::shearing(1.0, 0.0, 0.0, 0.0, 0.0, 0.0);
+        let scale_then_shear =
+            Matrix::shearing(1.0, 0.0, 0.0, 0.0, 0.0, 0.0) * Matrix::scaling(2.0, 1.0, 1.0);
+        assert_eq!(shear_then_scale * p, Point::new(4.0, 1.0, 0.0));
+        assert_eq!(scale_then_shear * p, Point::new(3.0, 1.0, 0.0));
+        assert_eq!(
+            *Matrix::identity()
+                .shear(1.0, 0.0, 0.0, 0.0, 0.0, 0.0)
+                .scale(2.0, 1.0, 1.0),
+            shear_then_scale
+        );
+    }
+
+    #[test]
+    fn rotation_around_coordinate_axes() {
+        let angle = consts::PI / 3.0;
+        assert_eq!(
+            Matrix::rotation(Vector::new(1.0, 0.0, 0.0), angle),
+            Matrix::rotation_x(angle)
+        );
+        assert_eq!(
+            Matrix::rotation(Vector::new(0.0, 2.0, 0.0), angle),
+            Matrix::rotation_y(angle)
+        );
+        assert_eq!(
+            Matrix::rotation(Vector::new(0.0, 0.0, 1.0), angle),
+            Matrix::rotation_z(angle)
+        );
+    }
+
+    #[test]
+    fn rotation_around_diagonal() {
+        let transform = Matrix::rotation(Vector::new(1.0, 1.0, 1.0), 2.0 * consts::PI / 3.0);
+        assert_eq!(
+            transform * Point::new(1.0, 0.0, 0.0),
+            Point::new(0.0, 1.0, 0.0)
+        );
+        assert_eq!(
+            transform * Vector::new(0.0, 0.0, 1.0),
+            Vector::new(1.0, 0.0, 0.0)
+        );
+    }
+
+    #[test]
+    fn rotation_around_point() {
+        let center = Point::new(1.0, 2.0, 3.0);
+        let transform =
+            Matrix::rotation_around(center, Vector::new(0.0, 0.0, 1.0), consts::PI / 2.0);
+        assert_eq!(transform * center, center);
+        assert_eq!(
+            transform * Point::new(2.0, 2.0, 3.0),
+            Point::new(1.0, 3.0, 3.0)
+        );
+        assert_eq!(
+            transform * Vector::new(1.0, 0.0, 0.0),
+            Vector::new(0.0, 1.0, 0.0)
+        );
+    }
+
+    #[test]
+    fn scaling_about_point() {
+        let center = Point::new(1.0, 1.0, 1.0);
+        let transform = Matrix::scaling_about(center, 2.0, 3.0, 4.0);
+        assert_eq!(transform * center, center);
+        assert_eq!(
+            transform * Point::new(2.0, 2.0, 2.0),
+            Point::new(3.0, 4.0, 5.0)
+        );
+        assert_eq!(transform * Point::zero(), Point::new(-1.0, -2.0, -3.0));
+    }
+
+    #[test]
+    fn fluent_transforms_about_point() {
+        let center = Point::new(0.0, 1.0, 0.0);
+        let axis = Vector::new(1.0, 0.0, 0.0);
+        let expected = Matrix::rotation_around(center, axis, consts::PI / 4.0)
+            * Matrix::scaling_about(center, 2.0, 2.0, 2.0);
+        let mut m = Matrix::identity();
+        m.scale_about(center, 2.0, 2.0, 2.0)
+            .rotate_around(center, axis, consts::PI / 4.0);
+        assert_eq!(m, expected);
+    }
+
+    #[test]
+    fn decompose_translation_rotation_and_scale() {
+        let m = Matrix::translation(1.0, -2.0, 3.0)
+            * Matrix::rotation(Vector::new(1.0, 1.0, 0.0), 0.7)
+            * Matrix::scaling(2.0, 0.5, 3.0);
+        let d = m.decompose();
+        assert_eq!(d.translation, Vector::new(1.0, -2.0, 3.0));
+        assert_eq!(
+            d.rotation.to_matrix(),
+            Matrix::rotation(Vector::new(1.0, 1.0, 0.0), 0.7)
+        );
+        assert_eq!(d.scale, Vector::new(2.0, 0.5, 3.0));
+        assert_eq!(d.to_matrix(), m);
+    }
+
+    #[test]
+    fn decompose_identity() {
+        let d = Matrix::identity().decompose();
+        assert_eq!(d.translation, Vector::zero());
+        assert_eq!(d.rotation, Quaternion::identity());
+        assert_eq!(d.scale, Vector::ones());
+    }
+
+    #[test]
+    fn decompose_reflection() {
+        let m = Matrix::rotation_y(consts::PI / 3.0) * Matrix::scaling(1.0, -2.0, 1.0);
+        let d = m.decompose();
+        assert!(d.scale[0] < 0.0);
+        assert_eq!(d.to_matrix(), m);
+    }
+
+    #[test]
+    fn decompose_drops_shearing() {
+        #[rustfmt::skip]
+        let shear = Matrix::new(
+            1.0, 1.0, 0.0, 0.0,
+            0.0, 1.0, 0.0, 0.0,
+            0.0, 0.0, 1.0, 0.0,
+        );
+        let d = shear.decompose();
+        assert_eq!(d.rotation, Quaternion::identity());
+        assert_ne!(d.to_matrix(), shear);
+    }
+
     #[test]
     fn transformations_in_sequence() {
         let p1 = Point::new(1.0, 0.0, 1.0);
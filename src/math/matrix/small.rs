@@ -0,0 +1,194 @@
+use std::ops::{Index, IndexMut};
+
+use crate::math::EPSILON;
+
+/// a 2-by-2 matrix, which is only used on the way to finding the determinant of a
+/// bigger one.
+#[derive(Copy, Clone, Debug)]
+pub struct Matrix2 {
+    rows: [[f64; 2]; 2],
+}
+
+/// a 3-by-3 matrix, such as the transformation sub-matrix of a `Matrix`.
+#[derive(Copy, Clone, Debug)]
+pub struct Matrix3 {
+    rows: [[f64; 3]; 3],
+}
+
+impl Matrix2 {
+    pub fn new(rows: [[f64; 2]; 2]) -> Matrix2 {
+        Matrix2 { rows }
+    }
+
+    pub fn determinant(&self) -> f64 {
+        self[(0, 0)] * self[(1, 1)] - self[(0, 1)] * self[(1, 0)]
+    }
+}
+
+impl Matrix3 {
+    pub fn new(rows: [[f64; 3]; 3]) -> Matrix3 {
+        Matrix3 { rows }
+    }
+
+    /// the 2-by-2 matrix left over after removing the given row and column.
+    pub fn submatrix(&self, row: usize, column: usize) -> Matrix2 {
+        let mut rows = [[0.0; 2]; 2];
+        for (i, r) in (0..3).filter(|&r| r != row).enumerate() {
+            for (j, c) in (0..3).filter(|&c| c != column).enumerate() {
+                rows[i][j] = self[(r, c)];
+            }
+        }
+        Matrix2::new(rows)
+    }
+
+    /// the determinant of the submatrix without the given row and column.
+    pub fn minor(&self, row: usize, column: usize) -> f64 {
+        self.submatrix(row, column).determinant()
+    }
+
+    /// the minor, negated when the row and column add up to an odd number.
+    pub fn cofactor(&self, row: usize, column: usize) -> f64 {
+        if (row + column) % 2 == 0 {
+            self.minor(row, column)
+        } else {
+            -self.minor(row, column)
+        }
+    }
+
+    /// expands along the first row.
+    pub fn determinant(&self) -> f64 {
+        (0..3).map(|j| self[(0, j)] * self.cofactor(0, j)).sum()
+    }
+}
+
+/* equality operations */
+
+impl PartialEq for Matrix2 {
+    /// test for equality using approximate comparison of floating point numbers, like
+    /// the other matrices.
+    fn eq(&self, other: &Self) -> bool {
+        self.rows
+            .iter()
+            .flatten()
+            .zip(other.rows.iter().flatten())
+            .all(|(a, b)| (a - b).abs() < EPSILON)
+    }
+}
+
+impl PartialEq for Matrix3 {
+    /// test for equality using approximate comparison of floating point numbers, like
+    /// the other matrices.
+    fn eq(&self, other: &Self) -> bool {
+        self.rows
+            .iter()
+            .flatten()
+            .zip(other.rows.iter().flatten())
+            .all(|(a, b)| (a - b).abs() < EPSILON)
+    }
+}
+
+/* indexing operations */
+
+impl Index<(usize, usize)> for Matrix2 {
+    type Output = f64;
+
+    fn index(&self, (i, j): (usize, usize)) -> &f64 {
+        &self.rows[i][j]
+    }
+}
+
+impl IndexMut<(usize, usize)> for Matrix2 {
+    fn index_mut(&mut self, (i, j): (usize, usize)) -> &mut f64 {
+        &mut self.rows[i][j]
+    }
+}
+
+impl Index<(usize, usize)> for Matrix3 {
+    type Output = f64;
+
+    fn index(&self, (i, j): (usize, usize)) -> &f64 {
+        &self.rows[i][j]
+    }
+}
+
+impl IndexMut<(usize, usize)> for Matrix3 {
+    fn index_mut(&mut self, (i, j): (usize, usize)) -> &mut f64 {
+        &mut self.rows[i][j]
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn construct_2x2() {
+        let m = Matrix2::new([[-3.0, 5.0], [1.0, -2.0]]);
+        assert_eq!(m[(0, 0)], -3.0);
+        assert_eq!(m[(0, 1)], 5.0);
+        assert_eq!(m[(1, 0)], 1.0);
+        assert_eq!(m[(1, 1)], -2.0);
+    }
+
+    #[test]
+    fn construct_3x3() {
+        let m = Matrix3::new([[-3.0, 5.0, 0.0], [1.0, -2.0, -7.0], [0.0, 1.0, 1.0]]);
+        assert_eq!(m[(0, 0)], -3.0);
+        assert_eq!(m[(1, 1)], -2.0);
+        assert_eq!(m[(2, 2)], 1.0);
+    }
+
+    #[test]
+    fn approximately_equal() {
+        let a = Matrix2::new([[1.0, 2.0], [3.0, 4.0]]);
+        assert_eq!(a, Matrix2::new([[1.0, 2.0], [3.0, 4.00001]]));
+        assert_ne!(a, Matrix2::new([[1.0, 2.0], [3.0, 4.001]]));
+
+        let b = Matrix3::new([[1.0, 2.0, 3.0], [4.0, 5.0, 6.0], [7.0, 8.0, 9.0]]);
+        assert_eq!(
+            b,
+            Matrix3::new([[1.0, 2.0, 3.0], [4.0, 5.00001, 6.0], [7.0, 8.0, 9.0]])
+        );
+        assert_ne!(
+            b,
+            Matrix3::new([[1.0, 2.0, 3.0], [4.0, 5.001, 6.0], [7.0, 8.0, 9.0]])
+        );
+    }
+
+    #[test]
+    fn determinant_2x2() {
+        let m = Matrix2::new([[1.0, 5.0], [-3.0, 2.0]]);
+        assert_eq!(m.determinant(), 17.0);
+    }
+
+    #[test]
+    fn submatrix_3x3() {
+        let m = Matrix3::new([[1.0, 5.0, 0.0], [-3.0, 2.0, 7.0], [0.0, 6.0, -3.0]]);
+        assert_eq!(m.submatrix(0, 2), Matrix2::new([[-3.0, 2.0], [0.0, 6.0]]));
+    }
+
+    #[test]
+    fn minor_3x3() {
+        let m = Matrix3::new([[3.0, 5.0, 0.0], [2.0, -1.0, -7.0], [6.0, -1.0, 5.0]]);
+        assert_eq!(m.submatrix(1, 0).determinant(), 25.0);
+        assert_eq!(m.minor(1, 0), 25.0);
+    }
+
+    #[test]
+    fn cofactor_3x3() {
+        let m = Matrix3::new([[3.0, 5.0, 0.0], [2.0, -1.0, -7.0], [6.0, -1.0, 5.0]]);
+        assert_eq!(m.minor(0, 0), -12.0);
+        assert_eq!(m.cofactor(0, 0), -12.0);
+        assert_eq!(m.minor(1, 0), 25.0);
+        assert_eq!(m.cofactor(1, 0), -25.0);
+    }
+
+    #[test]
+    fn determinant_3x3() {
+        let m = Matrix3::new([[1.0, 2.0, 6.0], [-5.0, 8.0, -4.0], [2.0, 6.0, 4.0]]);
+        assert_eq!(m.cofactor(0, 0), 56.0);
+        assert_eq!(m.cofactor(0, 1), 12.0);
+        assert_eq!(m.cofactor(0, 2), -46.0);
+        assert_eq!(m.determinant(), -196.0);
+    }
+}
@@ -0,0 +1,245 @@
+use std::ops::Mul;
+
+use super::{matrix::Matrix, vector::Vector, EPSILON};
+
+/// quaternion `w + xi + yj + zk`, stored as its scalar part `w` and its vector part
+/// `v = (x, y, z)`. unit quaternions represent rotations.
+#[derive(Copy, Clone, Debug)]
+pub struct Quaternion {
+    pub w: f64,
+    pub v: Vector,
+}
+
+impl Quaternion {
+    pub fn new(w: f64, v: Vector) -> Quaternion {
+        Quaternion { w, v }
+    }
+
+    /// the quaternion representing no rotation at all.
+    pub fn identity() -> Quaternion {
+        Quaternion::new(1.0, Vector::zero())
+    }
+
+    /// the rotation by `radians` around `axis`, which does not need to be normalized.
+    /// follows the right-hand rule, like `Matrix::rotation`.
+    pub fn from_axis_angle(axis: Vector, radians: f64) -> Quaternion {
+        let half = radians / 2.0;
+        Quaternion::new(half.cos(), axis.normalized() * half.sin())
+    }
+
+    /// finds the unit quaternion representing the rotation in the 3-by-3 transformation
+    /// sub-matrix of `m`, which must be orthonormal with a determinant of 1. the
+    /// translation column is ignored. taken from "foundations of game engine
+    /// development; volume 1: mathematics" by eric lengyel.
+    pub fn from_rotation(m: &Matrix) -> Quaternion {
+        let (m00, m11, m22) = (m[(0, 0)], m[(1, 1)], m[(2, 2)]);
+        let trace = m00 + m11 + m22;
+
+        // choose the largest of the four components to divide by, for stability.
+        if 0.0 < trace {
+            let w = (trace + 1.0).sqrt() * 0.5;
+            let f = 0.25 / w;
+            Quaternion::new(
+                w,
+                Vector::new(
+                    (m[(2, 1)] - m[(1, 2)]) * f,
+                    (m[(0, 2)] - m[(2, 0)]) * f,
+                    (m[(1, 0)] - m[(0, 1)]) * f,
+                ),
+            )
+        } else if m11 < m00 && m22 < m00 {
+            let x = (m00 - m11 - m22 + 1.0).sqrt() * 0.5;
+            let f = 0.25 / x;
+            Quaternion::new(
+                (m[(2, 1)] - m[(1, 2)]) * f,
+                Vector::new(x, (m[(1, 0)] + m[(0, 1)]) * f, (m[(0, 2)] + m[(2, 0)]) * f),
+            )
+        } else if m22 < m11 {
+            let y = (m11 - m00 - m22 + 1.0).sqrt() * 0.5;
+            let f = 0.25 / y;
+            Quaternion::new(
+                (m[(0, 2)] - m[(2, 0)]) * f,
+                Vector::new((m[(1, 0)] + m[(0, 1)]) * f, y, (m[(2, 1)] + m[(1, 2)]) * f),
+            )
+        } else {
+            let z = (m22 - m00 - m11 + 1.0).sqrt() * 0.5;
+            let f = 0.25 / z;
+            Quaternion::new(
+                (m[(1, 0)] - m[(0, 1)]) * f,
+                Vector::new((m[(0, 2)] + m[(2, 0)]) * f, (m[(2, 1)] + m[(1, 2)]) * f, z),
+            )
+        }
+    }
+
+    pub fn dot(&self, other: &Quaternion) -> f64 {
+        self.w * other.w + self.v.dot(&other.v)
+    }
+
+    pub fn magnitude(&self) -> f64 {
+        self.dot(self).sqrt()
+    }
+
+    /// scales the quaternion to a magnitude of 1. rounding errors build up when many
+    /// rotations are multiplied together, so renormalizing now and then keeps the
+    /// product a rotation.
+    pub fn normalized(&self) -> Quaternion {
+        let magnitude = self.magnitude();
+        Quaternion::new(self.w / magnitude, self.v / magnitude)
+    }
+
+    /// for a unit quaternion, the opposite rotation.
+    pub fn conjugate(&self) -> Quaternion {
+        Quaternion::new(self.w, -self.v)
+    }
+
+    /// spherical linear interpolation, which turns from `self` at `t = 0` to `other`
+    /// at `t = 1` at a constant speed, the short way around. both must be unit
+    /// quaternions.
+    pub fn slerp(&self, other: &Quaternion, t: f64) -> Quaternion {
+        // `q` and `-q` are the same rotation, so pick whichever is closer.
+        let mut cos = self.dot(other);
+        let other = if cos < 0.0 {
+            cos = -cos;
+            Quaternion::new(-other.w, -other.v)
+        } else {
+            *other
+        };
+
+        let (a, b) = if 1.0 - cos < EPSILON {
+            // nearly the same rotation, where the sine below vanishes; a straight
+            // line is close enough.
+            (1.0 - t, t)
+        } else {
+            let angle = cos.acos();
+            let sin = angle.sin();
+            (((1.0 - t) * angle).sin() / sin, (t * angle).sin() / sin)
+        };
+
+        Quaternion::new(a * self.w + b * other.w, self.v * a + other.v * b).normalized()
+    }
+
+    /// the rotation matrix represented by this quaternion, which must be a unit quaternion.
+    pub fn to_matrix(&self) -> Matrix {
+        let w = self.w;
+        let (x, y, z) = (self.v[0], self.v[1], self.v[2]);
+
+        #[rustfmt::skip]
+        Matrix::new(
+            1.0 - 2.0 * (y * y + z * z), 2.0 * (x * y - w * z),       2.0 * (x * z + w * y),       0.0,
+            2.0 * (x * y + w * z),       1.0 - 2.0 * (x * x + z * z), 2.0 * (y * z - w * x),       0.0,
+            2.0 * (x * z - w * y),       2.0 * (y * z + w * x),       1.0 - 2.0 * (x * x + y * y), 0.0,
+        )
+    }
+}
+
+/* quaternion-quaternion operations */
+
+impl Mul for Quaternion {
+    type Output = Self;
+
+    /// the hamilton product. as with matrices, `a * b` is the rotation `b` followed by
+    /// the rotation `a`.
+    fn mul(self, other: Self) -> Self::Output {
+        Quaternion::new(
+            self.w * other.w - self.v.dot(&other.v),
+            other.v * self.w + self.v * other.w + self.v.cross(&other.v),
+        )
+    }
+}
+
+/* equality operation */
+
+impl PartialEq for Quaternion {
+    /// test for equality using approximate comparison of floating point numbers. note
+    /// that `q` and `-q` represent the same rotation but are not equal.
+    fn eq(&self, other: &Self) -> bool {
+        (self.w - other.w).abs() < EPSILON && self.v == other.v
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::Point;
+    use std::f64::consts;
+
+    #[test]
+    fn identity_is_no_rotation() {
+        assert_eq!(Quaternion::identity().to_matrix(), Matrix::identity());
+        assert_eq!(
+            Quaternion::from_rotation(&Matrix::identity()),
+            Quaternion::identity()
+        );
+    }
+
+    #[test]
+    fn quarter_turn_around_z() {
+        let half = f64::from(2.0).sqrt() / 2.0;
+        let q = Quaternion::from_rotation(&Matrix::rotation_z(consts::PI / 2.0));
+        assert_eq!(q, Quaternion::new(half, Vector::new(0.0, 0.0, half)));
+        assert_eq!(
+            q.to_matrix() * Point::new(1.0, 0.0, 0.0),
+            Point::new(0.0, 1.0, 0.0)
+        );
+    }
+
+    #[test]
+    fn axis_angle_matches_matrix() {
+        let axis = Vector::new(1.0, -2.0, 0.5);
+        assert_eq!(
+            Quaternion::from_axis_angle(axis, 1.3).to_matrix(),
+            Matrix::rotation(axis, 1.3)
+        );
+    }
+
+    #[test]
+    fn multiplying_composes_rotations() {
+        let a = Quaternion::from_axis_angle(Vector::new(1.0, 0.0, 0.0), 0.7);
+        let b = Quaternion::from_axis_angle(Vector::new(0.0, 1.0, 0.0), -1.1);
+        assert_eq!((a * b).to_matrix(), a.to_matrix() * b.to_matrix());
+        assert_eq!(a * a.conjugate(), Quaternion::identity());
+    }
+
+    #[test]
+    fn normalizing() {
+        let q = Quaternion::new(2.0, Vector::new(0.0, 0.0, 2.0)).normalized();
+        assert!((q.magnitude() - 1.0).abs() < EPSILON);
+    }
+
+    #[test]
+    fn slerp_turns_at_constant_speed() {
+        let axis = Vector::new(0.0, 0.0, 1.0);
+        let from = Quaternion::identity();
+        let to = Quaternion::from_axis_angle(axis, consts::PI / 2.0);
+        assert_eq!(from.slerp(&to, 0.0), from);
+        assert_eq!(from.slerp(&to, 1.0), to);
+        assert_eq!(
+            from.slerp(&to, 0.25),
+            Quaternion::from_axis_angle(axis, consts::PI / 8.0)
+        );
+    }
+
+    #[test]
+    fn slerp_takes_short_way_around() {
+        let axis = Vector::new(0.0, 1.0, 0.0);
+        let from = Quaternion::from_axis_angle(axis, 0.1);
+        let to = Quaternion::from_axis_angle(axis, -0.1);
+        let negated = Quaternion::new(-to.w, -to.v);
+        assert_eq!(from.slerp(&negated, 0.5), Quaternion::identity());
+    }
+
+    #[test]
+    fn rotation_round_trip() {
+        // includes half turns, which have a trace of -1 and take the other branches.
+        let rotations = [
+            Matrix::rotation_x(consts::PI),
+            Matrix::rotation_y(consts::PI),
+            Matrix::rotation_z(consts::PI),
+            Matrix::rotation_x(0.3) * Matrix::rotation_y(-1.2) * Matrix::rotation_z(2.5),
+            Matrix::rotation(Vector::new(1.0, -2.0, 0.5), 3.0),
+        ];
+        for m in rotations.iter() {
+            assert_eq!(Quaternion::from_rotation(m).to_matrix(), *m);
+        }
+    }
+}
@@ -0,0 +1,195 @@
+/// the real roots of `a x^2 + b x + c`, in increasing order. a repeated root is given
+/// once for each time it is repeated. if `a` is 0 this is a line, with at most one root.
+pub fn quadratic(a: f64, b: f64, c: f64) -> Vec<f64> {
+    if a == 0.0 {
+        return if b == 0.0 { vec![] } else { vec![-c / b] };
+    }
+
+    let discriminant = b * b - 4.0 * a * c;
+    if discriminant < 0.0 {
+        return vec![];
+    }
+
+    // the usual formula subtracts nearly equal numbers for one of the roots when
+    // `4 a c` is small, so that root is found from the other instead.
+    let q = -0.5 * (b + b.signum() * discriminant.sqrt());
+    if q == 0.0 {
+        return vec![0.0, 0.0];
+    }
+
+    let mut roots = vec![q / a, c / q];
+    roots.sort_by(|x, y| x.total_cmp(y));
+    roots
+}
+
+/// the roots of `a x^3 + b x^2 + c x + d`, which has at least one if `a` is not 0.
+pub fn cubic(a: f64, b: f64, c: f64, d: f64) -> Vec<f64> {
+    if a == 0.0 {
+        return quadratic(b, c, d);
+    }
+
+    // substituting `x = y - b / 3` leaves `y^3 + p y + q`.
+    let (b, c, d) = (b / a, c / a, d / a);
+    let shift = b / 3.0;
+    let p = c - b * shift;
+    let q = 2.0 * shift * shift * shift - shift * c + d;
+
+    let mut roots = if p == 0.0 && q == 0.0 {
+        vec![0.0; 3]
+    } else {
+        let discriminant = (q / 2.0).powi(2) + (p / 3.0).powi(3);
+        if discriminant > 0.0 {
+            // one real root, by cardano's formula.
+            let root = discriminant.sqrt();
+            vec![(-q / 2.0 + root).cbrt() + (-q / 2.0 - root).cbrt()]
+        } else {
+            // three real roots, by the trigonometric method, which never needs the
+            // square root of a negative number.
+            let m = 2.0 * (-p / 3.0).sqrt();
+            let angle = ((3.0 * q) / (p * m)).max(-1.0).min(1.0).acos() / 3.0;
+            (0..3)
+                .map(|k| m * (angle - 2.0 * std::f64::consts::PI * k as f64 / 3.0).cos())
+                .collect()
+        }
+    };
+
+    for root in roots.iter_mut() {
+        *root = polish(&[1.0, b, c, d], *root - shift);
+    }
+    roots.sort_by(|x, y| x.total_cmp(y));
+    roots
+}
+
+/// the roots of `a x^4 + b x^3 + c x^2 + d x + e`, by ferrari's method: the quartic
+/// is split into two quadratics with the help of a root of a cubic. where the quartic
+/// only touches zero, as it does where a ray grazes a torus, rounding may lose the
+/// (repeated) roots or split them in two.
+pub fn quartic(a: f64, b: f64, c: f64, d: f64, e: f64) -> Vec<f64> {
+    if a == 0.0 {
+        return cubic(b, c, d, e);
+    }
+
+    // substituting `x = y - b / 4` leaves `y^4 + p y^2 + q y + r`.
+    let (b, c, d, e) = (b / a, c / a, d / a, e / a);
+    let shift = b / 4.0;
+    let p = c - 6.0 * shift * shift;
+    let q = d - 2.0 * c * shift + 8.0 * shift * shift * shift;
+    let r = e - d * shift + c * shift * shift - 3.0 * shift.powi(4);
+
+    let mut roots = if q.abs() < 1e-12 * (1.0 + p.abs() + r.abs()) {
+        // a quadratic in `y^2`.
+        quadratic(1.0, p, r)
+            .into_iter()
+            .filter(|&y2| y2 >= 0.0)
+            .flat_map(|y2| vec![-y2.sqrt(), y2.sqrt()])
+            .collect()
+    } else {
+        // `y^4 + p y^2 + q y + r` is `(y^2 + z/2 + p/2)^2 - z (y - q / 2z)^2`, with
+        // `z` any positive root of the resolvent cubic, so it is the product of two
+        // quadratics.
+        let z = cubic(1.0, 2.0 * p, p * p - 4.0 * r, -q * q)
+            .into_iter()
+            .fold(0.0, f64::max);
+        if z <= 0.0 {
+            return vec![];
+        }
+        let s = z.sqrt();
+        let mut roots = quadratic(1.0, s, (p + z) / 2.0 - q / (2.0 * s));
+        roots.extend(quadratic(1.0, -s, (p + z) / 2.0 + q / (2.0 * s)));
+        roots
+    };
+
+    for root in roots.iter_mut() {
+        *root = polish(&[1.0, b, c, d, e], *root - shift);
+    }
+    roots.sort_by(|x, y| x.total_cmp(y));
+    roots
+}
+
+/// the value of the polynomial with the given coefficients (highest power first) at
+/// `x`, and its slope there.
+fn evaluate(coefficients: &[f64], x: f64) -> (f64, f64) {
+    coefficients.iter().fold((0.0, 0.0), |(value, slope), &k| {
+        (value * x + k, slope * x + value)
+    })
+}
+
+/// moves `root` closer to a root of the polynomial by a few steps of newton's method,
+/// unless a step would make it worse (which happens near a repeated root).
+fn polish(coefficients: &[f64], mut root: f64) -> f64 {
+    for _ in 0..4 {
+        let (value, slope) = evaluate(coefficients, root);
+        if value == 0.0 || slope == 0.0 {
+            break;
+        }
+        let next = root - value / slope;
+        if evaluate(coefficients, next).0.abs() >= value.abs() {
+            break;
+        }
+        root = next;
+    }
+    root
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn assert_roots(actual: Vec<f64>, expected: &[f64]) {
+        assert_eq!(actual.len(), expected.len(), "{:?}", actual);
+        for (a, e) in actual.iter().zip(expected) {
+            assert!((a - e).abs() < 1e-9, "{:?} != {:?}", actual, expected);
+        }
+    }
+
+    #[test]
+    fn quadratic_roots() {
+        assert_roots(quadratic(1.0, -3.0, 2.0), &[1.0, 2.0]);
+        assert_roots(quadratic(1.0, 0.0, 1.0), &[]);
+        assert_roots(quadratic(0.0, 2.0, -4.0), &[2.0]);
+        // `4 a c` is tiny next to `b^2`, which loses the small root to rounding in the
+        // usual formula.
+        assert_roots(quadratic(1.0, -1e8, 1.0), &[1e-8, 1e8]);
+    }
+
+    #[test]
+    fn cubic_roots() {
+        // (x - 1)(x - 2)(x - 3)
+        assert_roots(cubic(1.0, -6.0, 11.0, -6.0), &[1.0, 2.0, 3.0]);
+        // (x - 2)(x^2 + 1)
+        assert_roots(cubic(2.0, -4.0, 2.0, -4.0), &[2.0]);
+        assert_roots(cubic(1.0, 0.0, 0.0, 0.0), &[0.0, 0.0, 0.0]);
+    }
+
+    #[test]
+    fn quartic_roots() {
+        // (x - 1)(x - 2)(x - 3)(x - 4)
+        assert_roots(
+            quartic(1.0, -10.0, 35.0, -50.0, 24.0),
+            &[1.0, 2.0, 3.0, 4.0],
+        );
+        // (x^2 - 4)(x^2 - 9), which has no cubic or linear terms.
+        assert_roots(quartic(1.0, 0.0, -13.0, 0.0, 36.0), &[-3.0, -2.0, 2.0, 3.0]);
+        // (x - 1)(x + 2)(x^2 + 1)
+        assert_roots(quartic(1.0, 1.0, -1.0, 1.0, -2.0), &[-2.0, 1.0]);
+        assert_roots(quartic(1.0, 0.0, 1.0, 0.0, 1.0), &[]);
+    }
+
+    #[test]
+    fn quartic_roots_far_apart() {
+        // (x - 0.001)(x - 1)(x - 10)(x - 1000)
+        let roots = [0.001, 1.0, 10.0, 1000.0];
+        let (a, b, c, d) = (roots[0], roots[1], roots[2], roots[3]);
+        let actual = quartic(
+            1.0,
+            -(a + b + c + d),
+            a * b + a * c + a * d + b * c + b * d + c * d,
+            -(a * b * c + a * b * d + a * c * d + b * c * d),
+            a * b * c * d,
+        );
+        assert_eq!(actual.len(), 4);
+        for (actual, expected) in actual.iter().zip(&roots) {
+            assert!((actual - expected).abs() < 1e-6 * expected.max(1.0));
+        }
+    }
+}
@@ -33,6 +33,17 @@ impl Vector {
         self / self.magnitude()
     }
 
+    /// like `normalized`, but returns `None` instead of a vector of nans when this
+    /// vector has no length (or is not finite) and so has no direction.
+    pub fn try_normalized(self) -> Option<Vector> {
+        let magnitude = self.magnitude();
+        if magnitude.is_finite() && EPSILON < magnitude {
+            Some(self / magnitude)
+        } else {
+            None
+        }
+    }
+
     pub fn normalize(&mut self) -> &mut Vector {
         *self = self.normalized();
         self
@@ -163,6 +174,16 @@ impl SubAssign for Vector {
 mod tests {
     use super::*;
 
+    #[test]
+    fn checked_normalization() {
+        assert_eq!(
+            Vector::new(0.0, 3.0, 4.0).try_normalized(),
+            Some(Vector::new(0.0, 0.6, 0.8))
+        );
+        assert_eq!(Vector::zero().try_normalized(), None);
+        assert_eq!(Vector::new(f64::NAN, 1.0, 0.0).try_normalized(), None);
+    }
+
     #[test]
     fn add_two_vectors() {
         let a1 = Vector::new(3.0, -2.0, 5.0);
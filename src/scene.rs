@@ -0,0 +1,405 @@
+pub mod expression;
+
+pub mod file;
+pub use file::{load, load_with, marshal, SceneFile, Shapes};
+
+pub mod manifest;
+pub use manifest::Manifest;
+
+pub mod presets;
+
+pub mod random;
+pub use random::RandomScene;
+
+pub mod yaml;
+
+use crate::{
+    math::{
+        geometry::{Billboard, Group, Heightfield, Metaballs, Sdf, Tube},
+        Form, Geometry, Matrix, Point, Transformable, Visibility,
+    },
+    world::{light, Background, Color, Light, Material, Texture, World},
+};
+
+/// a fluent builder for worlds, so that scenes can be described programmatically
+/// (object by object, in a similar manner to a scene file) without assembling
+/// transformation matrices by hand.
+#[derive(Default)]
+pub struct Scene {
+    objects: Vec<Geometry>,
+    lights: Vec<Light>,
+    background: Background,
+}
+
+impl Scene {
+    pub fn new() -> Scene {
+        Scene::default()
+    }
+
+    /// starts describing a unit sphere centered at the origin.
+    pub fn sphere(self) -> Object {
+        Object::new(self, Form::Sphere)
+    }
+
+    /// starts describing the xz plane.
+    pub fn plane(self) -> Object {
+        Object::new(self, Form::Plane)
+    }
+
+    /// starts describing a disk of the given radius, centered at the origin in the
+    /// xz plane.
+    pub fn disk(self, radius: f64) -> Object {
+        Object::new(self, Form::Disk { radius })
+    }
+
+    /// starts describing a rectangle centered at the origin in the xz plane, which
+    /// is `width` long along the x axis and `depth` long along the z axis.
+    pub fn quad(self, width: f64, depth: f64) -> Object {
+        Object::new(self, Form::Quad { width, depth })
+    }
+
+    /// starts describing a cube from -1 to 1 along each axis, with its edges rounded
+    /// off to the given radius.
+    pub fn rounded_box(self, radius: f64) -> Object {
+        Object::new(self, Form::RoundedBox { radius })
+    }
+
+    /// starts describing a terrain over the square from 0 to 1 along the x and z axes.
+    pub fn heightfield(self, heightfield: Heightfield) -> Object {
+        Object::new(self, Form::Heightfield(heightfield))
+    }
+
+    /// starts describing a surface given by a signed distance function.
+    pub fn sdf(self, sdf: Sdf) -> Object {
+        Object::new(self, Form::Sdf(sdf))
+    }
+
+    /// starts describing a set of spheres which blend smoothly into each other.
+    pub fn metaballs(self, metaballs: Metaballs) -> Object {
+        Object::new(self, Form::Metaballs(metaballs))
+    }
+
+    /// starts describing a tube swept along a line through a list of points.
+    pub fn tube(self, tube: Tube) -> Object {
+        Object::new(self, Form::Tube(tube))
+    }
+
+    /// starts describing a ring around the y axis, centered at the origin, whose tube
+    /// of radius `minor` runs around a circle of radius `major`.
+    pub fn torus(self, major: f64, minor: f64) -> Object {
+        Object::new(self, Form::Torus { major, minor })
+    }
+
+    /// starts describing a billboard, which is textured with its own sprite.
+    pub fn billboard(self, billboard: Billboard) -> Object {
+        let sprite = billboard.sprite.clone();
+        Object::new(self, Form::Billboard(billboard))
+            .material(Material::default().with_texture(Texture::image(sprite)))
+    }
+
+    /// starts describing a group of the objects in `children`, which are moved
+    /// together. the lights and background of `children` are ignored.
+    pub fn group(self, children: Scene) -> Object {
+        Object::new(self, Form::Group(Group::new(children.objects)))
+    }
+
+    /// adds a point light.
+    pub fn light(mut self, position: Point, color: Color) -> Scene {
+        self.lights
+            .push(Light::point(light::Point::new(position, color)));
+        self
+    }
+
+    /// adds an object which has already been fully described.
+    pub fn object(mut self, object: Geometry) -> Scene {
+        self.objects.push(object);
+        self
+    }
+
+    /// sets what is seen where rays do not hit anything, which is black otherwise.
+    pub fn background(self, background: Background) -> Scene {
+        Scene { background, ..self }
+    }
+
+    pub fn build(self) -> World {
+        let mut world = World::new(self.objects, self.lights);
+        world.background = self.background;
+        world
+    }
+}
+
+/// an object which is being described as part of a scene. scaling, rotation, and
+/// shearing are applied in the order that they are given, and then the object is
+/// moved to the position given by `at`, no matter when `at` was called.
+pub struct Object {
+    scene: Scene,
+    form: Form,
+    material: Material,
+    visibility: Visibility,
+    name: Option<String>,
+    transform: Matrix,
+    position: Point,
+}
+
+impl Object {
+    fn new(scene: Scene, form: Form) -> Object {
+        Object {
+            scene,
+            form,
+            material: Material::default(),
+            visibility: Visibility::default(),
+            name: None,
+            transform: Matrix::identity(),
+            position: Point::zero(),
+        }
+    }
+
+    pub fn at(self, x: f64, y: f64, z: f64) -> Object {
+        Object {
+            position: Point::new(x, y, z),
+            ..self
+        }
+    }
+
+    /// scales the object uniformly.
+    pub fn scale(self, factor: f64) -> Object {
+        self.scale_by(factor, factor, factor)
+    }
+
+    pub fn scale_by(mut self, x: f64, y: f64, z: f64) -> Object {
+        self.transform.scale(x, y, z);
+        self
+    }
+
+    pub fn rotate_x(mut self, radians: f64) -> Object {
+        self.transform.rotate_x(radians);
+        self
+    }
+
+    pub fn rotate_y(mut self, radians: f64) -> Object {
+        self.transform.rotate_y(radians);
+        self
+    }
+
+    pub fn rotate_z(mut self, radians: f64) -> Object {
+        self.transform.rotate_z(radians);
+        self
+    }
+
+    /// skews the object, moving each component of its points in proportion to the
+    /// other two; see `Matrix::shearing`.
+    pub fn shear(mut self, xy: f64, xz: f64, yx: f64, yz: f64, zx: f64, zy: f64) -> Object {
+        self.transform.shear(xy, xz, yx, yz, zx, zy);
+        self
+    }
+
+    /// applies an arbitrary transformation after those which have already been given.
+    pub fn transform(self, transform: Matrix) -> Object {
+        Object {
+            transform: transform * self.transform,
+            ..self
+        }
+    }
+
+    pub fn material(self, material: Material) -> Object {
+        Object { material, ..self }
+    }
+
+    /// chooses which kinds of rays can see the object.
+    pub fn visibility(self, visibility: Visibility) -> Object {
+        Object { visibility, ..self }
+    }
+
+    /// names the object, so that it can be found in the world with `World::find`.
+    pub fn name(self, name: &str) -> Object {
+        Object {
+            name: Some(name.to_string()),
+            ..self
+        }
+    }
+
+    /// finishes describing this object.
+    pub fn done(self) -> Scene {
+        let mut geometry = Geometry::default()
+            .with_form(self.form)
+            .with_material(self.material)
+            .with_visibility(self.visibility)
+            .transformed(
+                Matrix::translation(self.position[0], self.position[1], self.position[2])
+                    * self.transform,
+            );
+        if let Some(name) = &self.name {
+            geometry = geometry.with_name(name);
+        }
+        self.scene.object(geometry)
+    }
+
+    /// finishes describing this object, and starts describing a sphere.
+    pub fn sphere(self) -> Object {
+        self.done().sphere()
+    }
+
+    /// finishes describing this object, and starts describing a plane.
+    pub fn plane(self) -> Object {
+        self.done().plane()
+    }
+
+    /// finishes describing this object, and starts describing a disk.
+    pub fn disk(self, radius: f64) -> Object {
+        self.done().disk(radius)
+    }
+
+    /// finishes describing this object, and starts describing a rectangle.
+    pub fn quad(self, width: f64, depth: f64) -> Object {
+        self.done().quad(width, depth)
+    }
+
+    /// finishes describing this object, and starts describing a rounded box.
+    pub fn rounded_box(self, radius: f64) -> Object {
+        self.done().rounded_box(radius)
+    }
+
+    /// finishes describing this object, and starts describing a terrain.
+    pub fn heightfield(self, heightfield: Heightfield) -> Object {
+        self.done().heightfield(heightfield)
+    }
+
+    /// finishes describing this object, and starts describing a distance function.
+    pub fn sdf(self, sdf: Sdf) -> Object {
+        self.done().sdf(sdf)
+    }
+
+    /// finishes describing this object, and starts describing a set of metaballs.
+    pub fn metaballs(self, metaballs: Metaballs) -> Object {
+        self.done().metaballs(metaballs)
+    }
+
+    /// finishes describing this object, and starts describing a tube.
+    pub fn tube(self, tube: Tube) -> Object {
+        self.done().tube(tube)
+    }
+
+    /// finishes describing this object, and starts describing a torus.
+    pub fn torus(self, major: f64, minor: f64) -> Object {
+        self.done().torus(major, minor)
+    }
+
+    /// finishes describing this object, and starts describing a billboard.
+    pub fn billboard(self, billboard: Billboard) -> Object {
+        self.done().billboard(billboard)
+    }
+
+    /// finishes describing this object, and starts describing a group.
+    pub fn group(self, children: Scene) -> Object {
+        self.done().group(children)
+    }
+
+    /// finishes describing this object, and adds a point light.
+    pub fn light(self, position: Point, color: Color) -> Scene {
+        self.done().light(position, color)
+    }
+
+    /// finishes describing this object, and sets the background.
+    pub fn background(self, background: Background) -> Scene {
+        self.done().background(background)
+    }
+
+    /// finishes describing this object, and builds the world.
+    pub fn build(self) -> World {
+        self.done().build()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::f64::consts;
+
+    #[test]
+    fn empty_scene() {
+        let w = Scene::new().build();
+        assert!(w.objects.is_empty());
+        assert!(w.lights.is_empty());
+    }
+
+    #[test]
+    fn scene_with_background() {
+        let sky = Background::solid(Color::new(0.2, 0.4, 0.8));
+        let w = Scene::new().sphere().background(sky).build();
+        assert_eq!(w.objects.len(), 1);
+        assert_eq!(w.background, sky);
+    }
+
+    #[test]
+    fn build_default_world() {
+        let w = Scene::new()
+            .light(Point::new(-10.0, 10.0, -10.0), Color::new(1.0, 1.0, 1.0))
+            .sphere()
+            .material(Material {
+                diffuse: 0.7,
+                specular: 0.2,
+                ..presets::matte(Color::new(0.8, 1.0, 0.6))
+            })
+            .sphere()
+            .scale(0.5)
+            .build();
+        let expected = World::default();
+        assert_eq!(w.objects, expected.objects);
+        assert_eq!(w.lights, expected.lights);
+    }
+
+    #[test]
+    fn scene_with_group() {
+        let w = Scene::new()
+            .group(Scene::new().sphere().at(1.0, 0.0, 0.0).plane().done())
+            .at(0.0, 2.0, 0.0)
+            .name("pair")
+            .build();
+        assert_eq!(w.objects.len(), 1);
+        assert_eq!(w.find("pair"), Some(0));
+        assert_eq!(w.objects[0].transform, Matrix::translation(0.0, 2.0, 0.0));
+        match w.objects[0].form {
+            Form::Group(ref group) => assert_eq!(group.children().len(), 2),
+            _ => panic!("expected a group"),
+        }
+    }
+
+    #[test]
+    fn position_is_applied_last() {
+        let w = Scene::new()
+            .sphere()
+            .at(0.0, 1.0, 0.0)
+            .scale(2.0)
+            .rotate_y(consts::PI / 2.0)
+            .build();
+        let expected = *Matrix::identity()
+            .scale(2.0, 2.0, 2.0)
+            .rotate_y(consts::PI / 2.0)
+            .translate(0.0, 1.0, 0.0);
+        assert_eq!(w.objects[0].transform, expected);
+        assert_eq!(w.objects[0].form, Form::Sphere);
+    }
+
+    #[test]
+    fn objects_are_added_in_order() {
+        let w = Scene::new()
+            .plane()
+            .sphere()
+            .disk(2.0)
+            .quad(1.0, 3.0)
+            .build();
+        let forms: Vec<Form> = w.objects.iter().map(|object| object.form.clone()).collect();
+        assert_eq!(
+            forms,
+            vec![
+                Form::Plane,
+                Form::Sphere,
+                Form::Disk { radius: 2.0 },
+                Form::Quad {
+                    width: 1.0,
+                    depth: 3.0
+                }
+            ]
+        );
+    }
+}
@@ -0,0 +1,203 @@
+use std::{
+    collections::BTreeMap,
+    error,
+    f64::consts,
+    fmt::{self, Display, Formatter},
+    iter::Peekable,
+    str::Chars,
+};
+
+/// returned when an expression cannot be evaluated.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ExpressionError(String);
+
+impl Display for ExpressionError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(f, "{}", self.0)
+    }
+}
+
+impl error::Error for ExpressionError {}
+
+/// the names which always stand for the same number, and so cannot be defined.
+pub const CONSTANTS: [(&str, f64); 2] = [("pi", consts::PI), ("tau", consts::TAU)];
+
+/// evaluates simple arithmetic, such as `pi / 3` or `-(base + 1) * 2`: numbers, the
+/// `CONSTANTS`, and the names in `variables` can be added, subtracted, multiplied,
+/// divided, negated, and grouped with parentheses. names are made of letters, digits,
+/// and underscores, and do not start with a digit.
+pub fn evaluate(text: &str, variables: &BTreeMap<String, f64>) -> Result<f64, ExpressionError> {
+    let mut parser = Parser {
+        chars: text.chars().peekable(),
+        variables,
+    };
+
+    let value = parser.sum()?;
+    match parser.next() {
+        None => Ok(value),
+        Some(c) => Err(ExpressionError(format!("unexpected \"{}\"", c))),
+    }
+}
+
+struct Parser<'a> {
+    chars: Peekable<Chars<'a>>,
+    variables: &'a BTreeMap<String, f64>,
+}
+
+impl Parser<'_> {
+    /// the next character which is not whitespace, without consuming it.
+    fn peek(&mut self) -> Option<char> {
+        while let Some(c) = self.chars.peek() {
+            if !c.is_whitespace() {
+                return Some(*c);
+            }
+            self.chars.next();
+        }
+        None
+    }
+
+    fn next(&mut self) -> Option<char> {
+        self.peek()?;
+        self.chars.next()
+    }
+
+    fn sum(&mut self) -> Result<f64, ExpressionError> {
+        let mut value = self.product()?;
+        while let Some(c @ ('+' | '-')) = self.peek() {
+            self.chars.next();
+            let rhs = self.product()?;
+            value = if c == '+' { value + rhs } else { value - rhs };
+        }
+        Ok(value)
+    }
+
+    fn product(&mut self) -> Result<f64, ExpressionError> {
+        let mut value = self.unary()?;
+        while let Some(c @ ('*' | '/')) = self.peek() {
+            self.chars.next();
+            let rhs = self.unary()?;
+            value = if c == '*' { value * rhs } else { value / rhs };
+        }
+        Ok(value)
+    }
+
+    fn unary(&mut self) -> Result<f64, ExpressionError> {
+        match self.peek() {
+            Some('-') => {
+                self.chars.next();
+                Ok(-self.unary()?)
+            }
+            Some('+') => {
+                self.chars.next();
+                self.unary()
+            }
+            _ => self.atom(),
+        }
+    }
+
+    fn atom(&mut self) -> Result<f64, ExpressionError> {
+        match self.peek() {
+            Some('(') => {
+                self.chars.next();
+                let value = self.sum()?;
+                match self.next() {
+                    Some(')') => Ok(value),
+                    _ => Err(ExpressionError("missing \")\"".to_string())),
+                }
+            }
+            Some(c) if c.is_ascii_digit() || c == '.' => self.number(),
+            Some(c) if c.is_alphabetic() || c == '_' => self.name(),
+            Some(c) => Err(ExpressionError(format!("unexpected \"{}\"", c))),
+            None => Err(ExpressionError("expected a number".to_string())),
+        }
+    }
+
+    fn number(&mut self) -> Result<f64, ExpressionError> {
+        let mut text = self.take_while(|c| c.is_ascii_digit() || c == '.');
+
+        // an exponent, as in `1.5e-3`.
+        if let Some('e' | 'E') = self.chars.peek() {
+            let mut rest = self.chars.clone();
+            text.push(rest.next().unwrap());
+            if let Some(sign @ ('+' | '-')) = rest.peek() {
+                text.push(*sign);
+                rest.next();
+            }
+            if rest.peek().map_or(false, char::is_ascii_digit) {
+                self.chars = rest;
+                text.push_str(&self.take_while(|c| c.is_ascii_digit()));
+            } else {
+                return Err(ExpressionError(format!("invalid number \"{}\"", text)));
+            }
+        }
+
+        text.parse()
+            .map_err(|_| ExpressionError(format!("invalid number \"{}\"", text)))
+    }
+
+    fn name(&mut self) -> Result<f64, ExpressionError> {
+        let name = self.take_while(|c| c.is_alphanumeric() || c == '_');
+
+        CONSTANTS
+            .iter()
+            .find(|(constant, _)| *constant == name)
+            .map(|(_, value)| *value)
+            .or_else(|| self.variables.get(&name).copied())
+            .ok_or_else(|| ExpressionError(format!("unknown name \"{}\"", name)))
+    }
+
+    fn take_while<F: Fn(char) -> bool>(&mut self, predicate: F) -> String {
+        let mut text = String::new();
+        while let Some(&c) = self.chars.peek() {
+            if !predicate(c) {
+                break;
+            }
+            text.push(c);
+            self.chars.next();
+        }
+        text
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn eval(text: &str) -> Result<f64, ExpressionError> {
+        let mut variables = BTreeMap::new();
+        variables.insert("base".to_string(), 4.0);
+        variables.insert("half_base".to_string(), 2.0);
+        evaluate(text, &variables)
+    }
+
+    #[test]
+    fn evaluating_arithmetic() {
+        assert_eq!(eval("1.5"), Ok(1.5));
+        assert_eq!(eval("2.5e-1"), Ok(0.25));
+        assert_eq!(eval("1 + 2 * 3"), Ok(7.0));
+        assert_eq!(eval("(1 + 2) * 3"), Ok(9.0));
+        assert_eq!(eval("8 / 4 / 2"), Ok(1.0));
+        assert_eq!(eval("10 - 4 - 3"), Ok(3.0));
+        assert_eq!(eval("--2"), Ok(2.0));
+        assert_eq!(eval("-(1 + 1) * +3"), Ok(-6.0));
+    }
+
+    #[test]
+    fn evaluating_names() {
+        assert_eq!(eval("pi/3"), Ok(consts::PI / 3.0));
+        assert_eq!(eval("tau"), Ok(2.0 * consts::PI));
+        assert_eq!(eval("base*2 - half_base"), Ok(6.0));
+    }
+
+    #[test]
+    fn invalid_expressions() {
+        let error = |message: &str| Err(ExpressionError(message.to_string()));
+        assert_eq!(eval("height * 2"), error("unknown name \"height\""));
+        assert_eq!(eval("(1 + 2"), error("missing \")\""));
+        assert_eq!(eval("1 +"), error("expected a number"));
+        assert_eq!(eval("1 2"), error("unexpected \"2\""));
+        assert_eq!(eval("1e"), error("invalid number \"1e\""));
+        assert_eq!(eval("1.2.3"), error("invalid number \"1.2.3\""));
+        assert_eq!(eval("2 % 3"), error("unexpected \"%\""));
+    }
+}
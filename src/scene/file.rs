@@ -0,0 +1,2017 @@
+use std::{
+    collections::BTreeMap,
+    error,
+    fmt::{self, Display, Formatter},
+};
+
+use crate::{
+    math::{
+        geometry::{Group, Heightfield, Metaballs, Tube},
+        Form, Geometry, Matrix, Point, Transformable, Vector, Visibility,
+    },
+    scene::{
+        expression,
+        yaml::{self, Value},
+    },
+    world::{
+        background::Sky,
+        camera::Exposure,
+        light::{self, Falloff},
+        material::Anisotropy,
+        pattern::{Gradient, Grid, Ring, Stripe},
+        Animation, Background, Camera, Clip, Coat, Color, Light, Material, Pattern, Quality,
+        Texture, World,
+    },
+};
+
+/// the ways in which loading a scene file can fail.
+#[derive(Clone, Debug, PartialEq)]
+pub enum Error {
+    /// the file is not valid yaml.
+    Parse(yaml::ParseError),
+    /// the file is valid yaml, but does not describe a valid scene.
+    Invalid(String),
+    /// the file does not contain a camera.
+    MissingCamera,
+}
+
+impl Display for Error {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        match self {
+            Error::Parse(e) => write!(f, "{}", e),
+            Error::Invalid(message) => write!(f, "{}", message),
+            Error::MissingCamera => write!(f, "scene does not contain a camera"),
+        }
+    }
+}
+
+impl error::Error for Error {}
+
+impl From<yaml::ParseError> for Error {
+    fn from(e: yaml::ParseError) -> Error {
+        Error::Parse(e)
+    }
+}
+
+fn invalid<S: ToString>(message: S) -> Error {
+    Error::Invalid(message.to_string())
+}
+
+/// the contents of a scene file.
+pub struct SceneFile {
+    pub world: World,
+    pub camera: Camera,
+    /// the objects which move, as their index in `world.objects` and their animation.
+    pub animations: Vec<(usize, Animation)>,
+    /// the quality preset that the scene asks to be rendered at, if any, which has
+    /// already been applied to the world and camera; see `Quality::apply`.
+    pub quality: Option<Quality>,
+}
+
+impl SceneFile {
+    /// moves each animated object to where it is at `time`.
+    pub fn animate(&mut self, time: f64) {
+        for (object, animation) in self.animations.iter() {
+            self.world
+                .transform_object(*object, animation.transform_at(time));
+        }
+    }
+}
+
+/// loads a scene described in the yaml format from "the ray tracer challenge".
+/// the file is a sequence of items, each of which adds a camera, a light, or an object:
+///
+/// ```yaml
+/// - add: camera
+///   width: 100
+///   height: 50
+///   field-of-view: 1.0472
+///   from: [ 0, 1.5, -5 ]
+///   to: [ 0, 1, 0 ]
+///   up: [ 0, 1, 0 ]
+///
+/// - add: light
+///   at: [ -10, 10, -10 ]
+///   intensity: [ 1, 1, 1 ]
+///
+/// - add: sphere
+///   material:
+///     color: [ 1, 0.2, 1 ]
+///   transform:
+///     - [ scale, 0.5, 0.5, 0.5 ]
+///     - [ translate, 0, 1, 0 ]
+/// ```
+///
+/// a camera can also take the number of `samples` along each axis of a pixel, and an
+/// `exposure` with a `shutter` of `[ open, close ]` times, an `iso`, and a
+/// `compensation` in stops; see `Exposure`.
+/// besides spheres and planes, the objects can be a `disk` with a `radius`, or a `quad`
+/// with a `width` and `depth`; both lie flat in the xz plane like a plane does. a
+/// `rounded-box` is a cube from -1 to 1 with its edges rounded off to a `radius`, and a
+/// `heightfield` is a terrain over the square from 0 to 1 in the xz plane, whose
+/// `heights` are given as a list of rows running along z, each running along x.
+/// `metaballs` list their `balls` as `[ x, y, z, blend-radius ]`, and blend together
+/// wherever their combined field is above a `threshold`. a `tube` runs through a list
+/// of `points`, with one of its `radii` for each segment between them. a `torus` is a
+/// ring around the y axis, with a `major-radius` from its center to the middle of its
+/// tube and a `minor-radius` for the tube itself. a `group` holds
+/// a list of other objects as its `children`, which are placed by their own transforms
+/// and then moved together by the group's; the children keep their own materials.
+/// a group with many children renders faster when given a `divide` threshold, which
+/// sorts its children into smaller groups (see `Group::divided`).
+/// any object can be given a `name`, by which it can be found with `World::find`.
+/// an object can also be copied many times over with `repeat`, such as
+/// `repeat: { count: 5, offset: [ 2, 0, 0 ] }` for a row of five, or a list of such
+/// repetitions for a grid. a `rotate` of `[ x, y, z ]` radians turns each copy
+/// further than the one before, about the origin, after it is moved by the `offset`.
+/// the copies of a named object are named after it, as `name-0`, `name-1`, and so on.
+/// transformations are applied in the order that they are listed; besides `translate`,
+/// `scale`, and `rotate-x`, `-y`, and `-z`, a `shear` takes the six proportions `xy`,
+/// `xz`, `yx`, `yz`, `zx`, and `zy` (see `Matrix::shearing`). instead of a transform,
+/// an object can `animate` through a list of keyframes, each with a `time` and a
+/// `transform`; see `Animation` and `SceneFile::animate`. animations are not saved by
+/// `marshal`, which only sees the world as it is. lights may also
+/// give a `group`, and a `falloff` of either `constant` or `inverse-square`. a material
+/// can have a `coat`, which is another material painted over it wherever the pattern
+/// given as its `mask` is white. it can also have an `anisotropy`, with a `roughness-x`
+/// along its `grain` and a `roughness-y` across it, for highlights like brushed metal.
+/// a material's `transparency`, from 0 to 1, lets light through it, bent by its
+/// `refractive-index`, and its `reflective`, from 0 to 1, mirrors the scene around it.
+/// any object can be hidden from some kinds of rays by setting `camera`, `shadows`, or
+/// `reflections` to `false` under `visible`. a `background` is seen wherever nothing
+/// is hit; it is either a solid `color`, or a sky blending from a `horizon` color up to
+/// a `zenith` color, with an optional `sun` given by its `direction`, `radius` (in
+/// radians), and `color`. a `clip` item cuts away everything on the side of the plane
+/// through its `point` which its `normal` points towards, for a cutaway view; its
+/// optional `cap` is a material which covers the cut faces of the objects. a
+/// `settings` item sets the world's `falloff`, whether it casts `shadows` (and
+/// `colored-shadows`), its `max-depth` of reflections, its `ray-budget` of reflected
+/// and refracted rays for each pixel, and its `surface-offset`; see `World`. it can
+/// also ask for a `quality` preset of `draft`, `medium`, or `final`, which is applied
+/// to the world and camera before the settings that are given alongside it, so those
+/// win. the preset is not saved by `marshal`, since the world and camera are saved
+/// with it applied.
+///
+/// any number can be written as simple arithmetic, such as `[ rotate-y, pi/3 ]`; see
+/// `expression::evaluate`. a `define` item names a number for the items after it,
+/// as in `{ define: base, value: 2 }`, so that they can use it, as in `width: base*2`.
+/// other kinds of objects can be loaded by registering them
+/// with `Shapes`, and passing them to `load_with`.
+pub fn load(source: &str) -> Result<SceneFile, Error> {
+    load_with(source, &Shapes::default())
+}
+
+/// like `load`, but the objects are those known to `shapes`.
+pub fn load_with(source: &str, shapes: &Shapes) -> Result<SceneFile, Error> {
+    let document = yaml::parse(source)?;
+    let items = document
+        .as_sequence()
+        .ok_or_else(|| invalid("a scene must be a sequence of items"))?;
+
+    let mut camera = None;
+    let mut world = World::new(vec![], vec![]);
+    let mut animations = vec![];
+    let mut quality = None;
+    let mut settings = vec![];
+    let mut variables = BTreeMap::new();
+
+    for item in items {
+        if let Some(name) = item.get("define") {
+            let (name, value) = load_definition(item, name, &variables)?;
+            variables.insert(name, value);
+            continue;
+        }
+
+        let item = &substitute(item, &variables);
+        let objects = world.objects.len();
+
+        match string(field(item, "add")?)? {
+            "camera" => camera = Some(load_camera(item)?),
+            "light" => world.lights.push(load_light(item)?),
+            "background" => world.background = load_background(item)?,
+            "clip" => world.clip = Some(load_clip(item)?),
+            "settings" => {
+                if let Some(preset) = load_settings(item, &mut world)? {
+                    quality = Some(preset);
+                }
+                settings.push(item.clone());
+            }
+            _ => world.objects.extend(shapes.load(item)?),
+        }
+
+        if let Some(animate) = item.get("animate") {
+            if world.objects.len() == objects {
+                return Err(invalid("only objects can be animated"));
+            }
+            let animation = load_animation(animate)?;
+            let (start, _) = animation.span();
+            world.objects[objects].transform(animation.transform_at(start));
+            animations.push((objects, animation));
+        }
+    }
+
+    let mut camera = camera.ok_or(Error::MissingCamera)?;
+    // the preset replaces some of the settings, so the ones the scene gives itself are
+    // applied again over it.
+    if let Some(quality) = quality {
+        camera = quality.apply(&camera, &mut world);
+        for item in settings.iter() {
+            load_settings(item, &mut world)?;
+        }
+    }
+
+    Ok(SceneFile {
+        world,
+        camera,
+        animations,
+        quality,
+    })
+}
+
+/// reads a `define` item, which gives a `name` to the number that its `value` comes
+/// to, so that the name can be used in the expressions of the items after it.
+fn load_definition(
+    item: &Value,
+    name: &Value,
+    variables: &BTreeMap<String, f64>,
+) -> Result<(String, f64), Error> {
+    expect_keys(item, &["define", "value"])?;
+
+    let name = string(name)?;
+    let valid = name.starts_with(|c: char| c.is_alphabetic() || c == '_')
+        && name.chars().all(|c| c.is_alphanumeric() || c == '_');
+    if !valid
+        || expression::CONSTANTS
+            .iter()
+            .any(|(constant, _)| *constant == name)
+    {
+        return Err(invalid(format!("cannot define \"{}\"", name)));
+    }
+
+    let text = string(field(item, "value")?)?;
+    let value = expression::evaluate(text, variables).map_err(|e| {
+        invalid(format!(
+            "cannot define \"{}\" as \"{}\" ({})",
+            name, text, e
+        ))
+    })?;
+    Ok((name.to_string(), value))
+}
+
+/// a copy of `value` in which every scalar which is an expression using the defined
+/// `variables` is replaced by the number that it comes to. the kinds of items and
+/// the names of objects are left as they are, in case they share a name.
+fn substitute(value: &Value, variables: &BTreeMap<String, f64>) -> Value {
+    match value {
+        Value::Scalar(text) if !variables.is_empty() && text.parse::<f64>().is_err() => {
+            match expression::evaluate(text, variables) {
+                Ok(number) => Value::scalar(number),
+                Err(_) => value.clone(),
+            }
+        }
+        Value::Scalar(_) => value.clone(),
+        Value::Sequence(sequence) => Value::Sequence(
+            sequence
+                .iter()
+                .map(|value| substitute(value, variables))
+                .collect(),
+        ),
+        Value::Mapping(mapping) => Value::Mapping(
+            mapping
+                .iter()
+                .map(|(key, value)| match key.as_str() {
+                    "add" | "name" => (key.clone(), value.clone()),
+                    _ => (key.clone(), substitute(value, variables)),
+                })
+                .collect(),
+        ),
+    }
+}
+
+/// the value of `key` in `item`, which must be given. this and the functions which
+/// read single values below are public, so that a `Decoder` can read items the same
+/// way the loader does.
+pub fn field<'a>(item: &'a Value, key: &str) -> Result<&'a Value, Error> {
+    item.get(key)
+        .ok_or_else(|| invalid(format!("missing field \"{}\"", key)))
+}
+
+/// fails if the item contains any keys besides those which are expected.
+fn expect_keys(item: &Value, keys: &[&str]) -> Result<(), Error> {
+    let mapping = item
+        .as_mapping()
+        .ok_or_else(|| invalid("expected a mapping"))?;
+
+    match mapping
+        .iter()
+        .find(|(key, _)| !keys.contains(&key.as_str()))
+    {
+        Some((key, _)) => Err(invalid(format!("unknown field \"{}\"", key))),
+        None => Ok(()),
+    }
+}
+
+pub fn string(value: &Value) -> Result<&str, Error> {
+    value
+        .as_str()
+        .ok_or_else(|| invalid("expected a single value"))
+}
+
+/// a number, which may be given by an expression of constants (see `expression::evaluate`).
+pub fn number(value: &Value) -> Result<f64, Error> {
+    let text = string(value)?;
+    text.parse()
+        .or_else(|_| expression::evaluate(text, &BTreeMap::new()))
+        .map_err(|e| invalid(format!("expected a number, got \"{}\" ({})", text, e)))
+}
+
+pub fn count(value: &Value) -> Result<usize, Error> {
+    let text = string(value)?;
+    match text.parse() {
+        Ok(count) => Ok(count),
+        Err(_) => match expression::evaluate(text, &BTreeMap::new()) {
+            Ok(n) if n >= 0.0 && n.fract() == 0.0 => Ok(n as usize),
+            _ => Err(invalid(format!(
+                "expected a whole number, got \"{}\"",
+                text
+            ))),
+        },
+    }
+}
+
+pub fn boolean(value: &Value) -> Result<bool, Error> {
+    match string(value)? {
+        "true" => Ok(true),
+        "false" => Ok(false),
+        other => Err(invalid(format!(
+            "expected true or false, got \"{}\"",
+            other
+        ))),
+    }
+}
+
+pub fn numbers(value: &Value, length: usize) -> Result<Vec<f64>, Error> {
+    let sequence = value
+        .as_sequence()
+        .ok_or_else(|| invalid("expected a list of numbers"))?;
+
+    if sequence.len() != length {
+        return Err(invalid(format!(
+            "expected {} numbers, got {}",
+            length,
+            sequence.len()
+        )));
+    }
+
+    sequence.iter().map(number).collect()
+}
+
+pub fn point(value: &Value) -> Result<Point, Error> {
+    let n = numbers(value, 3)?;
+    Ok(Point::new(n[0], n[1], n[2]))
+}
+
+pub fn vector(value: &Value) -> Result<Vector, Error> {
+    let n = numbers(value, 3)?;
+    Ok(Vector::new(n[0], n[1], n[2]))
+}
+
+pub fn color(value: &Value) -> Result<Color, Error> {
+    let n = numbers(value, 3)?;
+    Ok(Color::new(n[0], n[1], n[2]))
+}
+
+/// reads the rows of a heightfield, which must all be the same length.
+fn heights(value: &Value) -> Result<Heightfield, Error> {
+    let rows = value
+        .as_sequence()
+        .ok_or_else(|| invalid("expected a list of rows of heights"))?;
+    let columns = match rows.first().and_then(Value::as_sequence) {
+        Some(row) => row.len(),
+        None => return Err(invalid("expected a list of rows of heights")),
+    };
+    if columns < 2 || rows.len() < 2 {
+        return Err(invalid("a heightfield needs at least 2 rows of 2 heights"));
+    }
+
+    let mut heights = Vec::with_capacity(columns * rows.len());
+    for row in rows {
+        heights.extend(numbers(row, columns)?);
+    }
+
+    Ok(Heightfield::new(columns, rows.len(), heights))
+}
+
+/// reads the center and blend radius of each metaball, given as `[ x, y, z, radius ]`.
+fn balls(value: &Value) -> Result<Vec<(Point, f64)>, Error> {
+    value
+        .as_sequence()
+        .ok_or_else(|| invalid("expected a list of balls"))?
+        .iter()
+        .map(|ball| {
+            let n = numbers(ball, 4)?;
+            Ok((Point::new(n[0], n[1], n[2]), n[3]))
+        })
+        .collect()
+}
+
+fn load_camera(item: &Value) -> Result<Camera, Error> {
+    expect_keys(
+        item,
+        &[
+            "add",
+            "width",
+            "height",
+            "field-of-view",
+            "from",
+            "to",
+            "up",
+            "samples",
+            "exposure",
+        ],
+    )?;
+
+    let mut camera = Camera::look_at(
+        point(field(item, "from")?)?,
+        point(field(item, "to")?)?,
+        vector(field(item, "up")?)?,
+    )
+    .size(
+        count(field(item, "width")?)?,
+        count(field(item, "height")?)?,
+    )
+    .field_of_view(number(field(item, "field-of-view")?)?.to_degrees())
+    .build()
+    .map_err(invalid)?;
+
+    if let Some(samples) = item.get("samples") {
+        camera.samples = count(samples)?;
+    }
+    if let Some(exposure) = item.get("exposure") {
+        camera.exposure = load_exposure(exposure)?;
+    }
+    Ok(camera)
+}
+
+/// reads the exposure of a camera. the settings which are left out keep their
+/// defaults.
+fn load_exposure(value: &Value) -> Result<Exposure, Error> {
+    expect_keys(value, &["shutter", "iso", "compensation"])?;
+
+    let mut exposure = Exposure::default();
+    if let Some(shutter) = value.get("shutter") {
+        let shutter = numbers(shutter, 2)?;
+        exposure = exposure.with_shutter(shutter[0], shutter[1]);
+    }
+    if let Some(iso) = value.get("iso") {
+        exposure = exposure.with_iso(number(iso)?);
+    }
+    if let Some(compensation) = value.get("compensation") {
+        exposure = exposure.with_compensation(number(compensation)?);
+    }
+    Ok(exposure)
+}
+
+/// reads a background item, as written by `marshal_background`.
+pub fn load_background(item: &Value) -> Result<Background, Error> {
+    expect_keys(item, &["add", "color", "horizon", "zenith", "sun"])?;
+
+    if let Some(value) = item.get("color") {
+        return Ok(Background::solid(color(value)?));
+    }
+
+    let sky = Sky::new(
+        color(field(item, "horizon")?)?,
+        color(field(item, "zenith")?)?,
+    );
+    match item.get("sun") {
+        Some(sun) => {
+            expect_keys(sun, &["direction", "radius", "color"])?;
+            Ok(Background::sky(sky.with_sun(
+                vector(field(sun, "direction")?)?,
+                number(field(sun, "radius")?)?,
+                color(field(sun, "color")?)?,
+            )))
+        }
+        None => Ok(Background::sky(sky)),
+    }
+}
+
+fn load_clip(item: &Value) -> Result<Clip, Error> {
+    expect_keys(item, &["add", "point", "normal", "cap"])?;
+
+    let clip = Clip::new(
+        point(field(item, "point")?)?,
+        vector(field(item, "normal")?)?,
+    );
+    match item.get("cap") {
+        Some(cap) => Ok(clip.with_cap(load_material(cap)?)),
+        None => Ok(clip),
+    }
+}
+
+/// reads the settings which apply to the whole world, returning the quality preset
+/// if one is given. the settings which are left out keep their defaults.
+fn load_settings(item: &Value, world: &mut World) -> Result<Option<Quality>, Error> {
+    expect_keys(
+        item,
+        &[
+            "add",
+            "falloff",
+            "shadows",
+            "colored-shadows",
+            "max-depth",
+            "ray-budget",
+            "surface-offset",
+            "quality",
+        ],
+    )?;
+
+    if let Some(value) = item.get("falloff") {
+        world.falloff = falloff(value)?;
+    }
+    if let Some(value) = item.get("shadows") {
+        world.shadows = boolean(value)?;
+    }
+    if let Some(value) = item.get("colored-shadows") {
+        world.colored_shadows = boolean(value)?;
+    }
+    if let Some(value) = item.get("max-depth") {
+        world.max_depth = count(value)?;
+    }
+    if let Some(value) = item.get("ray-budget") {
+        world.ray_budget = Some(count(value)?);
+    }
+    if let Some(value) = item.get("surface-offset") {
+        world.surface_offset = number(value)?;
+    }
+    match item.get("quality") {
+        Some(value) => string(value)?.parse().map(Some).map_err(invalid),
+        None => Ok(None),
+    }
+}
+
+fn falloff(value: &Value) -> Result<Falloff, Error> {
+    match string(value)? {
+        "constant" => Ok(Falloff::Constant),
+        "inverse-square" => Ok(Falloff::InverseSquare),
+        other => Err(invalid(format!("unknown light falloff \"{}\"", other))),
+    }
+}
+
+fn load_light(item: &Value) -> Result<Light, Error> {
+    expect_keys(item, &["add", "at", "intensity", "group", "falloff"])?;
+
+    let mut point = light::Point::new(
+        point(field(item, "at")?)?,
+        color(field(item, "intensity")?)?,
+    );
+    if let Some(group) = item.get("group") {
+        point = point.with_group(count(group)?);
+    }
+    if let Some(value) = item.get("falloff") {
+        point = point.with_falloff(falloff(value)?);
+    }
+
+    Ok(Light::point(point))
+}
+
+/// loads an object of any form.
+/// decodes the form of a kind of object from the item which adds it. the fields
+/// which every object may have, such as its material and transform, are read by
+/// the loader, and the group's `shapes` can load any objects nested in the item.
+pub type Decoder = fn(item: &Value, shapes: &Shapes) -> Result<Form, Error>;
+
+/// the kinds of objects that a scene file can add, by the name given to `add`.
+/// `Shapes::default` knows every built-in kind, and more can be registered, so that
+/// new forms can be loaded without changing the loader; see `load_with`.
+#[derive(Clone)]
+pub struct Shapes {
+    decoders: BTreeMap<String, (Vec<&'static str>, Decoder)>,
+}
+
+impl Shapes {
+    /// no kinds of objects at all.
+    pub fn empty() -> Shapes {
+        Shapes {
+            decoders: BTreeMap::new(),
+        }
+    }
+
+    /// adds a kind of object called `name` (replacing any other of the same name),
+    /// whose items may have `fields` besides those which every object may have. items
+    /// adding a camera, a light, a background, a clip, or settings are never treated
+    /// as objects.
+    pub fn register(
+        &mut self,
+        name: &str,
+        fields: &[&'static str],
+        decode: Decoder,
+    ) -> &mut Shapes {
+        self.decoders
+            .insert(name.to_string(), (fields.to_vec(), decode));
+        self
+    }
+
+    pub fn names(&self) -> impl Iterator<Item = &str> {
+        self.decoders.keys().map(String::as_str)
+    }
+
+    /// loads the objects added by `item`: just one, unless it is repeated.
+    pub fn load(&self, item: &Value) -> Result<Vec<Geometry>, Error> {
+        let name = string(field(item, "add")?)?;
+        let (fields, decode) = self
+            .decoders
+            .get(name)
+            .ok_or_else(|| invalid(format!("cannot add unknown item \"{}\"", name)))?;
+
+        let mut keys = fields.clone();
+        keys.extend(&[
+            "add",
+            "name",
+            "material",
+            "transform",
+            "animate",
+            "visible",
+            "repeat",
+        ]);
+        expect_keys(item, &keys)?;
+
+        let object = load_object(item, decode(item, self)?)?;
+        let repeat = match item.get("repeat") {
+            Some(repeat) => repeat,
+            None => return Ok(vec![object]),
+        };
+        if item.get("animate").is_some() {
+            return Err(invalid("an object cannot be both repeated and animated"));
+        }
+
+        Ok(load_repeat(repeat)?
+            .into_iter()
+            .enumerate()
+            .map(|(i, step)| {
+                let copy = object.clone().transformed(step * object.transform);
+                match object.name {
+                    Some(ref name) => copy.with_name(&format!("{}-{}", name, i)),
+                    None => copy,
+                }
+            })
+            .collect())
+    }
+}
+
+impl Default for Shapes {
+    fn default() -> Shapes {
+        let mut shapes = Shapes::empty();
+        shapes
+            .register("sphere", &[], |_, _| Ok(Form::Sphere))
+            .register("plane", &[], |_, _| Ok(Form::Plane))
+            .register("disk", &["radius"], |item, _| {
+                let radius = number(field(item, "radius")?)?;
+                Ok(Form::Disk { radius })
+            })
+            .register("rounded-box", &["radius"], |item, _| {
+                let radius = number(field(item, "radius")?)?;
+                Ok(Form::RoundedBox { radius })
+            })
+            .register("heightfield", &["heights"], |item, _| {
+                Ok(Form::Heightfield(heights(field(item, "heights")?)?))
+            })
+            .register("metaballs", &["balls", "threshold"], |item, _| {
+                let metaballs = Metaballs::new(
+                    balls(field(item, "balls")?)?,
+                    number(field(item, "threshold")?)?,
+                );
+                Ok(Form::Metaballs(metaballs))
+            })
+            .register("tube", &["points", "radii"], load_tube)
+            .register("torus", &["major-radius", "minor-radius"], |item, _| {
+                let major = number(field(item, "major-radius")?)?;
+                let minor = number(field(item, "minor-radius")?)?;
+                Ok(Form::Torus { major, minor })
+            })
+            .register("quad", &["width", "depth"], |item, _| {
+                let width = number(field(item, "width")?)?;
+                let depth = number(field(item, "depth")?)?;
+                Ok(Form::Quad { width, depth })
+            })
+            .register("group", &["children", "divide"], load_group);
+        shapes
+    }
+}
+
+fn load_tube(item: &Value, _: &Shapes) -> Result<Form, Error> {
+    let points = field(item, "points")?
+        .as_sequence()
+        .ok_or_else(|| invalid("expected a list of points"))?
+        .iter()
+        .map(point)
+        .collect::<Result<Vec<_>, _>>()?;
+    if points.len() < 2 {
+        return Err(invalid("a tube needs at least 2 points"));
+    }
+    let radii = numbers(field(item, "radii")?, points.len() - 1)?;
+    Ok(Form::Tube(Tube::new(points, radii)))
+}
+
+fn load_group(item: &Value, shapes: &Shapes) -> Result<Form, Error> {
+    let children = field(item, "children")?
+        .as_sequence()
+        .ok_or_else(|| invalid("expected a list of children"))?;
+    if children.iter().any(|child| child.get("animate").is_some()) {
+        return Err(invalid(
+            "only whole groups can be animated, not their children",
+        ));
+    }
+    let children = children
+        .iter()
+        .map(|child| shapes.load(child))
+        .collect::<Result<Vec<_>, _>>()?
+        .concat();
+    if item.get("material").is_some() {
+        return Err(invalid(
+            "a group cannot have a material; give one to each child",
+        ));
+    }
+    let mut group = Group::new(children);
+    if let Some(threshold) = item.get("divide") {
+        group = group.divided(number(threshold)?.max(1.0) as usize);
+    }
+    Ok(Form::Group(group))
+}
+
+fn load_object(item: &Value, form: Form) -> Result<Geometry, Error> {
+    if item.get("transform").is_some() && item.get("animate").is_some() {
+        return Err(invalid(
+            "an object cannot have both a transform and an animation",
+        ));
+    }
+
+    let material = match item.get("material") {
+        Some(material) => load_material(material)?,
+        None => Material::default(),
+    };
+    let transform = match item.get("transform") {
+        Some(transform) => load_transform(transform)?,
+        None => Matrix::identity(),
+    };
+    let visibility = match item.get("visible") {
+        Some(visibility) => load_visibility(visibility)?,
+        None => Visibility::default(),
+    };
+
+    let object = Geometry::default()
+        .with_form(form)
+        .with_material(material)
+        .with_visibility(visibility)
+        .transformed(transform);
+
+    match item.get("name") {
+        Some(name) => Ok(object.with_name(string(name)?)),
+        None => Ok(object),
+    }
+}
+
+/// the transforms which place each copy of a repeated object, after its own transform.
+/// a repetition makes `count` copies, each moved by the `offset` and then turned by
+/// `rotate` (in radians about the x, y, and z axes, in that order) from the one before,
+/// so that the first copy stays where the object is. a list of repetitions makes a
+/// copy for each combination of them, such as a grid from one along each axis.
+fn load_repeat(value: &Value) -> Result<Vec<Matrix>, Error> {
+    let repetitions = match value.as_sequence() {
+        Some(repetitions) => repetitions,
+        None => std::slice::from_ref(value),
+    };
+
+    let mut transforms = vec![Matrix::identity()];
+    for repetition in repetitions {
+        expect_keys(repetition, &["count", "offset", "rotate"])?;
+
+        let mut step = Matrix::identity();
+        if let Some(rotate) = repetition.get("rotate") {
+            let n = numbers(rotate, 3)?;
+            step = Matrix::rotation_z(n[2]) * Matrix::rotation_y(n[1]) * Matrix::rotation_x(n[0]);
+        }
+        if let Some(offset) = repetition.get("offset") {
+            let n = numbers(offset, 3)?;
+            step = Matrix::translation(n[0], n[1], n[2]) * step;
+        }
+
+        let mut copies = Vec::new();
+        let mut placed = Matrix::identity();
+        for _ in 0..count(field(repetition, "count")?)? {
+            copies.extend(transforms.iter().map(|&transform| placed * transform));
+            placed = step * placed;
+        }
+        transforms = copies;
+    }
+
+    Ok(transforms)
+}
+
+fn load_visibility(value: &Value) -> Result<Visibility, Error> {
+    expect_keys(value, &["camera", "shadows", "reflections"])?;
+
+    let mut visibility = Visibility::default();
+    if let Some(camera) = value.get("camera") {
+        visibility.camera = boolean(camera)?;
+    }
+    if let Some(shadows) = value.get("shadows") {
+        visibility.shadows = boolean(shadows)?;
+    }
+    if let Some(reflections) = value.get("reflections") {
+        visibility.reflections = boolean(reflections)?;
+    }
+
+    Ok(visibility)
+}
+
+fn load_animation(value: &Value) -> Result<Animation, Error> {
+    let keyframes = value
+        .as_sequence()
+        .filter(|keyframes| !keyframes.is_empty())
+        .ok_or_else(|| invalid("an animation must be a non-empty list of keyframes"))?
+        .iter()
+        .map(|keyframe| {
+            expect_keys(keyframe, &["time", "transform"])?;
+            Ok((
+                number(field(keyframe, "time")?)?,
+                load_transform(field(keyframe, "transform")?)?,
+            ))
+        })
+        .collect::<Result<Vec<_>, Error>>()?;
+
+    Ok(Animation::new(keyframes))
+}
+
+fn load_transform(value: &Value) -> Result<Matrix, Error> {
+    let steps = value
+        .as_sequence()
+        .ok_or_else(|| invalid("a transform must be a list of steps"))?;
+    let mut transform = Matrix::identity();
+
+    for step in steps {
+        let step = step
+            .as_sequence()
+            .filter(|step| !step.is_empty())
+            .ok_or_else(|| invalid("each step of a transform must be a non-empty list"))?;
+        let arguments = Value::Sequence(step[1..].to_vec());
+
+        transform = match string(&step[0])? {
+            "translate" => {
+                let n = numbers(&arguments, 3)?;
+                Matrix::translation(n[0], n[1], n[2])
+            }
+            "scale" => {
+                let n = numbers(&arguments, 3)?;
+                Matrix::scaling(n[0], n[1], n[2])
+            }
+            "rotate-x" => Matrix::rotation_x(numbers(&arguments, 1)?[0]),
+            "rotate-y" => Matrix::rotation_y(numbers(&arguments, 1)?[0]),
+            "rotate-z" => Matrix::rotation_z(numbers(&arguments, 1)?[0]),
+            "shear" => {
+                let n = numbers(&arguments, 6)?;
+                Matrix::shearing(n[0], n[1], n[2], n[3], n[4], n[5])
+            }
+            "matrix" => {
+                let n = numbers(&arguments, 12)?;
+                #[rustfmt::skip]
+                Matrix::new(
+                    n[0], n[1], n[2],  n[3],
+                    n[4], n[5], n[6],  n[7],
+                    n[8], n[9], n[10], n[11],
+                )
+            }
+            other => return Err(invalid(format!("unknown transform \"{}\"", other))),
+        } * transform;
+    }
+
+    Ok(transform)
+}
+
+fn load_material(value: &Value) -> Result<Material, Error> {
+    expect_keys(
+        value,
+        &[
+            "color",
+            "pattern",
+            "ambient",
+            "diffuse",
+            "specular",
+            "shininess",
+            "shadow-catcher",
+            "coat",
+            "anisotropy",
+            "transparency",
+            "reflective",
+            "refractive-index",
+        ],
+    )?;
+
+    let mut material = load_surface(value)?;
+    if let Some(reflective) = value.get("reflective") {
+        material.reflective = number(reflective)?;
+    }
+    if let Some(index) = value.get("refractive-index") {
+        material.refractive_index = number(index)?;
+    }
+    if let Some(transparency) = value.get("transparency") {
+        material.transparency = number(transparency)?;
+    }
+    if let Some(shadow_catcher) = value.get("shadow-catcher") {
+        material.shadow_catcher = boolean(shadow_catcher)?;
+    }
+    if let Some(coat) = value.get("coat") {
+        material.coat = Some(load_coat(coat)?);
+    }
+    if let Some(anisotropy) = value.get("anisotropy") {
+        material.anisotropy = Some(load_anisotropy(anisotropy)?);
+    }
+
+    Ok(material)
+}
+
+fn load_anisotropy(value: &Value) -> Result<Anisotropy, Error> {
+    expect_keys(value, &["roughness-x", "roughness-y", "grain"])?;
+
+    let anisotropy = Anisotropy::new(
+        number(field(value, "roughness-x")?)?,
+        number(field(value, "roughness-y")?)?,
+    );
+    match value.get("grain") {
+        Some(grain) => Ok(anisotropy.with_grain(vector(grain)?)),
+        None => Ok(anisotropy),
+    }
+}
+
+fn load_coat(value: &Value) -> Result<Coat, Error> {
+    expect_keys(
+        value,
+        &[
+            "color",
+            "pattern",
+            "ambient",
+            "diffuse",
+            "specular",
+            "shininess",
+            "mask",
+        ],
+    )?;
+
+    Ok(Coat::new(
+        load_surface(value)?,
+        load_pattern(field(value, "mask")?)?,
+    ))
+}
+
+/// reads the parts of a material which a coat also has.
+fn load_surface(value: &Value) -> Result<Material, Error> {
+    let mut material = Material::default();
+
+    if let Some(color) = value.get("color") {
+        material.texture = Texture::pattern(Pattern::solid(self::color(color)?));
+    }
+    if let Some(pattern) = value.get("pattern") {
+        material.texture = Texture::pattern(load_pattern(pattern)?);
+    }
+    if let Some(ambient) = value.get("ambient") {
+        material.ambient = number(ambient)?;
+    }
+    if let Some(diffuse) = value.get("diffuse") {
+        material.diffuse = number(diffuse)?;
+    }
+    if let Some(specular) = value.get("specular") {
+        material.specular = number(specular)?;
+    }
+    if let Some(shininess) = value.get("shininess") {
+        material.shininess = number(shininess)?;
+    }
+
+    Ok(material)
+}
+
+fn load_pattern(value: &Value) -> Result<Pattern, Error> {
+    expect_keys(value, &["type", "colors", "transform"])?;
+
+    let colors = field(value, "colors")?
+        .as_sequence()
+        .filter(|colors| colors.len() == 2)
+        .ok_or_else(|| invalid("a pattern must have exactly two colors"))?;
+    let (a, b) = (color(&colors[0])?, color(&colors[1])?);
+
+    let pattern = match string(field(value, "type")?)? {
+        "stripes" => Pattern::stripe(Stripe::new(a, b)),
+        "gradient" => Pattern::gradient(Gradient::new(a, b)),
+        "rings" => Pattern::ring(Ring::new(a, b)),
+        "checkers" => Pattern::grid(Grid::new(a, b)),
+        other => return Err(invalid(format!("unknown pattern \"{}\"", other))),
+    };
+
+    match value.get("transform") {
+        Some(transform) => Ok(pattern.transformed(load_transform(transform)?)),
+        None => Ok(pattern),
+    }
+}
+
+/// writes the world and camera as a scene file which can be read by `load`.
+pub fn marshal(world: &World, camera: &Camera) -> String {
+    let mut items = vec![marshal_camera(camera)];
+    items.extend(marshal_settings(world));
+    // black is what is seen without a background item.
+    if world.background != Background::default() {
+        items.extend(marshal_background(&world.background));
+    }
+    items.extend(world.clip.as_ref().map(marshal_clip));
+    items.extend(world.lights.iter().map(marshal_light));
+    items.extend(world.objects.iter().filter_map(marshal_object));
+
+    Value::Sequence(items).to_string()
+}
+
+fn entry<S: ToString>(key: &str, value: S) -> (String, Value) {
+    (key.to_string(), Value::scalar(value))
+}
+
+fn triple(key: &str, x: f64, y: f64, z: f64) -> (String, Value) {
+    (
+        key.to_string(),
+        Value::Sequence(vec![Value::scalar(x), Value::scalar(y), Value::scalar(z)]),
+    )
+}
+
+fn marshal_camera(camera: &Camera) -> Value {
+    // recover the parameters of the view transformation. its rows are the camera's
+    // left, up, and backward directions, and it maps the camera's position to the origin.
+    let transform = camera.view.transform;
+    let row = |i| Vector::new(transform[(i, 0)], transform[(i, 1)], transform[(i, 2)]);
+    let from = camera.view.inverse * Point::zero();
+    let forward = -row(2);
+    let to = from + forward;
+    // the rows are not normalized: the up row is only the part of the (unit) up vector
+    // which is perpendicular to the forward direction, so it is shorter than a unit
+    // vector unless the two were perpendicular. adding back a component along the
+    // forward direction that makes it a unit vector again recovers an up vector which
+    // produces the same transformation.
+    let up = row(1);
+    let up = up + (forward * (1.0 - up.dot(&up)).max(0.0).sqrt());
+
+    let mut mapping = vec![
+        entry("add", "camera"),
+        entry("width", camera.image_width),
+        entry("height", camera.image_height),
+        entry("field-of-view", camera.field_of_view),
+        triple("from", from[0], from[1], from[2]),
+        triple("to", to[0], to[1], to[2]),
+        triple("up", up[0], up[1], up[2]),
+    ];
+    if camera.samples != 1 {
+        mapping.push(entry("samples", camera.samples));
+    }
+    if camera.exposure != Exposure::default() {
+        let exposure = camera.exposure;
+        mapping.push((
+            "exposure".to_string(),
+            Value::Mapping(vec![
+                (
+                    "shutter".to_string(),
+                    Value::Sequence(vec![
+                        Value::scalar(exposure.shutter.0),
+                        Value::scalar(exposure.shutter.1),
+                    ]),
+                ),
+                entry("iso", exposure.iso),
+                entry("compensation", exposure.compensation),
+            ]),
+        ));
+    }
+    Value::Mapping(mapping)
+}
+
+/// the settings of the world which differ from the defaults, if any do.
+fn marshal_settings(world: &World) -> Option<Value> {
+    let defaults = World::new(vec![], vec![]);
+    let mut mapping = vec![entry("add", "settings")];
+
+    if world.falloff != defaults.falloff {
+        mapping.push(entry("falloff", marshal_falloff(world.falloff)));
+    }
+    if world.shadows != defaults.shadows {
+        mapping.push(entry("shadows", world.shadows));
+    }
+    if world.colored_shadows != defaults.colored_shadows {
+        mapping.push(entry("colored-shadows", world.colored_shadows));
+    }
+    if world.max_depth != defaults.max_depth {
+        mapping.push(entry("max-depth", world.max_depth));
+    }
+    if let Some(budget) = world.ray_budget {
+        mapping.push(entry("ray-budget", budget));
+    }
+    if world.surface_offset != defaults.surface_offset {
+        mapping.push(entry("surface-offset", world.surface_offset));
+    }
+
+    if mapping.len() > 1 {
+        Some(Value::Mapping(mapping))
+    } else {
+        None
+    }
+}
+
+fn marshal_falloff(falloff: Falloff) -> &'static str {
+    match falloff {
+        Falloff::Constant => "constant",
+        Falloff::InverseSquare => "inverse-square",
+    }
+}
+
+/// the item which adds `background`, unless it is a function.
+pub fn marshal_background(background: &Background) -> Option<Value> {
+    let color = |key, color: Color| triple(key, color.red(), color.green(), color.blue());
+
+    match background {
+        Background::Solid(solid) => Some(Value::Mapping(vec![
+            entry("add", "background"),
+            color("color", *solid),
+        ])),
+        Background::Sky(sky) => {
+            let mut mapping = vec![
+                entry("add", "background"),
+                color("horizon", sky.horizon),
+                color("zenith", sky.zenith),
+            ];
+            if let Some(sun) = sky.sun {
+                mapping.push((
+                    "sun".to_string(),
+                    Value::Mapping(vec![
+                        triple(
+                            "direction",
+                            sun.direction[0],
+                            sun.direction[1],
+                            sun.direction[2],
+                        ),
+                        entry("radius", sun.radius),
+                        color("color", sun.color),
+                    ]),
+                ));
+            }
+            Some(Value::Mapping(mapping))
+        }
+        // functions are code, which cannot be written to a scene file.
+        Background::Function(_) => None,
+    }
+}
+
+fn marshal_clip(clip: &Clip) -> Value {
+    let mut mapping = vec![
+        entry("add", "clip"),
+        triple("point", clip.point[0], clip.point[1], clip.point[2]),
+        triple("normal", clip.normal[0], clip.normal[1], clip.normal[2]),
+    ];
+    if let Some(ref cap) = clip.cap {
+        mapping.push(("cap".to_string(), marshal_material(cap)));
+    }
+    Value::Mapping(mapping)
+}
+
+fn marshal_light(light: &Light) -> Value {
+    match light {
+        Light::Point(point) => {
+            let mut mapping = vec![
+                entry("add", "light"),
+                triple(
+                    "at",
+                    point.position[0],
+                    point.position[1],
+                    point.position[2],
+                ),
+                triple(
+                    "intensity",
+                    point.color.red(),
+                    point.color.green(),
+                    point.color.blue(),
+                ),
+            ];
+            if point.group != 0 {
+                mapping.push(entry("group", point.group));
+            }
+            if let Some(falloff) = point.falloff {
+                mapping.push(entry("falloff", marshal_falloff(falloff)));
+            }
+            Value::Mapping(mapping)
+        }
+    }
+}
+
+fn marshal_object(object: &Geometry) -> Option<Value> {
+    let mut mapping = match object.form {
+        Form::Sphere => vec![entry("add", "sphere")],
+        Form::Plane => vec![entry("add", "plane")],
+        Form::Disk { radius } => vec![entry("add", "disk"), entry("radius", radius)],
+        Form::RoundedBox { radius } => {
+            vec![entry("add", "rounded-box"), entry("radius", radius)]
+        }
+        Form::Quad { width, depth } => vec![
+            entry("add", "quad"),
+            entry("width", width),
+            entry("depth", depth),
+        ],
+        Form::Torus { major, minor } => vec![
+            entry("add", "torus"),
+            entry("major-radius", major),
+            entry("minor-radius", minor),
+        ],
+        Form::Heightfield(ref heightfield) => vec![
+            entry("add", "heightfield"),
+            (
+                "heights".to_string(),
+                Value::Sequence(
+                    (0..heightfield.rows)
+                        .map(|row| {
+                            Value::Sequence(
+                                (0..heightfield.columns)
+                                    .map(|column| Value::scalar(heightfield.height(column, row)))
+                                    .collect(),
+                            )
+                        })
+                        .collect(),
+                ),
+            ),
+        ],
+        Form::Metaballs(ref metaballs) => vec![
+            entry("add", "metaballs"),
+            (
+                "balls".to_string(),
+                Value::Sequence(
+                    metaballs
+                        .balls()
+                        .iter()
+                        .map(|&(center, radius)| {
+                            Value::Sequence(
+                                [center[0], center[1], center[2], radius]
+                                    .iter()
+                                    .map(|&n| Value::scalar(n))
+                                    .collect(),
+                            )
+                        })
+                        .collect(),
+                ),
+            ),
+            entry("threshold", metaballs.threshold),
+        ],
+        Form::Tube(ref tube) => vec![
+            entry("add", "tube"),
+            (
+                "points".to_string(),
+                Value::Sequence(
+                    tube.points()
+                        .iter()
+                        .map(|p| {
+                            Value::Sequence(vec![
+                                Value::scalar(p[0]),
+                                Value::scalar(p[1]),
+                                Value::scalar(p[2]),
+                            ])
+                        })
+                        .collect(),
+                ),
+            ),
+            (
+                "radii".to_string(),
+                Value::Sequence(tube.radii().iter().map(|&r| Value::scalar(r)).collect()),
+            ),
+        ],
+        // objects without a form are invisible, so there is nothing to save.
+        Form::None => return None,
+        // distance functions are code, which cannot be written to a scene file.
+        Form::Sdf(_) => return None,
+        // nor can the images that billboards are cut out of.
+        Form::Billboard(_) => return None,
+        // test shapes only matter to the code checking them.
+        Form::Test(_) => return None,
+        Form::Group(ref group) => vec![
+            entry("add", "group"),
+            (
+                "children".to_string(),
+                Value::Sequence(group.children().iter().filter_map(marshal_object).collect()),
+            ),
+        ],
+    };
+    if let Some(ref name) = object.name {
+        mapping.insert(1, entry("name", name));
+    }
+    if let Form::Group(_) = object.form {
+        // groups have no material of their own.
+    } else {
+        mapping.push(("material".to_string(), marshal_material(&object.material)));
+    }
+    if let Some(transform) = marshal_transform(&object.transform) {
+        mapping.push(transform);
+    }
+    if object.visibility != Visibility::default() {
+        mapping.push((
+            "visible".to_string(),
+            Value::Mapping(vec![
+                entry("camera", object.visibility.camera),
+                entry("shadows", object.visibility.shadows),
+                entry("reflections", object.visibility.reflections),
+            ]),
+        ));
+    }
+
+    Some(Value::Mapping(mapping))
+}
+
+fn marshal_transform(transform: &Matrix) -> Option<(String, Value)> {
+    if *transform == Matrix::identity() {
+        return None;
+    }
+
+    let mut step = vec![Value::scalar("matrix")];
+    for i in 0..3 {
+        for j in 0..3 {
+            step.push(Value::scalar(transform[(i, j)]));
+        }
+        step.push(Value::scalar(transform.translation[i]));
+    }
+
+    Some((
+        "transform".to_string(),
+        Value::Sequence(vec![Value::Sequence(step)]),
+    ))
+}
+
+fn marshal_material(material: &Material) -> Value {
+    let default = Material::default();
+    let mut mapping = vec![];
+
+    match material.texture {
+        Texture::Pattern(Pattern::Solid(solid)) => mapping.push(triple(
+            "color",
+            solid.color.red(),
+            solid.color.green(),
+            solid.color.blue(),
+        )),
+        Texture::Pattern(pattern) => {
+            mapping.push(("pattern".to_string(), marshal_pattern(&pattern)))
+        }
+        // images can only be made in code, so the object is saved with the default
+        // color instead.
+        Texture::Image(_) => {}
+    }
+
+    let numbers = [
+        ("ambient", material.ambient, default.ambient),
+        ("diffuse", material.diffuse, default.diffuse),
+        ("specular", material.specular, default.specular),
+        ("shininess", material.shininess, default.shininess),
+        ("transparency", material.transparency, default.transparency),
+        ("reflective", material.reflective, default.reflective),
+        (
+            "refractive-index",
+            material.refractive_index,
+            default.refractive_index,
+        ),
+    ];
+    for &(key, value, default) in numbers.iter() {
+        if value != default {
+            mapping.push(entry(key, value));
+        }
+    }
+    if material.shadow_catcher {
+        mapping.push(entry("shadow-catcher", true));
+    }
+    if let Some(anisotropy) = material.anisotropy {
+        let grain = anisotropy.grain;
+        mapping.push((
+            "anisotropy".to_string(),
+            Value::Mapping(vec![
+                entry("roughness-x", anisotropy.roughness_x),
+                entry("roughness-y", anisotropy.roughness_y),
+                triple("grain", grain[0], grain[1], grain[2]),
+            ]),
+        ));
+    }
+    if let Some(ref coat) = material.coat {
+        if let Value::Mapping(mut coat_mapping) = marshal_material(&coat.material()) {
+            coat_mapping.push(("mask".to_string(), marshal_pattern(&coat.mask)));
+            mapping.push(("coat".to_string(), Value::Mapping(coat_mapping)));
+        }
+    }
+
+    Value::Mapping(mapping)
+}
+
+fn marshal_pattern(pattern: &Pattern) -> Value {
+    let (kind, (a, b), transform) = match pattern {
+        Pattern::Stripe(stripe) => ("stripes", stripe.colors(), stripe.transform),
+        Pattern::Gradient(gradient) => ("gradient", gradient.colors(), gradient.transform),
+        Pattern::Ring(ring) => ("rings", ring.colors(), ring.transform),
+        Pattern::Grid(grid) => ("checkers", grid.colors(), grid.transform),
+        Pattern::Solid(_) => unreachable!("solid patterns are saved as a material color"),
+    };
+
+    let color = |c: Color| {
+        Value::Sequence(vec![
+            Value::scalar(c.red()),
+            Value::scalar(c.green()),
+            Value::scalar(c.blue()),
+        ])
+    };
+
+    let mut mapping = vec![
+        entry("type", kind),
+        (
+            "colors".to_string(),
+            Value::Sequence(vec![color(a), color(b)]),
+        ),
+    ];
+    if let Some(transform) = marshal_transform(&transform) {
+        mapping.push(transform);
+    }
+
+    Value::Mapping(mapping)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{math::EPSILON, scene::presets, world::View};
+    use std::f64::consts;
+
+    fn camera() -> Camera {
+        let mut camera = Camera::new(100, 50, consts::PI / 3.0);
+        camera.view = View::transformed(
+            Point::new(0.0, 1.5, -5.0),
+            Point::new(0.0, 1.0, 0.0),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        camera
+    }
+
+    #[test]
+    fn load_scene() {
+        let source = "
+- add: camera
+  width: 100
+  height: 50
+  field-of-view: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: light
+  at: [ -10, 10, -10 ]
+  intensity: [ 1, 1, 1 ]
+
+- add: plane
+  material:
+    pattern:
+      type: checkers
+      colors:
+        - [ 1, 1, 1 ]
+        - [ 0, 0, 0 ]
+
+- add: sphere
+  material:
+    color: [ 1, 0.2, 1 ]
+    diffuse: 0.7
+  transform:
+    - [ scale, 0.5, 0.5, 0.5 ]
+    - [ translate, 0, 1, 0 ]
+";
+        let scene = load(source).unwrap();
+        assert_eq!(scene.camera, camera());
+        assert_eq!(
+            scene.world.lights,
+            vec![Light::point(light::Point::new(
+                Point::new(-10.0, 10.0, -10.0),
+                Color::white()
+            ))]
+        );
+        assert_eq!(scene.world.objects.len(), 2);
+        assert_eq!(scene.world.objects[0].form, Form::Plane);
+        assert_eq!(
+            scene.world.objects[0].material.texture,
+            Texture::pattern(Pattern::grid(Grid::new(Color::white(), Color::black())))
+        );
+        assert_eq!(scene.world.objects[1].form, Form::Sphere);
+        assert_eq!(scene.world.objects[1].material.diffuse, 0.7);
+        assert_eq!(
+            scene.world.objects[1].transform,
+            *Matrix::identity()
+                .scale(0.5, 0.5, 0.5)
+                .translate(0.0, 1.0, 0.0)
+        );
+    }
+
+    #[test]
+    fn load_shear_transform() {
+        let source = "
+- add: camera
+  width: 100
+  height: 50
+  field-of-view: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: sphere
+  transform:
+    - [ shear, 1, 0, 0, 0, 0.5, 0 ]
+    - [ translate, 0, 1, 0 ]
+";
+        let scene = load(source).unwrap();
+        assert_eq!(
+            scene.world.objects[0].transform,
+            *Matrix::identity()
+                .shear(1.0, 0.0, 0.0, 0.0, 0.5, 0.0)
+                .translate(0.0, 1.0, 0.0)
+        );
+    }
+
+    #[test]
+    fn load_animated_object() {
+        let source = "
+- add: camera
+  width: 100
+  height: 50
+  field-of-view: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: sphere
+  animate:
+    - time: 1
+      transform:
+        - [ translate, 0, 2, 0 ]
+    - time: 0
+      transform:
+        - [ translate, 0, 0, 0 ]
+";
+        let mut scene = load(source).unwrap();
+        assert_eq!(scene.animations.len(), 1);
+        assert_eq!(scene.world.objects[0].transform, Matrix::identity());
+        scene.animate(0.5);
+        assert_eq!(
+            scene.world.objects[0].transform,
+            Matrix::translation(0.0, 1.0, 0.0)
+        );
+
+        let both = source.replace("  animate:", "  transform: []\n  animate:");
+        assert!(load(&both).is_err());
+    }
+
+    #[test]
+    fn load_group() {
+        let source = "
+- add: camera
+  width: 100
+  height: 50
+  field-of-view: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: group
+  transform:
+    - [ translate, 0, 1, 0 ]
+  children:
+    - add: sphere
+      material:
+        color: [ 1, 0, 0 ]
+    - add: group
+      children:
+        - add: plane
+";
+        let scene = load(source).unwrap();
+        assert_eq!(scene.world.objects.len(), 1);
+        let group = &scene.world.objects[0];
+        assert_eq!(group.transform, Matrix::translation(0.0, 1.0, 0.0));
+        let children = match group.form {
+            Form::Group(ref group) => group.children().to_vec(),
+            _ => panic!("expected a group"),
+        };
+        assert_eq!(children.len(), 2);
+        assert_eq!(
+            children[0].material.texture,
+            Texture::pattern(Pattern::solid(Color::new(1.0, 0.0, 0.0)))
+        );
+
+        let colored = source.replace(
+            "- add: group\n  transform",
+            "- add: group\n  material: {}\n  transform",
+        );
+        assert_eq!(
+            load(&colored).err(),
+            Some(invalid(
+                "a group cannot have a material; give one to each child"
+            ))
+        );
+
+        let divided = source.replace(
+            "- add: group\n  transform",
+            "- add: group\n  divide: 1\n  transform",
+        );
+        let scene = load(&divided).unwrap();
+        match scene.world.objects[0].form {
+            Form::Group(ref group) => assert_eq!(group.children().len(), 2),
+            _ => panic!("expected a group"),
+        }
+    }
+
+    #[test]
+    fn scene_must_have_camera() {
+        assert_eq!(load("- add: sphere\n").err(), Some(Error::MissingCamera));
+    }
+
+    #[test]
+    fn reject_invalid_scenes() {
+        assert_eq!(
+            load("- add: cube\n").err(),
+            Some(Error::Invalid(
+                "cannot add unknown item \"cube\"".to_string()
+            ))
+        );
+        assert_eq!(
+            load("- add: sphere\n  transform:\n    - [ translate, 1, 2 ]\n").err(),
+            Some(Error::Invalid("expected 3 numbers, got 2".to_string()))
+        );
+        assert_eq!(
+            load("- add: sphere\n  material:\n    colour: [ 1, 1, 1 ]\n").err(),
+            Some(Error::Invalid("unknown field \"colour\"".to_string()))
+        );
+        match load("- add: sphere\n  material\n").err() {
+            Some(Error::Parse(e)) => assert_eq!(e.line, 2),
+            other => panic!("unexpected result: {:?}", other),
+        }
+    }
+
+    #[test]
+    fn load_expressions() {
+        let source = "
+- define: base
+  value: 2
+- define: size
+  value: base * 3
+
+- add: camera
+  width: size * 10
+  height: 50
+  field-of-view: pi/3
+  from: [ 0, 1.5, -base - 3 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: sphere
+  name: size
+  transform:
+    - [ rotate-y, -pi / 2 ]
+    - [ translate, 0, base, 0 ]
+";
+        let scene = load(source).unwrap();
+        assert_eq!(scene.camera.image_width, 60);
+        assert!((scene.camera.field_of_view - consts::PI / 3.0).abs() < 1e-9);
+        assert_eq!(scene.world.find("size"), Some(0));
+        assert_eq!(
+            scene.world.objects[0].transform,
+            *Matrix::identity()
+                .rotate_y(-consts::PI / 2.0)
+                .translate(0.0, 2.0, 0.0)
+        );
+
+        assert_eq!(
+            load("- define: pi\n  value: 3\n").err(),
+            Some(Error::Invalid("cannot define \"pi\"".to_string()))
+        );
+        assert_eq!(
+            load("- define: a\n  value: b + 1\n").err(),
+            Some(Error::Invalid(
+                "cannot define \"a\" as \"b + 1\" (unknown name \"b\")".to_string()
+            ))
+        );
+        assert_eq!(
+            load("- add: disk\n  radius: 2 *\n").err(),
+            Some(Error::Invalid(
+                "expected a number, got \"2 *\" (expected a number)".to_string()
+            ))
+        );
+    }
+
+    #[test]
+    fn load_repeated_objects() {
+        let source = "
+- add: camera
+  width: 10
+  height: 10
+  field-of-view: 1
+  from: [ 0, 0, -5 ]
+  to: [ 0, 0, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: sphere
+  name: ball
+  transform:
+    - [ scale, 0.5, 0.5, 0.5 ]
+  repeat:
+    - { count: 3, offset: [ 2, 0, 0 ] }
+    - { count: 2, offset: [ 0, 0, 2 ] }
+
+- add: group
+  children:
+    - add: disk
+      radius: 1
+      transform:
+        - [ translate, 5, 0, 0 ]
+      repeat: { count: 4, rotate: [ 0, pi/2, 0 ] }
+";
+        let scene = load(source).unwrap();
+        let objects = &scene.world.objects;
+        assert_eq!(objects.len(), 7);
+        assert_eq!(scene.world.find("ball-4"), Some(4));
+        assert_eq!(
+            objects[4].transform,
+            Matrix::translation(2.0, 0.0, 2.0) * Matrix::scaling(0.5, 0.5, 0.5)
+        );
+
+        let group = match objects[6].form {
+            Form::Group(ref group) => group,
+            _ => panic!("expected a group"),
+        };
+        let children = group.children();
+        assert_eq!(children.len(), 4);
+        assert_eq!(
+            children[1].transform * Point::zero(),
+            Point::new(0.0, 0.0, -5.0)
+        );
+
+        let animated = source.replace(
+            "  transform:\n    - [ scale, 0.5, 0.5, 0.5 ]",
+            "  animate:\n    - { time: 0, transform: [] }",
+        );
+        assert_eq!(
+            load(&animated).err(),
+            Some(Error::Invalid(
+                "an object cannot be both repeated and animated".to_string()
+            ))
+        );
+    }
+
+    #[test]
+    fn load_registered_shape() {
+        let mut shapes = Shapes::default();
+        shapes.register("coin", &["size"], |item, _| {
+            let radius = number(field(item, "size")?)? / 2.0;
+            Ok(Form::Disk { radius })
+        });
+
+        let source = "
+- add: camera
+  width: 10
+  height: 10
+  field-of-view: 1
+  from: [ 0, 0, -5 ]
+  to: [ 0, 0, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: group
+  children:
+    - add: coin
+      size: 3
+      transform:
+        - [ translate, 0, 1, 0 ]
+";
+        let scene = load_with(source, &shapes).unwrap();
+        let group = match scene.world.objects[0].form {
+            Form::Group(ref group) => group,
+            _ => panic!("expected a group"),
+        };
+        assert_eq!(group.children()[0].form, Form::Disk { radius: 1.5 });
+        assert_eq!(
+            group.children()[0].transform,
+            Matrix::translation(0.0, 1.0, 0.0)
+        );
+
+        assert_eq!(
+            load(source).err(),
+            Some(Error::Invalid(
+                "cannot add unknown item \"coin\"".to_string()
+            ))
+        );
+        assert_eq!(
+            load_with(&source.replace("size", "radius"), &shapes).err(),
+            Some(Error::Invalid("unknown field \"radius\"".to_string()))
+        );
+        assert!(Shapes::empty().names().next().is_none());
+        assert!(shapes.names().any(|name| name == "sphere"));
+    }
+
+    #[test]
+    fn marshal_round_trip() {
+        let mut world = World::default();
+        world.lights.push(Light::point(
+            light::Point::new(Point::new(5.0, 5.0, 5.0), Color::new(0.2, 0.3, 0.4))
+                .with_group(2)
+                .with_falloff(Falloff::InverseSquare),
+        ));
+        let mut floor = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::rotation_y(consts::PI / 7.0));
+        floor.material.texture = Texture::pattern(
+            Pattern::stripe(Stripe::new(Color::white(), Color::new(0.1, 0.2, 0.3)))
+                .transformed(Matrix::scaling(0.25, 0.25, 0.25)),
+        );
+        floor.material.shadow_catcher = true;
+        floor.material.transparency = 0.25;
+        floor.material.reflective = 0.5;
+        floor.material.refractive_index = 1.33;
+        floor.material = floor.material.with_coat(Coat::new(
+            presets::matte(Color::new(0.5, 0.2, 0.1)),
+            Pattern::ring(Ring::new(Color::white(), Color::black())),
+        ));
+        world.objects[0].material = world.objects[0]
+            .material
+            .with_anisotropy(Anisotropy::new(0.3, 0.05).with_grain(Vector::new(0.0, 0.0, 1.0)));
+        world.objects.push(floor);
+        world.background = Background::sky(
+            Sky::new(Color::new(0.9, 0.9, 1.0), Color::new(0.2, 0.3, 0.8)).with_sun(
+                Vector::new(1.0, 1.0, 0.0),
+                0.05,
+                Color::new(5.0, 5.0, 4.0),
+            ),
+        );
+        world.objects.push(
+            Geometry::default()
+                .with_form(Form::Disk { radius: 0.5 })
+                .with_name("little disk")
+                .with_visibility(Visibility {
+                    camera: false,
+                    ..Visibility::default()
+                }),
+        );
+        world.objects.push(
+            Geometry::default()
+                .with_form(Form::Quad {
+                    width: 2.0,
+                    depth: 0.25,
+                })
+                .transformed(Matrix::translation(0.0, 3.0, 0.0)),
+        );
+        world
+            .objects
+            .push(Geometry::default().with_form(Form::RoundedBox { radius: 0.1 }));
+        world.objects.push(
+            Geometry::default().with_form(Form::Heightfield(Heightfield::new(
+                2,
+                3,
+                vec![0.0, 0.5, 1.0, 0.25, 0.75, 0.125],
+            ))),
+        );
+        world.objects.push(
+            Geometry::default().with_form(Form::Metaballs(Metaballs::new(
+                vec![(Point::zero(), 1.0), (Point::new(1.0, 0.5, 0.0), 0.75)],
+                0.3,
+            ))),
+        );
+        world
+            .objects
+            .push(Geometry::default().with_form(Form::Tube(Tube::new(
+                vec![
+                    Point::zero(),
+                    Point::new(1.0, 0.0, 0.0),
+                    Point::new(1.0, 1.0, 0.5),
+                ],
+                vec![0.1, 0.05],
+            ))));
+        world
+            .objects
+            .push(Geometry::default().with_form(Form::Torus {
+                major: 1.5,
+                minor: 0.25,
+            }));
+        world.objects.push(
+            Geometry::default()
+                .with_form(Form::Group(Group::new(vec![
+                    Geometry::default()
+                        .with_form(Form::Sphere)
+                        .transformed(Matrix::translation(1.0, 0.0, 0.0)),
+                    Geometry::default().with_form(Form::Group(Group::new(vec![]))),
+                ])))
+                .transformed(Matrix::scaling(2.0, 2.0, 2.0)),
+        );
+        world.objects.push(Geometry::default());
+        world.clip = Some(
+            Clip::new(Point::new(0.0, 0.5, 0.0), Vector::new(1.0, 1.0, 0.0))
+                .with_cap(presets::matte(Color::new(0.9, 0.1, 0.1))),
+        );
+
+        let camera = camera();
+        let yaml = marshal(&world, &camera);
+        let scene = load(&yaml).unwrap();
+
+        assert_eq!(scene.camera, camera);
+        assert_eq!(scene.world.background, world.background);
+        assert_eq!(scene.world.lights, world.lights);
+        assert_eq!(scene.world.clip, world.clip);
+        // the object without a form is not saved.
+        assert_eq!(scene.world.objects[..], world.objects[..11]);
+    }
+
+    #[test]
+    fn load_settings() {
+        let source = "
+- add: camera
+  width: 100
+  height: 50
+  field-of-view: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: settings
+  falloff: inverse-square
+  shadows: false
+  max-depth: 8
+  quality: medium
+";
+        let scene = load(source).unwrap();
+        assert_eq!(scene.quality, Some(Quality::Medium));
+        assert_eq!(scene.camera.image_width, 50);
+        assert_eq!(scene.camera.image_height, 25);
+        assert_eq!(scene.camera.samples, 2);
+        let world = scene.world;
+        assert_eq!(world.falloff, Falloff::InverseSquare);
+        assert!(!world.shadows);
+        assert!(!world.colored_shadows);
+        assert_eq!(world.max_depth, 8);
+        assert_eq!(world.surface_offset, EPSILON);
+    }
+
+    #[test]
+    fn quality_preset_is_applied_before_settings() {
+        let source = "
+- add: camera
+  width: 100
+  height: 50
+  field-of-view: 1.0471975511965976
+  from: [ 0, 1.5, -5 ]
+  to: [ 0, 1, 0 ]
+  up: [ 0, 1, 0 ]
+
+- add: settings
+  max-depth: 8
+
+- add: settings
+  quality: draft
+";
+        let scene = load(source).unwrap();
+        assert_eq!(scene.camera.image_width, 25);
+        assert_eq!(scene.world.max_depth, 8);
+        assert!(!scene.world.shadows);
+    }
+
+    #[test]
+    fn marshal_settings_round_trip() {
+        let mut world = World::new(vec![], vec![]);
+        world.falloff = Falloff::InverseSquare;
+        world.shadows = false;
+        world.colored_shadows = true;
+        world.max_depth = 2;
+        world.ray_budget = Some(40);
+        world.surface_offset = 0.001;
+
+        let scene = load(&marshal(&world, &camera())).unwrap();
+        assert_eq!(scene.world.falloff, world.falloff);
+        assert_eq!(scene.world.shadows, world.shadows);
+        assert_eq!(scene.world.colored_shadows, world.colored_shadows);
+        assert_eq!(scene.world.max_depth, world.max_depth);
+        assert_eq!(scene.world.ray_budget, world.ray_budget);
+        assert_eq!(scene.world.surface_offset, world.surface_offset);
+    }
+
+    #[test]
+    fn marshal_default_settings_compactly() {
+        let world = World::new(vec![], vec![]);
+        assert!(!marshal(&world, &camera()).contains("settings"));
+    }
+
+    #[test]
+    fn marshal_camera_round_trip() {
+        let mut camera = camera();
+        camera.samples = 3;
+        camera.exposure = Exposure::new((0.25, 0.75), 400.0, -1.5);
+
+        let scene = load(&marshal(&World::new(vec![], vec![]), &camera)).unwrap();
+        assert_eq!(scene.camera.samples, 3);
+        assert_eq!(scene.camera.exposure, camera.exposure);
+        assert_eq!(scene.camera, camera);
+    }
+
+    #[test]
+    fn marshal_default_material_compactly() {
+        let world = World::new(vec![Geometry::default().with_form(Form::Sphere)], vec![]);
+        let yaml = marshal(&world, &camera());
+        assert!(yaml.ends_with("- add: sphere\n  material:\n    color: [ 1, 1, 1 ]\n"));
+    }
+}
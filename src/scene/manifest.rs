@@ -0,0 +1,551 @@
+use std::{fmt::Write, time::Duration};
+
+use crate::{
+    scene::{
+        file::{boolean, count, field, load_background, marshal_background, number, string, Error},
+        marshal,
+        yaml::{self, Value},
+    },
+    world::{
+        camera::Schedule,
+        light::Falloff,
+        stats::{ObjectStats, Report},
+        Background, Camera, Format, Quality, World,
+    },
+};
+
+/// what a render was made from and how, written alongside its image so that the
+/// render can be repeated exactly. a manifest is written as json (see `to_json`) and
+/// read back with `parse`.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Manifest {
+    /// the version of the ray tracer which made the render.
+    pub version: String,
+    /// a digest of the world and camera; see `Manifest::scene_hash`.
+    pub scene: u64,
+    /// the frame that the camera's samples were seeded from; see `Camera::frame`.
+    pub seed: u64,
+    pub quality: Quality,
+    pub settings: Settings,
+    pub schedule: Schedule,
+    pub format: Format,
+    /// the exposure compensation, in stops, that the image was written with.
+    pub exposure: f64,
+    /// the number of seconds the image was refined for, if the render was limited.
+    /// such a render depends on how fast the machine is, so it cannot be repeated
+    /// exactly.
+    pub budget: Option<f64>,
+    /// how long the render took.
+    pub elapsed: Duration,
+    /// a digest of the image; see `Canvas::hash`.
+    pub image: u64,
+    pub stats: Option<Report>,
+}
+
+/// the settings of the world that a render was made with, once the quality preset
+/// and any options were applied. these are not part of the scene's digest, since
+/// they are not part of the scene's description, so they are recorded separately.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Settings {
+    pub max_depth: usize,
+    pub ray_budget: Option<usize>,
+    pub shadows: bool,
+    pub falloff: Falloff,
+    /// the background, unless it is a function, which cannot be written down.
+    pub background: Option<Background>,
+}
+
+impl Settings {
+    pub fn of(world: &World) -> Settings {
+        Settings {
+            max_depth: world.max_depth,
+            ray_budget: world.ray_budget,
+            shadows: world.shadows,
+            falloff: world.falloff,
+            background: match world.background {
+                Background::Function(_) => None,
+                background => Some(background),
+            },
+        }
+    }
+
+    /// sets these settings on `world`. a background which was not recorded is left
+    /// as it is.
+    pub fn apply(&self, world: &mut World) {
+        world.max_depth = self.max_depth;
+        world.ray_budget = self.ray_budget;
+        world.shadows = self.shadows;
+        world.falloff = self.falloff;
+        if let Some(background) = self.background {
+            world.background = background;
+        }
+    }
+
+    fn to_json(&self) -> String {
+        format!(
+            "{{\"max-depth\":{},\"ray-budget\":{},\"shadows\":{},\"falloff\":\"{}\",\"background\":{}}}",
+            self.max_depth,
+            self.ray_budget
+                .map_or("null".to_string(), |budget| budget.to_string()),
+            self.shadows,
+            match self.falloff {
+                Falloff::Constant => "constant",
+                Falloff::InverseSquare => "inverse-square",
+            },
+            self.background
+                .as_ref()
+                .and_then(marshal_background)
+                .map_or("null".to_string(), |item| json(&item)),
+        )
+    }
+
+    fn parse(value: &Value) -> Result<Settings, Error> {
+        Ok(Settings {
+            max_depth: count(field(value, "max-depth")?)?,
+            ray_budget: match field(value, "ray-budget")? {
+                budget if budget.as_str() == Some("null") => None,
+                budget => Some(count(budget)?),
+            },
+            shadows: boolean(field(value, "shadows")?)?,
+            falloff: match string(field(value, "falloff")?)? {
+                "constant" => Falloff::Constant,
+                "inverse-square" => Falloff::InverseSquare,
+                other => {
+                    return Err(Error::Invalid(format!(
+                        "unknown light falloff \"{}\"",
+                        other
+                    )))
+                }
+            },
+            background: match field(value, "background")? {
+                background if background.as_str() == Some("null") => None,
+                background => Some(load_background(background)?),
+            },
+        })
+    }
+}
+
+impl Manifest {
+    /// a digest of the world and camera, which is the same for as long as the scene
+    /// is. the scene is digested as it would be saved by `marshal`, so whatever
+    /// cannot be saved (such as images) is left out.
+    pub fn scene_hash(world: &World, camera: &Camera) -> u64 {
+        fnv(marshal(world, camera).as_bytes())
+    }
+
+    pub fn to_json(&self) -> String {
+        let mut json = String::new();
+        let _ = write!(
+            json,
+            "{{\"version\":{},\"scene\":\"{:016x}\",\"seed\":{},\"quality\":\"{}\",\
+             \"settings\":{},\"workers\":{},\"tile-size\":{},\"order\":\"{}\",\"format\":\"{}\",\
+             \"exposure\":{:?},\"budget\":{},\"elapsed\":{:?},\"image\":\"{:016x}\",\
+             \"stats\":",
+            quoted(&self.version),
+            self.scene,
+            self.seed,
+            self.quality.name(),
+            self.settings.to_json(),
+            self.schedule.workers,
+            self.schedule.tile_size,
+            self.schedule.order.name(),
+            self.format.extension(),
+            self.exposure,
+            self.budget
+                .map_or("null".to_string(), |budget| format!("{:?}", budget)),
+            self.elapsed.as_secs_f64(),
+            self.image,
+        );
+
+        match &self.stats {
+            Some(report) => {
+                let objects: Vec<String> = report
+                    .objects
+                    .iter()
+                    .map(|stats| {
+                        format!(
+                            "{{\"object\":{},\"name\":{},\"tests\":{},\"hits\":{},\"time\":{:?}}}",
+                            stats.object,
+                            stats.name.as_deref().map_or("null".to_string(), quoted),
+                            stats.tests,
+                            stats.hits,
+                            stats.time.as_secs_f64()
+                        )
+                    })
+                    .collect();
+                let _ = write!(json, "[{}]", objects.join(","));
+            }
+            None => json.push_str("null"),
+        }
+
+        json.push_str("}\n");
+        json
+    }
+
+    /// the settings of the render as lines of text, to be written into the image
+    /// itself so that it describes how it was made; see `Canvas::export_with_comments`.
+    pub fn comments(&self) -> Vec<String> {
+        let mut comments = vec![
+            format!("ray-tracer-challenge {}", self.version),
+            format!("scene: {:016x}", self.scene),
+            // the final preset keeps the camera's samples, which are part of the scene.
+            match self.quality.samples() {
+                Some(samples) => format!(
+                    "quality: {} ({} samples per pixel)",
+                    self.quality.name(),
+                    samples * samples
+                ),
+                None => format!("quality: {}", self.quality.name()),
+            },
+            format!("seed: {}", self.seed),
+            format!("exposure: {:+}", self.exposure),
+        ];
+        if let Some(budget) = self.budget {
+            comments.push(format!("budget: {}s", budget));
+        }
+        comments.push(format!("elapsed: {:.3}s", self.elapsed.as_secs_f64()));
+        comments
+    }
+
+    /// reads a manifest written by `to_json`.
+    pub fn parse(source: &str) -> Result<Manifest, Error> {
+        let value = yaml::parse(source)?;
+        let invalid = |message: String| Error::Invalid(message);
+        // a number of seconds, which cannot be negative, nan, or too long to hold.
+        let duration = |value: &Value| -> Result<Duration, Error> {
+            let seconds = number(value)?;
+            Duration::try_from_secs_f64(seconds)
+                .map_err(|_| invalid(format!("expected a duration in seconds, got {}", seconds)))
+        };
+        let hex = |key: &str| {
+            let text = string(field(&value, key)?)?;
+            u64::from_str_radix(text, 16)
+                .map_err(|_| invalid(format!("expected a hexadecimal digest, got \"{}\"", text)))
+        };
+        let optional = |key: &str| match value.get(key) {
+            Some(value) if value.as_str() != Some("null") => Some(value),
+            _ => None,
+        };
+
+        let stats = match optional("stats") {
+            Some(stats) => {
+                let objects = stats
+                    .as_sequence()
+                    .ok_or_else(|| invalid("expected a list of stats".to_string()))?;
+                let objects = objects
+                    .iter()
+                    .map(|object| {
+                        Ok(ObjectStats {
+                            object: count(field(object, "object")?)?,
+                            name: match object.get("name") {
+                                Some(name) if name.as_str() != Some("null") => {
+                                    Some(string(name)?.into())
+                                }
+                                _ => None,
+                            },
+                            tests: count(field(object, "tests")?)? as u64,
+                            hits: count(field(object, "hits")?)? as u64,
+                            time: duration(field(object, "time")?)?,
+                        })
+                    })
+                    .collect::<Result<Vec<ObjectStats>, Error>>()?;
+                Some(Report { objects })
+            }
+            None => None,
+        };
+
+        Ok(Manifest {
+            version: string(field(&value, "version")?)?.to_string(),
+            scene: hex("scene")?,
+            seed: count(field(&value, "seed")?)? as u64,
+            quality: string(field(&value, "quality")?)?
+                .parse()
+                .map_err(|e| invalid(format!("{}", e)))?,
+            settings: Settings::parse(field(&value, "settings")?)?,
+            schedule: Schedule::default()
+                .with_workers(count(field(&value, "workers")?)?)
+                .with_tile_size(count(field(&value, "tile-size")?)?)
+                .with_order(
+                    string(field(&value, "order")?)?
+                        .parse()
+                        .map_err(|e| invalid(format!("{}", e)))?,
+                ),
+            format: string(field(&value, "format")?)?
+                .parse()
+                .map_err(|e| invalid(format!("{}", e)))?,
+            exposure: number(field(&value, "exposure")?)?,
+            budget: optional("budget")
+                .map(|budget| duration(budget).and(number(budget)))
+                .transpose()?,
+            elapsed: duration(field(&value, "elapsed")?)?,
+            image: hex("image")?,
+            stats,
+        })
+    }
+}
+
+/// `text` as a json string.
+fn quoted(text: &str) -> String {
+    let mut quoted = String::from("\"");
+    for c in text.chars() {
+        match c {
+            '"' => quoted.push_str("\\\""),
+            '\\' => quoted.push_str("\\\\"),
+            '\n' => quoted.push_str("\\n"),
+            '\t' => quoted.push_str("\\t"),
+            c => quoted.push(c),
+        }
+    }
+    quoted.push('"');
+    quoted
+}
+
+/// whether `text` is a number as json writes them, which (unlike what `f64` parses)
+/// has no leading `+`, no leading zeroes, and digits on both sides of any point.
+fn is_json_number(text: &str) -> bool {
+    let digits = |text: &str| !text.is_empty() && text.bytes().all(|b| b.is_ascii_digit());
+    let text = text.strip_prefix('-').unwrap_or(text);
+    let (mantissa, exponent) = match text.find(|c| c == 'e' || c == 'E') {
+        Some(i) => (&text[..i], Some(&text[i + 1..])),
+        None => (text, None),
+    };
+    let (integer, fraction) = match mantissa.find('.') {
+        Some(i) => (&mantissa[..i], Some(&mantissa[i + 1..])),
+        None => (mantissa, None),
+    };
+
+    digits(integer)
+        && (integer == "0" || !integer.starts_with('0'))
+        && fraction.map_or(true, digits)
+        && exponent.map_or(true, |exponent| {
+            digits(exponent.strip_prefix(&['+', '-'][..]).unwrap_or(exponent))
+        })
+}
+
+/// a scene file's `value` as json. scalars which are numbers or booleans are written
+/// as such, and the rest as strings; scene files read them all the same either way.
+fn json(value: &Value) -> String {
+    match value {
+        Value::Scalar(scalar) if scalar == "true" || scalar == "false" => scalar.clone(),
+        Value::Scalar(scalar) if is_json_number(scalar) => scalar.clone(),
+        Value::Scalar(scalar) => quoted(scalar),
+        Value::Sequence(sequence) => {
+            let values: Vec<String> = sequence.iter().map(json).collect();
+            format!("[{}]", values.join(","))
+        }
+        Value::Mapping(mapping) => {
+            let entries: Vec<String> = mapping
+                .iter()
+                .map(|(key, value)| format!("{}:{}", quoted(key), json(value)))
+                .collect();
+            format!("{{{}}}", entries.join(","))
+        }
+    }
+}
+
+/// 64-bit fnv-1a, as `Canvas::hash` uses.
+fn fnv(bytes: &[u8]) -> u64 {
+    const OFFSET_BASIS: u64 = 0xcbf2_9ce4_8422_2325;
+    const PRIME: u64 = 0x0000_0100_0000_01b3;
+
+    bytes.iter().fold(OFFSET_BASIS, |hash, &byte| {
+        (hash ^ byte as u64).wrapping_mul(PRIME)
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        math::{Matrix, Point, Transformable, Vector},
+        world::{background::Sky, camera::Order, Color, View},
+    };
+    use std::f64::consts;
+
+    fn manifest() -> Manifest {
+        Manifest {
+            version: "0.1.0".to_string(),
+            scene: 0x0123_4567_89ab_cdef,
+            seed: 7,
+            quality: Quality::Medium,
+            settings: Settings {
+                max_depth: 3,
+                ray_budget: Some(20),
+                shadows: false,
+                falloff: Falloff::InverseSquare,
+                background: Some(Background::sky(
+                    Sky::new(Color::new(0.9, 0.9, 1.0), Color::new(0.2, 0.4, 0.8)).with_sun(
+                        Vector::new(0.0, 1.0, 1.0),
+                        0.1,
+                        Color::new(1.0, 1.0, 0.9),
+                    ),
+                )),
+            },
+            schedule: Schedule::default()
+                .with_workers(3)
+                .with_tile_size(16)
+                .with_order(Order::Spiral),
+            format: Format::Csv,
+            exposure: -1.5,
+            budget: None,
+            elapsed: Duration::from_millis(1250),
+            image: 42,
+            stats: Some(Report {
+                objects: vec![
+                    ObjectStats {
+                        object: 1,
+                        name: Some("a \"quoted\" name".into()),
+                        tests: 100,
+                        hits: 20,
+                        time: Duration::from_micros(300),
+                    },
+                    ObjectStats {
+                        object: 0,
+                        name: None,
+                        tests: 50,
+                        hits: 0,
+                        time: Duration::from_micros(100),
+                    },
+                ],
+            }),
+        }
+    }
+
+    #[test]
+    fn manifest_round_trip() {
+        let manifest = manifest();
+        assert_eq!(Manifest::parse(&manifest.to_json()), Ok(manifest.clone()));
+
+        let manifest = Manifest {
+            budget: Some(2.5),
+            settings: Settings {
+                ray_budget: None,
+                background: None,
+                ..manifest.settings.clone()
+            },
+            stats: None,
+            ..manifest
+        };
+        assert_eq!(Manifest::parse(&manifest.to_json()), Ok(manifest));
+    }
+
+    #[test]
+    fn settings_restore_world() {
+        fn by_direction(direction: Vector) -> Color {
+            Color::from_vector(direction)
+        }
+
+        let mut world = World::default();
+        world.max_depth = 1;
+        world.ray_budget = Some(8);
+        world.falloff = Falloff::InverseSquare;
+        world.background = Background::solid(Color::new(0.1, 0.2, 0.3));
+        let settings = Settings::of(&world);
+
+        let mut again = World::default();
+        again.background = Background::function(by_direction);
+        settings.apply(&mut again);
+        assert_eq!(again.max_depth, 1);
+        assert_eq!(again.ray_budget, Some(8));
+        assert!(again.shadows);
+        assert_eq!(again.falloff, Falloff::InverseSquare);
+        assert_eq!(again.background, world.background);
+
+        // a function is kept as it is, since it could not be recorded.
+        let mut function = World::default();
+        function.background = Background::function(by_direction);
+        let settings = Settings::of(&function);
+        assert_eq!(settings.background, None);
+        settings.apply(&mut world);
+        assert_eq!(
+            world.background,
+            Background::solid(Color::new(0.1, 0.2, 0.3))
+        );
+    }
+
+    #[test]
+    fn manifest_is_json() {
+        let json = manifest().to_json();
+        assert!(json.starts_with("{\"version\":\"0.1.0\",\"scene\":\"0123456789abcdef\","));
+        assert!(json.contains("\"budget\":null,"));
+        assert!(json.contains("\"radius\":0.1"));
+        assert!(json.ends_with("}\n"));
+    }
+
+    #[test]
+    fn scalars_keep_their_json_types() {
+        let scalars = ["1", "-0.25", "2e-3", "true", "01", "+1", ".5", "NaN", "no"];
+        let value = Value::Sequence(
+            scalars
+                .iter()
+                .map(|scalar| Value::Scalar(scalar.to_string()))
+                .collect(),
+        );
+        assert_eq!(
+            json(&value),
+            r#"[1,-0.25,2e-3,true,"01","+1",".5","NaN","no"]"#
+        );
+    }
+
+    #[test]
+    fn manifest_comments() {
+        let manifest = manifest();
+        assert_eq!(
+            manifest.comments(),
+            [
+                "ray-tracer-challenge 0.1.0",
+                "scene: 0123456789abcdef",
+                "quality: medium (4 samples per pixel)",
+                "seed: 7",
+                "exposure: -1.5",
+                "elapsed: 1.250s",
+            ]
+        );
+
+        let manifest = Manifest {
+            budget: Some(2.5),
+            ..manifest
+        };
+        assert!(manifest.comments().contains(&"budget: 2.5s".to_string()));
+    }
+
+    #[test]
+    fn invalid_manifest() {
+        let json = manifest().to_json().replace("\"spiral\"", "\"zigzag\"");
+        assert_eq!(
+            Manifest::parse(&json),
+            Err(Error::Invalid(
+                "unknown tile order \"zigzag\" (expected scanline, spiral, or hilbert)".to_string()
+            ))
+        );
+
+        for (elapsed, shown) in [("-1.0", "-1"), ("NaN", "NaN")].iter() {
+            let json = manifest()
+                .to_json()
+                .replace("\"elapsed\":1.25", &format!("\"elapsed\":{}", elapsed));
+            assert_eq!(
+                Manifest::parse(&json),
+                Err(Error::Invalid(format!(
+                    "expected a duration in seconds, got {}",
+                    shown
+                )))
+            );
+        }
+    }
+
+    #[test]
+    fn scene_hash_follows_scene() {
+        let mut world = World::default();
+        let mut camera = Camera::new(10, 10, consts::PI / 2.0);
+        camera.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+
+        let hash = Manifest::scene_hash(&world, &camera);
+        assert_eq!(hash, Manifest::scene_hash(&World::default(), &camera));
+        world.objects[1].transform(Matrix::translation(0.0, 0.1, 0.0));
+        assert_ne!(hash, Manifest::scene_hash(&world, &camera));
+    }
+}
@@ -0,0 +1,68 @@
+use crate::world::{pattern::Grid, Color, Material, Pattern, Texture};
+
+/// a rough surface with no highlights.
+pub fn matte(color: Color) -> Material {
+    Material {
+        specular: 0.0,
+        ..Material::default().with_texture(Texture::pattern(Pattern::solid(color)))
+    }
+}
+
+/// a smooth surface with small, bright highlights.
+pub fn plastic(color: Color) -> Material {
+    Material {
+        diffuse: 0.7,
+        specular: 0.3,
+        shininess: 300.0,
+        ..Material::default().with_texture(Texture::pattern(Pattern::solid(color)))
+    }
+}
+
+/// a matte surface covered by a three-dimensional checkerboard.
+pub fn checkered(a: Color, b: Color) -> Material {
+    Material {
+        specular: 0.0,
+        ..Material::default().with_texture(Texture::pattern(Pattern::grid(Grid::new(a, b))))
+    }
+}
+
+/// a clear surface with sharp highlights, which lets most light through and bends it
+/// as glass does.
+pub fn glass(tint: Color) -> Material {
+    Material {
+        ambient: 0.0,
+        diffuse: 0.1,
+        specular: 1.0,
+        shininess: 300.0,
+        transparency: 0.9,
+        reflective: 0.9,
+        refractive_index: 1.5,
+        ..Material::default().with_texture(Texture::pattern(Pattern::solid(tint)))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn glass_lets_light_through() {
+        let m = glass(Color::white());
+        assert!(m.transparency > 0.5);
+        assert_eq!(m.ambient, 0.0);
+    }
+
+    #[test]
+    fn matte_has_no_highlights() {
+        let m = matte(Color::white());
+        assert_eq!(m.specular, 0.0);
+        assert_eq!(m.texture, Texture::pattern(Pattern::solid(Color::white())));
+    }
+
+    #[test]
+    fn plastic_is_shiny() {
+        let m = plastic(Color::white());
+        assert!(m.specular > 0.0);
+        assert!(m.shininess > Material::default().shininess);
+    }
+}
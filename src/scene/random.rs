@@ -0,0 +1,164 @@
+use crate::{
+    math::{geometry::Group, Form, Geometry, Matrix, Point, Transformable},
+    scene::presets,
+    world::{camera::Sampler, light, Color, Light, Material, World},
+};
+
+/// describes a world full of spheres of random sizes, colors, and finishes, scattered
+/// at random through a cube, for benchmarks and for testing the acceleration
+/// structures with many objects. the same seed always makes the same world.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct RandomScene {
+    pub spheres: usize,
+    pub seed: u64,
+    /// the spheres' centers lie within the cube from `-extent` to `extent` along
+    /// each axis.
+    pub extent: f64,
+    /// the smallest and largest radius of a sphere.
+    pub radii: (f64, f64),
+    /// if set, the spheres are put into one group, which is divided with this
+    /// threshold (see `Group::divided`); otherwise each sphere is its own object.
+    pub divide: Option<usize>,
+}
+
+impl RandomScene {
+    pub fn new(spheres: usize, seed: u64) -> RandomScene {
+        RandomScene {
+            spheres,
+            seed,
+            extent: 10.0,
+            radii: (0.1, 1.0),
+            divide: None,
+        }
+    }
+
+    pub fn with_extent(self, extent: f64) -> RandomScene {
+        RandomScene { extent, ..self }
+    }
+
+    pub fn with_radii(self, smallest: f64, largest: f64) -> RandomScene {
+        RandomScene {
+            radii: (smallest, largest),
+            ..self
+        }
+    }
+
+    pub fn with_divide(self, threshold: usize) -> RandomScene {
+        RandomScene {
+            divide: Some(threshold),
+            ..self
+        }
+    }
+
+    /// the spheres, each placed in the world.
+    pub fn spheres(&self) -> Vec<Geometry> {
+        let mut sampler = Sampler::new(self.seed, 0, 0);
+        let mut between = |low: f64, high: f64| low + (high - low) * sampler.next_f64();
+
+        (0..self.spheres)
+            .map(|_| {
+                let radius = between(self.radii.0, self.radii.1);
+                let center = Point::new(
+                    between(-self.extent, self.extent),
+                    between(-self.extent, self.extent),
+                    between(-self.extent, self.extent),
+                );
+                let color = Color::new(between(0.0, 1.0), between(0.0, 1.0), between(0.0, 1.0));
+                let material = if between(0.0, 1.0) < 0.5 {
+                    presets::matte(color)
+                } else {
+                    Material {
+                        shininess: between(10.0, 300.0),
+                        ..presets::plastic(color)
+                    }
+                };
+
+                Geometry::default()
+                    .with_form(Form::Sphere)
+                    .with_material(material)
+                    .transformed(
+                        Matrix::translation(center[0], center[1], center[2])
+                            * Matrix::scaling(radius, radius, radius),
+                    )
+            })
+            .collect()
+    }
+
+    /// a world of the spheres, lit by a white light above and in front of the cube.
+    pub fn build(&self) -> World {
+        let spheres = self.spheres();
+        let objects =
+            match self.divide {
+                Some(threshold) => vec![Geometry::default()
+                    .with_form(Form::Group(Group::new(spheres).divided(threshold)))],
+                None => spheres,
+            };
+
+        let light = light::Point::new(
+            Point::new(-2.0 * self.extent, 2.0 * self.extent, -2.0 * self.extent),
+            Color::white(),
+        );
+        World::new(objects, vec![Light::point(light)])
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        math::{Hittable, Vector},
+        world::Ray,
+    };
+
+    #[test]
+    fn same_seed_same_world() {
+        let a = RandomScene::new(20, 7).build();
+        let b = RandomScene::new(20, 7).build();
+        assert_eq!(a.objects, b.objects);
+        assert_eq!(a.objects.len(), 20);
+        assert_ne!(RandomScene::new(20, 8).build().objects, a.objects);
+    }
+
+    #[test]
+    fn spheres_lie_within_extent() {
+        let scene = RandomScene::new(50, 1)
+            .with_extent(3.0)
+            .with_radii(0.5, 0.5);
+        for sphere in scene.spheres() {
+            let bounds = sphere.bounds();
+            assert!(bounds.max[0] - bounds.min[0] - 1.0 < 1e-9);
+            for axis in 0..3 {
+                assert!(-3.5 <= bounds.min[axis] && bounds.max[axis] <= 3.5);
+            }
+        }
+    }
+
+    #[test]
+    fn divided_world_is_hit_the_same() {
+        let scene = RandomScene::new(200, 3).with_extent(5.0);
+        let flat = scene.build();
+        let divided = scene.with_divide(4).build();
+        assert_eq!(divided.objects.len(), 1);
+
+        // cast rays in random directions from random points around the cube.
+        let mut sampler = Sampler::new(99, 0, 0);
+        let mut next = || sampler.next_f64() * 2.0 - 1.0;
+        for _ in 0..500 {
+            let origin = Point::new(next() * 10.0, next() * 10.0, next() * 10.0);
+            let ray = Ray::new(origin, Vector::new(next(), next(), next()));
+            let times = |world: &World| -> Vec<f64> {
+                world.hit(ray).map_or(vec![], |hits| {
+                    hits.iter().map(|hit| hit.time).collect::<Vec<f64>>()
+                })
+            };
+            let (expected, actual) = (times(&flat), times(&divided));
+            assert_eq!(expected.len(), actual.len());
+            for (e, a) in expected.iter().zip(&actual) {
+                assert!((e - a).abs() < 1e-9);
+            }
+
+            let closest = divided.objects[0].hit(ray).and_then(|hits| hits.closest());
+            assert_eq!(closest.map(|hit| hit.time), expected.first().copied());
+        }
+    }
+}
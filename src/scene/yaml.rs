@@ -0,0 +1,727 @@
+use std::{
+    error,
+    fmt::{self, Display, Formatter},
+};
+
+/// a node of a yaml document. only the subset of yaml which is needed by scene files
+/// is supported: block and flow sequences, block and flow mappings, plain and
+/// double-quoted scalars, and comments. scalars are kept as text, and are interpreted
+/// by whoever reads the document.
+#[derive(Clone, Debug, PartialEq)]
+pub enum Value {
+    Scalar(String),
+    Sequence(Vec<Value>),
+    Mapping(Vec<(String, Value)>),
+}
+
+impl Value {
+    pub fn scalar<S: ToString>(scalar: S) -> Value {
+        Value::Scalar(scalar.to_string())
+    }
+
+    pub fn as_str(&self) -> Option<&str> {
+        match self {
+            Value::Scalar(scalar) => Some(scalar),
+            _ => None,
+        }
+    }
+
+    pub fn as_sequence(&self) -> Option<&[Value]> {
+        match self {
+            Value::Sequence(sequence) => Some(sequence),
+            _ => None,
+        }
+    }
+
+    pub fn as_mapping(&self) -> Option<&[(String, Value)]> {
+        match self {
+            Value::Mapping(mapping) => Some(mapping),
+            _ => None,
+        }
+    }
+
+    /// looks up the value of `key`, if this is a mapping which contains it.
+    pub fn get(&self, key: &str) -> Option<&Value> {
+        self.as_mapping()?
+            .iter()
+            .find(|(k, _)| k == key)
+            .map(|(_, value)| value)
+    }
+
+    fn is_flow(&self) -> bool {
+        match self {
+            Value::Scalar(_) => true,
+            Value::Sequence(sequence) => sequence.iter().all(|value| match value {
+                Value::Scalar(_) => true,
+                _ => false,
+            }),
+            Value::Mapping(_) => false,
+        }
+    }
+
+    fn write_flow(&self, out: &mut String) {
+        match self {
+            Value::Scalar(scalar) => write_scalar(scalar, out),
+            Value::Sequence(sequence) => {
+                out.push_str("[ ");
+                for (i, value) in sequence.iter().enumerate() {
+                    if i > 0 {
+                        out.push_str(", ");
+                    }
+                    value.write_flow(out);
+                }
+                out.push_str(" ]");
+            }
+            Value::Mapping(_) => unreachable!("mappings are always written in block style"),
+        }
+    }
+
+    fn write_block(&self, out: &mut String, indent: usize) {
+        let padding = " ".repeat(indent);
+
+        match self {
+            Value::Sequence(sequence) => {
+                for (i, value) in sequence.iter().enumerate() {
+                    // separate the items of the top-level sequence, since they tend to be large.
+                    if indent == 0 && i > 0 {
+                        out.push('\n');
+                    }
+                    out.push_str(&padding);
+                    out.push_str("- ");
+                    match value {
+                        Value::Mapping(mapping) if !mapping.is_empty() => {
+                            // the first entry shares the line with the dash.
+                            let mut entry = String::new();
+                            Value::Mapping(mapping.clone()).write_block(&mut entry, indent + 2);
+                            out.push_str(&entry[indent + 2..]);
+                        }
+                        value if value.is_flow() => {
+                            value.write_flow(out);
+                            out.push('\n');
+                        }
+                        value => {
+                            out.push('\n');
+                            value.write_block(out, indent + 2);
+                        }
+                    }
+                }
+            }
+            Value::Mapping(mapping) => {
+                for (key, value) in mapping {
+                    out.push_str(&padding);
+                    write_scalar(key, out);
+                    out.push(':');
+                    if value.is_flow() {
+                        out.push(' ');
+                        value.write_flow(out);
+                        out.push('\n');
+                    } else {
+                        out.push('\n');
+                        value.write_block(out, indent + 2);
+                    }
+                }
+            }
+            Value::Scalar(_) => {
+                out.push_str(&padding);
+                self.write_flow(out);
+                out.push('\n');
+            }
+        }
+    }
+}
+
+impl Display for Value {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        let mut out = String::new();
+        self.write_block(&mut out, 0);
+        write!(f, "{}", out)
+    }
+}
+
+fn write_scalar(scalar: &str, out: &mut String) {
+    let needs_quotes = scalar.is_empty()
+        || scalar.trim() != scalar
+        || is_sequence_item(scalar)
+        || scalar.chars().any(|c| ":#[]{},\"'\n\\".contains(c));
+
+    if needs_quotes {
+        out.push('"');
+        for c in scalar.chars() {
+            match c {
+                '"' => out.push_str("\\\""),
+                '\\' => out.push_str("\\\\"),
+                '\n' => out.push_str("\\n"),
+                c => out.push(c),
+            }
+        }
+        out.push('"');
+    } else {
+        out.push_str(scalar);
+    }
+}
+
+/// returned when a document cannot be parsed.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParseError {
+    /// the line (counting from 1) on which the problem was found.
+    pub line: usize,
+    pub message: String,
+}
+
+impl ParseError {
+    fn new<S: ToString>(line: usize, message: S) -> ParseError {
+        ParseError {
+            line,
+            message: message.to_string(),
+        }
+    }
+}
+
+impl Display for ParseError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(f, "line {}: {}", self.line, self.message)
+    }
+}
+
+impl error::Error for ParseError {}
+
+/// a line of the document with comments and indentation removed.
+struct Line {
+    number: usize,
+    indent: usize,
+    content: String,
+}
+
+/// parses a yaml document. an empty document is parsed as an empty sequence.
+pub fn parse(source: &str) -> Result<Value, ParseError> {
+    let mut lines: Vec<Line> = vec![];
+
+    for (i, raw) in source.lines().enumerate() {
+        if raw
+            .chars()
+            .take_while(|c| c.is_whitespace())
+            .any(|c| c == '\t')
+        {
+            return Err(ParseError::new(
+                i + 1,
+                "tabs cannot be used for indentation",
+            ));
+        }
+        let content = strip_comment(raw).trim_end();
+        let trimmed = content.trim_start();
+        if trimmed.is_empty() || trimmed == "---" {
+            continue;
+        }
+        lines.push(Line {
+            number: i + 1,
+            indent: content.len() - trimmed.len(),
+            content: trimmed.to_string(),
+        });
+    }
+
+    if lines.is_empty() {
+        return Ok(Value::Sequence(vec![]));
+    }
+
+    let mut position = 0;
+    let indent = lines[0].indent;
+    let value = parse_block(&mut lines, &mut position, indent)?;
+
+    if position < lines.len() {
+        Err(ParseError::new(
+            lines[position].number,
+            "unexpected indentation",
+        ))
+    } else {
+        Ok(value)
+    }
+}
+
+fn strip_comment(line: &str) -> &str {
+    let mut in_quotes = false;
+    let mut previous = ' ';
+
+    for (i, c) in line.char_indices() {
+        match c {
+            '"' if previous != '\\' => in_quotes = !in_quotes,
+            '#' if !in_quotes && previous.is_whitespace() => return &line[..i],
+            _ => (),
+        }
+        previous = c;
+    }
+
+    line
+}
+
+fn is_sequence_item(content: &str) -> bool {
+    content == "-" || content.starts_with("- ")
+}
+
+/// finds the `key: value` separator of a mapping entry, if the content is one.
+fn split_entry(content: &str) -> Option<(&str, &str)> {
+    if content.starts_with('[') || content.starts_with('{') {
+        return None;
+    }
+
+    let mut in_quotes = false;
+    let mut previous = ' ';
+
+    for (i, c) in content.char_indices() {
+        match c {
+            '"' if previous != '\\' => in_quotes = !in_quotes,
+            ':' if !in_quotes => {
+                let rest = &content[i + 1..];
+                if rest.is_empty() || rest.starts_with(' ') {
+                    return Some((content[..i].trim(), rest.trim()));
+                }
+            }
+            _ => (),
+        }
+        previous = c;
+    }
+
+    None
+}
+
+fn parse_block(
+    lines: &mut Vec<Line>,
+    position: &mut usize,
+    indent: usize,
+) -> Result<Value, ParseError> {
+    let line = &lines[*position];
+    if is_sequence_item(&line.content) {
+        parse_sequence(lines, position, indent)
+    } else if line.content.starts_with('[') || line.content.starts_with('{') {
+        // a flow collection on a line of its own, such as a document which is
+        // written as one line of json.
+        let value = parse_flow(&line.content, line.number)?;
+        *position += 1;
+        Ok(value)
+    } else {
+        parse_mapping(lines, position, indent)
+    }
+}
+
+fn parse_sequence(
+    lines: &mut Vec<Line>,
+    position: &mut usize,
+    indent: usize,
+) -> Result<Value, ParseError> {
+    let mut sequence = vec![];
+
+    while *position < lines.len()
+        && lines[*position].indent == indent
+        && is_sequence_item(&lines[*position].content)
+    {
+        let line = &lines[*position];
+        let rest = line.content[1..].trim_start().to_string();
+        let number = line.number;
+
+        if rest.is_empty() {
+            *position += 1;
+            match lines.get(*position) {
+                Some(next) if next.indent > indent => {
+                    let nested = next.indent;
+                    sequence.push(parse_block(lines, position, nested)?);
+                }
+                _ => sequence.push(Value::scalar("")),
+            }
+        } else if is_sequence_item(&rest) || split_entry(&rest).is_some() {
+            // the item is a block collection which starts on the same line as the dash,
+            // so treat the rest of the line as if it were on its own line.
+            let nested = indent + (line.content.len() - rest.len());
+            lines[*position] = Line {
+                number,
+                indent: nested,
+                content: rest,
+            };
+            sequence.push(parse_block(lines, position, nested)?);
+        } else {
+            sequence.push(parse_flow(&rest, number)?);
+            *position += 1;
+        }
+    }
+
+    Ok(Value::Sequence(sequence))
+}
+
+fn parse_mapping(
+    lines: &mut Vec<Line>,
+    position: &mut usize,
+    indent: usize,
+) -> Result<Value, ParseError> {
+    let mut mapping: Vec<(String, Value)> = vec![];
+
+    while *position < lines.len()
+        && lines[*position].indent == indent
+        && !is_sequence_item(&lines[*position].content)
+    {
+        let line = &lines[*position];
+        let number = line.number;
+        let (key, rest) = match split_entry(&line.content) {
+            Some((key, rest)) => (unquote(key, number)?, rest.to_string()),
+            None => return Err(ParseError::new(number, "expected a `key: value` entry")),
+        };
+        if mapping.iter().any(|(k, _)| *k == key) {
+            return Err(ParseError::new(
+                number,
+                format!("duplicate key \"{}\"", key),
+            ));
+        }
+        *position += 1;
+
+        let value = if !rest.is_empty() {
+            parse_flow(&rest, number)?
+        } else {
+            match lines.get(*position) {
+                Some(next) if next.indent > indent => {
+                    let nested = next.indent;
+                    parse_block(lines, position, nested)?
+                }
+                // a sequence is allowed to be at the same indentation as its key.
+                Some(next) if next.indent == indent && is_sequence_item(&next.content) => {
+                    parse_sequence(lines, position, indent)?
+                }
+                _ => Value::scalar(""),
+            }
+        };
+
+        mapping.push((key, value));
+    }
+
+    Ok(Value::Mapping(mapping))
+}
+
+fn unquote(text: &str, line: usize) -> Result<String, ParseError> {
+    let mut parser = Flow {
+        chars: text.chars().collect(),
+        position: 0,
+        line,
+    };
+    let value = parser.scalar(false)?;
+    Ok(value)
+}
+
+fn parse_flow(text: &str, line: usize) -> Result<Value, ParseError> {
+    let mut parser = Flow {
+        chars: text.chars().collect(),
+        position: 0,
+        line,
+    };
+    let value = parser.value(false)?;
+    parser.skip_whitespace();
+    if parser.position < parser.chars.len() {
+        Err(ParseError::new(line, "unexpected characters after value"))
+    } else {
+        Ok(value)
+    }
+}
+
+/// parser for values written on a single line, such as `[ 1, 2, { a: 3 } ]`.
+struct Flow {
+    chars: Vec<char>,
+    position: usize,
+    line: usize,
+}
+
+impl Flow {
+    fn peek(&self) -> Option<char> {
+        self.chars.get(self.position).copied()
+    }
+
+    fn skip_whitespace(&mut self) {
+        while let Some(c) = self.peek() {
+            if !c.is_whitespace() {
+                break;
+            }
+            self.position += 1;
+        }
+    }
+
+    fn expect(&mut self, expected: char) -> Result<(), ParseError> {
+        self.skip_whitespace();
+        if self.peek() == Some(expected) {
+            self.position += 1;
+            Ok(())
+        } else {
+            Err(ParseError::new(
+                self.line,
+                format!("expected `{}`", expected),
+            ))
+        }
+    }
+
+    fn value(&mut self, nested: bool) -> Result<Value, ParseError> {
+        self.skip_whitespace();
+        match self.peek() {
+            Some('[') => self.sequence(),
+            Some('{') => self.mapping(),
+            _ => Ok(Value::Scalar(self.scalar(nested)?)),
+        }
+    }
+
+    fn sequence(&mut self) -> Result<Value, ParseError> {
+        self.expect('[')?;
+        let mut sequence = vec![];
+
+        self.skip_whitespace();
+        if self.peek() == Some(']') {
+            self.position += 1;
+            return Ok(Value::Sequence(sequence));
+        }
+
+        loop {
+            sequence.push(self.value(true)?);
+            self.skip_whitespace();
+            match self.peek() {
+                Some(',') => self.position += 1,
+                Some(']') => {
+                    self.position += 1;
+                    return Ok(Value::Sequence(sequence));
+                }
+                _ => return Err(ParseError::new(self.line, "expected `,` or `]`")),
+            }
+        }
+    }
+
+    fn mapping(&mut self) -> Result<Value, ParseError> {
+        self.expect('{')?;
+        let mut mapping = vec![];
+
+        self.skip_whitespace();
+        if self.peek() == Some('}') {
+            self.position += 1;
+            return Ok(Value::Mapping(mapping));
+        }
+
+        loop {
+            self.skip_whitespace();
+            let key = self.scalar(true)?;
+            self.expect(':')?;
+            let value = self.value(true)?;
+            mapping.push((key, value));
+            self.skip_whitespace();
+            match self.peek() {
+                Some(',') => self.position += 1,
+                Some('}') => {
+                    self.position += 1;
+                    return Ok(Value::Mapping(mapping));
+                }
+                _ => return Err(ParseError::new(self.line, "expected `,` or `}`")),
+            }
+        }
+    }
+
+    /// reads a scalar. inside of a flow collection, a plain scalar ends at the
+    /// characters which delimit the collection.
+    fn scalar(&mut self, nested: bool) -> Result<String, ParseError> {
+        self.skip_whitespace();
+
+        if self.peek() == Some('"') {
+            self.position += 1;
+            let mut scalar = String::new();
+            loop {
+                match self.peek() {
+                    Some('"') => {
+                        self.position += 1;
+                        return Ok(scalar);
+                    }
+                    Some('\\') => {
+                        self.position += 1;
+                        match self.peek() {
+                            Some('n') => scalar.push('\n'),
+                            Some('t') => scalar.push('\t'),
+                            Some(c) => scalar.push(c),
+                            None => break,
+                        }
+                        self.position += 1;
+                    }
+                    Some(c) => {
+                        scalar.push(c);
+                        self.position += 1;
+                    }
+                    None => break,
+                }
+            }
+            return Err(ParseError::new(self.line, "unterminated string"));
+        }
+
+        let start = self.position;
+        while let Some(c) = self.peek() {
+            if nested && (c == ',' || c == ']' || c == '}' || c == ':') {
+                break;
+            }
+            self.position += 1;
+        }
+
+        Ok(self.chars[start..self.position]
+            .iter()
+            .collect::<String>()
+            .trim()
+            .to_string())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn seq(values: Vec<Value>) -> Value {
+        Value::Sequence(values)
+    }
+
+    fn map(entries: Vec<(&str, Value)>) -> Value {
+        Value::Mapping(
+            entries
+                .into_iter()
+                .map(|(key, value)| (key.to_string(), value))
+                .collect(),
+        )
+    }
+
+    fn s(scalar: &str) -> Value {
+        Value::scalar(scalar)
+    }
+
+    #[test]
+    fn parse_empty_document() {
+        assert_eq!(parse(""), Ok(seq(vec![])));
+        assert_eq!(parse("# nothing here\n\n"), Ok(seq(vec![])));
+    }
+
+    #[test]
+    fn parse_scene_like_document() {
+        let source = "
+# the camera
+- add: camera
+  width: 100
+  from: [ 0, 1.5, -5 ]
+
+- add: sphere
+  material:
+    color: [1, 0.2, 1]   # magenta
+    diffuse: 0.7
+  transform:
+    - [ translate, 1, 2, 3 ]
+    - [ scale, 0.5, 0.5, 0.5 ]
+";
+        let expected = seq(vec![
+            map(vec![
+                ("add", s("camera")),
+                ("width", s("100")),
+                ("from", seq(vec![s("0"), s("1.5"), s("-5")])),
+            ]),
+            map(vec![
+                ("add", s("sphere")),
+                (
+                    "material",
+                    map(vec![
+                        ("color", seq(vec![s("1"), s("0.2"), s("1")])),
+                        ("diffuse", s("0.7")),
+                    ]),
+                ),
+                (
+                    "transform",
+                    seq(vec![
+                        seq(vec![s("translate"), s("1"), s("2"), s("3")]),
+                        seq(vec![s("scale"), s("0.5"), s("0.5"), s("0.5")]),
+                    ]),
+                ),
+            ]),
+        ]);
+        assert_eq!(parse(source), Ok(expected));
+    }
+
+    #[test]
+    fn parse_sequence_at_same_indentation_as_key() {
+        let source = "transform:\n- [ scale, 2, 2, 2 ]\nname: x\n";
+        let expected = map(vec![
+            (
+                "transform",
+                seq(vec![seq(vec![s("scale"), s("2"), s("2"), s("2")])]),
+            ),
+            ("name", s("x")),
+        ]);
+        assert_eq!(parse(source), Ok(expected));
+    }
+
+    #[test]
+    fn parse_flow_mapping_and_quotes() {
+        let source = "repeat: { count: 3, offset: [1, 0, 0] }\nname: \"a: #b\"\n";
+        let expected = map(vec![
+            (
+                "repeat",
+                map(vec![
+                    ("count", s("3")),
+                    ("offset", seq(vec![s("1"), s("0"), s("0")])),
+                ]),
+            ),
+            ("name", s("a: #b")),
+        ]);
+        assert_eq!(parse(source), Ok(expected));
+    }
+
+    #[test]
+    fn parse_flow_document() {
+        let source = "{\"a\": [1, 2], \"b\": {\"c\": null}}\n";
+        let expected = map(vec![
+            ("a", seq(vec![s("1"), s("2")])),
+            ("b", map(vec![("c", s("null"))])),
+        ]);
+        assert_eq!(parse(source), Ok(expected));
+    }
+
+    #[test]
+    fn parse_errors_report_line() {
+        let error = parse("- add: sphere\n  material\n").unwrap_err();
+        assert_eq!(error.line, 2);
+        let error = parse("a: [1, 2\n").unwrap_err();
+        assert_eq!(error.line, 1);
+        let error = parse("a: 1\na: 2\n").unwrap_err();
+        assert_eq!(error.line, 2);
+    }
+
+    #[test]
+    fn write_and_parse_round_trip() {
+        let value = seq(vec![
+            map(vec![
+                ("add", s("light")),
+                ("at", seq(vec![s("-10"), s("10"), s("-10")])),
+            ]),
+            map(vec![
+                ("add", s("plane")),
+                ("name", s("floor: \"main\"")),
+                (
+                    "material",
+                    map(vec![(
+                        "pattern",
+                        map(vec![
+                            ("type", s("checkers")),
+                            (
+                                "colors",
+                                seq(vec![
+                                    seq(vec![s("1"), s("1"), s("1")]),
+                                    seq(vec![s("0"), s("0"), s("0")]),
+                                ]),
+                            ),
+                        ]),
+                    )]),
+                ),
+            ]),
+        ]);
+        let written = value.to_string();
+        assert_eq!(parse(&written), Ok(value));
+    }
+
+    #[test]
+    fn write_uses_block_and_flow_styles() {
+        let value = seq(vec![map(vec![
+            ("add", s("sphere")),
+            ("transform", seq(vec![seq(vec![s("scale"), s("2")])])),
+        ])]);
+        assert_eq!(
+            value.to_string(),
+            "- add: sphere\n  transform:\n    - [ scale, 2 ]\n"
+        );
+    }
+}
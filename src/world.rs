@@ -1,75 +1,580 @@
+pub mod animation;
+pub use animation::Animation;
+
+pub mod background;
+pub use background::Background;
+
 pub mod camera;
 pub use camera::{Camera, View};
 
+pub mod changes;
+pub use changes::Changes;
+
 pub mod canvas;
-pub use canvas::Canvas;
+pub use canvas::{Canvas, Format, SubCanvas};
+
+pub mod clip;
+pub use clip::Clip;
 
 pub mod color;
 pub use color::Color;
 
 pub mod intersection;
-pub use intersection::{Intersection, Intersections};
+pub use intersection::{Computations, Intersection, Intersections};
 
 pub mod light;
 pub use light::Light;
 
 pub mod material;
-pub use material::Material;
+pub use material::{Coat, Material};
 
 pub mod pattern;
 pub use pattern::Pattern;
 
+pub mod quality;
+pub use quality::Quality;
+
 pub mod ray;
 pub use ray::Ray;
 
+pub mod session;
+pub use session::Session;
+
+pub mod sprite;
+pub use sprite::Sprite;
+
+pub mod stats;
+pub use stats::Stats;
+
 pub mod texture;
 pub use texture::{Texture, Textured};
 
-use std::{cmp::Reverse, collections::BinaryHeap};
+use std::{cell::Cell, time::Instant};
 
-use crate::math::{Form, Geometry, Hittable, Matrix, Point, Transformable};
+use crate::math::{Bounds, Form, Geometry, Matrix, Point, Transformable, EPSILON};
 
 pub struct World {
     pub objects: Vec<Geometry>,
     pub lights: Vec<Light>,
+    /// whether shadow rays are cast towards the lights while shading.
+    pub shadows: bool,
+    /// whether the light passing through transparent objects takes on their color,
+    /// as through stained glass, rather than only being dimmed. the light is tinted
+    /// more deeply the further it travels through an object; see
+    /// `light::Point::transmittance`.
+    pub colored_shadows: bool,
+    /// how light diminishes with distance, for the lights that do not say otherwise.
+    pub falloff: light::Falloff,
+    /// what is seen by the rays which do not hit any objects.
+    pub background: Background,
+    /// when set, each light is drawn as a glowing ball of this radius in its own color,
+    /// so that it can be seen where the lights are while setting up a scene. the balls
+    /// neither cast shadows nor are lit.
+    pub light_markers: Option<f64>,
+    /// when set, counts the rays tested against each object; see `collect_stats`.
+    pub stats: Option<Stats>,
+    /// the most reflections that are followed from a ray cast into the world, which
+    /// keeps mirrors facing each other from reflecting each other forever.
+    pub max_depth: usize,
+    /// when set, the most reflected and refracted rays that are followed in all for
+    /// each pixel, shared evenly between its samples. rays branch at every surface
+    /// that both reflects and refracts, so nested glass can take far more rays than
+    /// `max_depth` suggests; this bounds how long any one pixel can take.
+    pub ray_budget: Option<usize>,
+    /// how far the points at which rays leave a surface are nudged off it, so that
+    /// the rays do not hit the surface they start on; see `Computations::with_offset`.
+    pub surface_offset: f64,
+    /// when set, everything on one side of this plane is cut away; see `Clip`.
+    pub clip: Option<Clip>,
+    /// what has changed since the changes were last taken; see `take_changes`.
+    changes: Changes,
 }
 
 impl World {
     pub fn new(objects: Vec<Geometry>, lights: Vec<Light>) -> World {
-        World { objects, lights }
+        World {
+            objects,
+            lights,
+            shadows: true,
+            colored_shadows: false,
+            falloff: light::Falloff::default(),
+            background: Background::default(),
+            light_markers: None,
+            stats: None,
+            max_depth: 5,
+            ray_budget: None,
+            surface_offset: EPSILON,
+            clip: None,
+            changes: Changes::default(),
+        }
+    }
+
+    /// moves the object at `index`, and records that it changed.
+    pub fn transform_object(&mut self, index: usize, transform: Matrix) {
+        self.objects[index].transform(transform);
+        self.changes.object(index);
+    }
+
+    /// replaces the object at `index` (such as with a group of different children),
+    /// and records that it changed.
+    pub fn replace_object(&mut self, index: usize, object: Geometry) {
+        self.objects[index] = object;
+        self.changes.object(index);
+    }
+
+    /// adds an object, returning its index.
+    pub fn add_object(&mut self, object: Geometry) -> usize {
+        self.objects.push(object);
+        self.changes.membership();
+        self.objects.len() - 1
+    }
+
+    /// removes the object at `index`, which moves every object after it down by one.
+    pub fn remove_object(&mut self, index: usize) -> Geometry {
+        self.changes.membership();
+        self.objects.remove(index)
+    }
+
+    /// records that the object at `index` changed, after changing `objects` directly.
+    pub fn mark_changed(&mut self, index: usize) {
+        self.changes.object(index);
+    }
+
+    /// what has changed since the changes were last taken.
+    pub fn changes(&self) -> &Changes {
+        &self.changes
+    }
+
+    /// returns what has changed, and starts recording changes afresh. whatever keeps
+    /// something cached about the world should take the changes before updating it.
+    pub fn take_changes(&mut self) -> Changes {
+        std::mem::take(&mut self.changes)
+    }
+
+    /// starts counting how many rays are tested against each of the objects which
+    /// are in the world now, and how long those tests take. this slows rendering
+    /// down a little, so it is off by default.
+    pub fn collect_stats(&mut self) -> &Stats {
+        let objects = self.objects.len();
+        self.stats.get_or_insert_with(|| Stats::new(objects))
+    }
+
+    /// the box around every object in the world, which reaches infinitely far if any
+    /// of the objects do (such as a plane), and is empty if there are no objects.
+    pub fn bounds(&self) -> Bounds {
+        self.objects.iter().fold(Bounds::empty(), |bounds, object| {
+            bounds.merged(object.bounds())
+        })
+    }
+
+    /// like `bounds`, but leaves out the objects which reach infinitely far, giving the
+    /// extent of the scene that a camera can frame.
+    pub fn finite_bounds(&self) -> Bounds {
+        self.objects
+            .iter()
+            .map(|object| object.bounds())
+            .filter(Bounds::is_finite)
+            .fold(Bounds::empty(), Bounds::merged)
     }
 
     pub fn cast_ray(&self, ray: Ray) -> Color {
-        let mut color = Color::new(0.0, 0.0, 0.0);
+        self.cast_ray_within(ray, usize::MAX)
+    }
+
+    /// like `cast_ray`, but follows at most `budget` reflected and refracted rays in
+    /// all. the rays are followed depth first, so those which are left out are the
+    /// last ones, from the end of the tree.
+    pub fn cast_ray_within(&self, ray: Ray, budget: usize) -> Color {
+        let budget = Cell::new(budget);
+        self.trace(ray, &|_: &Light| true, true, self.max_depth, false, &budget)
+    }
+
+    /// like `cast_ray`, but only the lights for which `is_lit_by` returns `true`
+    /// contribute to the color. the background is left out, so that adding up the
+    /// colors for each group of lights and `cast_background` gives `cast_ray`.
+    pub fn cast_ray_lit_by<F: Fn(&Light) -> bool>(&self, ray: Ray, is_lit_by: F) -> Color {
+        self.cast_ray_lit_by_within(ray, is_lit_by, usize::MAX)
+    }
+
+    /// like `cast_ray_lit_by`, but with a `budget` like `cast_ray_within`. the same
+    /// rays are left out whichever lights are used, so the sum still adds up.
+    pub fn cast_ray_lit_by_within<F: Fn(&Light) -> bool>(
+        &self,
+        ray: Ray,
+        is_lit_by: F,
+        budget: usize,
+    ) -> Color {
+        let budget = Cell::new(budget);
+        self.trace(ray, &is_lit_by, false, self.max_depth, false, &budget)
+    }
+
+    /// the background seen along `ray`, directly or in reflections and refractions,
+    /// without any of the light from the lights.
+    pub fn cast_background(&self, ray: Ray) -> Color {
+        self.cast_background_within(ray, usize::MAX)
+    }
+
+    /// like `cast_background`, but with a `budget` like `cast_ray_within`.
+    pub fn cast_background_within(&self, ray: Ray, budget: usize) -> Color {
+        let budget = Cell::new(budget);
+        self.trace(
+            ray,
+            &|_: &Light| false,
+            true,
+            self.max_depth,
+            false,
+            &budget,
+        )
+    }
+
+    /// the color seen along `ray`, following at most `remaining` reflections (or
+    /// refractions) from there, and at most `budget` reflected and refracted rays in
+    /// all. the `background` is only seen if asked for, in which case shadow catchers
+    /// darken it by every light. a `reflected` ray sees the objects which show up in
+    /// reflections, rather than those which the camera sees.
+    fn trace<F: Fn(&Light) -> bool>(
+        &self,
+        ray: Ray,
+        is_lit_by: &F,
+        background: bool,
+        remaining: usize,
+        reflected: bool,
+        budget: &Cell<usize>,
+    ) -> Color {
+        // the fraction of light that is let through the shadow catchers in front of the
+        // closest visible object (or the background), and what those catchers reflect.
+        let mut shade = 1.0;
+        let mut caught = Color::black();
+        let marker = self.light_marker(ray, &is_lit_by);
 
         if let Some(intersections) = self.hit(ray) {
-            if let Some(intersection) = intersections.closest() {
-                for light in &self.lights {
-                    color += light.illuminate(self, &intersection.compute());
+            for intersection in intersections.iter() {
+                if let Some((time, color)) = marker {
+                    if time < intersection.time {
+                        return color + caught;
+                    }
+                }
+                let visibility = intersection.object.visibility;
+                if !(if reflected {
+                    visibility.reflections
+                } else {
+                    visibility.camera
+                }) {
+                    continue;
+                }
+                let computations = self.compute(intersection, &intersections);
+
+                if computations.material.shadow_catcher {
+                    // the background is already seen through the catcher, so it is
+                    // left out of the reflection rather than seen twice.
+                    caught = caught
+                        + self.reflect(&computations, is_lit_by, false, remaining, budget) * shade;
+                    shade *= if background {
+                        self.unshadowed_fraction(computations.over_point, &|_: &Light| true)
+                    } else {
+                        self.unshadowed_fraction(computations.over_point, is_lit_by)
+                    };
+                    continue;
+                }
+
+                return self.shade(&computations, is_lit_by, background, remaining, budget) * shade
+                    + caught;
+            }
+        }
+
+        match marker {
+            Some((_, color)) => color + caught,
+            None if background => self.background.color_at(ray.direction) * shade + caught,
+            None => caught,
+        }
+    }
+
+    /// the computations at `intersection`, one of the ray's `intersections`. the
+    /// refractive indices are only worked out for transparent surfaces, which are the
+    /// only ones that refract.
+    fn compute(&self, intersection: &Intersection, intersections: &Intersections) -> Computations {
+        if intersection.object.material.transparency > 0.0 {
+            intersection.compute_within(intersections, self.surface_offset)
+        } else {
+            intersection.compute_with_offset(self.surface_offset)
+        }
+    }
+
+    /// the color of a surface that a ray has hit, lit by every light, along with
+    /// whatever it reflects and refracts.
+    pub fn shade_hit(&self, computations: &Computations) -> Color {
+        let budget = Cell::new(usize::MAX);
+        self.shade(
+            computations,
+            &|_: &Light| true,
+            true,
+            self.max_depth,
+            &budget,
+        )
+    }
+
+    /// like `shade_hit`, but only the lights for which `is_lit_by` returns `true`
+    /// contribute to the color, and the background is not seen.
+    pub fn shade_hit_lit_by<F: Fn(&Light) -> bool>(
+        &self,
+        computations: &Computations,
+        is_lit_by: F,
+    ) -> Color {
+        let budget = Cell::new(usize::MAX);
+        self.shade(computations, &is_lit_by, false, self.max_depth, &budget)
+    }
+
+    /// the color that a surface reflects, following at most `remaining` reflections.
+    /// this is black if the surface is not reflective, or no reflections remain.
+    pub fn reflected_color(&self, computations: &Computations, remaining: usize) -> Color {
+        let budget = Cell::new(usize::MAX);
+        self.reflect(computations, &|_: &Light| true, true, remaining, &budget)
+    }
+
+    /// the color that a surface lets through, bent by its refractive index, following
+    /// at most `remaining` refractions. this is black if the surface is opaque, no
+    /// refractions remain, or all of the light is reflected back.
+    pub fn refracted_color(&self, computations: &Computations, remaining: usize) -> Color {
+        let budget = Cell::new(usize::MAX);
+        self.refract(computations, &|_: &Light| true, true, remaining, &budget)
+    }
+
+    fn shade<F: Fn(&Light) -> bool>(
+        &self,
+        computations: &Computations,
+        is_lit_by: &F,
+        background: bool,
+        remaining: usize,
+        budget: &Cell<usize>,
+    ) -> Color {
+        let surface = self
+            .lights
+            .iter()
+            .filter(|light| is_lit_by(light))
+            .fold(Color::black(), |color, light| {
+                color + light.illuminate(self, computations)
+            });
+        let reflected = self.reflect(computations, is_lit_by, background, remaining, budget);
+        let refracted = self.refract(computations, is_lit_by, background, remaining, budget);
+
+        let material = &computations.material;
+        if material.reflective > 0.0 && material.transparency > 0.0 {
+            let reflectance = computations.schlick();
+            surface + reflected * reflectance + refracted * (1.0 - reflectance)
+        } else {
+            surface + reflected + refracted
+        }
+    }
+
+    fn reflect<F: Fn(&Light) -> bool>(
+        &self,
+        computations: &Computations,
+        is_lit_by: &F,
+        background: bool,
+        remaining: usize,
+        budget: &Cell<usize>,
+    ) -> Color {
+        let reflective = computations.material.reflective;
+        if remaining == 0 || reflective <= 0.0 || !spend(budget) {
+            return Color::black();
+        }
+
+        let ray = Ray::new(computations.over_point, computations.reflect_vector);
+        self.trace(ray, is_lit_by, background, remaining - 1, true, budget) * reflective
+    }
+
+    fn refract<F: Fn(&Light) -> bool>(
+        &self,
+        computations: &Computations,
+        is_lit_by: &F,
+        background: bool,
+        remaining: usize,
+        budget: &Cell<usize>,
+    ) -> Color {
+        let transparency = computations.material.transparency;
+        if remaining == 0 || transparency <= 0.0 {
+            return Color::black();
+        }
+
+        // snell's law, for the angle that the light bends through.
+        let ratio = computations.n1 / computations.n2;
+        let cos_i = computations.to_eye.dot(&computations.surface_normal);
+        let sin2_t = ratio * ratio * (1.0 - cos_i * cos_i);
+        if sin2_t > 1.0 {
+            // total internal reflection.
+            return Color::black();
+        }
+
+        if !spend(budget) {
+            return Color::black();
+        }
+
+        let cos_t = (1.0 - sin2_t).sqrt();
+        let direction =
+            computations.surface_normal * (ratio * cos_i - cos_t) - computations.to_eye * ratio;
+        let ray = Ray::new(computations.under_point, direction);
+        self.trace(ray, is_lit_by, background, remaining - 1, false, budget) * transparency
+    }
+
+    /// the first surface the ray sees, and the computations there. objects hidden
+    /// from the camera and shadow catchers are seen through.
+    pub fn visible_hit(&self, ray: Ray) -> Option<(Intersection, Computations)> {
+        let mut intersections = self.hit(ray)?;
+        while let Some(intersection) = intersections.pop() {
+            if !intersection.object.visibility.camera || intersection.object.material.shadow_catcher
+            {
+                continue;
+            }
+            let computations = intersection.compute_with_offset(self.surface_offset);
+            return Some((intersection.clone(), computations));
+        }
+        None
+    }
+
+    /// the index of the first object with the given name.
+    pub fn find(&self, name: &str) -> Option<usize> {
+        self.objects
+            .iter()
+            .position(|object| object.name.as_deref() == Some(name))
+    }
+
+    /// the time at which the ray first hits the marker of one of the lights for which
+    /// `is_lit_by` returns `true`, and the color of that light; see `light_markers`.
+    fn light_marker<F: Fn(&Light) -> bool>(&self, ray: Ray, is_lit_by: F) -> Option<(f64, Color)> {
+        let radius = self.light_markers?;
+
+        self.lights
+            .iter()
+            .filter(|light| is_lit_by(light))
+            .filter_map(|light| {
+                let offset = ray.origin - light.position();
+                let a = ray.direction.dot(&ray.direction);
+                let b = ray.direction.dot(&offset);
+                let c = offset.dot(&offset) - radius * radius;
+                let discriminant = b * b - a * c;
+                if discriminant < 0.0 {
+                    return None;
                 }
+
+                let root = discriminant.sqrt();
+                let time = if 0.0 < (-b - root) / a {
+                    (-b - root) / a
+                } else {
+                    (-b + root) / a
+                };
+                if 0.0 < time {
+                    Some((time, light.color()))
+                } else {
+                    None
+                }
+            })
+            .fold(
+                None,
+                |nearest: Option<(f64, Color)>, (time, color)| match nearest {
+                    Some((t, _)) if t <= time => nearest,
+                    _ => Some((time, color)),
+                },
+            )
+    }
+
+    /// the fraction of the light (weighted by intensity) from the lights for which
+    /// `is_lit_by` returns `true` that reaches the point without being blocked.
+    fn unshadowed_fraction<F: Fn(&Light) -> bool>(&self, point: Point, is_lit_by: F) -> f64 {
+        let (mut total, mut unshadowed) = (0.0, 0.0);
+
+        for light in self.lights.iter().filter(|light| is_lit_by(light)) {
+            let color = light.color();
+            let intensity = (color.red() + color.green() + color.blue()) / 3.0;
+
+            total += intensity;
+            if self.shadows {
+                let passed = light.transmittance(self, point);
+                unshadowed += intensity * (passed.red() + passed.green() + passed.blue()) / 3.0;
+            } else {
+                unshadowed += intensity;
             }
         }
 
-        color
+        if total > 0.0 {
+            unshadowed / total
+        } else {
+            1.0
+        }
     }
 
     pub fn hit(&self, ray: Ray) -> Option<Intersections> {
-        let mut heap: BinaryHeap<Reverse<Intersection>> = BinaryHeap::new();
+        self.hit_within(ray, 0.0, f64::INFINITY)
+    }
+
+    /// like `hit`, but only keeps the intersections strictly between the times
+    /// `t_min` and `t_max`. for example, a shadow ray only needs to know about
+    /// the objects that come before the light.
+    pub fn hit_within(&self, ray: Ray, t_min: f64, t_max: f64) -> Option<Intersections> {
+        self.hit_until(ray, t_min, t_max, &|_: &Geometry| false)
+    }
+
+    /// like `hit_within`, but the ray goes no further than the first object for which
+    /// `stops` returns `true`, so the parts of a divided group beyond it are not
+    /// tested. for example, nothing behind an opaque object can shadow a point. the
+    /// intersections beyond it may or may not be kept. while the world is clipped,
+    /// any object may be cut away where it is hit, so every object is tested.
+    pub fn hit_until(
+        &self,
+        ray: Ray,
+        t_min: f64,
+        t_max: f64,
+        stops: &dyn Fn(&Geometry) -> bool,
+    ) -> Option<Intersections> {
+        let mut intersections = Intersections::default();
+        let never = |_: &Geometry| false;
+        let stops: &dyn Fn(&Geometry) -> bool = if self.clip.is_some() { &never } else { stops };
+        let mut until = t_max;
+
+        for (i, object) in self.objects.iter().enumerate() {
+            let hits = match &self.stats {
+                Some(stats) => {
+                    let start = Instant::now();
+                    let hits = object.hit_until(ray, t_min, &mut until, stops);
+                    stats.record(i, hits.is_some(), start.elapsed());
+                    hits
+                }
+                None => object.hit_until(ray, t_min, &mut until, stops),
+            };
+
+            let hits = match (&self.clip, hits) {
+                (Some(clip), Some(hits)) => clip.apply(ray, object, hits),
+                (_, hits) => hits,
+            };
 
-        for object in self.objects.iter() {
-            if let Some(mut hits) = object.hit(ray) {
-                heap.append(&mut hits.heap);
+            if let Some(hits) = hits {
+                for hit in hits.between(t_min, t_max) {
+                    intersections.insert(Intersection {
+                        object_index: i,
+                        ..hit.clone()
+                    });
+                }
             }
         }
 
-        if !heap.is_empty() {
-            Some(Intersections::new(heap))
+        if !intersections.is_empty() {
+            Some(intersections)
         } else {
             None
         }
     }
 }
 
+/// takes one ray from `budget`, if there are any left.
+fn spend(budget: &Cell<usize>) -> bool {
+    match budget.get() {
+        0 => false,
+        left => {
+            budget.set(left - 1);
+            true
+        }
+    }
+}
+
 impl Default for World {
     fn default() -> World {
         let mut outer = Geometry::default().with_form(Form::Sphere);
@@ -90,12 +595,40 @@ impl Default for World {
 mod tests {
     use super::*;
     use crate::math::Vector;
+    use std::f64::consts;
+
+    #[test]
+    fn find_object_by_name() {
+        let mut w = World::default();
+        w.objects[1] = w.objects[1].clone().with_name("inner");
+        assert_eq!(w.find("inner"), Some(1));
+        assert_eq!(w.find("outer"), None);
+    }
+
+    #[test]
+    fn changes_are_recorded() {
+        let mut w = World::default();
+        assert!(w.changes().is_empty());
+        w.transform_object(1, Matrix::translation(0.0, 1.0, 0.0));
+        assert_eq!(w.objects[1].transform, Matrix::translation(0.0, 1.0, 0.0));
+        let changes = w.take_changes();
+        assert_eq!(changes.objects.iter().copied().collect::<Vec<_>>(), [1]);
+        assert!(!changes.membership);
+        assert!(w.changes().is_empty());
+
+        let sphere = w.remove_object(0);
+        assert_eq!(w.add_object(sphere), 1);
+        assert!(w.take_changes().membership);
+    }
 
     #[test]
     fn empty_world() {
         let w = World::new(vec![], vec![]);
         assert!(w.objects.is_empty());
         assert!(w.lights.is_empty());
+        assert!(w.shadows);
+        assert_eq!(w.falloff, light::Falloff::Constant);
+        assert_eq!(w.background, Background::solid(Color::black()));
     }
 
     #[test]
@@ -127,12 +660,25 @@ mod tests {
         assert_eq!(xs.pop().unwrap().time, 6.0);
     }
 
+    #[test]
+    fn intersect_with_world_within_range() {
+        let w = World::default();
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let mut xs = w.hit_within(r, 4.2, 5.8).unwrap();
+        assert_eq!(xs.count(), 2);
+        assert_eq!(xs.pop().unwrap().time, 4.5);
+        assert_eq!(xs.pop().unwrap().time, 5.5);
+        assert!(w.hit_within(r, 0.0, 3.0).is_none());
+        assert!(w.hit_within(r, 6.5, f64::INFINITY).is_none());
+    }
+
     #[test]
     fn shading_intersection() {
         let w = World::default();
         let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
-        let result = w.cast_ray(r);
-        assert_eq!(result, Color::new(0.38066, 0.47583, 0.2855));
+        let comps = Intersection::new(4.0, r, w.objects[0].clone()).compute();
+        assert_eq!(w.shade_hit(&comps), Color::new(0.38066, 0.47583, 0.2855));
+        assert_eq!(w.cast_ray(r), Color::new(0.38066, 0.47583, 0.2855));
     }
 
     #[test]
@@ -143,8 +689,206 @@ mod tests {
             Color::new(1.0, 1.0, 1.0),
         ))];
         let r = Ray::new(Point::zero(), Vector::new(0.0, 0.0, 1.0));
-        let result = w.cast_ray(r);
-        assert_eq!(result, Color::new(0.90498, 0.90498, 0.90498));
+        let comps = Intersection::new(0.5, r, w.objects[1].clone()).compute();
+        assert_eq!(w.shade_hit(&comps), Color::new(0.90498, 0.90498, 0.90498));
+        assert_eq!(w.cast_ray(r), Color::new(0.90498, 0.90498, 0.90498));
+    }
+
+    fn reflective_floor() -> Geometry {
+        let mut floor = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::translation(0.0, -1.0, 0.0));
+        floor.material.reflective = 0.5;
+        floor
+    }
+
+    #[test]
+    fn reflected_color_of_nonreflective_material() {
+        let mut w = World::default();
+        w.objects[1].material.ambient = 1.0;
+        let r = Ray::new(Point::zero(), Vector::new(0.0, 0.0, 1.0));
+        let comps = Intersection::new(1.0, r, w.objects[1].clone()).compute();
+        assert_eq!(w.reflected_color(&comps, 5), Color::black());
+    }
+
+    #[test]
+    fn reflected_color_of_reflective_material() {
+        let mut w = World::default();
+        let floor = reflective_floor();
+        w.objects.push(floor.clone());
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 0.0, -3.0), Vector::new(0.0, -root, root));
+        let comps = Intersection::new(2.0_f64.sqrt(), r, floor.clone()).compute();
+        assert_eq!(
+            w.reflected_color(&comps, 5),
+            Color::new(0.19033, 0.23791, 0.14274)
+        );
+        assert_eq!(w.shade_hit(&comps), Color::new(0.87676, 0.92434, 0.82917));
+        // with no reflections left, nothing is reflected.
+        assert_eq!(w.reflected_color(&comps, 0), Color::black());
+    }
+
+    #[test]
+    fn mutually_reflective_surfaces() {
+        let mut lower = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::translation(0.0, -1.0, 0.0));
+        lower.material.reflective = 1.0;
+        let mut upper = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::translation(0.0, 1.0, 0.0));
+        upper.material.reflective = 1.0;
+        let light = Light::point(light::Point::new(Point::zero(), Color::white()));
+        let w = World::new(vec![lower, upper], vec![light]);
+
+        // the ray bounces between the planes until the reflections run out.
+        let r = Ray::new(Point::zero(), Vector::new(0.0, 1.0, 0.0));
+        assert_eq!(w.cast_ray(r), Color::new(11.4, 11.4, 11.4));
+    }
+
+    #[test]
+    fn ray_budget_limits_reflections() {
+        let mut lower = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::translation(0.0, -1.0, 0.0));
+        lower.material.reflective = 1.0;
+        let mut upper = lower
+            .clone()
+            .transformed(Matrix::translation(0.0, 2.0, 0.0));
+        upper.material.reflective = 1.0;
+        let light = Light::point(light::Point::new(Point::zero(), Color::white()));
+        let mut w = World::new(vec![lower, upper], vec![light]);
+
+        // each surface that is seen adds the same amount of light.
+        let r = Ray::new(Point::zero(), Vector::new(0.0, 1.0, 0.0));
+        assert_eq!(w.cast_ray_within(r, 0), Color::new(1.9, 1.9, 1.9));
+        assert_eq!(w.cast_ray_within(r, 2), Color::new(5.7, 5.7, 5.7));
+        assert_eq!(w.cast_ray_within(r, 100), w.cast_ray(r));
+        w.max_depth = 1;
+        assert_eq!(w.cast_ray_within(r, 2), Color::new(3.8, 3.8, 3.8));
+    }
+
+    fn glass_floor() -> Geometry {
+        let mut floor = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::translation(0.0, -1.0, 0.0));
+        floor.material.transparency = 0.5;
+        floor.material.refractive_index = 1.5;
+        floor
+    }
+
+    fn red_ball() -> Geometry {
+        let mut ball = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(0.0, -3.5, -0.5));
+        ball.material.texture = Texture::pattern(Pattern::solid(Color::new(1.0, 0.0, 0.0)));
+        ball.material.ambient = 0.5;
+        ball
+    }
+
+    #[test]
+    fn refracted_color_of_opaque_surface() {
+        let w = World::default();
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let xs = w.hit(r).unwrap();
+        let comps = Intersection::new(4.0, r, w.objects[0].clone()).compute_within(&xs, EPSILON);
+        assert_eq!(w.refracted_color(&comps, 5), Color::black());
+    }
+
+    #[test]
+    fn refracted_color_with_no_refractions_left() {
+        let mut w = World::default();
+        w.objects[0].material.transparency = 1.0;
+        w.objects[0].material.refractive_index = 1.5;
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let xs = w.hit(r).unwrap();
+        let comps = Intersection::new(4.0, r, w.objects[0].clone()).compute_within(&xs, EPSILON);
+        assert_eq!(w.refracted_color(&comps, 0), Color::black());
+    }
+
+    #[test]
+    fn refracted_color_under_total_internal_reflection() {
+        let mut w = World::default();
+        w.objects[0].material.transparency = 1.0;
+        w.objects[0].material.refractive_index = 1.5;
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 0.0, root), Vector::new(0.0, 1.0, 0.0));
+        let xs = Intersections::with(vec![Intersection::new(root, r, w.objects[0].clone())]);
+        let comps = Intersection::new(root, r, w.objects[0].clone()).compute_within(&xs, EPSILON);
+        assert_eq!(w.refracted_color(&comps, 5), Color::black());
+    }
+
+    #[test]
+    fn shading_transparent_material() {
+        let mut w = World::default();
+        let floor = glass_floor();
+        w.objects.push(floor.clone());
+        w.objects.push(red_ball());
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 0.0, -3.0), Vector::new(0.0, -root, root));
+        let xs = Intersections::with(vec![Intersection::new(2.0_f64.sqrt(), r, floor.clone())]);
+        let comps = xs.closest().unwrap().compute_within(&xs, EPSILON);
+        // the ball is lit through the floor, since transparent objects cast lighter
+        // shadows, so it is redder than if the floor were opaque to the light.
+        assert_eq!(w.shade_hit(&comps), Color::new(1.12547, 0.68643, 0.68643));
+    }
+
+    #[test]
+    fn shading_reflective_transparent_material() {
+        let mut w = World::default();
+        let mut floor = glass_floor();
+        floor.material.reflective = 0.5;
+        w.objects.push(floor.clone());
+        w.objects.push(red_ball());
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 0.0, -3.0), Vector::new(0.0, -root, root));
+        let xs = Intersections::with(vec![Intersection::new(2.0_f64.sqrt(), r, floor.clone())]);
+        let comps = xs.closest().unwrap().compute_within(&xs, EPSILON);
+        assert_eq!(w.shade_hit(&comps), Color::new(1.115, 0.69644, 0.69243));
+    }
+
+    #[test]
+    fn object_hidden_from_reflections() {
+        let mut w = World::default();
+        w.objects.push(reflective_floor());
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 0.0, -3.0), Vector::new(0.0, -root, root));
+        let comps = Intersection::new(2.0_f64.sqrt(), r, w.objects[2].clone()).compute();
+        let seen = w.reflected_color(&comps, 5);
+
+        w.objects[0].visibility.reflections = false;
+        w.objects[1].visibility.reflections = false;
+        let hidden = w.reflected_color(&comps, 5);
+        assert_ne!(seen, hidden);
+        assert_eq!(hidden, Color::black());
+
+        // the camera still sees the spheres.
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(w.cast_ray(r), Color::new(0.38066, 0.47583, 0.2855));
+    }
+
+    #[test]
+    fn shading_intersection_without_lights() {
+        let mut w = World::default();
+        w.lights.clear();
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let comps = Intersection::new(4.0, r, w.objects[0].clone()).compute();
+        assert_eq!(w.shade_hit(&comps), Color::black());
+    }
+
+    #[test]
+    fn inverse_square_falloff() {
+        let mut w = World::default();
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        // the ray hits at (0, 0, -1), which is sqrt(281) away from the light.
+        w.lights = vec![Light::point(
+            light::Point::new(
+                Point::new(-10.0, 10.0, -10.0),
+                Color::new(281.0, 281.0, 281.0),
+            )
+            .with_falloff(light::Falloff::InverseSquare),
+        )];
+        assert_eq!(w.cast_ray(r), Color::new(0.38066, 0.47583, 0.2855));
     }
 
     #[test]
@@ -155,6 +899,40 @@ mod tests {
         assert_eq!(c, Color::black());
     }
 
+    #[test]
+    fn color_when_ray_misses_is_background() {
+        let mut w = World::default();
+        w.background = Background::sky(background::Sky::new(
+            Color::white(),
+            Color::new(0.0, 0.0, 1.0),
+        ));
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 1.0, 0.0));
+        assert_eq!(w.cast_ray(r), Color::new(0.0, 0.0, 1.0));
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(w.cast_ray(r), Color::new(0.38066, 0.47583, 0.2855));
+    }
+
+    #[test]
+    fn shadow_catcher_darkens_background() {
+        let mut w = World::new(vec![], vec![]);
+        w.lights = vec![Light::point(light::Point::new(
+            Point::new(0.0, 10.0, 0.0),
+            Color::new(1.0, 1.0, 1.0),
+        ))];
+        w.background = Background::solid(Color::new(0.5, 0.5, 0.5));
+        let catcher = Geometry::default()
+            .with_form(Form::Plane)
+            .with_material(Material::shadow_catcher());
+        let blocker = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(0.0, 5.0, 0.0));
+        w.objects = vec![catcher];
+        let r = Ray::new(Point::new(0.0, 1.0, -1.0), Vector::new(0.0, -1.0, 1.0));
+        assert_eq!(w.cast_ray(r), Color::new(0.5, 0.5, 0.5));
+        w.objects.push(blocker);
+        assert_eq!(w.cast_ray(r), Color::black());
+    }
+
     #[test]
     fn color_when_ray_hits() {
         let w = World::default();
@@ -213,11 +991,248 @@ mod tests {
         let s2 = Geometry::default()
             .with_form(Form::Sphere)
             .transformed(Matrix::translation(0.0, 0.0, 10.0));
-        w.objects.push(s2);
+        w.objects.push(s2.clone());
         let r = Ray::new(Point::new(0.0, 0.0, 5.0), Vector::new(0.0, 0.0, 1.0));
-        let i = Intersection::new(4.0, r, s2);
+        let i = Intersection::new(4.0, r, s2.clone());
         let comps = i.compute();
         let c = w.lights[0].illuminate(&w, &comps);
         assert_eq!(c, Color::new(0.1, 0.1, 0.1));
     }
+
+    #[test]
+    fn visible_hit_uses_surface_offset() {
+        let mut w = World::default();
+        w.surface_offset = 0.25;
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let (_, comps) = w.visible_hit(r).unwrap();
+        assert_eq!(comps.over_point, Point::new(0.0, 0.0, -1.25));
+        assert_eq!(comps.under_point, Point::new(0.0, 0.0, -0.75));
+    }
+
+    #[test]
+    fn transparent_object_casts_lighter_shadow() {
+        let mut w = World::default();
+        let point = Point::new(10.0, -10.0, 10.0);
+        w.objects[0].material.transparency = 0.5;
+        w.objects[1].material.transparency = 0.5;
+        let passed = w.lights[0].transmittance(&w, point);
+        // the ray to the light passes through both spheres, each on the way in and out.
+        assert_eq!(passed, Color::new(0.0625, 0.0625, 0.0625));
+        assert!(w.lights[0].casts_shade(&w, point));
+
+        w.objects[1].material.transparency = 0.0;
+        assert_eq!(w.lights[0].transmittance(&w, point), Color::black());
+    }
+
+    #[test]
+    fn colored_shadow_takes_occluder_color() {
+        let mut w = World::default();
+        w.objects.remove(1);
+        w.objects[0].material.transparency = 1.0;
+        let point = Point::new(10.0, -10.0, 10.0);
+        assert_eq!(w.lights[0].transmittance(&w, point), Color::white());
+        assert!(!w.lights[0].casts_shade(&w, point));
+
+        // the ray to the light passes through two units of the sphere.
+        w.colored_shadows = true;
+        assert_eq!(
+            w.lights[0].transmittance(&w, point),
+            Color::new(0.64, 1.0, 0.36)
+        );
+
+        // a thinner object tints the light less.
+        w.objects[0].transform(Matrix::scaling(0.5, 0.5, 0.5));
+        assert_eq!(
+            w.lights[0].transmittance(&w, point),
+            Color::new(0.8, 1.0, 0.6)
+        );
+
+        // from inside the object, only the way out of it counts.
+        assert_eq!(
+            w.lights[0].transmittance(&w, Point::zero()),
+            Color::new(0.8, 1.0, 0.6).powf(0.5)
+        );
+    }
+
+    #[test]
+    fn intersection_in_shadow_with_shadows_disabled() {
+        let mut w = World::default();
+        w.lights = vec![Light::point(light::Point::new(
+            Point::new(0.0, 0.0, -10.0),
+            Color::new(1.0, 1.0, 1.0),
+        ))];
+        let s1 = Geometry::default().with_form(Form::Sphere);
+        w.objects.push(s1);
+        let s2 = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(0.0, 0.0, 10.0));
+        w.objects.push(s2.clone());
+        w.shadows = false;
+        let r = Ray::new(Point::new(0.0, 0.0, 5.0), Vector::new(0.0, 0.0, 1.0));
+        let i = Intersection::new(4.0, r, s2.clone());
+        let comps = i.compute();
+        let c = w.lights[0].illuminate(&w, &comps);
+        assert_eq!(c, Color::new(1.9, 1.9, 1.9));
+    }
+
+    #[test]
+    fn color_lit_by_subset_of_lights() {
+        let mut w = World::default();
+        w.lights.push(Light::point(
+            light::Point::new(Point::new(10.0, 10.0, -10.0), Color::new(0.5, 0.5, 0.5))
+                .with_group(1),
+        ));
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let key = w.cast_ray_lit_by(r, |light| light.group() == 0);
+        let fill = w.cast_ray_lit_by(r, |light| light.group() == 1);
+        assert_eq!(key, Color::new(0.38066, 0.47583, 0.2855));
+        assert_eq!(key + fill, w.cast_ray(r));
+    }
+
+    #[test]
+    fn object_hidden_from_camera_still_casts_shadow() {
+        // a wall just behind the outer sphere, which is in its shadow.
+        let mut w = World::default();
+        w.objects[0].visibility.camera = false;
+        w.objects[1] = Geometry::default()
+            .with_form(Form::Plane)
+            .transformed(Matrix::translation(0.0, 0.0, 1.1) * Matrix::rotation_x(consts::PI / 2.0));
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let shaded = w.cast_ray(r);
+        assert_eq!(shaded, Color::new(0.1, 0.1, 0.1));
+
+        w.objects[0].visibility.shadows = false;
+        assert_ne!(w.cast_ray(r), shaded);
+    }
+
+    #[test]
+    fn world_bounds() {
+        let mut w = World::default();
+        let unit = Bounds::around(Point::zero(), 1.0);
+        assert_eq!(w.bounds(), unit);
+        assert_eq!(World::new(vec![], vec![]).bounds(), Bounds::empty());
+
+        w.objects.push(Geometry::default().with_form(Form::Plane));
+        assert!(!w.bounds().is_finite());
+        assert_eq!(w.finite_bounds(), unit);
+    }
+
+    #[test]
+    fn light_markers() {
+        let mut w = World::default();
+        let r = Ray::new(Point::new(-10.0, 10.0, -20.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(w.cast_ray(r), Color::black());
+
+        w.light_markers = Some(0.5);
+        assert_eq!(w.cast_ray(r), Color::new(1.0, 1.0, 1.0));
+        assert_eq!(w.cast_ray_lit_by(r, |_| false), Color::black());
+
+        // the marker is hidden behind the spheres, which are between it and the ray.
+        let r = Ray::new(Point::new(10.0, -10.0, 10.0), Vector::new(-1.0, 1.0, -1.0));
+        let hidden = w.cast_ray(r);
+        w.light_markers = None;
+        assert_eq!(w.cast_ray(r), hidden);
+    }
+
+    #[test]
+    fn stats_count_tests_and_hits() {
+        let mut w = World::default();
+        w.collect_stats();
+        let hit = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let miss = Ray::new(Point::new(0.0, 5.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        w.hit(hit);
+        w.hit(miss);
+
+        let report = w.stats.as_ref().unwrap().report();
+        assert_eq!(report.objects.len(), 2);
+        for stats in report.objects {
+            assert_eq!((stats.tests, stats.hits), (2, 1));
+        }
+    }
+
+    #[test]
+    fn shadow_catcher_is_invisible() {
+        let mut w = World::default();
+        let catcher = Geometry::default()
+            .with_form(Form::Plane)
+            .with_material(Material::shadow_catcher())
+            .transformed(
+                *Matrix::identity()
+                    .rotate_x(consts::PI / 2.0)
+                    .translate(0.0, 0.0, -3.0),
+            );
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let without_catcher = w.cast_ray(r);
+        w.objects.push(catcher);
+        assert_eq!(w.cast_ray(r), without_catcher);
+    }
+
+    #[test]
+    fn shadow_catcher_darkens_what_is_behind_it() {
+        let mut w = World::default();
+        w.lights = vec![Light::point(light::Point::new(
+            Point::new(0.0, 0.0, -10.0),
+            Color::new(1.0, 1.0, 1.0),
+        ))];
+        // a catcher in front of the camera, with a blocker between it and the light.
+        let catcher = Geometry::default()
+            .with_form(Form::Plane)
+            .with_material(Material::shadow_catcher())
+            .transformed(
+                *Matrix::identity()
+                    .rotate_x(consts::PI / 2.0)
+                    .translate(0.0, 0.0, -3.0),
+            );
+        let blocker = Geometry::default().with_form(Form::Sphere).transformed(
+            *Matrix::identity()
+                .scale(0.1, 0.1, 0.1)
+                .translate(0.0, 0.0, -8.0),
+        );
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let unshadowed = w.cast_ray(r);
+        w.objects.push(catcher);
+        w.objects.push(blocker);
+        let r = Ray::new(Point::new(0.0, 0.0, -4.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(w.cast_ray(r), Color::black());
+        assert_ne!(unshadowed, Color::black());
+    }
+
+    #[test]
+    fn reflective_shadow_catcher_adds_reflected_objects() {
+        let mut w = World::default();
+        let mut material = Material::shadow_catcher();
+        material.reflective = 0.5;
+        let catcher = Geometry::default()
+            .with_form(Form::Plane)
+            .with_material(material)
+            .transformed(Matrix::translation(0.0, -1.0, 0.0));
+
+        // looking down at the floor, the reflection is of the spheres above it.
+        let down = Ray::new(Point::new(0.0, 1.0, -5.0), Vector::new(0.0, -0.4, 0.9));
+        // looking down further away, the reflection misses everything.
+        let away = Ray::new(Point::new(0.0, 1.0, 5.0), Vector::new(0.0, -0.4, 0.9));
+        let behind = (w.cast_ray(down), w.cast_ray(away));
+        // the reflection starts just above the floor, as it does from the catcher.
+        let reflected = w.cast_ray(Ray::new(
+            Point::new(0.0, -1.0 + EPSILON, -0.5),
+            Vector::new(0.0, 0.4, 0.9),
+        ));
+        w.objects.push(catcher);
+
+        assert_ne!(reflected, Color::black());
+        assert_eq!(w.cast_ray(down), behind.0 + reflected * 0.5);
+        assert_eq!(w.cast_ray(away), behind.1);
+    }
+
+    #[test]
+    fn shadow_catcher_does_not_cast_shadows() {
+        let mut w = World::default();
+        let catcher = Geometry::default()
+            .with_form(Form::Plane)
+            .with_material(Material::shadow_catcher())
+            .transformed(Matrix::translation(0.0, 5.0, 0.0));
+        w.objects.push(catcher);
+        let point = Point::new(0.0, 2.0, 0.0);
+        assert_eq!(w.lights[0].casts_shade(&w, point), false);
+    }
 }
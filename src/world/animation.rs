@@ -0,0 +1,110 @@
+use crate::math::{Decomposition, Matrix, Point};
+
+/// a transform which changes over time, given by its value at a few key times.
+/// between the keyframes, the translation, rotation, and scale of the transform are
+/// each blended separately (see `Matrix::decompose`), so that objects turn smoothly
+/// rather than shrinking as they pass between two rotations. before the first
+/// keyframe and after the last, the transform holds still.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Animation {
+    keyframes: Vec<(f64, Decomposition)>,
+}
+
+impl Animation {
+    /// `keyframes` are pairs of a time and the transform at that time, in any order.
+    /// panics if there are none.
+    pub fn new(keyframes: Vec<(f64, Matrix)>) -> Animation {
+        assert!(
+            !keyframes.is_empty(),
+            "an animation needs at least 1 keyframe"
+        );
+
+        let mut keyframes: Vec<(f64, Decomposition)> = keyframes
+            .into_iter()
+            .map(|(time, transform)| (time, transform.decompose()))
+            .collect();
+        keyframes.sort_by(|a, b| a.0.partial_cmp(&b.0).unwrap());
+
+        Animation { keyframes }
+    }
+
+    /// the times of the first and last keyframes.
+    pub fn span(&self) -> (f64, f64) {
+        (
+            self.keyframes[0].0,
+            self.keyframes[self.keyframes.len() - 1].0,
+        )
+    }
+
+    pub fn transform_at(&self, time: f64) -> Matrix {
+        let next = self.keyframes.iter().position(|&(t, _)| time < t);
+        let (from, to) = match next {
+            Some(0) => return self.keyframes[0].1.to_matrix(),
+            None => return self.keyframes[self.keyframes.len() - 1].1.to_matrix(),
+            Some(i) => (self.keyframes[i - 1], self.keyframes[i]),
+        };
+
+        let t = (time - from.0) / (to.0 - from.0);
+        let (a, b) = (from.1, to.1);
+        Decomposition {
+            translation: a.translation + (b.translation - a.translation) * t,
+            rotation: a.rotation.slerp(&b.rotation, t),
+            scale: a.scale + (b.scale - a.scale) * t,
+        }
+        .to_matrix()
+    }
+
+    /// where the animation carries `point` at `time`.
+    pub fn point_at(&self, point: Point, time: f64) -> Point {
+        self.transform_at(time) * point
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::Vector;
+    use std::f64::consts;
+
+    fn slide_and_turn() -> Animation {
+        Animation::new(vec![
+            (
+                2.0,
+                Matrix::translation(4.0, 0.0, 0.0) * Matrix::rotation_y(consts::PI / 2.0),
+            ),
+            (0.0, Matrix::identity()),
+        ])
+    }
+
+    #[test]
+    fn holds_still_outside_of_keyframes() {
+        let animation = slide_and_turn();
+        assert_eq!(animation.span(), (0.0, 2.0));
+        assert_eq!(animation.transform_at(-1.0), Matrix::identity());
+        assert_eq!(
+            animation.transform_at(3.0),
+            Matrix::translation(4.0, 0.0, 0.0) * Matrix::rotation_y(consts::PI / 2.0)
+        );
+    }
+
+    #[test]
+    fn blends_between_keyframes() {
+        let animation = slide_and_turn();
+        assert_eq!(
+            animation.transform_at(1.0),
+            Matrix::translation(2.0, 0.0, 0.0) * Matrix::rotation_y(consts::PI / 4.0)
+        );
+    }
+
+    #[test]
+    fn turning_keeps_size() {
+        // a linear blend of the matrices would shrink the point halfway through.
+        let animation = Animation::new(vec![
+            (0.0, Matrix::identity()),
+            (1.0, Matrix::rotation_z(consts::PI)),
+        ]);
+        let moved = animation.point_at(Point::new(1.0, 0.0, 0.0), 0.5);
+        assert!(((moved - Point::zero()).magnitude() - 1.0).abs() < 1e-9);
+        assert_eq!(moved - Point::zero(), Vector::new(0.0, 1.0, 0.0));
+    }
+}
@@ -0,0 +1,80 @@
+use crate::{math::Vector, world::Color};
+
+pub mod sky;
+pub use sky::Sky;
+
+/// what is seen in the directions where a ray does not hit any objects.
+#[derive(Copy, Clone, Debug)]
+pub enum Background {
+    Solid(Color),
+    Sky(Sky),
+    /// an arbitrary function of the (not necessarily normalized) direction of the ray.
+    Function(fn(Vector) -> Color),
+}
+
+impl Background {
+    pub fn solid(color: Color) -> Background {
+        Background::Solid(color)
+    }
+
+    pub fn sky(sky: Sky) -> Background {
+        Background::Sky(sky)
+    }
+
+    pub fn function(f: fn(Vector) -> Color) -> Background {
+        Background::Function(f)
+    }
+
+    /// the color seen when looking in `direction`.
+    pub fn color_at(&self, direction: Vector) -> Color {
+        match self {
+            Background::Solid(color) => *color,
+            Background::Sky(sky) => sky.color_at(direction),
+            Background::Function(f) => f(direction),
+        }
+    }
+}
+
+impl Default for Background {
+    fn default() -> Background {
+        Background::solid(Color::black())
+    }
+}
+
+impl PartialEq for Background {
+    /// functions are only equal when they are the same function.
+    fn eq(&self, other: &Self) -> bool {
+        match (self, other) {
+            (Background::Solid(a), Background::Solid(b)) => a == b,
+            (Background::Sky(a), Background::Sky(b)) => a == b,
+            (Background::Function(a), Background::Function(b)) => *a as usize == *b as usize,
+            _ => false,
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn default_background_is_black() {
+        let background = Background::default();
+        assert_eq!(
+            background.color_at(Vector::new(0.0, 1.0, 0.0)),
+            Color::black()
+        );
+    }
+
+    #[test]
+    fn function_background() {
+        fn by_direction(direction: Vector) -> Color {
+            Color::from_vector(direction.normalized())
+        }
+        let background = Background::function(by_direction);
+        assert_eq!(
+            background.color_at(Vector::new(0.0, 0.0, 2.0)),
+            Color::new(0.0, 0.0, 1.0)
+        );
+    }
+}
@@ -0,0 +1,96 @@
+use crate::{math::Vector, world::Color};
+
+/// a sky which blends from one color at the horizon to another straight overhead,
+/// optionally with a sun. everything below the horizon is the horizon color.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Sky {
+    pub horizon: Color,
+    pub zenith: Color,
+    pub sun: Option<Sun>,
+}
+
+/// a disk in the sky, seen in every direction within `radius` radians of `direction`.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Sun {
+    pub direction: Vector,
+    pub radius: f64,
+    pub color: Color,
+}
+
+impl Sky {
+    pub fn new(horizon: Color, zenith: Color) -> Sky {
+        Sky {
+            horizon,
+            zenith,
+            sun: None,
+        }
+    }
+
+    pub fn with_sun(self, direction: Vector, radius: f64, color: Color) -> Sky {
+        Sky {
+            sun: Some(Sun {
+                direction: direction.normalized(),
+                radius,
+                color,
+            }),
+            ..self
+        }
+    }
+
+    pub fn color_at(&self, direction: Vector) -> Color {
+        let direction = direction.normalized();
+
+        if let Some(sun) = self.sun {
+            if direction.dot(&sun.direction) >= sun.radius.cos() {
+                return sun.color;
+            }
+        }
+
+        let height = direction[1].max(0.0);
+        (self.horizon * (1.0 - height)) + (self.zenith * height)
+    }
+}
+
+impl Default for Sky {
+    /// a pale blue sky with no sun.
+    fn default() -> Sky {
+        Sky::new(Color::new(0.9, 0.95, 1.0), Color::new(0.3, 0.5, 0.9))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn sky() -> Sky {
+        Sky::new(Color::white(), Color::new(0.0, 0.0, 1.0))
+    }
+
+    #[test]
+    fn sky_blends_from_horizon_to_zenith() {
+        let sky = sky();
+        assert_eq!(sky.color_at(Vector::new(1.0, 0.0, 0.0)), Color::white());
+        assert_eq!(
+            sky.color_at(Vector::new(0.0, 3.0, 0.0)),
+            Color::new(0.0, 0.0, 1.0)
+        );
+        assert_eq!(
+            sky.color_at(Vector::new(0.0, 0.5, f64::from(0.75).sqrt())),
+            Color::new(0.5, 0.5, 1.0)
+        );
+    }
+
+    #[test]
+    fn below_horizon_is_horizon_color() {
+        assert_eq!(sky().color_at(Vector::new(0.0, -1.0, 1.0)), Color::white());
+    }
+
+    #[test]
+    fn sun_disk() {
+        let sun_color = Color::new(10.0, 10.0, 8.0);
+        let sky = sky().with_sun(Vector::new(1.0, 1.0, 0.0), 0.1, sun_color);
+        assert_eq!(sky.color_at(Vector::new(2.0, 2.0, 0.0)), sun_color);
+        assert_eq!(sky.color_at(Vector::new(1.0, 1.1, 0.0)), sun_color);
+        assert_ne!(sky.color_at(Vector::new(1.0, 1.5, 0.0)), sun_color);
+    }
+}
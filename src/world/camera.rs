@@ -1,8 +1,45 @@
+use std::{
+    collections::{BTreeMap, BTreeSet, VecDeque},
+    f64::consts,
+    sync::{
+        atomic::{AtomicBool, Ordering},
+        mpsc, Mutex,
+    },
+    thread,
+    time::{Duration, Instant},
+};
+
 use crate::{
-    math::{matrix::Matrix, point::Point, vector::Vector},
-    world::{canvas::Canvas, ray::Ray, World},
+    math::{matrix::Matrix, point::Point, vector::Vector, Bounds, EPSILON},
+    world::{
+        canvas::{Canvas, SubCanvas},
+        color::Color,
+        ray::Ray,
+        World,
+    },
 };
 
+pub mod builder;
+pub use builder::Builder;
+
+pub mod exposure;
+pub use exposure::Exposure;
+
+pub mod filter;
+pub use filter::Filter;
+
+pub mod incremental;
+pub use incremental::Incremental;
+
+pub mod sampler;
+pub use sampler::Sampler;
+
+pub mod schedule;
+pub use schedule::{Order, Schedule, Tile};
+
+pub mod targets;
+pub use targets::{RenderTargets, Target};
+
 #[derive(Copy, Clone, Debug, PartialEq)]
 pub struct View {
     pub transform: Matrix,
@@ -52,6 +89,23 @@ pub struct Camera {
     pub image_height: usize,
     pub field_of_view: f64,
     pub view: View,
+    pub exposure: Exposure,
+    /// the number of samples taken along each axis of a pixel, so that each pixel
+    /// is the average of `samples * samples` evenly spaced rays.
+    pub samples: usize,
+    /// if set, the brightest that any one sample may be before it is combined with
+    /// the other samples in its pixel, which keeps rare but very bright samples (such
+    /// as a glimpse of the sun) from overwhelming the pixel.
+    pub sample_clamp: Option<f64>,
+    /// how the samples within a pixel are combined.
+    pub filter: Filter,
+    /// whether each sample is moved to a random spot within its share of the pixel,
+    /// which trades the stair-stepping of evenly spaced samples for noise. the spots
+    /// are chosen by a `Sampler` seeded from the `frame` and the pixel, so the image
+    /// is still the same every time it is rendered.
+    pub jitter: bool,
+    /// the number of the frame being rendered, when rendering an animation.
+    pub frame: u64,
     half_width: f64,
     half_height: f64,
     pixel_size: f64,
@@ -76,13 +130,96 @@ impl Camera {
             half_height,
             pixel_size: (half_width * 2.0) / (image_width as f64),
             view: View::default(),
+            exposure: Exposure::default(),
+            samples: 1,
+            sample_clamp: None,
+            filter: Filter::default(),
+            jitter: false,
+            frame: 0,
+        }
+    }
+
+    /// like `new`, but fails if the image has no pixels or the field of view (in
+    /// radians) is not strictly between 0 and pi.
+    pub fn try_new(
+        image_width: usize,
+        image_height: usize,
+        field_of_view: f64,
+    ) -> Result<Camera, builder::Error> {
+        if image_width == 0 || image_height == 0 {
+            Err(builder::Error::EmptyImage)
+        } else if !(0.0 < field_of_view && field_of_view < consts::PI) {
+            Err(builder::Error::InvalidFieldOfView(
+                field_of_view.to_degrees(),
+            ))
+        } else {
+            Ok(Camera::new(image_width, image_height, field_of_view))
         }
     }
 
+    /// returns this camera, but rendering an image of a different size.
+    /// the field of view, view transformation, and all other settings are kept.
+    pub fn resized(&self, image_width: usize, image_height: usize) -> Camera {
+        Camera {
+            view: self.view,
+            exposure: self.exposure,
+            samples: self.samples,
+            sample_clamp: self.sample_clamp,
+            filter: self.filter,
+            jitter: self.jitter,
+            frame: self.frame,
+            ..Camera::new(image_width, image_height, self.field_of_view)
+        }
+    }
+
+    /// returns this camera, but moved so that all of `bounds` is in view with some room
+    /// to spare: `margin` is the fraction of the size of the box left around it, so a
+    /// margin of 0.1 leaves a tenth of the box's size free on either side. the camera
+    /// keeps looking in the same direction, and keeps its field of view. empty or
+    /// infinitely large boxes cannot be framed, so the camera is left as it is.
+    pub fn framed(&self, bounds: Bounds, margin: f64) -> Camera {
+        if !bounds.is_finite() {
+            return *self;
+        }
+
+        // the rows of the view transformation are the camera's left, up, and backward
+        // directions.
+        let transform = self.view.transform;
+        let row = |i| Vector::new(transform[(i, 0)], transform[(i, 1)], transform[(i, 2)]);
+        let (up, forward) = (row(1), -row(2));
+
+        // fit the sphere around the box into the narrower side of the view.
+        let center = bounds.center();
+        let radius = (bounds.max - bounds.min).magnitude() / 2.0 * (1.0 + margin);
+        let half_angle = self.half_width.min(self.half_height).atan();
+        let distance = radius / half_angle.sin();
+
+        let mut camera = *self;
+        camera.view = View::transformed(center - forward * distance, center, up);
+        camera
+    }
+
+    /// like `framed`, but frames every object in the world. objects which reach
+    /// infinitely far, such as planes, are left out.
+    pub fn framed_world(&self, world: &World, margin: f64) -> Camera {
+        self.framed(world.finite_bounds(), margin)
+    }
+
+    /// starts describing a camera positioned at `from` and looking towards `to`.
+    pub fn look_at(from: Point, to: Point, up: Vector) -> Builder {
+        Builder::new(from, to, up)
+    }
+
     pub fn ray_for_pixel(&self, x: usize, y: usize) -> Ray {
-        // the offset from the edge of the canvas to the pixel's center
-        let x_offset = ((x as f64) + 0.5) * self.pixel_size;
-        let y_offset = ((y as f64) + 0.5) * self.pixel_size;
+        self.ray_for_subpixel(x, y, (0.5, 0.5))
+    }
+
+    /// like `ray_for_pixel`, but the ray passes through the pixel at `(dx, dy)`,
+    /// measured as a fraction of the pixel's width and height from its top-left corner.
+    pub fn ray_for_subpixel(&self, x: usize, y: usize, (dx, dy): (f64, f64)) -> Ray {
+        // the offset from the edge of the canvas to the sample point within the pixel
+        let x_offset = ((x as f64) + dx) * self.pixel_size;
+        let y_offset = ((y as f64) + dy) * self.pixel_size;
 
         // the un-transformed coordinates of the pixel in world space.
         // (the camera looks towards -z, so +x is to the left)
@@ -99,24 +236,436 @@ impl Camera {
         Ray::new(origin, direction)
     }
 
+    /// computes the final, exposed color of the pixel at `(x, y)`.
+    pub fn render_pixel(&self, world: &World, x: usize, y: usize) -> Color {
+        self.sample_pixel(world, x, y, |ray, budget| {
+            world.cast_ray_within(ray, budget)
+        })
+    }
+
+    /// combines the colors that `cast_ray` returns for each of the pixel's sample rays,
+    /// and then applies the exposure. each sample is given an even share of the
+    /// world's `ray_budget` for the pixel.
+    fn sample_pixel<F: Fn(Ray, usize) -> Color>(
+        &self,
+        world: &World,
+        x: usize,
+        y: usize,
+        cast_ray: F,
+    ) -> Color {
+        let rays = self.sample_rays(x, y);
+        let count = rays.len();
+        let colors: Vec<Color> = rays
+            .into_iter()
+            .enumerate()
+            .map(|(i, ray)| self.clamp_sample(cast_ray(ray, share(world.ray_budget, count, i))))
+            .collect();
+
+        self.filter.combine(&colors) * self.exposure.scale()
+    }
+
+    fn clamp_sample(&self, color: Color) -> Color {
+        match self.sample_clamp {
+            Some(limit) => filter::clamp(color, limit),
+            None => color,
+        }
+    }
+
+    /// the rays cast through the pixel at `(x, y)`, one for each sample.
+    fn sample_rays(&self, x: usize, y: usize) -> Vec<Ray> {
+        let samples = self.samples.max(1);
+        let mut rays = Vec::with_capacity(samples * samples);
+        let mut sampler = Sampler::new(self.frame, x, y);
+
+        for sy in 0..samples {
+            for sx in 0..samples {
+                let (jx, jy) = if self.jitter {
+                    (sampler.next_f64(), sampler.next_f64())
+                } else {
+                    (0.5, 0.5)
+                };
+                let offset = (
+                    ((sx as f64) + jx) / (samples as f64),
+                    ((sy as f64) + jy) / (samples as f64),
+                );
+                rays.push(self.ray_for_subpixel(x, y, offset));
+            }
+        }
+
+        rays
+    }
+
     pub fn render(&self, world: &World) -> Canvas {
         let mut image = Canvas::new(self.image_width, self.image_height);
 
         for y in 0..self.image_height {
             for x in 0..self.image_width {
-                let ray = self.ray_for_pixel(x, y);
-                image[(x, y)] = world.cast_ray(ray);
+                image[(x, y)] = self.render_pixel(world, x, y);
             }
         }
 
         image
     }
+
+    /// renders the image on several threads at once, as described by `schedule`.
+    /// each thread writes its tiles straight into the image. `on_tile` is called on
+    /// this thread as each tile is finished, so that the progress can be previewed.
+    pub fn render_scheduled<F: FnMut(&SubCanvas)>(
+        &self,
+        world: &World,
+        schedule: &Schedule,
+        on_tile: F,
+    ) -> Canvas {
+        let keep_going = AtomicBool::new(true);
+        self.render_cancellable(world, schedule, &keep_going, on_tile)
+            .expect("the render is never cancelled")
+    }
+
+    /// like `render_scheduled`, but stops early once `keep_going` is set to `false`
+    /// (usually from another thread), in which case `None` is returned. the tiles that
+    /// were being rendered when it was cancelled are finished first.
+    pub fn render_cancellable<F: FnMut(&SubCanvas)>(
+        &self,
+        world: &World,
+        schedule: &Schedule,
+        keep_going: &AtomicBool,
+        on_tile: F,
+    ) -> Option<Canvas> {
+        let (image, _) = self.render_partial(world, schedule, keep_going, on_tile);
+
+        if keep_going.load(Ordering::Relaxed) {
+            Some(image)
+        } else {
+            None
+        }
+    }
+
+    /// like `render_cancellable`, but gives back whatever was rendered before the
+    /// render was cancelled, along with the tiles which were not rendered (and so are
+    /// left black), in the order they would have been rendered.
+    pub fn render_partial<F: FnMut(&SubCanvas)>(
+        &self,
+        world: &World,
+        schedule: &Schedule,
+        keep_going: &AtomicBool,
+        mut on_tile: F,
+    ) -> (Canvas, Vec<Tile>) {
+        let mut image = Canvas::new(self.image_width, self.image_height);
+        let tiles = schedule.tiles(self.image_width, self.image_height);
+        let mut finished = vec![false; tiles.len()];
+        self.render_tiles(
+            world,
+            &mut image,
+            &tiles,
+            schedule.workers,
+            keep_going,
+            |view| {
+                if let Some(i) = tiles
+                    .iter()
+                    .position(|tile| tile.x == view.x && tile.y == view.y)
+                {
+                    finished[i] = true;
+                }
+                on_tile(view);
+            },
+        );
+
+        let missing = tiles
+            .iter()
+            .zip(finished)
+            .filter(|(_, finished)| !finished)
+            .map(|(&tile, _)| tile)
+            .collect();
+        (image, missing)
+    }
+
+    /// renders `tiles` of `image` on `workers` threads, leaving the rest of it as it is.
+    fn render_tiles<F: FnMut(&SubCanvas)>(
+        &self,
+        world: &World,
+        image: &mut Canvas,
+        tiles: &[Tile],
+        workers: usize,
+        keep_going: &AtomicBool,
+        mut on_tile: F,
+    ) {
+        let regions: Vec<_> = tiles
+            .iter()
+            .map(|tile| (tile.x, tile.y, tile.width, tile.height))
+            .collect();
+
+        // every worker takes the next tile from the front of a shared queue, so the
+        // tiles are started in order and no worker sits idle while others have work.
+        let queue: Mutex<VecDeque<SubCanvas>> = Mutex::new(image.split(&regions).into());
+        let (sender, receiver) = mpsc::channel();
+
+        thread::scope(|scope| {
+            for _ in 0..workers.max(1) {
+                let sender = sender.clone();
+                let queue = &queue;
+
+                scope.spawn(move || {
+                    while keep_going.load(Ordering::Relaxed) {
+                        let next = queue.lock().unwrap().pop_front();
+                        let mut view = match next {
+                            Some(view) => view,
+                            None => break,
+                        };
+                        for y in 0..view.height {
+                            for x in 0..view.width {
+                                view[(x, y)] = self.render_pixel(world, view.x + x, view.y + y);
+                            }
+                        }
+                        if sender.send(view).is_err() {
+                            break;
+                        }
+                    }
+                });
+            }
+            drop(sender);
+
+            for view in receiver {
+                on_tile(&view);
+            }
+        });
+    }
+
+    /// the pixels that `bounds` covers in the image, as a tile which is clipped to the
+    /// image (and so may be empty). boxes which reach infinitely far, or which are
+    /// partly behind the camera, cannot be projected onto the image.
+    fn tile_covering(&self, bounds: Bounds) -> Option<Tile> {
+        if !bounds.is_finite() {
+            return None;
+        }
+
+        // in camera space, the camera looks towards -z from the origin.
+        let bounds = bounds.transformed(self.view.transform);
+        if bounds.max[2] > -EPSILON {
+            return None;
+        }
+
+        let (mut left, mut top) = (f64::INFINITY, f64::INFINITY);
+        let (mut right, mut bottom) = (f64::NEG_INFINITY, f64::NEG_INFINITY);
+        for &x in &[bounds.min[0], bounds.max[0]] {
+            for &y in &[bounds.min[1], bounds.max[1]] {
+                for &z in &[bounds.min[2], bounds.max[2]] {
+                    // the inverse of `ray_for_subpixel`, measured in pixels.
+                    let px = (self.half_width + x / z) / self.pixel_size;
+                    let py = (self.half_height + y / z) / self.pixel_size;
+                    left = left.min(px);
+                    right = right.max(px);
+                    top = top.min(py);
+                    bottom = bottom.max(py);
+                }
+            }
+        }
+
+        let clip = |value: f64, limit: usize| value.max(0.0).min(limit as f64) as usize;
+        let (x0, x1) = (
+            clip(left.floor(), self.image_width),
+            clip(right.ceil(), self.image_width),
+        );
+        let (y0, y1) = (
+            clip(top.floor(), self.image_height),
+            clip(bottom.ceil(), self.image_height),
+        );
+
+        Some(Tile {
+            x: x0,
+            y: y0,
+            width: x1 - x0,
+            height: y1 - y0,
+        })
+    }
+
+    /// renders a separate image for each group of lights in the world, where each image
+    /// only contains the light contributed by the lights in that group. the background
+    /// is left out of every group and rendered by `render_background` instead. since
+    /// shading is additive, the images and the background sum to the image returned by
+    /// `render`, so the groups can be rebalanced against each other afterwards without
+    /// rendering again. (this does not hold if the samples are clamped or median
+    /// filtered, or behind shadow catchers, none of which are additive.)
+    pub fn render_light_groups(&self, world: &World) -> BTreeMap<usize, Canvas> {
+        let groups: BTreeSet<usize> = world.lights.iter().map(|light| light.group()).collect();
+
+        groups
+            .into_iter()
+            .map(|group| {
+                let mut image = Canvas::new(self.image_width, self.image_height);
+
+                for y in 0..self.image_height {
+                    for x in 0..self.image_width {
+                        image[(x, y)] = self.sample_pixel(world, x, y, |ray, budget| {
+                            world.cast_ray_lit_by_within(
+                                ray,
+                                |light| light.group() == group,
+                                budget,
+                            )
+                        });
+                    }
+                }
+
+                (group, image)
+            })
+            .collect()
+    }
+
+    /// renders only the background, as seen directly and in reflections and refractions,
+    /// which is the part of `render` that no light group contains.
+    pub fn render_background(&self, world: &World) -> Canvas {
+        let mut image = Canvas::new(self.image_width, self.image_height);
+
+        for y in 0..self.image_height {
+            for x in 0..self.image_width {
+                image[(x, y)] = self.sample_pixel(world, x, y, |ray, budget| {
+                    world.cast_background_within(ray, budget)
+                });
+            }
+        }
+
+        image
+    }
+
+    /// renders an image for each of `targets` in a single pass over the pixels. the
+    /// first surface seen by each sample ray is found once, and shared by all of the
+    /// targets which are not shaded. each shaded target is lit differently, so it
+    /// traces its sample rays itself. the images are named by `Target::name`.
+    pub fn render_targets(&self, world: &World, targets: &[Target]) -> RenderTargets {
+        let mut render_targets = RenderTargets::new(targets, self.image_width, self.image_height);
+        let surfaces = targets
+            .iter()
+            .any(|target| !target.is_shaded() && *target != Target::ObjectId);
+
+        for y in 0..self.image_height {
+            for x in 0..self.image_width {
+                let hits: Vec<_> = if surfaces {
+                    self.sample_rays(x, y)
+                        .into_iter()
+                        .map(|ray| world.visible_hit(ray))
+                        .collect()
+                } else {
+                    vec![]
+                };
+
+                for target in targets {
+                    let color = if target.is_shaded() {
+                        self.sample_pixel(world, x, y, |ray, budget| {
+                            target.sample_within(world, ray, budget)
+                        })
+                    } else if *target == Target::ObjectId {
+                        target.sample(world, self.ray_for_pixel(x, y))
+                    } else {
+                        let colors: Vec<Color> = hits
+                            .iter()
+                            .map(|hit| target.surface(hit.as_ref()))
+                            .collect();
+                        self.filter.combine(&colors)
+                    };
+
+                    render_targets.canvases.get_mut(&target.name()).unwrap()[(x, y)] = color;
+                }
+            }
+        }
+
+        render_targets
+    }
+
+    /// renders the image in a series of passes of increasing resolution, calling
+    /// `on_pass` with the partially refined image after each one. the first pass
+    /// renders one pixel out of every `block_size`-by-`block_size` block and fills
+    /// the whole block with its color; each following pass halves the block size
+    /// (reusing every pixel that has already been rendered) until the final pass
+    /// renders at full resolution. the returned image is identical to `render`.
+    pub fn render_progressively<F: FnMut(&Canvas)>(
+        &self,
+        world: &World,
+        block_size: usize,
+        on_pass: F,
+    ) -> Canvas {
+        self.refine(world, block_size, None, &AtomicBool::new(true), on_pass)
+    }
+
+    /// like `render_progressively`, but stops refining once `budget` has passed, or
+    /// `keep_going` is cleared, and returns the image as far as it got, in which some
+    /// blocks may not have been refined. the first pass is always finished, so that
+    /// the whole image is covered.
+    pub fn render_within(
+        &self,
+        world: &World,
+        block_size: usize,
+        budget: Duration,
+        keep_going: &AtomicBool,
+    ) -> Canvas {
+        let deadline = Some(Instant::now() + budget);
+        self.refine(world, block_size, deadline, keep_going, |_| {})
+    }
+
+    fn refine<F: FnMut(&Canvas)>(
+        &self,
+        world: &World,
+        block_size: usize,
+        deadline: Option<Instant>,
+        keep_going: &AtomicBool,
+        mut on_pass: F,
+    ) -> Canvas {
+        let mut image = Canvas::new(self.image_width, self.image_height);
+        let mut step = block_size.max(1).next_power_of_two();
+        let mut previous_step = None;
+
+        loop {
+            for y in (0..self.image_height).step_by(step) {
+                if previous_step.is_some() {
+                    let late = deadline.map_or(false, |deadline| deadline <= Instant::now());
+                    if late || !keep_going.load(Ordering::Relaxed) {
+                        return image;
+                    }
+                }
+                for x in (0..self.image_width).step_by(step) {
+                    // pixels on the previous (coarser) lattice were already rendered,
+                    // so only the blocks they cover need to be shrunk.
+                    let color = match previous_step {
+                        Some(previous) if x % previous == 0 && y % previous == 0 => image[(x, y)],
+                        _ => self.render_pixel(world, x, y),
+                    };
+
+                    for by in y..(y + step).min(self.image_height) {
+                        for bx in x..(x + step).min(self.image_width) {
+                            image[(bx, by)] = color;
+                        }
+                    }
+                }
+            }
+
+            on_pass(&image);
+
+            if step == 1 {
+                break;
+            }
+
+            previous_step = Some(step);
+            step /= 2;
+        }
+
+        image
+    }
+}
+
+/// the part of a pixel's `budget` of rays which is given to the `i`th of its `count`
+/// samples. the rays left over from dividing it evenly go to the first samples.
+fn share(budget: Option<usize>, count: usize, i: usize) -> usize {
+    match budget {
+        Some(budget) => budget / count + if i < budget % count { 1 } else { 0 },
+        None => usize::MAX,
+    }
 }
 
 #[cfg(test)]
 mod tests {
     use super::*;
-    use crate::{math::EPSILON, world::color::Color};
+    use crate::{
+        math::{Form, Geometry, EPSILON},
+        world::{light, Background, Light},
+    };
     use std::f64::consts;
 
     #[test]
@@ -178,6 +727,25 @@ mod tests {
         assert_eq!(c.field_of_view, consts::PI / 2.0);
         assert_eq!(c.view.transform, Matrix::identity());
         assert_eq!(c.view.inverse, Matrix::identity());
+        assert_eq!(c.exposure, Exposure::default());
+        assert_eq!(c.samples, 1);
+    }
+
+    #[test]
+    fn construct_checked_camera() {
+        assert_eq!(
+            Camera::try_new(160, 120, consts::PI / 2.0),
+            Ok(Camera::new(160, 120, consts::PI / 2.0))
+        );
+        assert_eq!(
+            Camera::try_new(0, 120, consts::PI / 2.0),
+            Err(builder::Error::EmptyImage)
+        );
+        assert_eq!(
+            Camera::try_new(160, 120, 0.0),
+            Err(builder::Error::InvalidFieldOfView(0.0))
+        );
+        assert!(Camera::try_new(160, 120, f64::NAN).is_err());
     }
 
     #[test]
@@ -238,4 +806,368 @@ mod tests {
         let image = c.render(&w);
         assert_eq!(image[(5, 5)], Color::new(0.38066, 0.47583, 0.2855));
     }
+
+    #[test]
+    fn render_world_with_exposure() {
+        let w = World::default();
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        let from = Point::new(0.0, 0.0, -5.0);
+        let to = Point::zero();
+        let up = Vector::new(0.0, 1.0, 0.0);
+        c.view = View::transformed(from, to, up);
+        c.exposure = Exposure::default().with_compensation(-1.0);
+        let image = c.render(&w);
+        assert_eq!(image[(5, 5)], Color::new(0.19033, 0.23792, 0.14275));
+    }
+
+    #[test]
+    fn progressive_render_refines_to_full_render() {
+        let w = World::default();
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let mut passes = vec![];
+        let image = c.render_progressively(&w, 4, |canvas| {
+            passes.push((canvas[(0, 0)], canvas[(3, 3)], canvas[(5, 5)]));
+        });
+        assert_eq!(passes.len(), 3);
+        // the first pass fills each 4x4 block with the color of its corner.
+        assert_eq!(passes[0].0, passes[0].1);
+        assert_eq!(passes[0].2, c.render_pixel(&w, 4, 4));
+        // the last pass is the full resolution image.
+        assert_eq!(passes[2].2, Color::new(0.38066, 0.47583, 0.2855));
+        let full = c.render(&w);
+        for y in 0..11 {
+            for x in 0..11 {
+                assert_eq!(image[(x, y)], full[(x, y)]);
+            }
+        }
+    }
+
+    #[test]
+    fn render_within_budget() {
+        let w = World::default();
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let mut first_pass = None;
+        c.render_progressively(&w, 4, |canvas| {
+            first_pass.get_or_insert_with(|| canvas.hash());
+        });
+
+        let keep_going = AtomicBool::new(true);
+        let rushed = c.render_within(&w, 4, Duration::from_secs(0), &keep_going);
+        assert_eq!(Some(rushed.hash()), first_pass);
+        let patient = c.render_within(&w, 4, Duration::from_secs(60), &keep_going);
+        assert_eq!(patient.hash(), c.render(&w).hash());
+
+        // cancelling stops after the first pass, however much time is left.
+        keep_going.store(false, Ordering::Relaxed);
+        let cancelled = c.render_within(&w, 4, Duration::from_secs(60), &keep_going);
+        assert_eq!(Some(cancelled.hash()), first_pass);
+    }
+
+    #[test]
+    fn resize_camera() {
+        let mut c = Camera::new(200, 125, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        c.samples = 3;
+        let resized = c.resized(100, 50);
+        assert_eq!(resized.image_width, 100);
+        assert_eq!(resized.image_height, 50);
+        assert_eq!(resized.view, c.view);
+        assert_eq!(resized.samples, 3);
+        assert!((resized.pixel_size - 0.02).abs() < EPSILON);
+    }
+
+    #[test]
+    fn supersampled_pixel_averages_subpixel_rays() {
+        let w = World::default();
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        c.samples = 2;
+        let expected = (w.cast_ray(c.ray_for_subpixel(3, 3, (0.25, 0.25)))
+            + w.cast_ray(c.ray_for_subpixel(3, 3, (0.75, 0.25)))
+            + w.cast_ray(c.ray_for_subpixel(3, 3, (0.25, 0.75)))
+            + w.cast_ray(c.ray_for_subpixel(3, 3, (0.75, 0.75))))
+            / 4.0;
+        assert_eq!(c.render_pixel(&w, 3, 3), expected);
+    }
+
+    #[test]
+    fn clamped_samples() {
+        let mut w = World::new(vec![], vec![]);
+        w.background = Background::solid(Color::new(20.0, 10.0, 0.0));
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.samples = 2;
+        assert_eq!(c.render_pixel(&w, 0, 0), Color::new(20.0, 10.0, 0.0));
+        c.sample_clamp = Some(4.0);
+        assert_eq!(c.render_pixel(&w, 0, 0), Color::new(4.0, 2.0, 0.0));
+    }
+
+    #[test]
+    fn scheduled_render_matches_render() {
+        let w = World::default();
+        let mut c = Camera::new(23, 17, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let expected = c.render(&w);
+        for &order in [Order::Scanline, Order::Spiral, Order::Hilbert].iter() {
+            let schedule = Schedule::default()
+                .with_workers(3)
+                .with_tile_size(4)
+                .with_order(order);
+            let mut finished = Vec::new();
+            let image = c.render_scheduled(&w, &schedule, |tile| {
+                assert_eq!(tile[(0, 0)], expected[(tile.x, tile.y)]);
+                finished.push((tile.x, tile.y));
+            });
+            finished.sort();
+            let mut tiles: Vec<_> = schedule
+                .tiles(23, 17)
+                .iter()
+                .map(|tile| (tile.x, tile.y))
+                .collect();
+            tiles.sort();
+            assert_eq!(finished, tiles);
+            assert_eq!(image.hash(), expected.hash());
+            for y in 0..17 {
+                for x in 0..23 {
+                    assert_eq!(image[(x, y)], expected[(x, y)]);
+                }
+            }
+        }
+    }
+
+    #[test]
+    fn framing_box() {
+        let c = Camera::new(100, 50, consts::PI / 2.0);
+        let framed = c.framed(Bounds::around(Point::new(0.0, 1.0, 0.0), 1.0), 0.0);
+
+        // still looking down -z, from far enough that the box's sphere fits vertically.
+        let radius = f64::from(3.0).sqrt();
+        let half_angle = f64::from(0.5).atan();
+        assert_eq!(
+            framed.view.inverse * Point::zero(),
+            Point::new(0.0, 1.0, radius / half_angle.sin())
+        );
+        assert_eq!(
+            framed.view.inverse * Vector::new(0.0, 0.0, -1.0),
+            Vector::new(0.0, 0.0, -1.0)
+        );
+
+        assert_eq!(c.framed(Bounds::empty(), 0.1), c);
+    }
+
+    #[test]
+    fn framing_world_leaves_out_planes() {
+        let mut w = World::default();
+        w.objects.push(Geometry::default().with_form(Form::Plane));
+        let c = Camera::new(100, 100, consts::PI / 2.0).framed_world(&w, 0.0);
+        assert_eq!(
+            c,
+            Camera::new(100, 100, consts::PI / 2.0).framed(Bounds::around(Point::zero(), 1.0), 0.0)
+        );
+        let r = c.ray_for_pixel(50, 50);
+        assert!(w.hit(r).is_some());
+    }
+
+    #[test]
+    fn jittered_render_does_not_depend_on_schedule() {
+        let w = World::default();
+        let mut c = Camera::new(15, 9, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        c.samples = 2;
+        c.jitter = true;
+
+        let expected = c.render(&w);
+        for &workers in [1, 2, 5].iter() {
+            let schedule = Schedule::default()
+                .with_workers(workers)
+                .with_tile_size(4)
+                .with_order(Order::Hilbert);
+            let image = c.render_scheduled(&w, &schedule, |_| {});
+            assert_eq!(image.hash(), expected.hash());
+        }
+
+        // another frame samples different spots.
+        c.frame = 1;
+        assert_ne!(c.render(&w).hash(), expected.hash());
+    }
+
+    #[test]
+    fn render_light_groups() {
+        let mut w = World::default();
+        w.lights.push(Light::point(
+            light::Point::new(Point::new(10.0, 10.0, -10.0), Color::new(0.5, 0.5, 0.5))
+                .with_group(3),
+        ));
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let groups = c.render_light_groups(&w);
+        assert_eq!(groups.keys().copied().collect::<Vec<_>>(), vec![0, 3]);
+        assert_eq!(groups[&0][(5, 5)], Color::new(0.38066, 0.47583, 0.2855));
+        let full = c.render(&w);
+        for y in 0..11 {
+            for x in 0..11 {
+                assert_eq!(groups[&0][(x, y)] + groups[&3][(x, y)], full[(x, y)]);
+            }
+        }
+    }
+
+    #[test]
+    fn render_light_groups_without_the_background() {
+        let mut w = World::default();
+        w.background = Background::solid(Color::new(0.5, 0.5, 0.5));
+        w.lights.push(Light::point(
+            light::Point::new(Point::new(10.0, 10.0, -10.0), Color::new(0.2, 0.2, 0.2))
+                .with_group(1),
+        ));
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let groups = c.render_light_groups(&w);
+        let background = c.render_background(&w);
+        // the corner misses the spheres.
+        assert_eq!(groups[&0][(0, 0)], Color::black());
+        assert_eq!(groups[&1][(0, 0)], Color::black());
+        assert_eq!(background[(0, 0)], Color::new(0.5, 0.5, 0.5));
+        assert_eq!(background[(5, 5)], Color::black());
+        let full = c.render(&w);
+        for y in 0..11 {
+            for x in 0..11 {
+                assert_eq!(
+                    groups[&0][(x, y)] + groups[&1][(x, y)] + background[(x, y)],
+                    full[(x, y)]
+                );
+            }
+        }
+    }
+
+    #[test]
+    fn render_several_targets() {
+        let w = World::default();
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        c.exposure = c.exposure.with_compensation(1.0);
+        let targets = c.render_targets(&w, &[Target::Beauty, Target::LightGroup(0), Target::Depth]);
+        assert_eq!(targets.get("beauty").unwrap().hash(), c.render(&w).hash());
+        assert_eq!(
+            targets.get("light-group-0").unwrap().hash(),
+            c.render_light_groups(&w)[&0].hash()
+        );
+        // depth is not exposed.
+        assert_eq!(
+            targets.get("depth").unwrap()[(5, 5)],
+            Color::new(4.0, 4.0, 4.0)
+        );
+    }
+
+    #[test]
+    fn light_group_and_background_targets_add_up() {
+        let mut w = World::default();
+        w.objects[0].material.reflective = 0.5;
+        w.background = Background::solid(Color::new(0.2, 0.3, 0.4));
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let targets = c.render_targets(
+            &w,
+            &[Target::Beauty, Target::LightGroup(0), Target::Background],
+        );
+        let beauty = targets.get("beauty").unwrap();
+        let group = targets.get("light-group-0").unwrap();
+        let background = targets.get("background").unwrap();
+        assert_eq!(background.hash(), c.render_background(&w).hash());
+        for y in 0..11 {
+            for x in 0..11 {
+                assert_eq!(group[(x, y)] + background[(x, y)], beauty[(x, y)]);
+            }
+        }
+    }
+
+    #[test]
+    fn surface_targets_share_one_hit() {
+        let w = World::default();
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        c.samples = 2;
+        let targets = c.render_targets(&w, &[Target::Depth, Target::Normal, Target::Albedo]);
+        for target in [Target::Depth, Target::Normal, Target::Albedo].iter() {
+            let alone = c.render_targets(&w, &[*target]);
+            assert_eq!(
+                targets.get(&target.name()).unwrap().hash(),
+                alone.get(&target.name()).unwrap().hash()
+            );
+        }
+        let rays = c.sample_rays(5, 5);
+        let depths: Vec<Color> = rays
+            .iter()
+            .map(|&ray| Target::Depth.sample(&w, ray))
+            .collect();
+        assert_eq!(
+            targets.get("depth").unwrap()[(5, 5)],
+            c.filter.combine(&depths)
+        );
+    }
+
+    #[test]
+    fn ray_budget_is_shared_between_samples() {
+        let shares: Vec<usize> = (0..4).map(|i| share(Some(6), 4, i)).collect();
+        assert_eq!(shares, [2, 2, 1, 1]);
+        assert_eq!(share(None, 4, 3), usize::MAX);
+
+        let mut w = World::default();
+        w.objects[0].material.reflective = 0.5;
+        w.background = Background::solid(Color::white());
+        w.ray_budget = Some(0);
+        let mut c = Camera::new(11, 11, consts::PI / 2.0);
+        c.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let ray = c.ray_for_pixel(5, 5);
+        assert_eq!(c.render_pixel(&w, 5, 5), w.cast_ray_within(ray, 0));
+        assert_ne!(c.render_pixel(&w, 5, 5), w.cast_ray(ray));
+    }
 }
@@ -0,0 +1,207 @@
+use std::{
+    error,
+    fmt::{self, Display, Formatter},
+};
+
+use crate::{
+    math::{Point, Vector, EPSILON},
+    world::{Camera, View},
+};
+
+/// the ways in which a camera description can be invalid.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Error {
+    /// the camera is looking at the point it is positioned at.
+    NoDirection,
+    /// the up vector has no length, so it cannot be normalized.
+    NoUp,
+    /// the up vector is parallel to the direction the camera is looking in.
+    UpParallelToDirection,
+    /// the image has no pixels along one of its axes.
+    EmptyImage,
+    /// the field of view (in degrees) is not strictly between 0 and 180.
+    InvalidFieldOfView(f64),
+}
+
+impl Display for Error {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        match self {
+            Error::NoDirection => write!(f, "camera is looking at its own position"),
+            Error::NoUp => write!(f, "camera up vector has zero length"),
+            Error::UpParallelToDirection => {
+                write!(f, "camera up vector is parallel to its viewing direction")
+            }
+            Error::EmptyImage => write!(f, "camera image must be at least 1 by 1 pixels"),
+            Error::InvalidFieldOfView(degrees) => write!(
+                f,
+                "camera field of view must be between 0 and 180 degrees, got {}",
+                degrees
+            ),
+        }
+    }
+}
+
+impl error::Error for Error {}
+
+/// builds a camera from a description of where it is and what it is looking at,
+/// validating the description along the way. created by `Camera::look_at`.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Builder {
+    from: Point,
+    to: Point,
+    up: Vector,
+    field_of_view: f64,
+    image_width: usize,
+    image_height: usize,
+}
+
+impl Builder {
+    /// the default image is 100 by 100 pixels with a 60 degree field of view.
+    pub fn new(from: Point, to: Point, up: Vector) -> Builder {
+        Builder {
+            from,
+            to,
+            up,
+            field_of_view: 60.0,
+            image_width: 100,
+            image_height: 100,
+        }
+    }
+
+    /// sets the field of view, measured in degrees.
+    pub fn field_of_view(self, degrees: f64) -> Builder {
+        Builder {
+            field_of_view: degrees,
+            ..self
+        }
+    }
+
+    pub fn size(self, image_width: usize, image_height: usize) -> Builder {
+        Builder {
+            image_width,
+            image_height,
+            ..self
+        }
+    }
+
+    pub fn build(self) -> Result<Camera, Error> {
+        let direction = self.to - self.from;
+        if direction.magnitude() < EPSILON {
+            return Err(Error::NoDirection);
+        }
+        if self.up.magnitude() < EPSILON {
+            return Err(Error::NoUp);
+        }
+        if direction
+            .normalized()
+            .cross(&self.up.normalized())
+            .magnitude()
+            < EPSILON
+        {
+            return Err(Error::UpParallelToDirection);
+        }
+        if self.image_width == 0 || self.image_height == 0 {
+            return Err(Error::EmptyImage);
+        }
+        if !(0.0 < self.field_of_view && self.field_of_view < 180.0) {
+            return Err(Error::InvalidFieldOfView(self.field_of_view));
+        }
+
+        let mut camera = Camera::new(
+            self.image_width,
+            self.image_height,
+            self.field_of_view.to_radians(),
+        );
+        camera.view = View::transformed(self.from, self.to, self.up);
+
+        Ok(camera)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::f64::consts;
+
+    #[test]
+    fn build_camera() {
+        let from = Point::new(0.0, 1.5, -5.0);
+        let to = Point::new(0.0, 1.0, 0.0);
+        let up = Vector::new(0.0, 1.0, 0.0);
+        let camera = Camera::look_at(from, to, up)
+            .field_of_view(90.0)
+            .size(200, 125)
+            .build()
+            .unwrap();
+        let mut expected = Camera::new(200, 125, consts::PI / 2.0);
+        expected.view = View::transformed(from, to, up);
+        assert_eq!(camera, expected);
+    }
+
+    #[test]
+    fn up_vector_does_not_need_to_be_normalized() {
+        let from = Point::new(0.0, 0.0, 8.0);
+        let to = Point::zero();
+        let camera = Camera::look_at(from, to, Vector::new(0.0, 5.0, 0.0))
+            .build()
+            .unwrap();
+        assert_eq!(
+            camera.view,
+            View::transformed(from, to, Vector::new(0.0, 1.0, 0.0))
+        );
+    }
+
+    #[test]
+    fn reject_looking_at_own_position() {
+        let p = Point::new(1.0, 2.0, 3.0);
+        let result = Camera::look_at(p, p, Vector::new(0.0, 1.0, 0.0)).build();
+        assert_eq!(result, Err(Error::NoDirection));
+    }
+
+    #[test]
+    fn reject_zero_up_vector() {
+        let result =
+            Camera::look_at(Point::zero(), Point::new(0.0, 0.0, -1.0), Vector::zero()).build();
+        assert_eq!(result, Err(Error::NoUp));
+    }
+
+    #[test]
+    fn reject_up_parallel_to_direction() {
+        let result = Camera::look_at(
+            Point::zero(),
+            Point::new(0.0, 3.0, 0.0),
+            Vector::new(0.0, -1.0, 0.0),
+        )
+        .build();
+        assert_eq!(result, Err(Error::UpParallelToDirection));
+    }
+
+    #[test]
+    fn reject_empty_image() {
+        let result = Camera::look_at(
+            Point::zero(),
+            Point::new(0.0, 0.0, -1.0),
+            Vector::new(0.0, 1.0, 0.0),
+        )
+        .size(0, 10)
+        .build();
+        assert_eq!(result, Err(Error::EmptyImage));
+    }
+
+    #[test]
+    fn reject_invalid_field_of_view() {
+        let builder = Camera::look_at(
+            Point::zero(),
+            Point::new(0.0, 0.0, -1.0),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        assert_eq!(
+            builder.field_of_view(0.0).build(),
+            Err(Error::InvalidFieldOfView(0.0))
+        );
+        assert_eq!(
+            builder.field_of_view(180.0).build(),
+            Err(Error::InvalidFieldOfView(180.0))
+        );
+    }
+}
@@ -0,0 +1,97 @@
+/// photographic exposure settings for a camera. the radiance arriving at each pixel
+/// is scaled by these settings before being tone mapped into the final image, so the
+/// overall brightness of a render can be adjusted without editing every light.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Exposure {
+    /// the span of time `(open, close)` during which the shutter is open. the length
+    /// of this interval is the shutter speed, and any time-dependent effects (such as
+    /// motion blur) should be sampled from within it.
+    pub shutter: (f64, f64),
+    /// sensitivity of the sensor; an iso of 100 is treated as unity gain.
+    pub iso: f64,
+    /// exposure compensation measured in stops; each positive stop doubles the
+    /// brightness and each negative stop halves it.
+    pub compensation: f64,
+}
+
+impl Exposure {
+    pub fn new(shutter: (f64, f64), iso: f64, compensation: f64) -> Exposure {
+        Exposure {
+            shutter,
+            iso,
+            compensation,
+        }
+    }
+
+    pub fn with_shutter(self, open: f64, close: f64) -> Exposure {
+        Exposure::new((open, close), self.iso, self.compensation)
+    }
+
+    pub fn with_iso(self, iso: f64) -> Exposure {
+        Exposure::new(self.shutter, iso, self.compensation)
+    }
+
+    pub fn with_compensation(self, compensation: f64) -> Exposure {
+        Exposure::new(self.shutter, self.iso, compensation)
+    }
+
+    /// the length of time that the shutter stays open.
+    pub fn shutter_speed(&self) -> f64 {
+        self.shutter.1 - self.shutter.0
+    }
+
+    /// maps `fraction`, which is in `[0, 1]`, onto the shutter interval.
+    pub fn time_at(&self, fraction: f64) -> f64 {
+        self.shutter.0 + (self.shutter_speed() * fraction)
+    }
+
+    /// the factor by which radiance is multiplied before tone mapping.
+    pub fn scale(&self) -> f64 {
+        self.shutter_speed() * (self.iso / 100.0) * self.compensation.exp2()
+    }
+}
+
+impl Default for Exposure {
+    fn default() -> Exposure {
+        Exposure::new((0.0, 1.0), 100.0, 0.0)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::EPSILON;
+
+    #[test]
+    fn default_exposure_is_neutral() {
+        let e = Exposure::default();
+        assert_eq!(e.shutter, (0.0, 1.0));
+        assert_eq!(e.iso, 100.0);
+        assert_eq!(e.compensation, 0.0);
+        assert_eq!(e.scale(), 1.0);
+    }
+
+    #[test]
+    fn iso_scales_linearly() {
+        let e = Exposure::default().with_iso(400.0);
+        assert!((e.scale() - 4.0).abs() < EPSILON);
+    }
+
+    #[test]
+    fn compensation_is_measured_in_stops() {
+        let brighter = Exposure::default().with_compensation(1.0);
+        let darker = Exposure::default().with_compensation(-2.0);
+        assert!((brighter.scale() - 2.0).abs() < EPSILON);
+        assert!((darker.scale() - 0.25).abs() < EPSILON);
+    }
+
+    #[test]
+    fn shutter_interval() {
+        let e = Exposure::default().with_shutter(0.5, 0.75);
+        assert!((e.shutter_speed() - 0.25).abs() < EPSILON);
+        assert!((e.scale() - 0.25).abs() < EPSILON);
+        assert!((e.time_at(0.0) - 0.5).abs() < EPSILON);
+        assert!((e.time_at(0.5) - 0.625).abs() < EPSILON);
+        assert!((e.time_at(1.0) - 0.75).abs() < EPSILON);
+    }
+}
@@ -0,0 +1,118 @@
+use crate::world::Color;
+
+/// how the samples taken within a pixel are combined into the pixel's color.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Filter {
+    /// the average of the samples.
+    Mean,
+    /// the median of each color channel of the samples. a few samples that are far
+    /// brighter (or darker) than the rest do not affect the result, which suppresses
+    /// isolated bright "fireflies", at the cost of some smoothing along edges.
+    Median,
+}
+
+impl Filter {
+    /// combines the samples, which must not be empty.
+    pub fn combine(&self, samples: &[Color]) -> Color {
+        match self {
+            Filter::Mean => {
+                let sum = samples
+                    .iter()
+                    .fold(Color::black(), |sum, &sample| sum + sample);
+                sum / (samples.len() as f64)
+            }
+            Filter::Median => {
+                let mut median = Color::black();
+                let mut channel = Vec::with_capacity(samples.len());
+
+                for i in 0..3 {
+                    channel.clear();
+                    channel.extend(samples.iter().map(|sample| sample[i]));
+                    channel.sort_by(|a, b| a.total_cmp(b));
+
+                    let middle = channel.len() / 2;
+                    median[i] = if channel.len() % 2 == 0 {
+                        (channel[middle - 1] + channel[middle]) / 2.0
+                    } else {
+                        channel[middle]
+                    };
+                }
+
+                median
+            }
+        }
+    }
+}
+
+impl Default for Filter {
+    fn default() -> Filter {
+        Filter::Mean
+    }
+}
+
+/// scales `sample` down so that none of its channels are brighter than `limit`,
+/// keeping its hue.
+pub fn clamp(sample: Color, limit: f64) -> Color {
+    let brightest = sample.red().max(sample.green()).max(sample.blue());
+    if brightest > limit {
+        sample * (limit / brightest)
+    } else {
+        sample
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn samples() -> Vec<Color> {
+        vec![
+            Color::new(0.1, 0.2, 0.3),
+            Color::new(0.3, 0.2, 0.1),
+            Color::new(50.0, 50.0, 50.0),
+            Color::new(0.2, 0.2, 0.2),
+        ]
+    }
+
+    #[test]
+    fn mean_filter() {
+        assert_eq!(
+            Filter::Mean.combine(&samples()),
+            Color::new(12.65, 12.65, 12.65)
+        );
+    }
+
+    #[test]
+    fn median_filter_ignores_outliers() {
+        assert_eq!(
+            Filter::Median.combine(&samples()),
+            Color::new(0.25, 0.2, 0.25)
+        );
+        assert_eq!(
+            Filter::Median.combine(&samples()[..3]),
+            Color::new(0.3, 0.2, 0.3)
+        );
+    }
+
+    #[test]
+    fn median_filter_ignores_nan() {
+        let samples = [
+            Color::new(0.1, 0.2, 0.3),
+            Color::new(0.3, 0.2, 0.1),
+            Color::new(f64::NAN, f64::NAN, f64::NAN),
+        ];
+        assert_eq!(Filter::Median.combine(&samples), Color::new(0.3, 0.2, 0.3));
+    }
+
+    #[test]
+    fn clamp_keeps_hue() {
+        assert_eq!(
+            clamp(Color::new(8.0, 4.0, 2.0), 2.0),
+            Color::new(2.0, 1.0, 0.5)
+        );
+        assert_eq!(
+            clamp(Color::new(0.5, 0.25, 0.0), 2.0),
+            Color::new(0.5, 0.25, 0.0)
+        );
+    }
+}
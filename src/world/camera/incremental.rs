@@ -0,0 +1,288 @@
+use std::sync::atomic::AtomicBool;
+
+use crate::{
+    math::{Bounds, Form, Geometry, Point},
+    world::{
+        camera::{Camera, Schedule, Tile},
+        Canvas, Ray, World,
+    },
+};
+
+/// an image which is kept up to date while the objects in a world are moved around,
+/// such as while a scene is being edited: after the first render, `update` renders
+/// again only the tiles which the changes recorded by the world could have affected.
+///
+/// a tile is rendered again if the box around a changed object, where it was or where
+/// it is now, covers any of the tile, or lies between a light and a surface seen
+/// through the tile (so that its shadow may have moved), including the shadow
+/// catchers that the first surface is seen through. a change could be seen in a
+/// reflection or through a refraction anywhere, so every tile is rendered again while
+/// anything in the world is reflective or transparent. changes to the lights, the
+/// camera, or the world's settings are not recorded, so they need a new `Incremental`.
+pub struct Incremental {
+    camera: Camera,
+    schedule: Schedule,
+    image: Canvas,
+    /// the points seen through the center of each pixel, row by row: those on the
+    /// shadow catchers in front, then the first surface, if anything is hit.
+    seen: Vec<Vec<Point>>,
+    /// the box around each of the world's objects, as of the last render.
+    bounds: Vec<Bounds>,
+}
+
+impl Incremental {
+    /// renders the whole image, and starts keeping track of the world's changes.
+    pub fn new(camera: Camera, schedule: Schedule, world: &mut World) -> Incremental {
+        let mut incremental = Incremental {
+            camera,
+            schedule,
+            image: Canvas::new(camera.image_width, camera.image_height),
+            seen: vec![vec![]; camera.image_width * camera.image_height],
+            bounds: vec![],
+        };
+
+        world.take_changes();
+        let tiles = incremental.tiles();
+        incremental.render(world, &tiles);
+        incremental
+    }
+
+    pub fn image(&self) -> &Canvas {
+        &self.image
+    }
+
+    /// brings the image up to date with the changes made to the world since the last
+    /// render, returning the number of tiles which were rendered again. if objects were
+    /// added or removed, or anything is reflective or transparent, every tile is
+    /// rendered again.
+    pub fn update(&mut self, world: &mut World) -> usize {
+        let changes = world.take_changes();
+        if changes.is_empty() {
+            return 0;
+        }
+
+        let tiles = if changes.membership
+            || self.bounds.len() != world.objects.len()
+            || world.objects.iter().any(reflects)
+        {
+            self.tiles()
+        } else {
+            let boxes: Vec<Bounds> = changes
+                .objects
+                .iter()
+                .flat_map(|&index| vec![self.bounds[index], world.objects[index].bounds()])
+                .filter(|bounds| !bounds.is_empty())
+                .collect();
+
+            self.tiles()
+                .into_iter()
+                .filter(|tile| self.is_affected(tile, world, &boxes))
+                .collect()
+        };
+
+        self.render(world, &tiles);
+        tiles.len()
+    }
+
+    fn tiles(&self) -> Vec<Tile> {
+        self.schedule
+            .tiles(self.camera.image_width, self.camera.image_height)
+    }
+
+    /// whether any of `boxes` could change what is seen through `tile`.
+    fn is_affected(&self, tile: &Tile, world: &World, boxes: &[Bounds]) -> bool {
+        let covers = |bounds: &Bounds| match self.camera.tile_covering(*bounds) {
+            Some(area) => {
+                area.x < tile.x + tile.width
+                    && tile.x < area.x + area.width
+                    && area.y < tile.y + tile.height
+                    && tile.y < area.y + area.height
+            }
+            None => true,
+        };
+        if boxes.iter().any(covers) {
+            return true;
+        }
+
+        for y in tile.y..(tile.y + tile.height) {
+            for x in tile.x..(tile.x + tile.width) {
+                for &point in self.seen[y * self.camera.image_width + x].iter() {
+                    for light in &world.lights {
+                        let ray = Ray::new(point, light.position() - point);
+                        let shadows = |bounds: &Bounds| match bounds.hit(ray) {
+                            Some((enter, leave)) => enter < 1.0 && 0.0 < leave,
+                            None => false,
+                        };
+                        if boxes.iter().any(shadows) {
+                            return true;
+                        }
+                    }
+                }
+            }
+        }
+
+        false
+    }
+
+    /// renders `tiles` again, and remembers where everything is now.
+    fn render(&mut self, world: &World, tiles: &[Tile]) {
+        let keep_going = AtomicBool::new(true);
+        self.camera.render_tiles(
+            world,
+            &mut self.image,
+            tiles,
+            self.schedule.workers,
+            &keep_going,
+            |_| {},
+        );
+
+        for tile in tiles {
+            for y in tile.y..(tile.y + tile.height) {
+                for x in tile.x..(tile.x + tile.width) {
+                    let ray = self.camera.ray_for_pixel(x, y);
+                    self.seen[y * self.camera.image_width + x] = seen(world, ray);
+                }
+            }
+        }
+
+        self.bounds = world.objects.iter().map(|object| object.bounds()).collect();
+    }
+}
+
+/// the points that the camera sees along `ray`: those on the shadow catchers, whose
+/// shadows it sees, up to and including the first surface which is not one. objects
+/// hidden from the camera are seen through, as in `World::visible_hit`.
+fn seen(world: &World, ray: Ray) -> Vec<Point> {
+    let mut points = vec![];
+    if let Some(mut intersections) = world.hit(ray) {
+        while let Some(intersection) = intersections.pop() {
+            if !intersection.object.visibility.camera {
+                continue;
+            }
+            points.push(intersection.compute_with_offset(world.surface_offset).point);
+            if !intersection.object.material.shadow_catcher {
+                break;
+            }
+        }
+    }
+    points
+}
+
+/// whether any part of the object reflects or refracts other objects.
+fn reflects(object: &Geometry) -> bool {
+    match object.form {
+        Form::Group(ref group) => group.children().iter().any(reflects),
+        _ => object.material.reflective > 0.0 || object.material.transparency > 0.0,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        math::{Form, Geometry, Matrix, Transformable, Vector},
+        world::{camera::Order, light, Background, Color, Light, Material},
+    };
+    use std::f64::consts;
+
+    fn scene() -> (World, Camera, Schedule) {
+        let floor = Geometry::default().with_form(Form::Plane);
+        let left = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(-3.0, 1.0, 0.0));
+        let right = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(3.0, 1.0, 0.0));
+        let light = Light::Point(light::Point::new(
+            Point::new(0.0, 10.0, -10.0),
+            Color::white(),
+        ));
+        let world = World::new(vec![floor, left, right], vec![light]);
+
+        let mut camera = Camera::new(40, 20, consts::PI / 3.0);
+        camera.view.transform(
+            Point::new(0.0, 2.0, -10.0),
+            Point::new(0.0, 1.0, 0.0),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        let schedule = Schedule::new(2, 5, Order::Scanline);
+
+        (world, camera, schedule)
+    }
+
+    #[test]
+    fn first_render_is_complete() {
+        let (mut world, camera, schedule) = scene();
+        let incremental = Incremental::new(camera, schedule, &mut world);
+        assert_eq!(incremental.image().hash(), camera.render(&world).hash());
+    }
+
+    #[test]
+    fn updating_without_changes() {
+        let (mut world, camera, schedule) = scene();
+        let mut incremental = Incremental::new(camera, schedule, &mut world);
+        assert_eq!(incremental.update(&mut world), 0);
+    }
+
+    #[test]
+    fn moving_an_object_renders_some_tiles() {
+        let (mut world, camera, schedule) = scene();
+        let mut incremental = Incremental::new(camera, schedule, &mut world);
+        let total = schedule
+            .tiles(camera.image_width, camera.image_height)
+            .len();
+
+        world.transform_object(1, Matrix::translation(0.0, 0.5, 0.0));
+        let rendered = incremental.update(&mut world);
+        assert!(0 < rendered && rendered < total);
+        assert_eq!(incremental.image().hash(), camera.render(&world).hash());
+    }
+
+    #[test]
+    fn moving_an_object_over_a_shadow_catcher_renders_its_shadow() {
+        let (mut world, camera, schedule) = scene();
+        // the shadows on the catcher only show up over a background.
+        world.objects[0].material = Material::shadow_catcher();
+        world.background = Background::solid(Color::white());
+        world.lights = vec![Light::Point(light::Point::new(
+            Point::new(-20.0, 3.0, 0.0),
+            Color::white(),
+        ))];
+        let mut incremental = Incremental::new(camera, schedule, &mut world);
+        let total = schedule
+            .tiles(camera.image_width, camera.image_height)
+            .len();
+
+        world.transform_object(1, Matrix::translation(0.0, 0.0, 2.0));
+        let rendered = incremental.update(&mut world);
+        assert!(0 < rendered && rendered < total);
+        assert_eq!(incremental.image().hash(), camera.render(&world).hash());
+    }
+
+    #[test]
+    fn moving_an_object_over_a_mirror_renders_every_tile() {
+        let (mut world, camera, schedule) = scene();
+        world.objects[0].material.reflective = 0.5;
+        let mut incremental = Incremental::new(camera, schedule, &mut world);
+        let total = schedule
+            .tiles(camera.image_width, camera.image_height)
+            .len();
+
+        world.transform_object(1, Matrix::translation(0.0, 0.5, 0.0));
+        assert_eq!(incremental.update(&mut world), total);
+        assert_eq!(incremental.image().hash(), camera.render(&world).hash());
+    }
+
+    #[test]
+    fn adding_an_object_renders_every_tile() {
+        let (mut world, camera, schedule) = scene();
+        let mut incremental = Incremental::new(camera, schedule, &mut world);
+        let total = schedule
+            .tiles(camera.image_width, camera.image_height)
+            .len();
+
+        world.add_object(Geometry::default().with_form(Form::Sphere));
+        assert_eq!(incremental.update(&mut world), total);
+        assert_eq!(incremental.image().hash(), camera.render(&world).hash());
+    }
+}
@@ -0,0 +1,69 @@
+/// a small random number generator whose sequence depends only on the frame and pixel
+/// that it was seeded from. every pixel gets its own sampler, so the samples that are
+/// taken do not depend on which thread renders the pixel, or in what order, and a
+/// render comes out exactly the same no matter how it is scheduled.
+/// (https://prng.di.unimi.it/splitmix64.c)
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Sampler {
+    state: u64,
+}
+
+impl Sampler {
+    pub fn new(frame: u64, x: usize, y: usize) -> Sampler {
+        // mix each part of the seed in turn, so that neighboring pixels and frames
+        // start from unrelated states.
+        let mut state = 0;
+        for &part in [frame, x as u64, y as u64].iter() {
+            state = mix(state ^ part);
+        }
+        Sampler { state }
+    }
+
+    pub fn next_u64(&mut self) -> u64 {
+        self.state = self.state.wrapping_add(0x9e37_79b9_7f4a_7c15);
+        mix(self.state)
+    }
+
+    /// a number in `[0, 1)`.
+    pub fn next_f64(&mut self) -> f64 {
+        // the top 53 bits fill the mantissa of a double exactly.
+        (self.next_u64() >> 11) as f64 / (1u64 << 53) as f64
+    }
+}
+
+fn mix(mut z: u64) -> u64 {
+    z = (z ^ (z >> 30)).wrapping_mul(0xbf58_476d_1ce4_e5b9);
+    z = (z ^ (z >> 27)).wrapping_mul(0x94d0_49bb_1331_11eb);
+    z ^ (z >> 31)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn same_seed_same_sequence() {
+        let mut a = Sampler::new(2, 10, 20);
+        let mut b = Sampler::new(2, 10, 20);
+        for _ in 0..10 {
+            assert_eq!(a.next_u64(), b.next_u64());
+        }
+    }
+
+    #[test]
+    fn seeds_differ_by_frame_and_pixel() {
+        let first = Sampler::new(0, 1, 2).next_u64();
+        assert_ne!(first, Sampler::new(1, 1, 2).next_u64());
+        assert_ne!(first, Sampler::new(0, 2, 1).next_u64());
+        assert_ne!(first, Sampler::new(0, 1, 3).next_u64());
+    }
+
+    #[test]
+    fn numbers_are_in_unit_interval() {
+        let mut sampler = Sampler::new(0, 0, 0);
+        for _ in 0..1000 {
+            let n = sampler.next_f64();
+            assert!(0.0 <= n && n < 1.0);
+        }
+    }
+}
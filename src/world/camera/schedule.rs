@@ -0,0 +1,255 @@
+use std::{
+    cmp::Ordering,
+    error,
+    fmt::{self, Display, Formatter},
+    str::FromStr,
+    thread,
+};
+
+/// the order in which the tiles of an image are handed out to be rendered. since
+/// tiles are finished roughly in this order, it decides how a preview fills in.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Order {
+    /// row by row, from the top left to the bottom right.
+    Scanline,
+    /// outwards from the center of the image, where the subject usually is.
+    Spiral,
+    /// along a hilbert curve, which keeps consecutive tiles close together.
+    Hilbert,
+}
+
+/// returned when parsing the name of a tile order which does not exist.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParseOrderError(String);
+
+impl Display for ParseOrderError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "unknown tile order \"{}\" (expected scanline, spiral, or hilbert)",
+            self.0
+        )
+    }
+}
+
+impl error::Error for ParseOrderError {}
+
+impl Order {
+    /// the name of the order, as it is parsed.
+    pub fn name(&self) -> &'static str {
+        match self {
+            Order::Scanline => "scanline",
+            Order::Spiral => "spiral",
+            Order::Hilbert => "hilbert",
+        }
+    }
+}
+
+impl FromStr for Order {
+    type Err = ParseOrderError;
+
+    fn from_str(s: &str) -> Result<Order, ParseOrderError> {
+        match s.to_lowercase().as_str() {
+            "scanline" => Ok(Order::Scanline),
+            "spiral" => Ok(Order::Spiral),
+            "hilbert" => Ok(Order::Hilbert),
+            _ => Err(ParseOrderError(s.to_string())),
+        }
+    }
+}
+
+/// a rectangular region of an image, measured in pixels.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Tile {
+    pub x: usize,
+    pub y: usize,
+    pub width: usize,
+    pub height: usize,
+}
+
+/// how the work of rendering an image is split up and shared between threads.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Schedule {
+    /// the number of threads rendering at once.
+    pub workers: usize,
+    /// the length of the sides of each (square) tile, in pixels.
+    pub tile_size: usize,
+    pub order: Order,
+}
+
+impl Schedule {
+    pub fn new(workers: usize, tile_size: usize, order: Order) -> Schedule {
+        Schedule {
+            workers,
+            tile_size,
+            order,
+        }
+    }
+
+    pub fn with_workers(self, workers: usize) -> Schedule {
+        Schedule { workers, ..self }
+    }
+
+    pub fn with_tile_size(self, tile_size: usize) -> Schedule {
+        Schedule { tile_size, ..self }
+    }
+
+    pub fn with_order(self, order: Order) -> Schedule {
+        Schedule { order, ..self }
+    }
+
+    /// splits an image into tiles, listed in the order they should be rendered.
+    /// tiles along the right and bottom edges are cut short to fit the image.
+    pub fn tiles(&self, image_width: usize, image_height: usize) -> Vec<Tile> {
+        let size = self.tile_size.max(1);
+        let columns = (image_width + size - 1) / size;
+        let rows = (image_height + size - 1) / size;
+
+        let mut cells: Vec<(usize, usize)> = (0..rows)
+            .flat_map(|row| (0..columns).map(move |column| (column, row)))
+            .collect();
+
+        match self.order {
+            Order::Scanline => {}
+            Order::Spiral => {
+                // compare positions relative to the center in units of half a tile, so
+                // that images with an even number of tiles stay symmetric.
+                let (cx, cy) = (columns as i64 - 1, rows as i64 - 1);
+                let key = |&(column, row): &(usize, usize)| {
+                    let dx = 2 * column as i64 - cx;
+                    let dy = 2 * row as i64 - cy;
+                    (dx.abs().max(dy.abs()), (dy as f64).atan2(dx as f64))
+                };
+                cells.sort_by(|a, b| {
+                    let (ring_a, angle_a) = key(a);
+                    let (ring_b, angle_b) = key(b);
+                    ring_a
+                        .cmp(&ring_b)
+                        .then(angle_a.partial_cmp(&angle_b).unwrap_or(Ordering::Equal))
+                });
+            }
+            Order::Hilbert => {
+                let side = columns.max(rows).next_power_of_two();
+                cells.sort_by_key(|&(column, row)| hilbert_index(side, column, row));
+            }
+        }
+
+        cells
+            .into_iter()
+            .map(|(column, row)| Tile {
+                x: column * size,
+                y: row * size,
+                width: size.min(image_width - column * size),
+                height: size.min(image_height - row * size),
+            })
+            .collect()
+    }
+}
+
+impl Default for Schedule {
+    /// one worker for each available processor, with 16 by 16 tiles in scanline order.
+    fn default() -> Schedule {
+        let workers = thread::available_parallelism().map_or(1, |n| n.get());
+        Schedule::new(workers, 16, Order::Scanline)
+    }
+}
+
+/// the distance along the hilbert curve that fills a `side` by `side` grid (where
+/// `side` is a power of two) at which it passes through `(x, y)`.
+fn hilbert_index(side: usize, mut x: usize, mut y: usize) -> usize {
+    let mut index = 0;
+    let mut s = side / 2;
+
+    while s > 0 {
+        let rx = (x & s > 0) as usize;
+        let ry = (y & s > 0) as usize;
+        index += s * s * ((3 * rx) ^ ry);
+
+        // rotate the quadrant so that the curve inside of it lines up.
+        if ry == 0 {
+            if rx == 1 {
+                x = s - 1 - (x & (s - 1));
+                y = s - 1 - (y & (s - 1));
+            }
+            std::mem::swap(&mut x, &mut y);
+        }
+
+        s /= 2;
+    }
+
+    index
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn corners(tiles: &[Tile]) -> Vec<(usize, usize)> {
+        tiles.iter().map(|tile| (tile.x, tile.y)).collect()
+    }
+
+    #[test]
+    fn parse_order() {
+        assert_eq!("scanline".parse(), Ok(Order::Scanline));
+        assert_eq!("Spiral".parse(), Ok(Order::Spiral));
+        assert_eq!("HILBERT".parse(), Ok(Order::Hilbert));
+        assert_eq!(
+            "random".parse::<Order>(),
+            Err(ParseOrderError("random".to_string()))
+        );
+        for order in [Order::Scanline, Order::Spiral, Order::Hilbert].iter() {
+            assert_eq!(order.name().parse(), Ok(*order));
+        }
+    }
+
+    #[test]
+    fn scanline_tiles_cover_image() {
+        let tiles = Schedule::new(1, 4, Order::Scanline).tiles(10, 5);
+        assert_eq!(
+            corners(&tiles),
+            vec![(0, 0), (4, 0), (8, 0), (0, 4), (4, 4), (8, 4)]
+        );
+        assert_eq!(
+            tiles[5],
+            Tile {
+                x: 8,
+                y: 4,
+                width: 2,
+                height: 1
+            }
+        );
+        let area: usize = tiles.iter().map(|tile| tile.width * tile.height).sum();
+        assert_eq!(area, 50);
+    }
+
+    #[test]
+    fn spiral_starts_at_center() {
+        let tiles = Schedule::new(1, 1, Order::Spiral).tiles(3, 3);
+        assert_eq!(tiles.len(), 9);
+        assert_eq!(corners(&tiles[..1]), vec![(1, 1)]);
+        for tile in &tiles[1..] {
+            assert_ne!((tile.x, tile.y), (1, 1));
+        }
+    }
+
+    #[test]
+    fn hilbert_tiles_are_adjacent() {
+        let tiles = Schedule::new(1, 2, Order::Hilbert).tiles(8, 8);
+        assert_eq!(tiles.len(), 16);
+        assert_eq!(corners(&tiles[..4]), vec![(0, 0), (2, 0), (2, 2), (0, 2)]);
+        for pair in tiles.windows(2) {
+            let dx = (pair[0].x as i64 - pair[1].x as i64).abs();
+            let dy = (pair[0].y as i64 - pair[1].y as i64).abs();
+            assert_eq!(dx + dy, 2);
+        }
+    }
+
+    #[test]
+    fn hilbert_tiles_on_uneven_grid() {
+        let mut hilbert = corners(&Schedule::new(1, 1, Order::Hilbert).tiles(3, 2));
+        let mut scanline = corners(&Schedule::new(1, 1, Order::Scanline).tiles(3, 2));
+        hilbert.sort();
+        scanline.sort();
+        assert_eq!(hilbert, scanline);
+    }
+}
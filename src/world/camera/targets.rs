@@ -0,0 +1,154 @@
+use std::collections::BTreeMap;
+
+use crate::world::{Canvas, Color, Computations, Intersection, Ray, World};
+
+/// one kind of image that a render can produce alongside (or instead of) the final
+/// image. everything but the final image and the light groups is an "arbitrary
+/// output variable" describing the first surface seen through each pixel, which is
+/// not exposed and which is meant to be exported raw (see `Canvas::to_csv`).
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Target {
+    /// the final image, as returned by `Camera::render`.
+    Beauty,
+    /// only the light from the lights in a group; see `Camera::render_light_groups`.
+    LightGroup(usize),
+    /// only the background, which the light groups leave out; see
+    /// `Camera::render_background`.
+    Background,
+    /// the distance to the surface in each channel, or infinity where there is none.
+    Depth,
+    /// the world space normal of the surface, with x, y, and z as red, green, and blue.
+    Normal,
+    /// the color of the surface, before it is lit.
+    Albedo,
+    /// one more than the index in the world of the object seen through the center of
+    /// each pixel in each channel, or 0 where there is none. only the center is used,
+    /// since blending the indices of several objects would be meaningless.
+    ObjectId,
+}
+
+impl Target {
+    /// the name of the image the target produces.
+    pub fn name(&self) -> String {
+        match self {
+            Target::Beauty => "beauty".to_string(),
+            Target::LightGroup(group) => format!("light-group-{}", group),
+            Target::Background => "background".to_string(),
+            Target::Depth => "depth".to_string(),
+            Target::Normal => "normal".to_string(),
+            Target::Albedo => "albedo".to_string(),
+            Target::ObjectId => "object-id".to_string(),
+        }
+    }
+
+    /// whether the target is made of light, which is clamped and exposed like the
+    /// final image.
+    pub fn is_shaded(&self) -> bool {
+        matches!(
+            self,
+            Target::Beauty | Target::LightGroup(_) | Target::Background
+        )
+    }
+
+    /// the value of the target for a single ray.
+    pub fn sample(&self, world: &World, ray: Ray) -> Color {
+        self.sample_within(world, ray, usize::MAX)
+    }
+
+    /// like `sample`, but the shaded targets follow at most `budget` reflected and
+    /// refracted rays; see `World::cast_ray_within`.
+    pub fn sample_within(&self, world: &World, ray: Ray, budget: usize) -> Color {
+        match self {
+            Target::Beauty => world.cast_ray_within(ray, budget),
+            Target::LightGroup(group) => {
+                world.cast_ray_lit_by_within(ray, |light| light.group() == *group, budget)
+            }
+            Target::Background => world.cast_background_within(ray, budget),
+            _ => self.surface(world.visible_hit(ray).as_ref()),
+        }
+    }
+
+    /// the value of a target which is not shaded, given the first surface that a ray
+    /// sees (as found by `World::visible_hit`), if any. shaded targets are black, since
+    /// they depend on more than the one surface.
+    pub fn surface(&self, hit: Option<&(Intersection, Computations)>) -> Color {
+        match self {
+            Target::Beauty | Target::LightGroup(_) | Target::Background => Color::black(),
+            Target::Depth => {
+                let depth = hit.map_or(f64::INFINITY, |(hit, _)| hit.time);
+                Color::new(depth, depth, depth)
+            }
+            Target::Normal => hit.map_or(Color::black(), |(_, c)| {
+                Color::from_vector(c.surface_normal)
+            }),
+            Target::Albedo => hit.map_or(Color::black(), |(_, c)| {
+                c.material.texture.color_at_uv(c.point, c.uv)
+            }),
+            Target::ObjectId => {
+                let id = hit.map_or(0.0, |(hit, _)| (hit.object_index + 1) as f64);
+                Color::new(id, id, id)
+            }
+        }
+    }
+}
+
+/// the named images written by a single render; see `Camera::render_targets`.
+#[derive(Debug)]
+pub struct RenderTargets {
+    pub canvases: BTreeMap<String, Canvas>,
+}
+
+impl RenderTargets {
+    /// a blank canvas of the given size for each of `targets`.
+    pub fn new(targets: &[Target], width: usize, height: usize) -> RenderTargets {
+        RenderTargets {
+            canvases: targets
+                .iter()
+                .map(|target| (target.name(), Canvas::new(width, height)))
+                .collect(),
+        }
+    }
+
+    pub fn get(&self, name: &str) -> Option<&Canvas> {
+        self.canvases.get(name)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::{Point, Vector};
+
+    #[test]
+    fn target_names() {
+        let targets = [Target::Beauty, Target::LightGroup(2), Target::Depth];
+        let render_targets = RenderTargets::new(&targets, 4, 3);
+        let names: Vec<&String> = render_targets.canvases.keys().collect();
+        assert_eq!(names, ["beauty", "depth", "light-group-2"]);
+        assert_eq!(render_targets.get("depth").unwrap().width, 4);
+        assert!(render_targets.get("normal").is_none());
+    }
+
+    #[test]
+    fn surface_targets() {
+        let world = World::default();
+        let ray = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        assert_eq!(Target::Depth.sample(&world, ray), Color::new(4.0, 4.0, 4.0));
+        assert_eq!(
+            Target::Normal.sample(&world, ray),
+            Color::new(0.0, 0.0, -1.0)
+        );
+        assert_eq!(
+            Target::Albedo.sample(&world, ray),
+            Color::new(0.8, 1.0, 0.6)
+        );
+        assert_eq!(
+            Target::ObjectId.sample(&world, ray),
+            Color::new(1.0, 1.0, 1.0)
+        );
+
+        let miss = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 1.0, 0.0));
+        assert_eq!(Target::Depth.sample(&world, miss)[0], f64::INFINITY);
+        assert_eq!(Target::Normal.sample(&world, miss), Color::black());
+    }
+}
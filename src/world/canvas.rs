@@ -1,11 +1,17 @@
 use std::{
-    fmt::{self, Display, Formatter},
+    error,
+    fmt::{self, Display, Formatter, Write},
     ops::{Index, IndexMut},
+    str::FromStr,
     vec::Vec,
 };
 
 use super::color::{Color, MAX_COLOR};
 
+mod inflate;
+mod jpeg;
+mod png;
+
 #[derive(Debug)]
 pub struct Canvas {
     pub width: usize,
@@ -18,6 +24,16 @@ impl Canvas {
         Canvas::from_fn(width, height, |_, _| Color::new(0.0, 0.0, 0.0))
     }
 
+    /// like `new`, but fails instead of making an empty canvas when either
+    /// dimension is zero.
+    pub fn try_new(width: usize, height: usize) -> Result<Canvas, EmptyCanvasError> {
+        if width == 0 || height == 0 {
+            Err(EmptyCanvasError { width, height })
+        } else {
+            Ok(Canvas::new(width, height))
+        }
+    }
+
     pub fn from_fn<F: FnMut(usize, usize) -> Color>(
         width: usize,
         height: usize,
@@ -32,12 +48,439 @@ impl Canvas {
         }
     }
 
+    /// a stable digest of the image, suitable for checking that a render has not
+    /// changed. pixels are quantized the same way as when writing an image file, so
+    /// differences in color too small to be visible do not change the digest.
+    pub fn hash(&self) -> u64 {
+        // 64-bit fnv-1a, which is fixed across platforms and compiler versions
+        // (unlike `std::collections::hash_map::DefaultHasher`).
+        const OFFSET_BASIS: u64 = 0xcbf2_9ce4_8422_2325;
+        const PRIME: u64 = 0x0000_0100_0000_01b3;
+
+        let dimensions = [self.width as u64, self.height as u64];
+        let bytes = dimensions
+            .iter()
+            .flat_map(|d| d.to_le_bytes().to_vec())
+            .chain(self.vals.iter().flat_map(|c| c.quantized().to_vec()));
+
+        bytes.fold(OFFSET_BASIS, |hash, byte| {
+            (hash ^ byte as u64).wrapping_mul(PRIME)
+        })
+    }
+
+    /// a view of the `width` by `height` region with its top-left corner at `(x, y)`.
+    /// the view is indexed relative to that corner, and writes go straight into this
+    /// canvas.
+    pub fn sub(&mut self, x: usize, y: usize, width: usize, height: usize) -> SubCanvas<'_> {
+        self.split(&[(x, y, width, height)]).pop().unwrap()
+    }
+
+    /// like `sub`, but creates a view of each `(x, y, width, height)` region at once.
+    /// since the regions must not overlap, the views can be written to independently,
+    /// such as by different threads. panics if the regions overlap or do not fit.
+    pub fn split(&mut self, regions: &[(usize, usize, usize, usize)]) -> Vec<SubCanvas<'_>> {
+        let (width, height) = (self.width, self.height);
+        let mut views: Vec<SubCanvas<'_>> = regions
+            .iter()
+            .map(|&(x, y, w, h)| {
+                assert!(
+                    x + w <= width && y + h <= height,
+                    "region is not inside canvas"
+                );
+                SubCanvas {
+                    x,
+                    y,
+                    width: w,
+                    height: h,
+                    rows: Vec::with_capacity(h),
+                }
+            })
+            .collect();
+
+        // hand out each row from left to right, one piece to each region that covers it.
+        let mut by_x: Vec<usize> = (0..regions.len()).collect();
+        by_x.sort_by_key(|&i| regions[i].0);
+
+        for (y, mut row) in self.vals.chunks_mut(width.max(1)).enumerate() {
+            let mut start = 0;
+            for &i in by_x.iter() {
+                let (x, top, w, h) = regions[i];
+                if y < top || top + h <= y {
+                    continue;
+                }
+                assert!(start <= x, "regions overlap");
+                let (_, rest) = std::mem::take(&mut row).split_at_mut(x - start);
+                let (piece, rest) = rest.split_at_mut(w);
+                views[i].rows.push(piece);
+                row = rest;
+                start = x + w;
+            }
+        }
+
+        views
+    }
+
     pub fn to_ppm(&self) -> String {
+        self.to_ppm_with_comments(&[])
+    }
+
+    /// like `to_ppm`, but with each of `comments` written as a comment in the header,
+    /// such as to record how the image was made.
+    pub fn to_ppm_with_comments(&self, comments: &[String]) -> String {
+        let mut header = String::from("P3\n");
+        for line in comments.iter().flat_map(|comment| comment.lines()) {
+            header.push_str("# ");
+            header.push_str(line);
+            header.push('\n');
+        }
         format!(
-            "P3\n{} {}\n{}\n{}",
-            self.width, self.height, MAX_COLOR as i64, self
+            "{}{} {}\n{}\n{}",
+            header, self.width, self.height, MAX_COLOR as i64, self
         )
     }
+
+    /// reads a ppm image, either as text (`P3`, as written by `to_ppm`) or as binary
+    /// (`P6`). each channel is scaled so that the image's maximum value becomes 1,
+    /// without any other change; see `linearized` for images which are encoded as srgb.
+    pub fn from_ppm(bytes: &[u8]) -> Result<Canvas, ParsePpmError> {
+        let mut header = PpmHeader { bytes, position: 0 };
+        let binary = match header.next_field() {
+            Some(b"P3") => false,
+            Some(b"P6") => true,
+            _ => return Err(ParsePpmError("expected P3 or P6".to_string())),
+        };
+        let width = header.next_number("width")?;
+        let height = header.next_number("height")?;
+        let max = header.next_number("maximum value")?;
+        if max == 0 || max > 65535 {
+            return Err(ParsePpmError(format!(
+                "maximum value {} is not allowed",
+                max
+            )));
+        }
+
+        // the header is not trusted, so the size of the image may not even fit.
+        let too_large = || ParsePpmError(format!("image of {} by {} is too large", width, height));
+        let count = width
+            .checked_mul(height)
+            .and_then(|pixels| pixels.checked_mul(3))
+            .ok_or_else(too_large)?;
+        let values: Vec<usize> = if binary {
+            // a single whitespace character separates the header from the pixels.
+            let pixels = &bytes[(header.position + 1).min(bytes.len())..];
+            let size = if max < 256 { 1 } else { 2 };
+            if pixels.len() < count.checked_mul(size).ok_or_else(too_large)? {
+                return Err(ParsePpmError("too few pixels".to_string()));
+            }
+            pixels
+                .chunks(size)
+                .take(count)
+                .map(|c| c.iter().fold(0, |value, &byte| value * 256 + byte as usize))
+                .collect()
+        } else {
+            (0..count)
+                .map(|_| header.next_number("pixel value"))
+                .collect::<Result<_, _>>()?
+        };
+
+        let channel = |i: usize| values[i].min(max) as f64 / max as f64;
+        Ok(Canvas::from_fn(width, height, |x, y| {
+            let i = (x + y * width) * 3;
+            Color::new(channel(i), channel(i + 1), channel(i + 2))
+        }))
+    }
+
+    /// reads a png image of any bit depth or color type, interlaced or not, converted
+    /// from srgb to linear color (see `linearized`), as textures need. alpha is
+    /// dropped; see `Sprite::from_png` to keep it.
+    pub fn from_png(bytes: &[u8]) -> Result<Canvas, ParsePngError> {
+        Canvas::from_png_with_alpha(bytes).map(|(canvas, _)| canvas)
+    }
+
+    /// like `from_png`, along with the alpha of each pixel, row by row. alpha is not
+    /// encoded, so it is not converted.
+    pub fn from_png_with_alpha(bytes: &[u8]) -> Result<(Canvas, Vec<f64>), ParsePngError> {
+        let (canvas, alpha) = png::decode(bytes).map_err(ParsePngError)?;
+        Ok((canvas.linearized(), alpha))
+    }
+
+    /// reads a sequential jpeg image, in grayscale or color, converted from srgb to
+    /// linear color like `from_png`. progressive and arithmetic coded images are not
+    /// supported.
+    pub fn from_jpeg(bytes: &[u8]) -> Result<Canvas, ParseJpegError> {
+        jpeg::decode(bytes)
+            .map(|canvas| canvas.linearized())
+            .map_err(ParseJpegError)
+    }
+
+    /// a copy of the canvas, brightened by `stops` (or darkened, if negative), as
+    /// though it had been rendered with that much more exposure compensation (see
+    /// `Exposure`). since exposure only scales each pixel, this gives the same image
+    /// as rendering again.
+    pub fn exposed(&self, stops: f64) -> Canvas {
+        let scale = stops.exp2();
+        Canvas::from_fn(self.width, self.height, |x, y| self[(x, y)] * scale)
+    }
+
+    /// a copy of the canvas with each pixel converted from srgb to linear color, as
+    /// needed for images made elsewhere (like photographs used as textures). renders
+    /// from this ray tracer are written without any encoding, and so do not need it.
+    pub fn linearized(&self) -> Canvas {
+        let channel = |c: f64| {
+            if c <= 0.04045 {
+                c / 12.92
+            } else {
+                ((c + 0.055) / 1.055).powf(2.4)
+            }
+        };
+        Canvas::from_fn(self.width, self.height, |x, y| {
+            let c = self[(x, y)];
+            Color::new(channel(c[0]), channel(c[1]), channel(c[2]))
+        })
+    }
+
+    /// the raw value of every pixel, one per line, as columns `x,y,r,g,b` under a
+    /// header. unlike `to_ppm`, the values are neither clamped nor quantized, so that
+    /// they can be analyzed elsewhere.
+    pub fn to_csv(&self) -> String {
+        let mut csv = String::from("x,y,r,g,b\n");
+        for (i, color) in self.vals.iter().enumerate() {
+            writeln!(
+                csv,
+                "{},{},{},{},{}",
+                i % self.width,
+                i / self.width,
+                color[0],
+                color[1],
+                color[2]
+            )
+            .unwrap();
+        }
+        csv
+    }
+
+    /// the raw value of every pixel, as an object with the `width` and `height` of
+    /// the canvas and its `pixels` as a list of rows, each a list of `[r, g, b]`.
+    /// values which are nan or infinite are written as `null`.
+    pub fn to_json(&self) -> String {
+        let number = |value: f64| {
+            if value.is_finite() {
+                format!("{:?}", value)
+            } else {
+                "null".to_string()
+            }
+        };
+        let rows: Vec<String> = self
+            .vals
+            .chunks(self.width.max(1))
+            .map(|row| {
+                let colors: Vec<String> = row
+                    .iter()
+                    .map(|c| format!("[{},{},{}]", number(c[0]), number(c[1]), number(c[2])))
+                    .collect();
+                format!("[{}]", colors.join(","))
+            })
+            .collect();
+
+        format!(
+            "{{\"width\":{},\"height\":{},\"pixels\":[{}]}}\n",
+            self.width,
+            self.height,
+            rows.join(",")
+        )
+    }
+
+    pub fn export(&self, format: Format) -> String {
+        self.export_with_comments(format, &[])
+    }
+
+    /// like `export`, but with `comments` written into the file, if the format has
+    /// comments; see `to_ppm_with_comments`. csv and json files are written without.
+    pub fn export_with_comments(&self, format: Format, comments: &[String]) -> String {
+        match format {
+            Format::Ppm => self.to_ppm_with_comments(comments),
+            Format::Csv => self.to_csv(),
+            Format::Json => self.to_json(),
+        }
+    }
+}
+
+/// the kinds of file a canvas can be written as; see `Canvas::export`.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Format {
+    Ppm,
+    Csv,
+    Json,
+}
+
+/// returned when making a canvas which has no pixels along one of its axes.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct EmptyCanvasError {
+    pub width: usize,
+    pub height: usize,
+}
+
+impl Display for EmptyCanvasError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "canvas must be at least 1 by 1 pixels, got {} by {}",
+            self.width, self.height
+        )
+    }
+}
+
+impl error::Error for EmptyCanvasError {}
+
+/// returned when parsing the name of a format which does not exist.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParseFormatError(String);
+
+impl Display for ParseFormatError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "unknown format \"{}\" (expected ppm, csv, or json)",
+            self.0
+        )
+    }
+}
+
+impl error::Error for ParseFormatError {}
+
+impl FromStr for Format {
+    type Err = ParseFormatError;
+
+    fn from_str(s: &str) -> Result<Format, ParseFormatError> {
+        match s.to_lowercase().as_str() {
+            "ppm" => Ok(Format::Ppm),
+            "csv" => Ok(Format::Csv),
+            "json" => Ok(Format::Json),
+            _ => Err(ParseFormatError(s.to_string())),
+        }
+    }
+}
+
+impl Format {
+    /// the usual file name extension for the format.
+    pub fn extension(&self) -> &'static str {
+        match self {
+            Format::Ppm => "ppm",
+            Format::Csv => "csv",
+            Format::Json => "json",
+        }
+    }
+}
+
+impl Default for Format {
+    fn default() -> Format {
+        Format::Ppm
+    }
+}
+
+/// returned when reading an image which is not a valid ppm file.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParsePpmError(String);
+
+impl Display for ParsePpmError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(f, "invalid ppm image: {}", self.0)
+    }
+}
+
+impl error::Error for ParsePpmError {}
+
+/// returned when reading an image which is not a valid png file.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParsePngError(String);
+
+impl Display for ParsePngError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(f, "invalid png image: {}", self.0)
+    }
+}
+
+impl error::Error for ParsePngError {}
+
+/// returned when reading an image which is not a valid (or supported) jpeg file.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParseJpegError(String);
+
+impl Display for ParseJpegError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(f, "invalid jpeg image: {}", self.0)
+    }
+}
+
+impl error::Error for ParseJpegError {}
+
+/// splits the header of a ppm file into its fields, skipping whitespace and comments.
+struct PpmHeader<'a> {
+    bytes: &'a [u8],
+    position: usize,
+}
+
+impl<'a> PpmHeader<'a> {
+    fn next_field(&mut self) -> Option<&'a [u8]> {
+        while let Some(&byte) = self.bytes.get(self.position) {
+            if byte == b'#' {
+                while self.bytes.get(self.position).map_or(false, |&b| b != b'\n') {
+                    self.position += 1;
+                }
+            } else if byte.is_ascii_whitespace() {
+                self.position += 1;
+            } else {
+                break;
+            }
+        }
+
+        let start = self.position;
+        while self
+            .bytes
+            .get(self.position)
+            .map_or(false, |b| !b.is_ascii_whitespace())
+        {
+            self.position += 1;
+        }
+
+        if start == self.position {
+            None
+        } else {
+            Some(&self.bytes[start..self.position])
+        }
+    }
+
+    fn next_number(&mut self, name: &str) -> Result<usize, ParsePpmError> {
+        self.next_field()
+            .and_then(|field| std::str::from_utf8(field).ok())
+            .and_then(|field| field.parse().ok())
+            .ok_or_else(|| ParsePpmError(format!("expected {}", name)))
+    }
+}
+
+/// a rectangular part of a canvas, created by `Canvas::sub` or `Canvas::split`.
+#[derive(Debug)]
+pub struct SubCanvas<'a> {
+    /// the position of the view's top-left corner within its canvas.
+    pub x: usize,
+    pub y: usize,
+    pub width: usize,
+    pub height: usize,
+    rows: Vec<&'a mut [Color]>,
+}
+
+impl Index<(usize, usize)> for SubCanvas<'_> {
+    type Output = Color;
+
+    fn index(&self, (x, y): (usize, usize)) -> &Self::Output {
+        &self.rows[y][x]
+    }
+}
+
+impl IndexMut<(usize, usize)> for SubCanvas<'_> {
+    fn index_mut(&mut self, (x, y): (usize, usize)) -> &mut Color {
+        &mut self.rows[y][x]
+    }
 }
 
 impl Index<(usize, usize)> for Canvas {
@@ -85,6 +528,23 @@ mod tests {
         }
     }
 
+    #[test]
+    fn create_checked_canvas() {
+        assert_eq!(
+            Canvas::try_new(0, 20).unwrap_err(),
+            EmptyCanvasError {
+                width: 0,
+                height: 20
+            }
+        );
+        assert_eq!(
+            Canvas::try_new(10, 0).unwrap_err().to_string(),
+            "canvas must be at least 1 by 1 pixels, got 10 by 0"
+        );
+        let c = Canvas::try_new(10, 20).unwrap();
+        assert_eq!((c.width, c.height), (10, 20));
+    }
+
     #[test]
     fn write_pixel() {
         let mut c = Canvas::new(10, 20);
@@ -93,6 +553,79 @@ mod tests {
         assert_eq!(c[(2, 3)], red);
     }
 
+    #[test]
+    fn hash_is_stable() {
+        let c = Canvas::from_fn(3, 2, |x, y| Color::new(x as f64 / 2.0, y as f64, 0.25));
+        assert_eq!(c.hash(), c.hash());
+        assert_eq!(
+            c.hash(),
+            Canvas::from_fn(3, 2, |x, y| Color::new(x as f64 / 2.0, y as f64, 0.25)).hash()
+        );
+    }
+
+    #[test]
+    fn hash_ignores_invisible_differences() {
+        let a = Canvas::from_fn(4, 4, |_, _| Color::new(0.5, 0.2, 0.9));
+        let b = Canvas::from_fn(4, 4, |_, _| Color::new(0.5001, 0.2, 0.9));
+        assert_eq!(a.hash(), b.hash());
+
+        let clamped = Canvas::from_fn(4, 4, |_, _| Color::new(0.5, 0.2, 3.0));
+        let white = Canvas::from_fn(4, 4, |_, _| Color::new(0.5, 0.2, 1.0));
+        assert_eq!(clamped.hash(), white.hash());
+    }
+
+    #[test]
+    fn hash_detects_changes() {
+        let a = Canvas::new(4, 4);
+        let mut b = Canvas::new(4, 4);
+        b[(1, 2)] = Color::new(0.0, 0.1, 0.0);
+        assert_ne!(a.hash(), b.hash());
+        assert_ne!(Canvas::new(4, 2).hash(), Canvas::new(2, 4).hash());
+    }
+
+    #[test]
+    fn write_through_sub_canvas() {
+        let mut c = Canvas::new(10, 20);
+        let red = Color::new(1.0, 0.0, 0.0);
+        let mut sub = c.sub(2, 3, 4, 5);
+        assert_eq!((sub.x, sub.y, sub.width, sub.height), (2, 3, 4, 5));
+        sub[(0, 0)] = red;
+        sub[(3, 4)] = red;
+        assert_eq!(c[(2, 3)], red);
+        assert_eq!(c[(5, 7)], red);
+        assert_eq!(c[(6, 7)], Color::black());
+    }
+
+    #[test]
+    fn split_canvas_into_regions() {
+        let mut c = Canvas::new(4, 3);
+        let regions = [(2, 0, 2, 3), (0, 0, 2, 2), (0, 2, 2, 1)];
+        for (i, mut view) in c.split(&regions).into_iter().enumerate() {
+            for y in 0..view.height {
+                for x in 0..view.width {
+                    view[(x, y)] = Color::new(i as f64, 0.0, 0.0);
+                }
+            }
+        }
+        for y in 0..3 {
+            for x in 0..4 {
+                let expected = match (x, y) {
+                    (2..=3, _) => 0.0,
+                    (_, 0..=1) => 1.0,
+                    _ => 2.0,
+                };
+                assert_eq!(c[(x, y)], Color::new(expected, 0.0, 0.0));
+            }
+        }
+    }
+
+    #[test]
+    #[should_panic]
+    fn split_canvas_rejects_overlap() {
+        let mut c = Canvas::new(4, 4);
+        c.split(&[(0, 0, 3, 3), (2, 2, 2, 2)]);
+    }
+
     #[test]
     fn ppm_header() {
         let c = Canvas::new(5, 3);
@@ -156,6 +689,274 @@ mod tests {
         );
     }
 
+    #[test]
+    fn ppm_comments() {
+        let mut c = Canvas::new(2, 1);
+        c[(1, 0)] = Color::new(1.0, 0.5, 0.0);
+        let ppm = c.to_ppm_with_comments(&["made by: test".to_string(), "a\nb".to_string()]);
+        let lines: Vec<&str> = ppm.split("\n").collect();
+        assert_eq!(
+            lines[..6],
+            ["P3", "# made by: test", "# a", "# b", "2 1", "255"]
+        );
+        assert_eq!(Canvas::from_ppm(ppm.as_bytes()).unwrap().hash(), c.hash());
+        assert_eq!(
+            c.export_with_comments(Format::Csv, &["x".to_string()]),
+            c.to_csv()
+        );
+    }
+
+    #[test]
+    fn ppm_round_trip() {
+        let c = Canvas::from_fn(3, 2, |x, y| Color::new(x as f64 / 2.0, y as f64, 0.2));
+        let read = Canvas::from_ppm(c.to_ppm().as_bytes()).unwrap();
+        assert_eq!((read.width, read.height), (3, 2));
+        assert_eq!(read.hash(), c.hash());
+    }
+
+    #[test]
+    fn read_binary_ppm_with_comments() {
+        let mut bytes = b"P6 # made elsewhere\n2 1\n# maximum\n255\n".to_vec();
+        bytes.extend(&[255, 0, 51, 0, 255, 0]);
+        let c = Canvas::from_ppm(&bytes).unwrap();
+        assert_eq!(c[(0, 0)], Color::new(1.0, 0.0, 0.2));
+        assert_eq!(c[(1, 0)], Color::new(0.0, 1.0, 0.0));
+    }
+
+    #[test]
+    fn reject_invalid_ppm() {
+        assert!(Canvas::from_ppm(b"P5\n1 1\n255\n0").is_err());
+        assert!(Canvas::from_ppm(b"P3\n2 1\n255\n0 0 0").is_err());
+        assert!(Canvas::from_ppm(b"P6\n2 1\n255\n\x00\x00").is_err());
+        // sizes which overflow are rejected rather than allocated.
+        assert_eq!(
+            Canvas::from_ppm(b"P3 99999999999 99999999999 255\n0 0 0").unwrap_err(),
+            ParsePpmError("image of 99999999999 by 99999999999 is too large".to_string())
+        );
+        assert!(Canvas::from_ppm(b"P6 4611686018427387904 1 65535\n\x00").is_err());
+    }
+
+    /// the largest difference between any channel of two canvases of the same size.
+    fn max_difference(a: &Canvas, b: &Canvas) -> f64 {
+        assert_eq!((a.width, a.height), (b.width, b.height));
+        a.vals
+            .iter()
+            .zip(b.vals.iter())
+            .flat_map(|(a, b)| (0..3).map(move |i| (a[i] - b[i]).abs()))
+            .fold(0.0, f64::max)
+    }
+
+    macro_rules! fixture {
+        ($name:literal) => {
+            include_bytes!(concat!("../../resources/fixtures/", $name))
+        };
+    }
+
+    /// corrupts `bytes` in every way that a damaged file might be: cut short at every
+    /// length, and then with bits flipped, bytes overwritten and runs of bytes dropped or
+    /// repeated, at positions picked by a fixed xorshift sequence.
+    pub(super) fn mutations(bytes: &[u8]) -> impl Iterator<Item = Vec<u8>> + '_ {
+        let mut state: u64 = 0x2545_f491_4f6c_dd1d;
+        let mut next = move |bound: usize| {
+            state ^= state << 13;
+            state ^= state >> 7;
+            state ^= state << 17;
+            (state % bound.max(1) as u64) as usize
+        };
+        let truncated = (0..bytes.len()).map(move |length| bytes[..length].to_vec());
+        let damaged = (0..2000).map(move |_| {
+            let mut damaged = bytes.to_vec();
+            for _ in 0..1 + next(4) {
+                let at = next(damaged.len());
+                match next(4) {
+                    0 => damaged[at] ^= 1 << next(8),
+                    1 => damaged[at] = [0x00, 0xff, next(256) as u8][next(3)],
+                    2 => {
+                        let end = (at + next(16)).min(damaged.len());
+                        damaged.drain(at..end);
+                    }
+                    _ => {
+                        let end = (at + next(16)).min(damaged.len());
+                        let run = damaged[at..end].to_vec();
+                        damaged.splice(at..at, run);
+                    }
+                }
+                if damaged.is_empty() {
+                    break;
+                }
+            }
+            damaged
+        });
+        truncated.chain(damaged)
+    }
+
+    #[test]
+    fn read_png() {
+        let cases: [(&[u8], &[u8]); 4] = [
+            (fixture!("rgb.png"), fixture!("rgb.ppm")),
+            (
+                fixture!("rgba16-interlaced.png"),
+                fixture!("rgba16-interlaced.ppm"),
+            ),
+            (fixture!("palette.png"), fixture!("palette.ppm")),
+            (
+                fixture!("gray1-interlaced.png"),
+                fixture!("gray1-interlaced.ppm"),
+            ),
+        ];
+        for (png, ppm) in cases.iter() {
+            let expected = Canvas::from_ppm(ppm).unwrap().linearized();
+            assert_eq!(
+                max_difference(&Canvas::from_png(png).unwrap(), &expected),
+                0.0
+            );
+        }
+    }
+
+    #[test]
+    fn read_png_alpha() {
+        let (_, alpha) = Canvas::from_png_with_alpha(fixture!("rgb.png")).unwrap();
+        assert!(alpha.iter().all(|&alpha| alpha == 1.0));
+
+        let (canvas, alpha) =
+            Canvas::from_png_with_alpha(fixture!("rgba16-interlaced.png")).unwrap();
+        // every pixel of the fixture has the same alpha.
+        assert_eq!(alpha.len(), canvas.width * canvas.height);
+        assert!(alpha.iter().all(|&alpha| alpha == 1234.0 / 65535.0));
+    }
+
+    #[test]
+    fn reject_invalid_png() {
+        let png = fixture!("rgb.png");
+        assert!(Canvas::from_png(&png[1..]).is_err());
+        assert!(Canvas::from_png(&png[..png.len() / 2]).is_err());
+        let mut corrupt = png.to_vec();
+        // the color type of the header.
+        corrupt[25] = 5;
+        assert_eq!(
+            Canvas::from_png(&corrupt).unwrap_err(),
+            ParsePngError("unknown color type 5".to_string())
+        );
+    }
+
+    #[test]
+    fn damaged_png_does_not_panic() {
+        let cases: [&[u8]; 4] = [
+            fixture!("rgb.png"),
+            fixture!("rgba16-interlaced.png"),
+            fixture!("palette.png"),
+            fixture!("gray1-interlaced.png"),
+        ];
+        for png in cases.iter() {
+            for damaged in mutations(png) {
+                // any result will do, as long as decoding returns one.
+                let _ = Canvas::from_png_with_alpha(&damaged);
+            }
+        }
+    }
+
+    #[test]
+    fn read_jpeg() {
+        // the fixtures are quantized by one, so only rounding is lost, though it grows
+        // by up to 2.3 times once the colors are linearized.
+        let cases: [(&[u8], &[u8]); 4] = [
+            (fixture!("ycbcr.jpg"), fixture!("ycbcr.ppm")),
+            (fixture!("ycbcr-420.jpg"), fixture!("ycbcr-420.ppm")),
+            (fixture!("adobe-rgb.jpg"), fixture!("adobe-rgb.ppm")),
+            (fixture!("gray.jpg"), fixture!("gray.ppm")),
+        ];
+        for (jpeg, ppm) in cases.iter() {
+            let expected = Canvas::from_ppm(ppm).unwrap().linearized();
+            assert!(max_difference(&Canvas::from_jpeg(jpeg).unwrap(), &expected) <= 7.0 / 255.0);
+        }
+    }
+
+    #[test]
+    fn reject_invalid_jpeg() {
+        let jpeg = fixture!("ycbcr.jpg");
+        assert!(Canvas::from_jpeg(&jpeg[1..]).is_err());
+        assert!(Canvas::from_jpeg(&jpeg[..jpeg.len() / 2]).is_err());
+        // the same image, marked as progressive.
+        let progressive: Vec<u8> = jpeg
+            .windows(2)
+            .map(|pair| if pair == [0xff, 0xc0] { 0xc2 } else { pair[1] })
+            .collect();
+        let progressive = [&jpeg[..1], &progressive[..]].concat();
+        assert_eq!(
+            Canvas::from_jpeg(&progressive).unwrap_err(),
+            ParseJpegError("only baseline jpeg images are supported".to_string())
+        );
+        // a frame header that is too short for the components it lists.
+        let frame = jpeg
+            .windows(2)
+            .position(|pair| pair == [0xff, 0xc0])
+            .unwrap();
+        let length = u16::from_be_bytes([jpeg[frame + 2], jpeg[frame + 3]]) as usize;
+        let truncated = [
+            &jpeg[..frame + 2],
+            &(length as u16 - 4).to_be_bytes()[..],
+            &jpeg[frame + 4..frame + length - 2],
+            &jpeg[frame + 2 + length..],
+        ]
+        .concat();
+        assert_eq!(
+            Canvas::from_jpeg(&truncated).unwrap_err(),
+            ParseJpegError("frame header ends early".to_string())
+        );
+    }
+
+    #[test]
+    fn damaged_jpeg_does_not_panic() {
+        let cases: [&[u8]; 4] = [
+            fixture!("ycbcr.jpg"),
+            fixture!("ycbcr-420.jpg"),
+            fixture!("adobe-rgb.jpg"),
+            fixture!("gray.jpg"),
+        ];
+        for jpeg in cases.iter() {
+            for damaged in mutations(jpeg) {
+                let _ = Canvas::from_jpeg(&damaged);
+            }
+        }
+    }
+
+    #[test]
+    fn exposing_canvas() {
+        let c = Canvas::from_fn(1, 1, |_, _| Color::new(0.25, 0.5, 1.0));
+        assert_eq!(c.exposed(1.0)[(0, 0)], Color::new(0.5, 1.0, 2.0));
+        assert_eq!(c.exposed(-2.0)[(0, 0)], Color::new(0.0625, 0.125, 0.25));
+    }
+
+    #[test]
+    fn srgb_to_linear() {
+        let c = Canvas::from_fn(1, 1, |_, _| Color::new(0.0, 0.5, 1.0)).linearized();
+        assert_eq!(c[(0, 0)], Color::new(0.0, 0.21404114048223255, 1.0));
+    }
+
+    #[test]
+    fn csv_keeps_raw_values() {
+        let mut c = Canvas::new(2, 1);
+        c[(1, 0)] = Color::new(1.5, -0.25, 0.125);
+        assert_eq!(c.to_csv(), "x,y,r,g,b\n0,0,0,0,0\n1,0,1.5,-0.25,0.125\n");
+    }
+
+    #[test]
+    fn json_keeps_raw_values() {
+        let mut c = Canvas::new(2, 2);
+        c[(1, 0)] = Color::new(1.5, f64::NAN, 0.125);
+        assert_eq!(
+            c.to_json(),
+            "{\"width\":2,\"height\":2,\"pixels\":[[[0.0,0.0,0.0],[1.5,null,0.125]],\
+             [[0.0,0.0,0.0],[0.0,0.0,0.0]]]}\n"
+        );
+    }
+
+    #[test]
+    fn parse_format() {
+        assert_eq!("CSV".parse(), Ok(Format::Csv));
+        assert!("png".parse::<Format>().is_err());
+    }
+
     #[test]
     fn ppm_ends_with_newline() {
         let c = Canvas::new(5, 3);
@@ -0,0 +1,298 @@
+/// reads the bits of a deflate stream, least significant bit first.
+struct Bits<'a> {
+    bytes: &'a [u8],
+    position: usize,
+    buffer: u32,
+    count: u32,
+}
+
+impl<'a> Bits<'a> {
+    fn take(&mut self, count: u32) -> Result<u32, String> {
+        while self.count < count {
+            let byte = *self
+                .bytes
+                .get(self.position)
+                .ok_or_else(|| "compressed data ends early".to_string())?;
+            self.position += 1;
+            self.buffer |= (byte as u32) << self.count;
+            self.count += 8;
+        }
+        let bits = self.buffer & ((1u64 << count) - 1) as u32;
+        self.buffer >>= count;
+        self.count -= count;
+        Ok(bits)
+    }
+
+    /// skips to the start of the next byte.
+    fn align(&mut self) {
+        self.buffer = 0;
+        self.count = 0;
+    }
+}
+
+/// a canonical huffman code, as the number of symbols of each length and the
+/// symbols in order of their codes.
+struct Huffman {
+    counts: [u16; 16],
+    symbols: Vec<u16>,
+}
+
+impl Huffman {
+    fn new(lengths: &[u8]) -> Huffman {
+        let mut counts = [0; 16];
+        for &length in lengths {
+            counts[length as usize] += 1;
+        }
+        counts[0] = 0;
+
+        let mut offsets = [0; 16];
+        for i in 1..16 {
+            offsets[i] = offsets[i - 1] + counts[i - 1];
+        }
+        let mut symbols = vec![0; offsets[15] as usize + counts[15] as usize];
+        for (symbol, &length) in lengths.iter().enumerate() {
+            if length != 0 {
+                symbols[offsets[length as usize] as usize] = symbol as u16;
+                offsets[length as usize] += 1;
+            }
+        }
+
+        Huffman { counts, symbols }
+    }
+
+    fn decode(&self, bits: &mut Bits) -> Result<u16, String> {
+        // the codes of each length follow on from those of the length before.
+        let (mut code, mut first, mut index) = (0i32, 0i32, 0i32);
+        for length in 1..16 {
+            code |= bits.take(1)? as i32;
+            let count = self.counts[length] as i32;
+            if code - first < count {
+                return Ok(self.symbols[(index + code - first) as usize]);
+            }
+            index += count;
+            first = (first + count) << 1;
+            code <<= 1;
+        }
+        Err("invalid huffman code".to_string())
+    }
+}
+
+const LENGTH_BASE: [u16; 29] = [
+    3, 4, 5, 6, 7, 8, 9, 10, 11, 13, 15, 17, 19, 23, 27, 31, 35, 43, 51, 59, 67, 83, 99, 115, 131,
+    163, 195, 227, 258,
+];
+const LENGTH_EXTRA: [u8; 29] = [
+    0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 0,
+];
+const DISTANCE_BASE: [u16; 30] = [
+    1, 2, 3, 4, 5, 7, 9, 13, 17, 25, 33, 49, 65, 97, 129, 193, 257, 385, 513, 769, 1025, 1537,
+    2049, 3073, 4097, 6145, 8193, 12289, 16385, 24577,
+];
+const DISTANCE_EXTRA: [u8; 30] = [
+    0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7, 8, 8, 9, 9, 10, 10, 11, 11, 12, 12, 13,
+    13,
+];
+
+/// the order in which the lengths of the code length code are given.
+const CODE_LENGTH_ORDER: [usize; 19] = [
+    16, 17, 18, 0, 8, 7, 9, 6, 10, 5, 11, 4, 12, 3, 13, 2, 14, 1, 15,
+];
+
+/// decompresses a zlib stream.
+pub fn zlib(bytes: &[u8]) -> Result<Vec<u8>, String> {
+    if bytes.len() < 2 {
+        return Err("compressed data ends early".to_string());
+    }
+    let (method, flags) = (bytes[0], bytes[1]);
+    if method & 0x0f != 8 || ((method as u16) << 8 | flags as u16) % 31 != 0 {
+        return Err("not a zlib stream".to_string());
+    }
+    if flags & 0x20 != 0 {
+        return Err("preset dictionaries are not supported".to_string());
+    }
+    inflate(&bytes[2..])
+}
+
+/// decompresses raw deflate data.
+pub fn inflate(bytes: &[u8]) -> Result<Vec<u8>, String> {
+    let mut bits = Bits {
+        bytes,
+        position: 0,
+        buffer: 0,
+        count: 0,
+    };
+    let mut out = Vec::new();
+
+    loop {
+        let last = bits.take(1)? == 1;
+        match bits.take(2)? {
+            0 => stored(&mut bits, &mut out)?,
+            1 => {
+                let mut lengths = [0; 288];
+                lengths[..144].iter_mut().for_each(|l| *l = 8);
+                lengths[144..256].iter_mut().for_each(|l| *l = 9);
+                lengths[256..280].iter_mut().for_each(|l| *l = 7);
+                lengths[280..].iter_mut().for_each(|l| *l = 8);
+                let literals = Huffman::new(&lengths);
+                let distances = Huffman::new(&[5; 30]);
+                block(&mut bits, &mut out, &literals, &distances)?;
+            }
+            2 => {
+                let (literals, distances) = dynamic_codes(&mut bits)?;
+                block(&mut bits, &mut out, &literals, &distances)?;
+            }
+            _ => return Err("invalid block type".to_string()),
+        }
+        if last {
+            return Ok(out);
+        }
+    }
+}
+
+fn stored(bits: &mut Bits, out: &mut Vec<u8>) -> Result<(), String> {
+    bits.align();
+    let header = bits
+        .bytes
+        .get(bits.position..bits.position + 4)
+        .ok_or_else(|| "compressed data ends early".to_string())?;
+    let length = u16::from_le_bytes([header[0], header[1]]);
+    let complement = u16::from_le_bytes([header[2], header[3]]);
+    if length != !complement {
+        return Err("stored block has a corrupt length".to_string());
+    }
+    let start = bits.position + 4;
+    let data = bits
+        .bytes
+        .get(start..start + length as usize)
+        .ok_or_else(|| "compressed data ends early".to_string())?;
+    out.extend_from_slice(data);
+    bits.position = start + length as usize;
+    Ok(())
+}
+
+fn dynamic_codes(bits: &mut Bits) -> Result<(Huffman, Huffman), String> {
+    let literal_count = bits.take(5)? as usize + 257;
+    let distance_count = bits.take(5)? as usize + 1;
+    let length_count = bits.take(4)? as usize + 4;
+
+    let mut code_lengths = [0; 19];
+    for &i in CODE_LENGTH_ORDER[..length_count].iter() {
+        code_lengths[i] = bits.take(3)? as u8;
+    }
+    let code_lengths = Huffman::new(&code_lengths);
+
+    let mut lengths = Vec::with_capacity(literal_count + distance_count);
+    while lengths.len() < literal_count + distance_count {
+        let symbol = code_lengths.decode(bits)?;
+        let (length, repeat) = match symbol {
+            0..=15 => (symbol as u8, 1),
+            16 => {
+                let previous = *lengths
+                    .last()
+                    .ok_or_else(|| "repeated length has nothing to repeat".to_string())?;
+                (previous, 3 + bits.take(2)?)
+            }
+            17 => (0, 3 + bits.take(3)?),
+            _ => (0, 11 + bits.take(7)?),
+        };
+        lengths.extend((0..repeat).map(|_| length));
+    }
+    if lengths.len() > literal_count + distance_count {
+        return Err("too many code lengths".to_string());
+    }
+
+    Ok((
+        Huffman::new(&lengths[..literal_count]),
+        Huffman::new(&lengths[literal_count..]),
+    ))
+}
+
+fn block(
+    bits: &mut Bits,
+    out: &mut Vec<u8>,
+    literals: &Huffman,
+    distances: &Huffman,
+) -> Result<(), String> {
+    loop {
+        let symbol = literals.decode(bits)? as usize;
+        match symbol {
+            0..=255 => out.push(symbol as u8),
+            256 => return Ok(()),
+            257..=285 => {
+                let i = symbol - 257;
+                let length = LENGTH_BASE[i] as usize + bits.take(LENGTH_EXTRA[i] as u32)? as usize;
+                let i = distances.decode(bits)? as usize;
+                if i >= 30 {
+                    return Err("invalid distance".to_string());
+                }
+                let distance =
+                    DISTANCE_BASE[i] as usize + bits.take(DISTANCE_EXTRA[i] as u32)? as usize;
+                if distance > out.len() {
+                    return Err("distance reaches back before the start".to_string());
+                }
+                // the copy may overlap what it is copying, repeating it.
+                let start = out.len() - distance;
+                for i in 0..length {
+                    out.push(out[start + i]);
+                }
+            }
+            _ => return Err("invalid length".to_string()),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn inflate_stored_block() {
+        let bytes = [0x01, 0x03, 0x00, 0xfc, 0xff, b'a', b'b', b'c'];
+        assert_eq!(inflate(&bytes).unwrap(), b"abc");
+    }
+
+    #[test]
+    fn inflate_fixed_codes() {
+        // zlib.compress(b"hello hello hello hello")
+        let bytes = [
+            0x78, 0x9c, 0xcb, 0x48, 0xcd, 0xc9, 0xc9, 0x57, 0xc8, 0x40, 0x27, 0x01, 0x68, 0x03,
+            0x08, 0xb1,
+        ];
+        assert_eq!(zlib(&bytes).unwrap(), b"hello hello hello hello");
+    }
+
+    #[test]
+    fn inflate_dynamic_codes() {
+        let mut x: u32 = 1;
+        let text: Vec<u8> = (0..100)
+            .map(|_| {
+                x = x.wrapping_mul(1_103_515_245).wrapping_add(12345) & 0x7fff_ffff;
+                b"aaaaaaaabbbbccd "[(x >> 16) as usize % 16]
+            })
+            .collect();
+        assert_eq!(zlib(DYNAMIC).unwrap(), text);
+    }
+
+    #[test]
+    fn reject_corrupt_streams() {
+        assert!(zlib(&[0x78]).is_err());
+        assert!(zlib(&[0x78, 0x9d, 0x00]).is_err());
+        assert!(inflate(&[0x07]).is_err());
+        assert!(inflate(&[0x01, 0x03, 0x00, 0xfc, 0xfe]).is_err());
+    }
+
+    #[test]
+    fn damaged_streams_do_not_panic() {
+        for damaged in crate::world::canvas::tests::mutations(DYNAMIC) {
+            let _ = zlib(&damaged);
+        }
+    }
+
+    /// zlib.compress of the text in `inflate_dynamic_codes`, which uses dynamic codes.
+    const DYNAMIC: &[u8] = &[
+        0x78, 0xda, 0x35, 0x8c, 0xc1, 0x0d, 0x00, 0x30, 0x08, 0x02, 0x57, 0x61, 0x35, 0x0e, 0xf6,
+        0x9f, 0xa1, 0xda, 0xa6, 0x3c, 0x0c, 0xe1, 0x40, 0xd7, 0x80, 0xb1, 0xa3, 0xc4, 0xb6, 0xdc,
+        0x3d, 0xa3, 0xc9, 0x33, 0x68, 0x99, 0xc9, 0x23, 0x5b, 0x1d, 0x8f, 0x2b, 0x90, 0x6e, 0x94,
+        0xd0, 0x2d, 0x35, 0xa4, 0x6f, 0xa9, 0x3f, 0x9a, 0x07, 0x70, 0x00, 0x09, 0x5d, 0x23, 0xa8,
+    ];
+}
@@ -0,0 +1,510 @@
+use std::f64::consts;
+
+use super::Canvas;
+use crate::world::Color;
+
+/// the order in which the coefficients of a block are stored, from the lowest
+/// frequencies to the highest.
+const ZIGZAG: [usize; 64] = [
+    0, 1, 8, 16, 9, 2, 3, 10, 17, 24, 32, 25, 18, 11, 4, 5, 12, 19, 26, 33, 40, 48, 41, 34, 27, 20,
+    13, 6, 7, 14, 21, 28, 35, 42, 49, 56, 57, 50, 43, 36, 29, 22, 15, 23, 30, 37, 44, 51, 58, 59,
+    52, 45, 38, 31, 39, 46, 53, 60, 61, 54, 47, 55, 62, 63,
+];
+
+/// a huffman table, as the largest code of each length and where the symbols of
+/// each length start.
+#[derive(Clone, Default)]
+struct Huffman {
+    symbols: Vec<u8>,
+    /// for each length, the first code, the last code (or -1 if there are none),
+    /// and the index of the first symbol.
+    lengths: [(i32, i32, usize); 17],
+}
+
+impl Huffman {
+    fn new(counts: &[u8], symbols: &[u8]) -> Huffman {
+        let mut lengths = [(0, -1, 0); 17];
+        let (mut code, mut index) = (0, 0);
+        for length in 1..=16 {
+            let count = counts[length - 1] as i32;
+            lengths[length] = (code, code + count - 1, index);
+            code = (code + count) << 1;
+            index += count as usize;
+        }
+        Huffman {
+            symbols: symbols.to_vec(),
+            lengths,
+        }
+    }
+
+    fn decode(&self, bits: &mut Bits) -> Result<u8, String> {
+        let mut code = 0;
+        for length in 1..=16 {
+            code = (code << 1) | bits.take(1)? as i32;
+            let (first, last, index) = self.lengths[length];
+            if code <= last {
+                return self
+                    .symbols
+                    .get(index + (code - first) as usize)
+                    .copied()
+                    .ok_or_else(|| "invalid huffman code".to_string());
+            }
+        }
+        Err("invalid huffman code".to_string())
+    }
+}
+
+/// reads the bits of entropy coded data, most significant bit first, skipping the
+/// zero bytes stuffed after each `0xff`. a marker ends the data, after which only
+/// zeros are read.
+struct Bits<'a> {
+    bytes: &'a [u8],
+    position: usize,
+    buffer: u32,
+    count: u32,
+}
+
+impl<'a> Bits<'a> {
+    fn take(&mut self, count: u32) -> Result<u32, String> {
+        while self.count < count {
+            let byte = match self.bytes.get(self.position) {
+                Some(0xff) if self.bytes.get(self.position + 1) == Some(&0) => {
+                    self.position += 2;
+                    0xff
+                }
+                Some(0xff) | None => 0,
+                Some(&byte) => {
+                    self.position += 1;
+                    byte
+                }
+            };
+            self.buffer = (self.buffer << 8) | byte as u32;
+            self.count += 8;
+        }
+        self.count -= count;
+        Ok((self.buffer >> self.count) & ((1u64 << count) - 1) as u32)
+    }
+
+    /// the value of a coefficient of `size` bits, which are negative if the first
+    /// bit is clear.
+    fn receive(&mut self, size: u8) -> Result<i32, String> {
+        if size == 0 {
+            return Ok(0);
+        }
+        if size > 16 {
+            return Err("coefficient is too large".to_string());
+        }
+        let value = self.take(size as u32)? as i32;
+        if value < 1 << (size - 1) {
+            Ok(value - (1 << size) + 1)
+        } else {
+            Ok(value)
+        }
+    }
+
+    /// skips the restart marker which should come next, discarding any bits left
+    /// over from the byte before it.
+    fn restart(&mut self) -> Result<(), String> {
+        self.buffer = 0;
+        self.count = 0;
+        match self.bytes.get(self.position..self.position + 2) {
+            Some([0xff, marker]) if (0xd0..=0xd7).contains(marker) => {
+                self.position += 2;
+                Ok(())
+            }
+            _ => Err("missing restart marker".to_string()),
+        }
+    }
+}
+
+struct Component {
+    id: u8,
+    horizontal: usize,
+    vertical: usize,
+    table: usize,
+    /// the number of blocks across and down the component, padded out to whole
+    /// minimum coded units.
+    columns: usize,
+    rows: usize,
+    samples: Vec<u8>,
+    /// the dc coefficient of the previous block, which the next one is relative to.
+    predictor: i32,
+}
+
+/// reads a baseline (or extended sequential, huffman coded) jpeg image; see
+/// `Canvas::from_jpeg`.
+pub fn decode(bytes: &[u8]) -> Result<Canvas, String> {
+    if !bytes.starts_with(&[0xff, 0xd8]) {
+        return Err("missing start of image".to_string());
+    }
+
+    let mut quantization = [[0u16; 64]; 4];
+    let mut dc_tables = vec![Huffman::default(); 4];
+    let mut ac_tables = vec![Huffman::default(); 4];
+    let mut components: Vec<Component> = vec![];
+    let (mut width, mut height) = (0, 0);
+    let mut restart_interval = 0;
+    let mut adobe_rgb = false;
+    let mut position = 2;
+
+    loop {
+        // markers may be padded with any number of fill bytes.
+        while bytes.get(position) == Some(&0xff) && bytes.get(position + 1) == Some(&0xff) {
+            position += 1;
+        }
+        let marker = match bytes.get(position..position + 2) {
+            Some([0xff, marker]) => *marker,
+            _ => return Err("expected a marker".to_string()),
+        };
+        if marker == 0xd9 {
+            break;
+        }
+        let length = bytes
+            .get(position + 2..position + 4)
+            .map(|b| u16::from_be_bytes([b[0], b[1]]) as usize)
+            .filter(|&length| length >= 2)
+            .ok_or_else(|| "file ends early".to_string())?;
+        let segment = bytes
+            .get(position + 4..position + 2 + length)
+            .ok_or_else(|| "file ends early".to_string())?;
+        position += 2 + length;
+
+        match marker {
+            0xc0 | 0xc1 => {
+                if segment.len() < 6 || segment[0] != 8 {
+                    return Err("only 8 bit samples are supported".to_string());
+                }
+                height = u16::from_be_bytes([segment[1], segment[2]]) as usize;
+                width = u16::from_be_bytes([segment[3], segment[4]]) as usize;
+                if width == 0 || height == 0 {
+                    return Err("image has no pixels".to_string());
+                }
+                let count = segment[5] as usize;
+                if segment.len() < 6 + 3 * count {
+                    return Err("frame header ends early".to_string());
+                }
+                components = segment[6..6 + 3 * count]
+                    .chunks_exact(3)
+                    .map(|c| Component {
+                        id: c[0],
+                        horizontal: (c[1] >> 4).max(1) as usize,
+                        vertical: (c[1] & 0x0f).max(1) as usize,
+                        table: (c[2] & 3) as usize,
+                        columns: 0,
+                        rows: 0,
+                        samples: vec![],
+                        predictor: 0,
+                    })
+                    .collect();
+                if components.len() != 1 && components.len() != 3 {
+                    return Err(format!("{} color components", components.len()));
+                }
+                allocate(&mut components, width, height);
+            }
+            0xc2..=0xcf if marker != 0xc4 && marker != 0xc8 && marker != 0xcc => {
+                return Err("only baseline jpeg images are supported".to_string());
+            }
+            0xc4 => {
+                let mut rest = segment;
+                while rest.len() >= 17 {
+                    let class = rest[0] >> 4;
+                    let index = (rest[0] & 3) as usize;
+                    let counts = &rest[1..17];
+                    let total: usize = counts.iter().map(|&count| count as usize).sum();
+                    let symbols = rest
+                        .get(17..17 + total)
+                        .ok_or_else(|| "huffman table ends early".to_string())?;
+                    let table = Huffman::new(counts, symbols);
+                    if class == 0 {
+                        dc_tables[index] = table;
+                    } else {
+                        ac_tables[index] = table;
+                    }
+                    rest = &rest[17 + total..];
+                }
+            }
+            0xdb => {
+                let mut rest = segment;
+                while !rest.is_empty() {
+                    let wide = rest[0] >> 4 != 0;
+                    let index = (rest[0] & 3) as usize;
+                    let size = if wide { 128 } else { 64 };
+                    let values = rest
+                        .get(1..1 + size)
+                        .ok_or_else(|| "quantization table ends early".to_string())?;
+                    for k in 0..64 {
+                        quantization[index][ZIGZAG[k]] = if wide {
+                            u16::from_be_bytes([values[k * 2], values[k * 2 + 1]])
+                        } else {
+                            values[k] as u16
+                        };
+                    }
+                    rest = &rest[1 + size..];
+                }
+            }
+            0xdd => {
+                restart_interval = segment
+                    .get(..2)
+                    .map(|b| u16::from_be_bytes([b[0], b[1]]) as usize)
+                    .ok_or_else(|| "restart interval ends early".to_string())?;
+            }
+            0xee => {
+                // an adobe segment says whether the three components are rgb rather
+                // than luma and chroma.
+                adobe_rgb = segment.starts_with(b"Adobe") && segment.get(11) == Some(&0);
+            }
+            0xda => {
+                if components.is_empty() {
+                    return Err("scan comes before the frame".to_string());
+                }
+                let count = *segment.first().unwrap_or(&0) as usize;
+                let mut scan = vec![];
+                for c in segment.get(1..1 + count * 2).unwrap_or(&[]).chunks(2) {
+                    let i = components
+                        .iter()
+                        .position(|component| component.id == c[0])
+                        .ok_or_else(|| "scan refers to a missing component".to_string())?;
+                    scan.push((i, (c[1] >> 4) as usize & 3, (c[1] & 3) as usize));
+                }
+                if scan.is_empty() {
+                    return Err("scan has no components".to_string());
+                }
+
+                let mut bits = Bits {
+                    bytes: &bytes[position..],
+                    position: 0,
+                    buffer: 0,
+                    count: 0,
+                };
+                let tables = Tables {
+                    quantization: &quantization,
+                    dc: &dc_tables,
+                    ac: &ac_tables,
+                };
+                decode_scan(
+                    &mut components,
+                    &scan,
+                    &tables,
+                    (width, height),
+                    restart_interval,
+                    &mut bits,
+                )?;
+
+                // skip to the marker after the entropy coded data.
+                position += bits.position;
+                while let Some(pair) = bytes.get(position..position + 2) {
+                    if pair[0] == 0xff && pair[1] != 0 && !(0xd0..=0xd7).contains(&pair[1]) {
+                        break;
+                    }
+                    position += 1;
+                }
+            }
+            // application data and comments are skipped.
+            _ => {}
+        }
+    }
+
+    if components.is_empty() {
+        return Err("missing frame".to_string());
+    }
+    Ok(to_canvas(&components, width, height, adobe_rgb))
+}
+
+/// sizes each component's samples to cover the whole minimum coded units.
+fn allocate(components: &mut [Component], width: usize, height: usize) {
+    let max_h = components.iter().map(|c| c.horizontal).max().unwrap_or(1);
+    let max_v = components.iter().map(|c| c.vertical).max().unwrap_or(1);
+    let mcu_columns = (width + 8 * max_h - 1) / (8 * max_h);
+    let mcu_rows = (height + 8 * max_v - 1) / (8 * max_v);
+    for component in components.iter_mut() {
+        component.columns = mcu_columns * component.horizontal;
+        component.rows = mcu_rows * component.vertical;
+        component.samples = vec![0; component.columns * component.rows * 64];
+    }
+}
+
+struct Tables<'a> {
+    quantization: &'a [[u16; 64]; 4],
+    dc: &'a [Huffman],
+    ac: &'a [Huffman],
+}
+
+/// decodes the blocks of the `scan`, which lists each of its components along with
+/// its dc and ac tables.
+fn decode_scan(
+    components: &mut [Component],
+    scan: &[(usize, usize, usize)],
+    tables: &Tables,
+    size: (usize, usize),
+    restart_interval: usize,
+    bits: &mut Bits,
+) -> Result<(), String> {
+    for component in components.iter_mut() {
+        component.predictor = 0;
+    }
+    let max_h = components.iter().map(|c| c.horizontal).max().unwrap_or(1);
+    let max_v = components.iter().map(|c| c.vertical).max().unwrap_or(1);
+
+    // a scan of a single component goes through just the blocks covering the image,
+    // one at a time, while a scan of several goes through whole minimum coded units.
+    let mut units: Vec<Vec<(usize, usize, usize)>> = vec![];
+    if scan.len() == 1 {
+        let component = &components[scan[0].0];
+        let width = (size.0 * component.horizontal + max_h - 1) / max_h;
+        let height = (size.1 * component.vertical + max_v - 1) / max_v;
+        for row in 0..(height + 7) / 8 {
+            for column in 0..(width + 7) / 8 {
+                units.push(vec![(0, column, row)]);
+            }
+        }
+    } else {
+        let mcu_columns = (size.0 + 8 * max_h - 1) / (8 * max_h);
+        let mcu_rows = (size.1 + 8 * max_v - 1) / (8 * max_v);
+        for mcu_row in 0..mcu_rows {
+            for mcu_column in 0..mcu_columns {
+                let mut blocks = vec![];
+                for (i, &(c, _, _)) in scan.iter().enumerate() {
+                    let component = &components[c];
+                    for v in 0..component.vertical {
+                        for h in 0..component.horizontal {
+                            blocks.push((
+                                i,
+                                mcu_column * component.horizontal + h,
+                                mcu_row * component.vertical + v,
+                            ));
+                        }
+                    }
+                }
+                units.push(blocks);
+            }
+        }
+    }
+
+    for (n, unit) in units.iter().enumerate() {
+        if restart_interval > 0 && n > 0 && n % restart_interval == 0 {
+            bits.restart()?;
+            for component in components.iter_mut() {
+                component.predictor = 0;
+            }
+        }
+        for &(i, column, row) in unit {
+            let (c, dc, ac) = scan[i];
+            let component = &mut components[c];
+            let quantization = &tables.quantization[component.table];
+            let block = decode_block(bits, &tables.dc[dc], &tables.ac[ac], component)?;
+            let stride = component.columns * 8;
+            let offset = row * 8 * stride + column * 8;
+            idct(
+                &block,
+                quantization,
+                &mut component.samples[offset..],
+                stride,
+            );
+        }
+    }
+    Ok(())
+}
+
+/// the quantized coefficients of a block, in their natural order.
+fn decode_block(
+    bits: &mut Bits,
+    dc: &Huffman,
+    ac: &Huffman,
+    component: &mut Component,
+) -> Result<[i32; 64], String> {
+    let mut block = [0; 64];
+    let size = dc.decode(bits)?;
+    component.predictor += bits.receive(size)?;
+    block[0] = component.predictor;
+
+    let mut k = 1;
+    while k < 64 {
+        let symbol = ac.decode(bits)?;
+        let (run, size) = ((symbol >> 4) as usize, symbol & 0x0f);
+        if size == 0 {
+            if run != 15 {
+                // the rest of the block is zero.
+                break;
+            }
+            k += 16;
+            continue;
+        }
+        k += run;
+        if k >= 64 {
+            return Err("block has too many coefficients".to_string());
+        }
+        block[ZIGZAG[k]] = bits.receive(size)?;
+        k += 1;
+    }
+    Ok(block)
+}
+
+/// dequantizes a block and transforms it back into samples, written into `out`
+/// with `stride` samples between rows.
+fn idct(block: &[i32; 64], quantization: &[u16; 64], out: &mut [u8], stride: usize) {
+    let mut coefficients = [0.0; 64];
+    for i in 0..64 {
+        coefficients[i] = (block[i] * quantization[i] as i32) as f64;
+    }
+
+    // cos((2x + 1) u pi / 16), scaled by the normalization for u.
+    let mut basis = [[0.0; 8]; 8];
+    for (x, row) in basis.iter_mut().enumerate() {
+        for (u, value) in row.iter_mut().enumerate() {
+            let scale = if u == 0 { consts::FRAC_1_SQRT_2 } else { 1.0 };
+            *value = scale * (((2 * x + 1) * u) as f64 * consts::PI / 16.0).cos();
+        }
+    }
+
+    // transform the rows, then the columns.
+    let mut rows = [0.0; 64];
+    for v in 0..8 {
+        for x in 0..8 {
+            rows[v * 8 + x] = (0..8)
+                .map(|u| basis[x][u] * coefficients[v * 8 + u])
+                .sum::<f64>()
+                / 2.0;
+        }
+    }
+    for y in 0..8 {
+        for x in 0..8 {
+            let value = (0..8).map(|v| basis[y][v] * rows[v * 8 + x]).sum::<f64>() / 2.0;
+            out[y * stride + x] = (value + 128.0).round().max(0.0).min(255.0) as u8;
+        }
+    }
+}
+
+/// combines the components into colors, stretching those which were stored at a
+/// lower resolution.
+fn to_canvas(components: &[Component], width: usize, height: usize, rgb: bool) -> Canvas {
+    let max_h = components.iter().map(|c| c.horizontal).max().unwrap_or(1);
+    let max_v = components.iter().map(|c| c.vertical).max().unwrap_or(1);
+    let sample = |c: &Component, x: usize, y: usize| -> f64 {
+        let (x, y) = (x * c.horizontal / max_h, y * c.vertical / max_v);
+        c.samples[y * c.columns * 8 + x] as f64
+    };
+
+    Canvas::from_fn(width, height, |x, y| {
+        let color = if components.len() == 1 {
+            let gray = sample(&components[0], x, y);
+            [gray, gray, gray]
+        } else if rgb {
+            [
+                sample(&components[0], x, y),
+                sample(&components[1], x, y),
+                sample(&components[2], x, y),
+            ]
+        } else {
+            let luma = sample(&components[0], x, y);
+            let blue = sample(&components[1], x, y) - 128.0;
+            let red = sample(&components[2], x, y) - 128.0;
+            [
+                luma + 1.402 * red,
+                luma - 0.344_136 * blue - 0.714_136 * red,
+                luma + 1.772 * blue,
+            ]
+        };
+        let channel = |value: f64| value.max(0.0).min(255.0) / 255.0;
+        Color::new(channel(color[0]), channel(color[1]), channel(color[2]))
+    })
+}
@@ -0,0 +1,311 @@
+use super::{inflate, Canvas};
+use crate::world::Color;
+
+/// the kinds of pixels that a png image can have.
+#[derive(Copy, Clone, Debug, PartialEq)]
+enum Kind {
+    Gray,
+    Rgb,
+    Palette,
+    GrayAlpha,
+    Rgba,
+}
+
+impl Kind {
+    fn channels(&self) -> usize {
+        match self {
+            Kind::Gray | Kind::Palette => 1,
+            Kind::GrayAlpha => 2,
+            Kind::Rgb => 3,
+            Kind::Rgba => 4,
+        }
+    }
+}
+
+/// where each pass of an interlaced image starts, and how far apart its pixels are,
+/// as `(x, y, dx, dy)`.
+const ADAM7: [(usize, usize, usize, usize); 7] = [
+    (0, 0, 8, 8),
+    (4, 0, 8, 8),
+    (0, 4, 4, 8),
+    (2, 0, 4, 4),
+    (0, 2, 2, 4),
+    (1, 0, 2, 2),
+    (0, 1, 1, 2),
+];
+
+/// reads a png image, with each channel scaled to [0, 1] but otherwise as it is
+/// stored, and the alpha of each pixel, row by row; see `Canvas::from_png`.
+pub fn decode(bytes: &[u8]) -> Result<(Canvas, Vec<f64>), String> {
+    if !bytes.starts_with(b"\x89PNG\r\n\x1a\n") {
+        return Err("missing png signature".to_string());
+    }
+
+    let mut header = None;
+    let mut palette = vec![];
+    let mut transparency = vec![];
+    let mut data = vec![];
+    let mut position = 8;
+    loop {
+        let length = be32(bytes, position)? as usize;
+        let kind = bytes
+            .get(position + 4..position + 8)
+            .ok_or_else(|| "file ends early".to_string())?;
+        let start = position + 8;
+        let chunk = start
+            .checked_add(length)
+            .and_then(|end| bytes.get(start..end))
+            .ok_or_else(|| "file ends early".to_string())?;
+        // skip the checksum, too.
+        position = start + length + 4;
+
+        match kind {
+            b"IHDR" => header = Some(Header::read(chunk)?),
+            b"PLTE" => palette = chunk.to_vec(),
+            b"tRNS" => transparency = chunk.to_vec(),
+            b"IDAT" => data.extend_from_slice(chunk),
+            b"IEND" => break,
+            // everything else is ancillary, and can be skipped.
+            _ => {}
+        }
+    }
+
+    let header = header.ok_or_else(|| "missing header".to_string())?;
+    let raw = inflate::zlib(&data)?;
+    header.pixels(&raw, &palette, &transparency)
+}
+
+fn be32(bytes: &[u8], at: usize) -> Result<u32, String> {
+    let b = bytes
+        .get(at..at + 4)
+        .ok_or_else(|| "file ends early".to_string())?;
+    Ok(u32::from_be_bytes([b[0], b[1], b[2], b[3]]))
+}
+
+struct Header {
+    width: usize,
+    height: usize,
+    depth: usize,
+    kind: Kind,
+    interlaced: bool,
+}
+
+impl Header {
+    fn read(chunk: &[u8]) -> Result<Header, String> {
+        if chunk.len() != 13 {
+            return Err("header has the wrong length".to_string());
+        }
+        let width = be32(chunk, 0)? as usize;
+        let height = be32(chunk, 4)? as usize;
+        if width == 0 || height == 0 {
+            return Err("image has no pixels".to_string());
+        }
+
+        let depth = chunk[8] as usize;
+        let kind = match chunk[9] {
+            0 => Kind::Gray,
+            2 => Kind::Rgb,
+            3 => Kind::Palette,
+            4 => Kind::GrayAlpha,
+            6 => Kind::Rgba,
+            other => return Err(format!("unknown color type {}", other)),
+        };
+        let allowed: &[usize] = match kind {
+            Kind::Gray => &[1, 2, 4, 8, 16],
+            Kind::Palette => &[1, 2, 4, 8],
+            _ => &[8, 16],
+        };
+        if !allowed.contains(&depth) {
+            return Err(format!("bit depth {} is not allowed here", depth));
+        }
+        if chunk[10] != 0 || chunk[11] != 0 {
+            return Err("unknown compression or filter method".to_string());
+        }
+        let interlaced = match chunk[12] {
+            0 => false,
+            1 => true,
+            other => return Err(format!("unknown interlace method {}", other)),
+        };
+
+        Ok(Header {
+            width,
+            height,
+            depth,
+            kind,
+            interlaced,
+        })
+    }
+
+    /// the canvas made of the decompressed image `data`, which is a series of passes
+    /// (or just one, if the image is not interlaced) of filtered rows, and the alpha
+    /// of each of its pixels.
+    fn pixels(
+        &self,
+        data: &[u8],
+        palette: &[u8],
+        transparency: &[u8],
+    ) -> Result<(Canvas, Vec<f64>), String> {
+        let bits = self.kind.channels() * self.depth;
+        // filters work on whole pixels, or on bytes if the pixels are smaller.
+        let stride = (bits / 8).max(1);
+        self.width
+            .checked_mul(self.height)
+            .filter(|&pixels| pixels <= data.len().saturating_mul(8))
+            .ok_or_else(|| "too few pixels".to_string())?;
+
+        let mut canvas = Canvas::new(self.width, self.height);
+        let mut alpha = vec![1.0; self.width * self.height];
+        let passes: &[(usize, usize, usize, usize)] = if self.interlaced {
+            &ADAM7
+        } else {
+            &[(0, 0, 1, 1)]
+        };
+
+        let mut position = 0;
+        for &(x0, y0, dx, dy) in passes {
+            let columns = (self.width + dx - 1).saturating_sub(x0) / dx;
+            let rows = (self.height + dy - 1).saturating_sub(y0) / dy;
+            if columns == 0 || rows == 0 {
+                continue;
+            }
+
+            let row_length = (columns * bits + 7) / 8;
+            let mut previous = vec![0; row_length];
+            for row in 0..rows {
+                let filter = *data
+                    .get(position)
+                    .ok_or_else(|| "too few pixels".to_string())?;
+                let mut line = data
+                    .get(position + 1..position + 1 + row_length)
+                    .ok_or_else(|| "too few pixels".to_string())?
+                    .to_vec();
+                position += 1 + row_length;
+                unfilter(filter, &mut line, &previous, stride)?;
+
+                for column in 0..columns {
+                    let (x, y) = (x0 + column * dx, y0 + row * dy);
+                    let (color, opacity) = self.color(&line, column, palette, transparency)?;
+                    canvas[(x, y)] = color;
+                    alpha[y * self.width + x] = opacity;
+                }
+                previous = line;
+            }
+        }
+
+        Ok((canvas, alpha))
+    }
+
+    /// the color and alpha of the pixel in `column` of an unfiltered row. images
+    /// without an alpha channel may still give the alpha of each palette entry, or a
+    /// single color which is transparent, in their `transparency` chunk.
+    fn color(
+        &self,
+        line: &[u8],
+        column: usize,
+        palette: &[u8],
+        transparency: &[u8],
+    ) -> Result<(Color, f64), String> {
+        let channels = self.kind.channels();
+        let max = ((1u32 << self.depth) - 1) as f64;
+        let sample = |channel: usize| -> f64 {
+            let i = column * channels + channel;
+            let value = match self.depth {
+                16 => u16::from_be_bytes([line[i * 2], line[i * 2 + 1]]) as u32,
+                8 => line[i] as u32,
+                depth => {
+                    // smaller samples are packed into bytes, highest bits first.
+                    let bit = i * depth;
+                    let shift = 8 - depth - bit % 8;
+                    (line[bit / 8] >> shift) as u32 & ((1 << depth) - 1)
+                }
+            };
+            value as f64
+        };
+
+        // whether the first samples of the pixel are those of the transparent color.
+        let is_transparent = |channels: usize| {
+            transparency.len() == channels * 2
+                && (0..channels).all(|channel| {
+                    let key = u16::from_be_bytes([
+                        transparency[channel * 2],
+                        transparency[channel * 2 + 1],
+                    ]);
+                    sample(channel) == key as f64
+                })
+        };
+        let opaque_unless = |transparent: bool| if transparent { 0.0 } else { 1.0 };
+
+        Ok(match self.kind {
+            Kind::Gray | Kind::GrayAlpha => {
+                let gray = sample(0) / max;
+                let alpha = match self.kind {
+                    Kind::GrayAlpha => sample(1) / max,
+                    _ => opaque_unless(is_transparent(1)),
+                };
+                (Color::new(gray, gray, gray), alpha)
+            }
+            Kind::Rgb | Kind::Rgba => {
+                let alpha = match self.kind {
+                    Kind::Rgba => sample(3) / max,
+                    _ => opaque_unless(is_transparent(3)),
+                };
+                (
+                    Color::new(sample(0) / max, sample(1) / max, sample(2) / max),
+                    alpha,
+                )
+            }
+            Kind::Palette => {
+                let index = sample(0) as usize;
+                let entry = palette
+                    .get(index * 3..index * 3 + 3)
+                    .ok_or_else(|| "color is not in the palette".to_string())?;
+                // entries past the end of the chunk are opaque.
+                let alpha = transparency
+                    .get(index)
+                    .map_or(1.0, |&alpha| alpha as f64 / 255.0);
+                (
+                    Color::new(
+                        entry[0] as f64 / 255.0,
+                        entry[1] as f64 / 255.0,
+                        entry[2] as f64 / 255.0,
+                    ),
+                    alpha,
+                )
+            }
+        })
+    }
+}
+
+/// undoes the `filter` of a row, given the unfiltered row above it. each byte is
+/// predicted from the bytes `stride` before it in its row, above it, or both.
+fn unfilter(filter: u8, line: &mut [u8], previous: &[u8], stride: usize) -> Result<(), String> {
+    for i in 0..line.len() {
+        let left = if i >= stride { line[i - stride] } else { 0 };
+        let up = previous[i];
+        let up_left = if i >= stride { previous[i - stride] } else { 0 };
+        let prediction = match filter {
+            0 => 0,
+            1 => left,
+            2 => up,
+            3 => ((left as u16 + up as u16) / 2) as u8,
+            4 => paeth(left, up, up_left),
+            other => return Err(format!("unknown filter type {}", other)),
+        };
+        line[i] = line[i].wrapping_add(prediction);
+    }
+    Ok(())
+}
+
+/// whichever of the neighbors is closest to `left + up - up_left`.
+fn paeth(left: u8, up: u8, up_left: u8) -> u8 {
+    let (a, b, c) = (left as i16, up as i16, up_left as i16);
+    let p = a + b - c;
+    let (pa, pb, pc) = ((p - a).abs(), (p - b).abs(), (p - c).abs());
+    if pa <= pb && pa <= pc {
+        left
+    } else if pb <= pc {
+        up
+    } else {
+        up_left
+    }
+}
@@ -0,0 +1,49 @@
+use std::collections::BTreeSet;
+
+/// what has changed in a world since its changes were last taken, so that whatever
+/// is cached about the world (such as the boxes around its objects) can be brought up
+/// to date without starting over. see `World::take_changes`.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Changes {
+    /// the indices of the objects which were moved or replaced.
+    pub objects: BTreeSet<usize>,
+    /// whether objects were added or removed, which moves the objects after them to
+    /// other indices, so that anything kept by index must be rebuilt.
+    pub membership: bool,
+}
+
+impl Changes {
+    pub fn is_empty(&self) -> bool {
+        self.objects.is_empty() && !self.membership
+    }
+
+    /// records that the object at `index` was moved or replaced.
+    pub fn object(&mut self, index: usize) {
+        self.objects.insert(index);
+    }
+
+    /// records that objects were added or removed.
+    pub fn membership(&mut self) {
+        self.membership = true;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn recording_changes() {
+        let mut changes = Changes::default();
+        assert!(changes.is_empty());
+        changes.object(3);
+        changes.object(1);
+        changes.object(3);
+        assert_eq!(changes.objects.iter().copied().collect::<Vec<_>>(), [1, 3]);
+        assert!(!changes.membership);
+
+        let mut added = Changes::default();
+        added.membership();
+        assert!(!added.is_empty());
+    }
+}
@@ -0,0 +1,164 @@
+use crate::{
+    math::{Form, Geometry, Matrix, Point, Transformable, Vector, EPSILON},
+    world::{Intersection, Intersections, Material, Ray},
+};
+
+/// a plane which cuts away everything on one side of it, for cutaway views. the
+/// objects are cut open, so the rays see into them; a `cap` covers the cut faces of
+/// the objects with a flat material instead, as if they were solid.
+///
+/// capping only works for objects which are closed, such as spheres, since the cut
+/// face is found where the plane is inside of an object: where a ray leaving the
+/// plane passes through the object's surface an odd number of times.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Clip {
+    pub point: Point,
+    /// points towards the side which is cut away.
+    pub normal: Vector,
+    pub cap: Option<Material>,
+}
+
+impl Clip {
+    /// cuts away everything on the side of the plane through `point` which `normal`
+    /// points towards.
+    pub fn new(point: Point, normal: Vector) -> Clip {
+        Clip {
+            point,
+            normal: normal.normalized(),
+            cap: None,
+        }
+    }
+
+    pub fn with_cap(self, cap: Material) -> Clip {
+        Clip {
+            cap: Some(cap),
+            ..self
+        }
+    }
+
+    /// whether `point` is on the side which is cut away.
+    pub fn cuts(&self, point: Point) -> bool {
+        (point - self.point).dot(&self.normal) > 0.0
+    }
+
+    /// the intersections of `ray` with `object` which are not cut away, along with
+    /// the cap, if the ray enters the object through the cut face.
+    pub fn apply(&self, ray: Ray, object: &Geometry, hits: Intersections) -> Option<Intersections> {
+        let mut kept: Vec<Intersection> = hits
+            .iter()
+            .filter(|hit| !self.cuts(ray.at(hit.time)))
+            .cloned()
+            .collect();
+
+        if let Some(ref cap) = self.cap {
+            let facing = ray.direction.dot(&self.normal);
+            let time = (self.point - ray.origin).dot(&self.normal) / facing;
+            if facing.abs() > EPSILON && time > 0.0 {
+                let beyond = hits.iter().filter(|hit| hit.time > time).count();
+                if beyond % 2 == 1 {
+                    let face = Geometry::default()
+                        .with_form(Form::Plane)
+                        .with_material(cap.clone())
+                        .with_visibility(object.visibility)
+                        .transformed(self.placement());
+                    kept.push(Intersection::new(time, ray, face));
+                }
+            }
+        }
+
+        if kept.is_empty() {
+            None
+        } else {
+            Some(Intersections::with(kept))
+        }
+    }
+
+    /// moves the xz plane onto the clipping plane.
+    fn placement(&self) -> Matrix {
+        let up = Vector::new(0.0, 1.0, 0.0);
+        let cosine = up.dot(&self.normal);
+        let rotation = if cosine > 1.0 - EPSILON {
+            Matrix::identity()
+        } else if cosine < EPSILON - 1.0 {
+            Matrix::rotation_x(std::f64::consts::PI)
+        } else {
+            Matrix::rotation(up.cross(&self.normal), cosine.acos())
+        };
+
+        Matrix::translation(self.point[0], self.point[1], self.point[2]) * rotation
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{
+        math::Hittable,
+        world::{Color, Pattern, Texture, World},
+    };
+
+    fn ray() -> Ray {
+        Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0))
+    }
+
+    #[test]
+    fn cutting_points() {
+        let clip = Clip::new(Point::new(0.0, 0.0, 0.5), Vector::new(0.0, 0.0, -2.0));
+        assert_eq!(clip.normal, Vector::new(0.0, 0.0, -1.0));
+        assert!(clip.cuts(Point::new(0.0, 0.0, -1.0)));
+        assert!(!clip.cuts(Point::new(0.0, 0.0, 1.0)));
+    }
+
+    #[test]
+    fn cutting_away_front_of_sphere() {
+        let sphere = Geometry::default().with_form(Form::Sphere);
+        let clip = Clip::new(Point::zero(), Vector::new(0.0, 0.0, -1.0));
+        let hits = clip
+            .apply(ray(), &sphere, sphere.hit(ray()).unwrap())
+            .unwrap();
+        let times: Vec<f64> = hits.iter().map(|hit| hit.time).collect();
+        assert_eq!(times, [6.0]);
+
+        let clip = Clip::new(Point::new(0.0, 0.0, -2.0), Vector::new(0.0, 0.0, 1.0));
+        assert!(clip
+            .apply(ray(), &sphere, sphere.hit(ray()).unwrap())
+            .is_none());
+    }
+
+    #[test]
+    fn capping_cut_face() {
+        let sphere = Geometry::default().with_form(Form::Sphere);
+        let cap =
+            Material::default().with_texture(Texture::pattern(Pattern::solid(Color::white())));
+        let clip = Clip::new(Point::zero(), Vector::new(0.0, 0.0, -1.0)).with_cap(cap.clone());
+        let hits = clip
+            .apply(ray(), &sphere, sphere.hit(ray()).unwrap())
+            .unwrap();
+        let closest = hits.closest().unwrap();
+        assert_eq!(closest.time, 5.0);
+        assert_eq!(closest.object.material, cap);
+        let normal = closest.object.normal_at(ray().at(5.0)).unwrap();
+        assert_eq!(normal, Vector::new(0.0, 0.0, -1.0));
+
+        // the plane is not inside a sphere which lies wholly beyond it.
+        let beyond = sphere.transformed(Matrix::translation(0.0, 0.0, 3.0));
+        let hits = clip
+            .apply(ray(), &beyond, beyond.hit(ray()).unwrap())
+            .unwrap();
+        let times: Vec<f64> = hits.iter().map(|hit| hit.time).collect();
+        assert_eq!(times, [7.0, 9.0]);
+    }
+
+    #[test]
+    fn clipping_world() {
+        let mut world = World::default();
+        world.clip = Some(Clip::new(Point::zero(), Vector::new(0.0, 0.0, -1.0)));
+        let times: Vec<f64> = world.hit(ray()).unwrap().iter().map(|i| i.time).collect();
+        assert_eq!(times, [5.5, 6.0]);
+
+        world.clip = world.clip.map(|clip| clip.with_cap(Material::default()));
+        let hit = world.hit(ray()).unwrap().closest().unwrap();
+        assert_eq!(hit.time, 5.0);
+        assert_eq!(hit.object_index, 0);
+    }
+}
@@ -1,5 +1,5 @@
 use std::{
-    f64,
+    error, f64,
     fmt::{self, Display, Formatter},
     ops::{Add, AddAssign, Div, DivAssign, Index, IndexMut, Mul, MulAssign, Neg, Sub, SubAssign},
 };
@@ -17,6 +17,19 @@ impl Color {
         Color(Vector::new(r, g, b))
     }
 
+    /// like `new`, but fails if any component is nan or infinite.
+    pub fn try_new(r: f64, g: f64, b: f64) -> Result<Color, NonFiniteColorError> {
+        if r.is_finite() && g.is_finite() && b.is_finite() {
+            Ok(Color::new(r, g, b))
+        } else {
+            Err(NonFiniteColorError {
+                red: r,
+                green: g,
+                blue: b,
+            })
+        }
+    }
+
     pub fn from_vector(vector: Vector) -> Color {
         Color(vector)
     }
@@ -40,35 +53,62 @@ impl Color {
     pub fn blue(&self) -> f64 {
         self.0[2]
     }
+
+    /// raises each component to the power of `exponent`.
+    pub fn powf(&self, exponent: f64) -> Color {
+        Color::new(
+            self.red().powf(exponent),
+            self.green().powf(exponent),
+            self.blue().powf(exponent),
+        )
+    }
+
+    /// clamps each component into `[0, 1]` and maps it onto the integers between
+    /// `MIN_COLOR` and `MAX_COLOR`, as written to an image file.
+    pub fn quantized(&self) -> [u8; 3] {
+        let channel = |c: f64| {
+            change_interval(
+                clamp_between(c, 0.0, 1.0),
+                (0.0, 1.0),
+                (MIN_COLOR, MAX_COLOR),
+            )
+            .round() as u8
+        };
+        [
+            channel(self.red()),
+            channel(self.green()),
+            channel(self.blue()),
+        ]
+    }
 }
 
 impl Display for Color {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        let [r, g, b] = self.quantized();
+        write!(f, "{} {} {}", r, g, b)
+    }
+}
+
+/// returned when making a color with a component which is nan or infinite.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct NonFiniteColorError {
+    pub red: f64,
+    pub green: f64,
+    pub blue: f64,
+}
+
+impl Display for NonFiniteColorError {
     fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
         write!(
             f,
-            "{} {} {}",
-            change_interval(
-                clamp_between(self.red(), 0.0, 1.0),
-                (0.0, 1.0),
-                (MIN_COLOR, MAX_COLOR)
-            )
-            .round() as i64,
-            change_interval(
-                clamp_between(self.green(), 0.0, 1.0),
-                (0.0, 1.0),
-                (MIN_COLOR, MAX_COLOR)
-            )
-            .round() as i64,
-            change_interval(
-                clamp_between(self.blue(), 0.0, 1.0),
-                (0.0, 1.0),
-                (MIN_COLOR, MAX_COLOR)
-            )
-            .round() as i64,
+            "color components must be finite, got ({}, {}, {})",
+            self.red, self.green, self.blue
         )
     }
 }
 
+impl error::Error for NonFiniteColorError {}
+
 /* indexing operations */
 
 impl Index<usize> for Color {
@@ -169,6 +209,26 @@ impl Mul for Color {
 mod tests {
     use super::*;
 
+    #[test]
+    fn create_checked_color() {
+        assert_eq!(Color::try_new(0.5, 0.0, 2.0), Ok(Color::new(0.5, 0.0, 2.0)));
+        assert!(Color::try_new(f64::NAN, 0.0, 0.0).is_err());
+        assert_eq!(
+            Color::try_new(0.0, f64::INFINITY, 0.0),
+            Err(NonFiniteColorError {
+                red: 0.0,
+                green: f64::INFINITY,
+                blue: 0.0
+            })
+        );
+        assert_eq!(
+            Color::try_new(0.0, f64::INFINITY, 0.0)
+                .unwrap_err()
+                .to_string(),
+            "color components must be finite, got (0, inf, 0)"
+        );
+    }
+
     #[test]
     fn colors_are_vectors() {
         let c = Color::new(-0.5, 0.4, 1.7);
@@ -203,4 +263,11 @@ mod tests {
         let c2 = Color::new(0.9, 1.0, 0.1);
         assert_eq!(c1 * c2, Color::new(0.9, 0.2, 0.04));
     }
+
+    #[test]
+    fn raise_color_to_power() {
+        let c = Color::new(0.5, 1.0, 0.2);
+        assert_eq!(c.powf(2.0), Color::new(0.25, 1.0, 0.04));
+        assert_eq!(c.powf(0.0), Color::white());
+    }
 }
@@ -1,24 +1,47 @@
-use std::{
-    cmp::{Ordering, Reverse},
-    collections::BinaryHeap,
-};
+use std::{cmp::Ordering, mem, ptr};
 
 use crate::{
     math::{Geometry, Hittable, Point, Vector, EPSILON},
     world::{Material, Ray},
 };
 
-#[derive(Copy, Clone, Debug)]
+/// everything about a hit which is needed to shade it, worked out in one place.
+#[derive(Clone, Debug)]
 pub struct Computations {
+    /// where the ray hit the surface.
     pub point: Point,
+    /// the point, nudged off the surface on the side the ray came from, so that rays
+    /// cast from it (such as to the lights) do not hit the surface they start on,
+    /// which would speckle it with shadow ("shadow acne").
+    pub over_point: Point,
+    /// the point, nudged just under the surface, where rays passing through the
+    /// surface start.
+    pub under_point: Point,
     pub to_eye: Vector,
+    /// the normal on the side of the surface the ray came from.
     pub surface_normal: Vector,
+    /// the direction of the ray once it is reflected by the surface.
+    pub reflect_vector: Vector,
     pub is_inside: bool,
     pub material: Material,
+    /// the surface coordinates of the point, if the object has them.
+    pub uv: Option<(f64, f64)>,
+    /// the refractive indices of what the ray is passing out of and into. these are
+    /// both 1 (the index of a vacuum) unless the computations are made `within` the
+    /// rest of the ray's intersections.
+    pub n1: f64,
+    pub n2: f64,
 }
 
 impl Computations {
     pub fn new(intersection: &Intersection) -> Computations {
+        Computations::with_offset(intersection, EPSILON)
+    }
+
+    /// like `new`, but the over and under points are nudged by `offset` rather than
+    /// by `EPSILON`. a larger offset suits scenes whose objects are very large (or
+    /// far away), where rounding errors grow beyond `EPSILON`.
+    pub fn with_offset(intersection: &Intersection, offset: f64) -> Computations {
         let point = intersection.ray.at(intersection.time);
         let to_eye = -intersection.ray.direction;
 
@@ -30,30 +53,158 @@ impl Computations {
         }
 
         Computations {
-            point: point + (surface_normal * EPSILON),
+            point,
+            over_point: point + (surface_normal * offset),
+            under_point: point - (surface_normal * offset),
             to_eye,
             surface_normal,
+            reflect_vector: intersection.ray.direction.reflect_across(surface_normal),
             is_inside,
-            material: intersection.object.material,
+            material: intersection.object.material.at(point, intersection.uv),
+            uv: intersection.uv,
+            n1: 1.0,
+            n2: 1.0,
         }
     }
+
+    /// like `with_offset`, but finds the refractive indices on either side of the
+    /// surface from the objects that the ray is inside of there, which are worked out
+    /// from the rest of its `intersections`.
+    pub fn within(
+        intersection: &Intersection,
+        intersections: &Intersections,
+        offset: f64,
+    ) -> Computations {
+        let mut computations = Computations::with_offset(intersection, offset);
+
+        // the objects that the intersections are with, in the order the ray first
+        // meets them, so that each is known by its place here rather than compared
+        // in full again. objects at different indices in the world are different
+        // objects, however alike, so only those at the same index (such as the
+        // children of one group) need comparing.
+        let mut objects: Vec<&Intersection> = vec![];
+        let mut ids = Vec::with_capacity(intersections.count());
+        for other in intersections.iter() {
+            let id = objects.iter().position(|first| {
+                first.object_index == other.object_index && first.object == other.object
+            });
+            ids.push(id.unwrap_or_else(|| {
+                objects.push(other);
+                objects.len() - 1
+            }));
+        }
+
+        // the objects which the ray is inside of, innermost last. a ray enters an
+        // object at one intersection with it and leaves it at the next. since only the
+        // intersections ahead of the ray are known, the objects which it starts inside
+        // of are those it leaves first, and the last one it leaves is the outermost.
+        let leaving = |first: &Intersection| {
+            first
+                .object
+                .normal_at(first.ray.at(first.time))
+                .map_or(false, |normal| normal.dot(&first.ray.direction) > 0.0)
+        };
+        let mut containers: Vec<usize> = (0..objects.len())
+            .rev()
+            .filter(|&id| leaving(objects[id]))
+            .collect();
+
+        let index = |containers: &Vec<usize>| {
+            containers
+                .last()
+                .map_or(1.0, |&id| objects[id].object.material.refractive_index)
+        };
+        for (other, &id) in intersections.iter().zip(ids.iter()) {
+            // the intersection is usually one of these, and then needn't be compared.
+            let is_hit = ptr::eq(other, intersection)
+                || (other.time == intersection.time && other.object == intersection.object);
+            if is_hit {
+                computations.n1 = index(&containers);
+            }
+
+            match containers.iter().rposition(|&container| container == id) {
+                Some(i) => {
+                    containers.remove(i);
+                }
+                None => containers.push(id),
+            }
+
+            if is_hit {
+                computations.n2 = index(&containers);
+                break;
+            }
+        }
+
+        computations
+    }
+
+    /// the fraction of the light which is reflected rather than refracted at the
+    /// surface, by schlick's approximation of the fresnel equations.
+    pub fn schlick(&self) -> f64 {
+        let mut cos = self.to_eye.dot(&self.surface_normal);
+
+        // there is total internal reflection when leaving a denser material at too
+        // shallow an angle.
+        if self.n1 > self.n2 {
+            let ratio = self.n1 / self.n2;
+            let sin2_t = ratio * ratio * (1.0 - cos * cos);
+            if sin2_t > 1.0 {
+                return 1.0;
+            }
+            cos = (1.0 - sin2_t).sqrt();
+        }
+
+        let r0 = ((self.n1 - self.n2) / (self.n1 + self.n2)).powi(2);
+        r0 + (1.0 - r0) * (1.0 - cos).powi(5)
+    }
 }
 
-#[derive(Copy, Clone, Debug)]
+#[derive(Clone, Debug)]
 pub struct Intersection {
     pub time: f64,
     pub ray: Ray,
     pub object: Geometry,
+    /// the index in the world of the object which was hit, which identifies it. for
+    /// the children of a group, this is the index of the group.
+    pub object_index: usize,
+    /// the coordinates `(u, v)` of the intersection on the object's surface, which are
+    /// each between 0 and 1.
+    pub uv: Option<(f64, f64)>,
 }
 
 impl Intersection {
     pub fn new(time: f64, ray: Ray, object: Geometry) -> Intersection {
-        Intersection { time, ray, object }
+        Intersection {
+            time,
+            ray,
+            object,
+            object_index: 0,
+            uv: None,
+        }
+    }
+
+    pub fn with_uv(self, u: f64, v: f64) -> Intersection {
+        Intersection {
+            uv: Some((u, v)),
+            ..self
+        }
     }
 
     pub fn compute(&self) -> Computations {
         Computations::new(self)
     }
+
+    /// like `compute`, with the over and under points nudged by `offset`; see
+    /// `Computations::with_offset`.
+    pub fn compute_with_offset(&self, offset: f64) -> Computations {
+        Computations::with_offset(self, offset)
+    }
+
+    /// like `compute`, with the refractive indices found from the rest of the ray's
+    /// `intersections`; see `Computations::within`.
+    pub fn compute_within(&self, intersections: &Intersections, offset: f64) -> Computations {
+        Computations::within(self, intersections, offset)
+    }
 }
 
 /// HACK: this would imply that two different intersections are equal
@@ -71,68 +222,121 @@ impl Eq for Intersection {}
 
 impl PartialOrd for Intersection {
     fn partial_cmp(&self, other: &Self) -> Option<Ordering> {
-        self.time.partial_cmp(&other.time)
+        Some(self.cmp(other))
     }
 }
 
 impl Ord for Intersection {
     fn cmp(&self, other: &Self) -> Ordering {
-        self.time.partial_cmp(&other.time).unwrap()
+        self.time.total_cmp(&other.time)
     }
 }
 
-#[derive(Clone, Debug)]
+/// the intersections of a ray, kept sorted by time so that the closest ones can be
+/// found (or skipped past) by binary search. only intersections in front of the ray,
+/// at positive times, are kept.
+#[derive(Clone, Debug, Default)]
 pub struct Intersections {
-    pub heap: BinaryHeap<Reverse<Intersection>>,
-}
-
-impl Default for Intersections {
-    fn default() -> Intersections {
-        Intersections::new(BinaryHeap::new())
-    }
+    sorted: Vec<Intersection>,
+    /// the index of the closest intersection which has not been popped. popping moves
+    /// this forward rather than shifting the rest of the intersections down.
+    head: usize,
 }
 
 impl Intersections {
-    pub fn new(heap: BinaryHeap<Reverse<Intersection>>) -> Intersections {
-        Intersections { heap }
-    }
-
     pub fn with(intersections: Vec<Intersection>) -> Intersections {
-        let mut result = Intersections::default();
+        let mut sorted: Vec<Intersection> = intersections
+            .into_iter()
+            .filter(|intersection| intersection.time > 0.0)
+            .collect();
+        sorted.sort_by(|a, b| a.time.total_cmp(&b.time));
 
-        for intersection in intersections {
-            result.insert(intersection);
-        }
-
-        result
+        Intersections { sorted, head: 0 }
     }
 
+    /// adds the intersection where it belongs in time, after any others at the same time.
     pub fn insert(&mut self, intersection: Intersection) -> &mut Intersections {
         if intersection.time > 0.0 {
-            self.heap.push(Reverse(intersection));
+            let i = self.head + self.index_after(intersection.time);
+            self.sorted.insert(i, intersection);
         }
 
         self
     }
 
-    pub fn closest(&self) -> Option<Intersection> {
-        if let Some(&Reverse(intersection)) = self.heap.peek() {
-            Some(intersection)
-        } else {
-            None
+    /// adds all of `other`'s intersections, after any of these at the same times.
+    pub fn merge(&mut self, other: Intersections) -> &mut Intersections {
+        let mut mine = mem::take(&mut self.sorted)
+            .into_iter()
+            .skip(self.head)
+            .peekable();
+        let mut theirs = other.sorted.into_iter().skip(other.head).peekable();
+        let mut sorted = Vec::with_capacity(mine.len() + theirs.len());
+
+        loop {
+            let next = match (mine.peek(), theirs.peek()) {
+                (Some(a), Some(b)) if b.time < a.time => theirs.next(),
+                (Some(_), _) => mine.next(),
+                (None, _) => theirs.next(),
+            };
+            match next {
+                Some(intersection) => sorted.push(intersection),
+                None => break,
+            }
         }
+
+        self.sorted = sorted;
+        self.head = 0;
+        self
+    }
+
+    /// the closest intersection, which is the one that the ray hits.
+    pub fn closest(&self) -> Option<Intersection> {
+        self.remaining().first().cloned()
+    }
+
+    /// the closest intersection strictly after `time`.
+    pub fn hit_after(&self, time: f64) -> Option<Intersection> {
+        self.remaining().get(self.index_after(time)).cloned()
+    }
+
+    /// the intersections strictly between the times `t_min` and `t_max`, in order.
+    pub fn between(&self, t_min: f64, t_max: f64) -> &[Intersection] {
+        let remaining = self.remaining();
+        let start = self.index_after(t_min);
+        let end = remaining.partition_point(|i| i.time < t_max).max(start);
+        &remaining[start..end]
+    }
+
+    /// the intersections which have not been popped.
+    fn remaining(&self) -> &[Intersection] {
+        &self.sorted[self.head..]
+    }
+
+    /// the index among the remaining intersections of the first strictly after `time`.
+    fn index_after(&self, time: f64) -> usize {
+        self.remaining().partition_point(|i| i.time <= time)
     }
 
     pub fn count(&self) -> usize {
-        self.heap.len()
+        self.remaining().len()
     }
 
-    pub fn pop(&mut self) -> Option<Intersection> {
-        if let Some(Reverse(intersection)) = self.heap.pop() {
-            Some(intersection)
-        } else {
-            None
-        }
+    pub fn is_empty(&self) -> bool {
+        self.remaining().is_empty()
+    }
+
+    /// the intersections in order of time.
+    pub fn iter(&self) -> impl Iterator<Item = &Intersection> {
+        self.remaining().iter()
+    }
+
+    /// removes the closest intersection, and lends it out. it is only skipped past
+    /// rather than moved, so it lives for as long as these intersections do.
+    pub fn pop(&mut self) -> Option<&Intersection> {
+        let intersection = self.sorted.get(self.head)?;
+        self.head += 1;
+        Some(intersection)
     }
 }
 
@@ -145,7 +349,7 @@ mod tests {
     fn intersection_encapsulates_object() {
         let s = Geometry::default().with_form(Form::Sphere);
         let r = Ray::new(Point::zero(), Vector::zero());
-        let i = Intersection::new(3.5, r, s);
+        let i = Intersection::new(3.5, r, s.clone());
         assert_eq!(i.time, 3.5);
         assert_eq!(i.object, s);
     }
@@ -154,9 +358,9 @@ mod tests {
     fn aggregating_intersections() {
         let s = Geometry::default().with_form(Form::Sphere);
         let r = Ray::new(Point::zero(), Vector::zero());
-        let i1 = Intersection::new(1.0, r, s);
-        let i2 = Intersection::new(2.0, r, s);
-        let mut xs = Intersections::with(vec![i2, i1]);
+        let i1 = Intersection::new(1.0, r, s.clone());
+        let i2 = Intersection::new(2.0, r, s.clone());
+        let mut xs = Intersections::with(vec![i2.clone(), i1.clone()]);
         assert_eq!(xs.count(), 2);
         assert_eq!(xs.pop().unwrap().time, i1.time);
         assert_eq!(xs.pop().unwrap().time, i2.time);
@@ -176,9 +380,9 @@ mod tests {
     fn closest_hit_multiple_options() {
         let s = Geometry::default().with_form(Form::Sphere);
         let r = Ray::new(Point::zero(), Vector::zero());
-        let i1 = Intersection::new(1.0, r, s);
-        let i2 = Intersection::new(2.0, r, s);
-        let xs = Intersections::with(vec![i1, i2]);
+        let i1 = Intersection::new(1.0, r, s.clone());
+        let i2 = Intersection::new(2.0, r, s.clone());
+        let xs = Intersections::with(vec![i1.clone(), i2]);
         assert_eq!(xs.closest().unwrap(), i1);
     }
 
@@ -186,9 +390,9 @@ mod tests {
     fn closest_hit_one_option() {
         let s = Geometry::default().with_form(Form::Sphere);
         let r = Ray::new(Point::zero(), Vector::zero());
-        let i1 = Intersection::new(-1.0, r, s);
-        let i2 = Intersection::new(1.0, r, s);
-        let xs = Intersections::with(vec![i1, i2]);
+        let i1 = Intersection::new(-1.0, r, s.clone());
+        let i2 = Intersection::new(1.0, r, s.clone());
+        let xs = Intersections::with(vec![i1, i2.clone()]);
         assert_eq!(xs.closest().unwrap(), i2);
     }
 
@@ -196,8 +400,8 @@ mod tests {
     fn closest_hit_no_options() {
         let s = Geometry::default().with_form(Form::Sphere);
         let r = Ray::new(Point::zero(), Vector::zero());
-        let i1 = Intersection::new(-1.0, r, s);
-        let i2 = Intersection::new(-2.0, r, s);
+        let i1 = Intersection::new(-1.0, r, s.clone());
+        let i2 = Intersection::new(-2.0, r, s.clone());
         let xs = Intersections::with(vec![i1, i2]);
         assert!(xs.closest().is_none());
     }
@@ -206,30 +410,127 @@ mod tests {
     fn closest_hit_has_lowest_nonnegative_time() {
         let s = Geometry::default().with_form(Form::Sphere);
         let r = Ray::new(Point::zero(), Vector::zero());
-        let i1 = Intersection::new(5.0, r, s);
-        let i2 = Intersection::new(7.0, r, s);
-        let i3 = Intersection::new(-3.0, r, s);
-        let i4 = Intersection::new(2.0, r, s);
-        let xs = Intersections::with(vec![i1, i2, i3, i4]);
+        let i1 = Intersection::new(5.0, r, s.clone());
+        let i2 = Intersection::new(7.0, r, s.clone());
+        let i3 = Intersection::new(-3.0, r, s.clone());
+        let i4 = Intersection::new(2.0, r, s.clone());
+        let xs = Intersections::with(vec![i1, i2, i3, i4.clone()]);
         assert_eq!(xs.closest().unwrap(), i4);
     }
 
+    #[test]
+    fn insert_keeps_order() {
+        let s = Geometry::default().with_form(Form::Sphere);
+        let r = Ray::new(Point::zero(), Vector::zero());
+        let mut xs = Intersections::default();
+        for &time in [3.0, 1.0, -1.0, 2.0].iter() {
+            xs.insert(Intersection::new(time, r, s.clone()));
+        }
+        let times: Vec<f64> = xs.iter().map(|i| i.time).collect();
+        assert_eq!(times, [1.0, 2.0, 3.0]);
+    }
+
+    #[test]
+    fn nan_times_are_not_kept() {
+        let s = Geometry::default().with_form(Form::Sphere);
+        let r = Ray::new(Point::zero(), Vector::zero());
+        let xs = Intersections::with(vec![
+            Intersection::new(2.0, r, s.clone()),
+            Intersection::new(f64::NAN, r, s.clone()),
+            Intersection::new(1.0, r, s.clone()),
+        ]);
+        let times: Vec<f64> = xs.iter().map(|i| i.time).collect();
+        assert_eq!(times, [1.0, 2.0]);
+        assert!(Intersection::new(f64::NAN, r, s.clone()) > Intersection::new(1.0, r, s));
+    }
+
+    #[test]
+    fn merge_keeps_order() {
+        let s = Geometry::default().with_form(Form::Sphere);
+        let p = Geometry::default().with_form(Form::Plane);
+        let r = Ray::new(Point::zero(), Vector::zero());
+        let with = |times: &[f64], object: &Geometry| {
+            Intersections::with(
+                times
+                    .iter()
+                    .map(|&time| Intersection::new(time, r, object.clone()))
+                    .collect(),
+            )
+        };
+        let mut xs = with(&[1.0, 3.0, 5.0], &s);
+        let mut others = with(&[0.5, 2.0, 3.0, 6.0], &p);
+        xs.pop();
+        others.pop();
+        xs.merge(others);
+
+        let times: Vec<f64> = xs.iter().map(|i| i.time).collect();
+        assert_eq!(times, [2.0, 3.0, 3.0, 5.0, 6.0]);
+        // the merged intersections go after those at the same time.
+        assert_eq!(xs.between(2.5, 4.0)[0].object, s);
+        assert_eq!(xs.between(2.5, 4.0)[1].object, p);
+        assert_eq!(xs.count(), 5);
+    }
+
+    #[test]
+    fn pop_then_insert() {
+        let s = Geometry::default().with_form(Form::Sphere);
+        let r = Ray::new(Point::zero(), Vector::zero());
+        let mut xs = Intersections::default();
+        for &time in [1.0, 2.0, 3.0].iter() {
+            xs.insert(Intersection::new(time, r, s.clone()));
+        }
+        assert_eq!(xs.pop().unwrap().time, 1.0);
+        xs.insert(Intersection::new(1.5, r, s.clone()));
+        assert_eq!(xs.closest().unwrap().time, 1.5);
+        assert_eq!(xs.hit_after(1.5).unwrap().time, 2.0);
+        let times: Vec<f64> = xs.iter().map(|i| i.time).collect();
+        assert_eq!(times, [1.5, 2.0, 3.0]);
+    }
+
+    #[test]
+    fn hit_after_time() {
+        let s = Geometry::default().with_form(Form::Sphere);
+        let r = Ray::new(Point::zero(), Vector::zero());
+        let xs = Intersections::with(
+            [1.0, 2.0, 3.0]
+                .iter()
+                .map(|&time| Intersection::new(time, r, s.clone()))
+                .collect(),
+        );
+        assert_eq!(xs.hit_after(0.0).unwrap().time, 1.0);
+        assert_eq!(xs.hit_after(2.0).unwrap().time, 3.0);
+        assert!(xs.hit_after(3.0).is_none());
+        let between: Vec<f64> = xs.between(1.0, 3.5).iter().map(|i| i.time).collect();
+        assert_eq!(between, [2.0, 3.0]);
+        assert!(xs.between(3.0, 1.0).is_empty());
+    }
+
     #[test]
     fn compute_intersection_data() {
         let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
         let shape = Geometry::default().with_form(Form::Sphere);
-        let i = Intersection::new(4.0, r, shape);
+        let i = Intersection::new(4.0, r, shape.clone());
         let comps = i.compute();
         assert_eq!(comps.point, Point::new(0.0, 0.0, -1.0));
         assert_eq!(comps.to_eye, Vector::new(0.0, 0.0, -1.0));
         assert_eq!(comps.surface_normal, Vector::new(0.0, 0.0, -1.0));
     }
 
+    #[test]
+    fn compute_carries_surface_coordinates() {
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let shape = Geometry::default().with_form(Form::Sphere);
+        let i = Intersection::new(4.0, r, shape.clone());
+        assert_eq!(i.uv, None);
+        assert_eq!(i.compute().uv, None);
+        assert_eq!(i.with_uv(0.25, 0.5).compute().uv, Some((0.25, 0.5)));
+    }
+
     #[test]
     fn intersection_on_outside() {
         let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
         let shape = Geometry::default().with_form(Form::Sphere);
-        let i = Intersection::new(4.0, r, shape);
+        let i = Intersection::new(4.0, r, shape.clone());
         let comps = i.compute();
         assert_eq!(comps.is_inside, false);
     }
@@ -238,7 +539,7 @@ mod tests {
     fn intersection_on_inside() {
         let r = Ray::new(Point::zero(), Vector::new(0.0, 0.0, 1.0));
         let shape = Geometry::default().with_form(Form::Sphere);
-        let i = Intersection::new(1.0, r, shape);
+        let i = Intersection::new(1.0, r, shape.clone());
         let comps = i.compute();
         assert_eq!(comps.point, Point::new(0.0, 0.0, 1.0));
         assert_eq!(comps.to_eye, Vector::new(0.0, 0.0, -1.0));
@@ -252,8 +553,112 @@ mod tests {
         let shape = Geometry::default()
             .with_form(Form::Sphere)
             .transformed(Matrix::translation(0.0, 0.0, 1.0));
-        let i = Intersection::new(5.0, r, shape);
+        let i = Intersection::new(5.0, r, shape.clone());
+        let comps = i.compute();
+        assert!(comps.over_point[2] < (-EPSILON / 2.0));
+        assert!(comps.point[2] > comps.over_point[2]);
+    }
+
+    #[test]
+    fn intersection_offsets_under_point() {
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let shape = Geometry::default()
+            .with_form(Form::Sphere)
+            .transformed(Matrix::translation(0.0, 0.0, 1.0));
+        let i = Intersection::new(5.0, r, shape.clone());
         let comps = i.compute();
-        assert!(comps.point[2] < (-EPSILON / 2.0));
+        assert!(comps.under_point[2] > (EPSILON / 2.0));
+        assert!(comps.point[2] < comps.under_point[2]);
+    }
+
+    fn glass_sphere() -> Geometry {
+        let mut sphere = Geometry::default().with_form(Form::Sphere);
+        sphere.material.transparency = 1.0;
+        sphere.material.refractive_index = 1.5;
+        sphere
+    }
+
+    #[test]
+    fn refractive_indices_at_intersections() {
+        let mut a = glass_sphere().transformed(Matrix::scaling(2.0, 2.0, 2.0));
+        a.material.refractive_index = 1.5;
+        let mut b = glass_sphere().transformed(Matrix::translation(0.0, 0.0, -0.25));
+        b.material.refractive_index = 2.0;
+        let mut c = glass_sphere().transformed(Matrix::translation(0.0, 0.0, 0.25));
+        c.material.refractive_index = 2.5;
+
+        let r = Ray::new(Point::new(0.0, 0.0, -4.0), Vector::new(0.0, 0.0, 1.0));
+        let xs = Intersections::with(vec![
+            Intersection::new(2.0, r, a.clone()),
+            Intersection::new(2.75, r, b.clone()),
+            Intersection::new(3.25, r, c.clone()),
+            Intersection::new(4.75, r, b.clone()),
+            Intersection::new(5.25, r, c.clone()),
+            Intersection::new(6.0, r, a.clone()),
+        ]);
+        let expected = [
+            (1.0, 1.5),
+            (1.5, 2.0),
+            (2.0, 2.5),
+            (2.5, 2.5),
+            (2.5, 1.5),
+            (1.5, 1.0),
+        ];
+        for (i, &(n1, n2)) in xs.iter().zip(expected.iter()) {
+            let comps = i.compute_within(&xs, EPSILON);
+            assert_eq!((comps.n1, comps.n2), (n1, n2));
+        }
+    }
+
+    #[test]
+    fn schlick_under_total_internal_reflection() {
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 0.0, root), Vector::new(0.0, 1.0, 0.0));
+        let shape = glass_sphere();
+        // the ray starts inside the sphere.
+        let xs = Intersections::with(vec![Intersection::new(root, r, shape.clone())]);
+        let comps = Intersection::new(root, r, shape.clone()).compute_within(&xs, EPSILON);
+        assert_eq!((comps.n1, comps.n2), (1.5, 1.0));
+        assert_eq!(comps.schlick(), 1.0);
+    }
+
+    #[test]
+    fn schlick_with_perpendicular_ray() {
+        let r = Ray::new(Point::zero(), Vector::new(0.0, 1.0, 0.0));
+        let shape = glass_sphere();
+        let xs = Intersections::with(vec![Intersection::new(1.0, r, shape.clone())]);
+        let comps = Intersection::new(1.0, r, shape.clone()).compute_within(&xs, EPSILON);
+        assert!((comps.schlick() - 0.04).abs() < EPSILON);
+    }
+
+    #[test]
+    fn schlick_with_small_angle() {
+        let r = Ray::new(Point::new(0.0, 0.99, -2.0), Vector::new(0.0, 0.0, 1.0));
+        let shape = glass_sphere();
+        let xs = Intersections::with(vec![
+            Intersection::new(1.8589, r, shape.clone()),
+            Intersection::new(2.1411, r, shape.clone()),
+        ]);
+        let comps = Intersection::new(1.8589, r, shape.clone()).compute_within(&xs, EPSILON);
+        assert!((comps.schlick() - 0.48873).abs() < EPSILON);
+    }
+
+    #[test]
+    fn intersection_with_larger_offset() {
+        let r = Ray::new(Point::new(0.0, 0.0, -5.0), Vector::new(0.0, 0.0, 1.0));
+        let shape = Geometry::default().with_form(Form::Sphere);
+        let comps = Intersection::new(4.0, r, shape.clone()).compute_with_offset(0.1);
+        assert_eq!(comps.point, Point::new(0.0, 0.0, -1.0));
+        assert!((comps.over_point[2] + 1.1).abs() < EPSILON);
+        assert!((comps.under_point[2] + 0.9).abs() < EPSILON);
+    }
+
+    #[test]
+    fn compute_reflect_vector() {
+        let root = 2.0_f64.sqrt() / 2.0;
+        let r = Ray::new(Point::new(0.0, 1.0, -1.0), Vector::new(0.0, -root, root));
+        let shape = Geometry::default().with_form(Form::Plane);
+        let comps = Intersection::new(2.0_f64.sqrt(), r, shape.clone()).compute();
+        assert_eq!(comps.reflect_vector, Vector::new(0.0, root, root));
     }
 }
@@ -1,8 +1,11 @@
 use crate::{
     math,
-    world::{intersection::Computations, Color, Textured, World},
+    world::{intersection::Computations, Color, World},
 };
 
+pub mod falloff;
+pub use falloff::Falloff;
+
 pub mod point;
 pub use point::Point;
 
@@ -16,13 +19,40 @@ impl Light {
         Self::Point(point)
     }
 
+    /// the group that this light has been tagged with. lights which share a group
+    /// can be rendered together into their own canvas; see `Camera::render_light_groups`.
+    /// lights are in group 0 unless tagged otherwise.
+    pub fn group(&self) -> usize {
+        match self {
+            Self::Point(point) => point.group,
+        }
+    }
+
+    pub fn position(&self) -> math::Point {
+        match self {
+            Self::Point(point) => point.position,
+        }
+    }
+
+    pub fn color(&self) -> Color {
+        match self {
+            Self::Point(point) => point.color,
+        }
+    }
+
     pub fn illuminate(&self, world: &World, computations: &Computations) -> Color {
         let variant = match self {
             Self::Point(point) => point,
         };
 
+        // the color of the light once it has travelled to the point
+        let light_color = variant.color_at(world, computations.point);
         // combine the surface color with the light's color with respect to its intensity
-        let effective_color = computations.material.color_at(computations.point) * variant.color;
+        let effective_color = computations
+            .material
+            .texture
+            .color_at_uv(computations.point, computations.uv)
+            * light_color;
         // find the direction to the light source
         let to_light = (variant.position - computations.point).normalized();
         // compute the ambient contribution
@@ -40,23 +70,33 @@ impl Light {
             // light reflects away from the eye.
             let reflected_light = (-to_light).reflect_across(computations.surface_normal);
             let reflect_dot_eye = reflected_light.dot(&computations.to_eye);
-            if reflect_dot_eye <= 0.0 {
+            if let Some(anisotropy) = computations.material.anisotropy {
+                // an anisotropic highlight has its own shape, so it takes the place of
+                // the phong highlight entirely.
+                let factor =
+                    anisotropy.specular(computations.surface_normal, to_light, computations.to_eye);
+                (
+                    diffuse,
+                    light_color * computations.material.specular * factor,
+                )
+            } else if reflect_dot_eye <= 0.0 {
                 (diffuse, Color::new(0.0, 0.0, 0.0))
             } else {
                 // compute the specular contribution
                 let factor = reflect_dot_eye.powf(computations.material.shininess);
                 (
                     diffuse,
-                    variant.color * computations.material.specular * factor,
+                    light_color * computations.material.specular * factor,
                 )
             }
         } else {
             (Color::new(0.0, 0.0, 0.0), Color::new(0.0, 0.0, 0.0))
         };
 
-        if variant.casts_shade(world, computations.point) {
-            // the point is in the shadow cast by this light
-            ambient
+        if world.shadows {
+            // as much of the light as is not blocked on the way to the point
+            let transmittance = variant.transmittance(world, computations.over_point);
+            ambient + (diffuse + specular) * transmittance
         } else {
             // add the three contributions together to get the final shading
             ambient + diffuse + specular
@@ -68,4 +108,11 @@ impl Light {
             Self::Point(p) => p.casts_shade(world, point),
         }
     }
+
+    /// the fraction of the light which reaches `point`; see `Point::transmittance`.
+    pub fn transmittance(&self, world: &World, point: math::Point) -> Color {
+        match self {
+            Self::Point(p) => p.transmittance(world, point),
+        }
+    }
 }
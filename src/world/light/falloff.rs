@@ -0,0 +1,44 @@
+/// how the light from a light source diminishes as it travels away from the source.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Falloff {
+    /// the light's color is used as-is, no matter how far away it is. this is the
+    /// model used by "the ray tracer challenge".
+    Constant,
+    /// physically based falloff. the light's color is its intensity one unit away
+    /// from the source, and diminishes with the square of the distance beyond that.
+    InverseSquare,
+}
+
+impl Falloff {
+    /// the factor by which the light's color is multiplied after travelling `distance`.
+    pub fn attenuation(&self, distance: f64) -> f64 {
+        match self {
+            Falloff::Constant => 1.0,
+            Falloff::InverseSquare => 1.0 / (distance * distance),
+        }
+    }
+}
+
+impl Default for Falloff {
+    fn default() -> Falloff {
+        Falloff::Constant
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn constant_falloff() {
+        assert_eq!(Falloff::Constant.attenuation(0.5), 1.0);
+        assert_eq!(Falloff::Constant.attenuation(100.0), 1.0);
+    }
+
+    #[test]
+    fn inverse_square_falloff() {
+        assert_eq!(Falloff::InverseSquare.attenuation(1.0), 1.0);
+        assert_eq!(Falloff::InverseSquare.attenuation(2.0), 0.25);
+        assert_eq!(Falloff::InverseSquare.attenuation(10.0), 0.01);
+    }
+}
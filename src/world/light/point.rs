@@ -1,34 +1,121 @@
 use crate::{
     math,
-    world::{intersection::Computations, Color, Material, Ray, World},
+    math::{Geometry, Hittable},
+    world::{intersection::Computations, light::Falloff, Color, Material, Ray, World},
 };
 
 #[derive(Copy, Clone, Debug, PartialEq)]
 pub struct Point {
     pub position: math::Point,
     pub color: Color,
+    /// the light group this light belongs to; see `Light::group`.
+    pub group: usize,
+    /// how the light diminishes with distance, or `None` to use `World::falloff`.
+    pub falloff: Option<Falloff>,
 }
 
 impl Point {
     pub fn new(position: math::Point, color: Color) -> Point {
-        Point { position, color }
+        Point {
+            position,
+            color,
+            group: 0,
+            falloff: None,
+        }
+    }
+
+    pub fn with_group(self, group: usize) -> Point {
+        Point { group, ..self }
+    }
+
+    pub fn with_falloff(self, falloff: Falloff) -> Point {
+        Point {
+            falloff: Some(falloff),
+            ..self
+        }
     }
 
+    /// the color of the light that arrives at `point`, before any shadowing.
+    pub fn color_at(&self, world: &World, point: math::Point) -> Color {
+        let falloff = self.falloff.unwrap_or(world.falloff);
+        self.color * falloff.attenuation((self.position - point).magnitude())
+    }
+
+    /// whether any of the light is blocked on its way to `point`.
     pub fn casts_shade(&self, world: &World, point: math::Point) -> bool {
+        self.transmittance(world, point) != Color::white()
+    }
+
+    /// the fraction of the light, for each color, which reaches `point`: white where
+    /// nothing is in the way, black where an opaque object is. each surface of a
+    /// transparent object lets through as much as its transparency. if the world's
+    /// shadows are colored, the light is also tinted by each object it passes
+    /// through, by as much more as it travels further inside; the color of an object
+    /// is the color that white light takes on after one unit inside it.
+    pub fn transmittance(&self, world: &World, point: math::Point) -> Color {
         let to_light = self.position - point;
         let distance = to_light.magnitude();
         let direction = to_light.normalized();
         let ray_to_light = Ray::new(point, direction);
 
-        if let Some(intersections) = world.hit(ray_to_light) {
-            if let Some(intersection) = intersections.closest() {
-                if intersection.time < distance {
-                    return true;
-                }
+        // only objects between the point and the light can block it. shadow catchers
+        // are invisible, so they cannot cast shadows, and neither can objects which
+        // have been told not to. nothing beyond an opaque object matters, since none of
+        // the light gets past it.
+        let blocks = |object: &Geometry| {
+            !object.material.shadow_catcher
+                && object.visibility.shadows
+                && object.material.transparency <= 0.0
+        };
+        let intersections = match world.hit_until(ray_to_light, 0.0, distance, &blocks) {
+            Some(intersections) => intersections,
+            None => return Color::white(),
+        };
+
+        let mut passed = Color::white();
+        // the objects that the ray to the light is inside of, with where it entered
+        // them and their color there.
+        let mut inside: Vec<(&Geometry, f64, Color)> = vec![];
+        for intersection in intersections.iter().filter(|intersection| {
+            !intersection.object.material.shadow_catcher && intersection.object.visibility.shadows
+        }) {
+            let at = ray_to_light.at(intersection.time);
+            let material = intersection.object.material.at(at, intersection.uv);
+            if material.transparency <= 0.0 {
+                return Color::black();
+            }
+            passed = passed * material.transparency;
+            if !world.colored_shadows {
+                continue;
             }
-        }
 
-        false
+            let color = material.texture.color_at_uv(at, intersection.uv);
+            let entering = intersection
+                .object
+                .normal_at(at)
+                .map_or(true, |normal| normal.dot(&direction) < 0.0);
+            if entering {
+                inside.push((&intersection.object, intersection.time, color));
+            } else {
+                // a ray which leaves an object it never entered started inside it.
+                let (start, color) = match inside
+                    .iter()
+                    .rposition(|&(object, _, _)| *object == intersection.object)
+                {
+                    Some(i) => {
+                        let (_, start, color) = inside.remove(i);
+                        (start, color)
+                    }
+                    None => (0.0, color),
+                };
+                passed = passed * color.powf(intersection.time - start);
+            }
+        }
+        // the light itself is inside whatever is left.
+        for (_, start, color) in inside {
+            passed = passed * color.powf(distance - start);
+        }
+        passed
     }
 }
 
@@ -54,6 +141,31 @@ mod tests {
         let light = Point::new(position, color);
         assert_eq!(light.position, position);
         assert_eq!(light.color, color);
+        assert_eq!(light.group, 0);
+        assert_eq!(light.falloff, None);
+    }
+
+    #[test]
+    fn light_falloff_defaults_to_world() {
+        let light = Point::new(math::Point::zero(), Color::new(4.0, 4.0, 4.0));
+        let point = math::Point::new(0.0, 2.0, 0.0);
+        let mut world = World::new(vec![], vec![]);
+        assert_eq!(light.color_at(&world, point), Color::new(4.0, 4.0, 4.0));
+        world.falloff = Falloff::InverseSquare;
+        assert_eq!(light.color_at(&world, point), Color::new(1.0, 1.0, 1.0));
+    }
+
+    #[test]
+    fn light_falloff_overrides_world() {
+        let light = Point::new(math::Point::zero(), Color::new(4.0, 4.0, 4.0))
+            .with_falloff(Falloff::Constant);
+        let point = math::Point::new(0.0, 2.0, 0.0);
+        let mut world = World::new(vec![], vec![]);
+        world.falloff = Falloff::InverseSquare;
+        assert_eq!(light.color_at(&world, point), Color::new(4.0, 4.0, 4.0));
+        let light = light.with_falloff(Falloff::InverseSquare);
+        world.falloff = Falloff::Constant;
+        assert_eq!(light.color_at(&world, point), Color::new(1.0, 1.0, 1.0));
     }
 
     #[test]
@@ -70,10 +182,16 @@ mod tests {
             &world,
             &Computations {
                 point,
+                over_point: point,
+                under_point: point,
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: true,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(result, Color::new(1.9, 1.9, 1.9));
@@ -97,10 +215,16 @@ mod tests {
             &world,
             &Computations {
                 point,
+                over_point: point,
+                under_point: point,
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: true,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(result, Color::new(1.0, 1.0, 1.0));
@@ -120,10 +244,16 @@ mod tests {
             &world,
             &Computations {
                 point,
+                over_point: point,
+                under_point: point,
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: true,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(result, Color::new(0.7364, 0.7364, 0.7364));
@@ -147,10 +277,16 @@ mod tests {
             &world,
             &Computations {
                 point,
+                over_point: point,
+                under_point: point,
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: true,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(result, Color::new(1.6364, 1.6364, 1.6364));
@@ -170,10 +306,16 @@ mod tests {
             &world,
             &Computations {
                 point,
+                over_point: point,
+                under_point: point,
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: false,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(result, Color::new(0.1, 0.1, 0.1));
@@ -196,10 +338,16 @@ mod tests {
             &world,
             &Computations {
                 point,
+                over_point: point,
+                under_point: point,
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: false,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(result, Color::new(0.1, 0.1, 0.1));
@@ -224,20 +372,32 @@ mod tests {
             &world,
             &Computations {
                 point: math::Point::new(0.9, 0.0, 0.0),
+                over_point: math::Point::new(0.9, 0.0, 0.0),
+                under_point: math::Point::new(0.9, 0.0, 0.0),
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: false,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         let c2 = light.illuminate(
             &world,
             &Computations {
                 point: math::Point::new(1.1, 0.0, 0.0),
+                over_point: math::Point::new(1.1, 0.0, 0.0),
+                under_point: math::Point::new(1.1, 0.0, 0.0),
+                reflect_vector: Vector::zero(),
                 to_eye,
                 surface_normal,
-                material,
+                material: material.clone(),
                 is_inside: false,
+                uv: None,
+                n1: 1.0,
+                n2: 1.0,
             },
         );
         assert_eq!(c1, Color::white());
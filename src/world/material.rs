@@ -3,15 +3,74 @@ use crate::{
     world::{Color, Pattern, Texture, Textured},
 };
 
+pub mod anisotropy;
+pub use anisotropy::Anisotropy;
+
 /// contains required data for the phong reflection model.
 /// (https://en.wikipedia.org/wiki/Phong_reflection_model)
-#[derive(Copy, Clone, Debug)]
+#[derive(Clone, Debug)]
 pub struct Material {
     pub texture: Texture,
     pub ambient: f64,
     pub diffuse: f64,
     pub specular: f64,
     pub shininess: f64,
+    /// a shadow catcher is invisible, except for the shadows that are cast onto it,
+    /// which darken whatever is behind it. this allows rendered objects to be
+    /// composited onto a photograph of a real surface. if it is `reflective`, the
+    /// objects that it reflects are added on top, but never the background.
+    pub shadow_catcher: bool,
+    /// another material painted over this one in places.
+    pub coat: Option<Coat>,
+    /// when set, highlights are stretched along a grain instead of using `shininess`.
+    pub anisotropy: Option<Anisotropy>,
+    /// how much light passes through the surface, from 0 (none) to 1 (all of it).
+    /// shadows cast by a transparent object are lighter to match.
+    pub transparency: f64,
+    /// how much of the surrounding scene the surface reflects, from 0 (none, the
+    /// default) to 1 (a perfect mirror).
+    pub reflective: f64,
+    /// how much light bends as it passes into the material; 1 for a vacuum (the
+    /// default), about 1.5 for glass. only transparent materials refract.
+    pub refractive_index: f64,
+}
+
+/// a second material painted over a first, such as patches of rust over paint. it
+/// covers the first wherever its mask is white, blends with it wherever its mask is
+/// gray, and leaves it bare wherever its mask is black.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Coat {
+    pub texture: Texture,
+    pub ambient: f64,
+    pub diffuse: f64,
+    pub specular: f64,
+    pub shininess: f64,
+    pub mask: Pattern,
+}
+
+impl Coat {
+    /// takes everything but whether it is a shadow catcher from `material`.
+    pub fn new(material: Material, mask: Pattern) -> Coat {
+        Coat {
+            texture: material.texture.clone(),
+            ambient: material.ambient,
+            diffuse: material.diffuse,
+            specular: material.specular,
+            shininess: material.shininess,
+            mask,
+        }
+    }
+
+    /// the material that is painted on, without its mask.
+    pub fn material(&self) -> Material {
+        Material::new(
+            self.texture.clone(),
+            self.ambient,
+            self.diffuse,
+            self.specular,
+            self.shininess,
+        )
+    }
 }
 
 impl Material {
@@ -28,17 +87,74 @@ impl Material {
             diffuse,
             specular,
             shininess,
+            shadow_catcher: false,
+            coat: None,
+            anisotropy: None,
+            transparency: 0.0,
+            reflective: 0.0,
+            refractive_index: 1.0,
+        }
+    }
+
+    pub fn with_coat(&self, coat: Coat) -> Material {
+        Material {
+            coat: Some(coat),
+            ..self.clone()
+        }
+    }
+
+    pub fn with_anisotropy(&self, anisotropy: Anisotropy) -> Material {
+        Material {
+            anisotropy: Some(anisotropy),
+            ..self.clone()
+        }
+    }
+
+    /// the material as it is at one point, with its coat (if it has one) blended in
+    /// according to the mask there. `uv` are the surface coordinates of the point, if
+    /// the object has them.
+    pub fn at(&self, point: Point, uv: Option<(f64, f64)>) -> Material {
+        let coat = match self.coat {
+            Some(ref coat) => coat,
+            None => return self.clone(),
+        };
+
+        let mask = coat.mask.color_at(point);
+        let amount = ((mask.red() + mask.green() + mask.blue()) / 3.0)
+            .max(0.0)
+            .min(1.0);
+        let blend = |under: f64, over: f64| under + (over - under) * amount;
+
+        let color = self.texture.color_at_uv(point, uv) * (1.0 - amount)
+            + coat.texture.color_at_uv(point, uv) * amount;
+
+        Material {
+            texture: Texture::pattern(Pattern::solid(color)),
+            ambient: blend(self.ambient, coat.ambient),
+            diffuse: blend(self.diffuse, coat.diffuse),
+            specular: blend(self.specular, coat.specular),
+            shininess: blend(self.shininess, coat.shininess),
+            shadow_catcher: self.shadow_catcher,
+            coat: None,
+            anisotropy: self.anisotropy,
+            transparency: self.transparency,
+            reflective: self.reflective,
+            refractive_index: self.refractive_index,
         }
     }
 
     pub fn with_texture(&self, texture: Texture) -> Material {
-        Material::new(
+        Material {
             texture,
-            self.ambient,
-            self.diffuse,
-            self.specular,
-            self.shininess,
-        )
+            ..self.clone()
+        }
+    }
+
+    pub fn shadow_catcher() -> Material {
+        Material {
+            shadow_catcher: true,
+            ..Material::default()
+        }
     }
 }
 
@@ -67,6 +183,12 @@ impl PartialEq for Material {
             && (self.diffuse - other.diffuse).abs() < EPSILON
             && (self.specular - other.specular).abs() < EPSILON
             && (self.shininess - other.shininess).abs() < EPSILON
+            && self.shadow_catcher == other.shadow_catcher
+            && self.coat == other.coat
+            && self.anisotropy == other.anisotropy
+            && (self.transparency - other.transparency).abs() < EPSILON
+            && (self.reflective - other.reflective).abs() < EPSILON
+            && (self.refractive_index - other.refractive_index).abs() < EPSILON
     }
 }
 
@@ -85,5 +207,48 @@ mod tests {
         assert_eq!(m.diffuse, 0.9);
         assert_eq!(m.specular, 0.9);
         assert_eq!(m.shininess, 200.0);
+        assert!(!m.shadow_catcher);
+        assert_eq!(m.coat, None);
+        assert_eq!(m.transparency, 0.0);
+        assert_eq!(m.reflective, 0.0);
+        assert_eq!(m.refractive_index, 1.0);
+    }
+
+    #[test]
+    fn coat_blends_by_mask() {
+        let paint = Material::default()
+            .with_texture(Texture::pattern(Pattern::solid(Color::new(0.0, 0.0, 1.0))));
+        let rust = Material {
+            specular: 0.0,
+            ..paint.with_texture(Texture::pattern(Pattern::solid(Color::new(0.6, 0.3, 0.0))))
+        };
+
+        let covered = paint
+            .with_coat(Coat::new(rust.clone(), Pattern::solid(Color::white())))
+            .at(Point::zero(), None);
+        assert_eq!(covered.color_at(Point::zero()), Color::new(0.6, 0.3, 0.0));
+        assert_eq!(covered.specular, 0.0);
+        assert_eq!(covered.coat, None);
+
+        let blended = paint
+            .with_coat(Coat::new(
+                rust.clone(),
+                Pattern::solid(Color::new(0.5, 0.5, 0.5)),
+            ))
+            .at(Point::zero(), None);
+        assert_eq!(blended.color_at(Point::zero()), Color::new(0.3, 0.15, 0.5));
+        assert_eq!(blended.specular, 0.45);
+
+        let bare = paint
+            .with_coat(Coat::new(rust, Pattern::solid(Color::black())))
+            .at(Point::zero(), None);
+        assert_eq!(bare.color_at(Point::zero()), Color::new(0.0, 0.0, 1.0));
+        assert_eq!(bare.specular, paint.specular);
+    }
+
+    #[test]
+    fn material_without_coat_is_unchanged() {
+        let m = Material::default();
+        assert_eq!(m.at(Point::new(1.0, 2.0, 3.0), Some((0.5, 0.5))), m);
     }
 }
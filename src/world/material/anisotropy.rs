@@ -0,0 +1,126 @@
+use std::f64::consts;
+
+use crate::math::{Vector, EPSILON};
+
+/// highlights which are stretched in one direction across the surface, like those on
+/// brushed metal. uses the ward model, which measures roughness separately along the
+/// grain of the surface and across it.
+/// (https://en.wikipedia.org/wiki/Specular_highlight#Ward_anisotropic_distribution)
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Anisotropy {
+    /// the roughness along the grain, usually between 0.01 and 0.5.
+    pub roughness_x: f64,
+    /// the roughness across the grain.
+    pub roughness_y: f64,
+    /// the direction (in world space) that the grain runs in. it is flattened onto
+    /// the surface at each point, so it does not need to lie along it.
+    pub grain: Vector,
+}
+
+impl Anisotropy {
+    /// the grain runs along the x axis.
+    pub fn new(roughness_x: f64, roughness_y: f64) -> Anisotropy {
+        Anisotropy {
+            roughness_x,
+            roughness_y,
+            grain: Vector::new(1.0, 0.0, 0.0),
+        }
+    }
+
+    pub fn with_grain(self, grain: Vector) -> Anisotropy {
+        Anisotropy { grain, ..self }
+    }
+
+    /// how much of the light arriving from `to_light` is reflected towards `to_eye`,
+    /// where all three vectors are normalized. takes the place of the phong
+    /// highlight's `reflect_dot_eye.powf(shininess)` factor.
+    pub fn specular(&self, normal: Vector, to_light: Vector, to_eye: Vector) -> f64 {
+        let light_dot_normal = to_light.dot(&normal);
+        let eye_dot_normal = to_eye.dot(&normal);
+        if light_dot_normal <= 0.0 || eye_dot_normal <= 0.0 {
+            return 0.0;
+        }
+
+        // the grain, and the direction across it, along the surface.
+        let along = self.grain - normal * self.grain.dot(&normal);
+        let along = if along.magnitude() < EPSILON {
+            // the grain points straight out of the surface, so pick any direction.
+            let other = if normal[2].abs() < 0.9 {
+                Vector::new(0.0, 0.0, 1.0)
+            } else {
+                Vector::new(1.0, 0.0, 0.0)
+            };
+            normal.cross(&other)
+        } else {
+            along
+        }
+        .normalized();
+        let across = normal.cross(&along);
+
+        let halfway = (to_light + to_eye).normalized();
+        let x = halfway.dot(&along) / self.roughness_x;
+        let y = halfway.dot(&across) / self.roughness_y;
+        let h = halfway.dot(&normal);
+
+        let exponent = -(x * x + y * y) / (h * h);
+        let brdf = exponent.exp()
+            / (4.0
+                * consts::PI
+                * self.roughness_x
+                * self.roughness_y
+                * (light_dot_normal * eye_dot_normal).sqrt());
+
+        brdf * light_dot_normal
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn tilted(x: f64, z: f64) -> Vector {
+        Vector::new(x, 1.0, z).normalized()
+    }
+
+    #[test]
+    fn highlight_is_stretched_along_grain() {
+        let brushed = Anisotropy::new(0.5, 0.1);
+        let normal = Vector::new(0.0, 1.0, 0.0);
+        let to_eye = normal;
+
+        // the same tilt of the light, once along the grain and once across it.
+        let along = brushed.specular(normal, tilted(0.3, 0.0), to_eye);
+        let across = brushed.specular(normal, tilted(0.0, 0.3), to_eye);
+        assert!(across * 5.0 < along);
+    }
+
+    #[test]
+    fn equal_roughness_is_symmetric() {
+        let isotropic = Anisotropy::new(0.2, 0.2);
+        let normal = Vector::new(0.0, 1.0, 0.0);
+        let along = isotropic.specular(normal, tilted(0.3, 0.0), normal);
+        let across = isotropic.specular(normal, tilted(0.0, 0.3), normal);
+        assert!((along - across).abs() < EPSILON);
+    }
+
+    #[test]
+    fn grain_is_flattened_onto_surface() {
+        let normal = Vector::new(0.0, 1.0, 0.0);
+        let flat = Anisotropy::new(0.5, 0.1);
+        let steep = flat.with_grain(Vector::new(1.0, 5.0, 0.0));
+        let to_light = tilted(0.3, 0.1);
+        assert!(
+            (flat.specular(normal, to_light, normal) - steep.specular(normal, to_light, normal))
+                .abs()
+                < EPSILON
+        );
+    }
+
+    #[test]
+    fn no_highlight_from_behind() {
+        let brushed = Anisotropy::new(0.5, 0.1);
+        let normal = Vector::new(0.0, 1.0, 0.0);
+        assert_eq!(brushed.specular(normal, -normal, normal), 0.0);
+        assert_eq!(brushed.specular(normal, normal, -normal), 0.0);
+    }
+}
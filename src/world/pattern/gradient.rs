@@ -22,6 +22,11 @@ impl Gradient {
             inverse: Matrix::identity(),
         }
     }
+
+    /// the two colors that the pattern blends between.
+    pub fn colors(&self) -> (Color, Color) {
+        (self.a, self.b)
+    }
 }
 
 impl Transformable for Gradient {
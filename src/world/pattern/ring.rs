@@ -22,6 +22,11 @@ impl Ring {
             inverse: Matrix::identity(),
         }
     }
+
+    /// the two colors that the pattern alternates between.
+    pub fn colors(&self) -> (Color, Color) {
+        (self.a, self.b)
+    }
 }
 
 impl Transformable for Ring {
@@ -0,0 +1,180 @@
+use std::{
+    error,
+    fmt::{self, Display, Formatter},
+    str::FromStr,
+};
+
+use crate::world::{Camera, World};
+
+/// presets which trade image quality for rendering speed.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Quality {
+    /// a quick, low resolution preview without shadows and with shallow reflections.
+    Draft,
+    /// a reasonably quick render that is good enough to judge composition and lighting.
+    Medium,
+    /// the full resolution image, with as many samples as the camera asks for.
+    Final,
+}
+
+impl Quality {
+    /// the name of the preset, as it is parsed.
+    pub fn name(&self) -> &'static str {
+        match self {
+            Quality::Draft => "draft",
+            Quality::Medium => "medium",
+            Quality::Final => "final",
+        }
+    }
+
+    /// the fraction of the camera's resolution to render at.
+    pub fn resolution_scale(&self) -> f64 {
+        match self {
+            Quality::Draft => 0.25,
+            Quality::Medium => 0.5,
+            Quality::Final => 1.0,
+        }
+    }
+
+    /// the number of samples taken along each axis of a pixel, or `None` to keep the
+    /// camera's own.
+    pub fn samples(&self) -> Option<usize> {
+        match self {
+            Quality::Draft => Some(1),
+            Quality::Medium => Some(2),
+            Quality::Final => None,
+        }
+    }
+
+    /// how many times rays are reflected or refracted before giving up.
+    pub fn max_depth(&self) -> usize {
+        match self {
+            Quality::Draft => 2,
+            Quality::Medium => 4,
+            Quality::Final => 5,
+        }
+    }
+
+    /// whether shadow rays are cast.
+    pub fn shadows(&self) -> bool {
+        match self {
+            Quality::Draft => false,
+            Quality::Medium | Quality::Final => true,
+        }
+    }
+
+    /// applies this preset to the world, replacing its shadows and maximum depth, and
+    /// returns a camera configured to match it. settings which are given explicitly,
+    /// such as a maximum depth on the command line, should be applied afterwards so
+    /// that they win over the preset's.
+    pub fn apply(&self, camera: &Camera, world: &mut World) -> Camera {
+        let scale =
+            |length: usize| (((length as f64) * self.resolution_scale()).round() as usize).max(1);
+
+        let mut camera = camera.resized(scale(camera.image_width), scale(camera.image_height));
+        if let Some(samples) = self.samples() {
+            camera.samples = samples;
+        }
+        world.shadows = self.shadows();
+        world.max_depth = self.max_depth();
+
+        camera
+    }
+}
+
+impl Default for Quality {
+    fn default() -> Quality {
+        Quality::Final
+    }
+}
+
+/// returned when parsing the name of a quality preset which does not exist.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ParseQualityError(String);
+
+impl Display for ParseQualityError {
+    fn fmt(&self, f: &mut Formatter<'_>) -> fmt::Result {
+        write!(
+            f,
+            "unknown quality preset \"{}\" (expected draft, medium, or final)",
+            self.0
+        )
+    }
+}
+
+impl error::Error for ParseQualityError {}
+
+impl FromStr for Quality {
+    type Err = ParseQualityError;
+
+    fn from_str(s: &str) -> Result<Quality, ParseQualityError> {
+        match s.to_lowercase().as_str() {
+            "draft" => Ok(Quality::Draft),
+            "medium" => Ok(Quality::Medium),
+            "final" => Ok(Quality::Final),
+            _ => Err(ParseQualityError(s.to_string())),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::f64::consts;
+
+    #[test]
+    fn parse_quality() {
+        assert_eq!("draft".parse(), Ok(Quality::Draft));
+        assert_eq!("Medium".parse(), Ok(Quality::Medium));
+        assert_eq!("FINAL".parse(), Ok(Quality::Final));
+        assert_eq!(
+            "ultra".parse::<Quality>(),
+            Err(ParseQualityError("ultra".to_string()))
+        );
+        for quality in [Quality::Draft, Quality::Medium, Quality::Final].iter() {
+            assert_eq!(quality.name().parse(), Ok(*quality));
+        }
+    }
+
+    #[test]
+    fn default_quality_is_final() {
+        assert_eq!(Quality::default(), Quality::Final);
+    }
+
+    #[test]
+    fn apply_draft_quality() {
+        let mut world = World::default();
+        let camera = Camera::new(1000, 500, consts::PI / 3.0);
+        let draft = Quality::Draft.apply(&camera, &mut world);
+        assert_eq!(draft.image_width, 250);
+        assert_eq!(draft.image_height, 125);
+        assert_eq!(draft.samples, 1);
+        assert_eq!(draft.field_of_view, camera.field_of_view);
+        assert!(!world.shadows);
+        assert_eq!(world.max_depth, 2);
+    }
+
+    #[test]
+    fn apply_final_quality() {
+        let mut world = World::default();
+        world.shadows = false;
+        world.max_depth = 1;
+        let mut camera = Camera::new(1000, 500, consts::PI / 3.0);
+        camera.samples = 4;
+        let full = Quality::Final.apply(&camera, &mut world);
+        assert_eq!(full.image_width, 1000);
+        assert_eq!(full.image_height, 500);
+        assert_eq!(full.samples, 4);
+        assert!(world.shadows);
+        assert_eq!(world.max_depth, 5);
+    }
+
+    #[test]
+    fn tiny_images_keep_at_least_one_pixel() {
+        let mut world = World::default();
+        let camera = Camera::new(2, 1, consts::PI / 3.0);
+        let draft = Quality::Draft.apply(&camera, &mut world);
+        assert_eq!(draft.image_width, 1);
+        assert_eq!(draft.image_height, 1);
+    }
+}
@@ -0,0 +1,261 @@
+use std::{
+    sync::{
+        atomic::{AtomicBool, Ordering},
+        Arc,
+    },
+    time::Duration,
+};
+
+use crate::world::{
+    camera::{Schedule, Tile},
+    stats::Report,
+    Camera, Canvas, Quality, World,
+};
+
+/// everything needed to render a scene, held together so that the command line, a
+/// preview window, or anything else can drive a render the same way: configure the
+/// session, hand out `Canceller`s to whatever may need to stop it, and call `render`.
+pub struct Session {
+    pub world: World,
+    pub camera: Camera,
+    pub schedule: Schedule,
+    keep_going: Arc<AtomicBool>,
+}
+
+/// stops the render of the session it came from; see `Session::canceller`.
+#[derive(Clone, Debug)]
+pub struct Canceller(Arc<AtomicBool>);
+
+/// how far along a render is, given each time a tile is finished.
+#[derive(Copy, Clone, Debug)]
+pub struct Progress {
+    pub finished: usize,
+    pub total: usize,
+}
+
+impl Session {
+    pub fn new(world: World, camera: Camera) -> Session {
+        Session {
+            world,
+            camera,
+            schedule: Schedule::default(),
+            keep_going: Arc::new(AtomicBool::new(true)),
+        }
+    }
+
+    pub fn with_schedule(self, schedule: Schedule) -> Session {
+        Session { schedule, ..self }
+    }
+
+    /// applies a quality preset to the camera and the world.
+    pub fn with_quality(mut self, quality: Quality) -> Session {
+        self.camera = quality.apply(&self.camera, &mut self.world);
+        self
+    }
+
+    /// counts the rays tested against each object while rendering; see `stats`.
+    pub fn with_stats(mut self) -> Session {
+        self.world.collect_stats();
+        self
+    }
+
+    /// the counts from the renders so far, if the session is collecting them.
+    pub fn stats(&self) -> Option<Report> {
+        self.world
+            .stats
+            .as_ref()
+            .map(|stats| stats.report().with_names(&self.world))
+    }
+
+    pub fn canceller(&self) -> Canceller {
+        Canceller(self.keep_going.clone())
+    }
+
+    /// renders the image, calling `on_progress` on this thread as each tile is
+    /// finished. returns `None` if the render was cancelled before it was finished.
+    /// cancelling stops the render which is running (or the next one, if none is),
+    /// and the session can be rendered again afterwards.
+    pub fn render<F: FnMut(Progress)>(&self, on_progress: F) -> Option<Canvas> {
+        let (image, missing) = self.render_partial(on_progress);
+        if missing.is_empty() {
+            Some(image)
+        } else {
+            None
+        }
+    }
+
+    /// like `render`, but a cancelled render gives back the image as far as it got,
+    /// along with the tiles which were not rendered; see `Camera::render_partial`.
+    pub fn render_partial<F: FnMut(Progress)>(&self, mut on_progress: F) -> (Canvas, Vec<Tile>) {
+        let total = self
+            .schedule
+            .tiles(self.camera.image_width, self.camera.image_height)
+            .len();
+        let mut finished = 0;
+
+        let image =
+            self.camera
+                .render_partial(&self.world, &self.schedule, &self.keep_going, |_| {
+                    finished += 1;
+                    on_progress(Progress { finished, total });
+                });
+
+        self.keep_going.store(true, Ordering::Relaxed);
+        image
+    }
+
+    /// renders the image as well as can be done within `budget`, refining it from
+    /// blocks of `block_size` pixels; see `Camera::render_within`. this renders on
+    /// one thread, and ignores the schedule. cancelling stops refining, once the
+    /// first pass covers the image.
+    pub fn render_within(&self, block_size: usize, budget: Duration) -> Canvas {
+        let image = self
+            .camera
+            .render_within(&self.world, block_size, budget, &self.keep_going);
+
+        self.keep_going.store(true, Ordering::Relaxed);
+        image
+    }
+
+    /// renders the image once, and returns a copy of it for each of `stops`, exposed
+    /// by that many stops more than the camera's own exposure; see `Canvas::exposed`.
+    /// returns `None` if the render was cancelled.
+    pub fn render_bracketed<F: FnMut(Progress)>(
+        &self,
+        stops: &[f64],
+        on_progress: F,
+    ) -> Option<Vec<Canvas>> {
+        let image = self.render(on_progress)?;
+        Some(stops.iter().map(|&stop| image.exposed(stop)).collect())
+    }
+}
+
+impl Canceller {
+    pub fn cancel(&self) {
+        self.0.store(false, Ordering::Relaxed);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::math::{Point, Vector};
+    use crate::world::{Color, View};
+    use std::f64::consts;
+
+    fn session() -> Session {
+        let mut camera = Camera::new(20, 10, consts::PI / 2.0);
+        camera.view = View::transformed(
+            Point::new(0.0, 0.0, -5.0),
+            Point::zero(),
+            Vector::new(0.0, 1.0, 0.0),
+        );
+        Session::new(World::default(), camera)
+            .with_schedule(Schedule::default().with_workers(1).with_tile_size(5))
+    }
+
+    #[test]
+    fn render_reports_progress() {
+        let session = session();
+        let mut progress = vec![];
+        let image = session
+            .render(|p| progress.push((p.finished, p.total)))
+            .unwrap();
+        assert_eq!(progress, (1..=8).map(|i| (i, 8)).collect::<Vec<_>>());
+        assert_eq!(image.hash(), session.camera.render(&session.world).hash());
+    }
+
+    #[test]
+    fn cancelling_stops_render() {
+        let session = session();
+        let canceller = session.canceller();
+
+        // cancelled before the workers pick up their first tiles.
+        canceller.cancel();
+        let mut finished = 0;
+        assert!(session.render(|p| finished = p.finished).is_none());
+        assert_eq!(finished, 0);
+
+        // the next render is not cancelled.
+        assert!(session.render(|_| {}).is_some());
+    }
+
+    #[test]
+    fn cancelling_keeps_partial_image() {
+        let session = session();
+        let canceller = session.canceller();
+        let complete = session.render(|_| {}).unwrap();
+
+        // cancelled before it starts, nothing is rendered.
+        canceller.cancel();
+        let (image, missing) = session.render_partial(|_| {});
+        let tiles = session.schedule.tiles(20, 10);
+        assert_eq!(missing, tiles);
+        assert_eq!(image.hash(), Canvas::new(20, 10).hash());
+
+        // cancelled once the third tile is finished. there is only one worker, though
+        // it may have gone on to more tiles by the time it sees the cancellation.
+        let (image, missing) = session.render_partial(|p| {
+            if p.finished == 3 {
+                canceller.cancel();
+            }
+        });
+        assert!(missing.len() <= tiles.len() - 3);
+        assert_eq!(missing, tiles[(tiles.len() - missing.len())..].to_vec());
+        for tile in tiles.iter() {
+            let rendered = !missing.contains(tile);
+            for y in tile.y..(tile.y + tile.height) {
+                for x in tile.x..(tile.x + tile.width) {
+                    let expected = if rendered {
+                        complete[(x, y)]
+                    } else {
+                        Color::black()
+                    };
+                    assert_eq!(image[(x, y)], expected);
+                }
+            }
+        }
+
+        let (image, missing) = session.render_partial(|_| {});
+        assert!(missing.is_empty());
+        assert_eq!(image.hash(), complete.hash());
+    }
+
+    #[test]
+    fn cancelling_stops_refining() {
+        let session = session();
+        let mut first_pass = None;
+        session
+            .camera
+            .render_progressively(&session.world, 4, |canvas| {
+                first_pass.get_or_insert_with(|| canvas.hash());
+            });
+
+        session.canceller().cancel();
+        let image = session.render_within(4, Duration::from_secs(60));
+        assert_eq!(Some(image.hash()), first_pass);
+
+        // the next render is not cancelled.
+        let image = session.render_within(4, Duration::from_secs(60));
+        assert_eq!(image.hash(), session.camera.render(&session.world).hash());
+    }
+
+    #[test]
+    fn bracketing_matches_exposure() {
+        let mut session = session();
+        let images = session.render_bracketed(&[-1.0, 0.0], |_| {}).unwrap();
+        assert_eq!(images.len(), 2);
+        assert_eq!(images[1].hash(), session.render(|_| {}).unwrap().hash());
+
+        session.camera.exposure = session.camera.exposure.with_compensation(-1.0);
+        assert_eq!(images[0].hash(), session.render(|_| {}).unwrap().hash());
+    }
+
+    #[test]
+    fn stats_are_collected() {
+        let session = session().with_stats();
+        assert_eq!(session.stats().unwrap().objects.len(), 0);
+        session.render(|_| {});
+        assert_eq!(session.stats().unwrap().objects.len(), 2);
+    }
+}
@@ -0,0 +1,102 @@
+use std::sync::Arc;
+
+use crate::world::{canvas::ParsePngError, Canvas, Color};
+
+/// an image whose pixels each have a color and an alpha (opacity) between 0 and 1.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Sprite {
+    pub width: usize,
+    pub height: usize,
+    pixels: Arc<[(Color, f64)]>,
+}
+
+impl Sprite {
+    /// `pixels` are listed row by row, starting from the top left. panics if the
+    /// image is empty, or if the number of pixels does not match.
+    pub fn new(width: usize, height: usize, pixels: Vec<(Color, f64)>) -> Sprite {
+        assert!(
+            0 < width && 0 < height,
+            "a sprite needs at least 1 by 1 pixels"
+        );
+        assert_eq!(
+            pixels.len(),
+            width * height,
+            "a {} by {} sprite needs {} pixels",
+            width,
+            height,
+            width * height
+        );
+
+        Sprite {
+            width,
+            height,
+            pixels: pixels.into(),
+        }
+    }
+
+    pub fn from_fn<F: FnMut(usize, usize) -> (Color, f64)>(
+        width: usize,
+        height: usize,
+        mut f: F,
+    ) -> Sprite {
+        let pixels = (0..(width * height))
+            .map(|i| f(i % width, i / width))
+            .collect();
+
+        Sprite::new(width, height, pixels)
+    }
+
+    /// an opaque sprite with the pixels of `canvas`, such as an image read by
+    /// `Canvas::from_ppm`, `Canvas::from_png` or `Canvas::from_jpeg`.
+    pub fn from_canvas(canvas: &Canvas) -> Sprite {
+        Sprite::from_fn(canvas.width, canvas.height, |x, y| (canvas[(x, y)], 1.0))
+    }
+
+    /// reads a png image, keeping its alpha so that its transparent parts can be cut
+    /// out of a billboard. the colors are linear, as with `Canvas::from_png`.
+    pub fn from_png(bytes: &[u8]) -> Result<Sprite, ParsePngError> {
+        let (canvas, alpha) = Canvas::from_png_with_alpha(bytes)?;
+        Ok(Sprite::from_fn(canvas.width, canvas.height, |x, y| {
+            (canvas[(x, y)], alpha[y * canvas.width + x])
+        }))
+    }
+
+    /// the color and alpha of the pixel at the surface coordinates `(u, v)`, where
+    /// `u` goes from 0 at the left to 1 at the right, and `v` goes from 0 at the
+    /// bottom to 1 at the top.
+    pub fn sample(&self, u: f64, v: f64) -> (Color, f64) {
+        let x = (u * self.width as f64).max(0.0) as usize;
+        let y = ((1.0 - v) * self.height as f64).max(0.0) as usize;
+        self.pixels[y.min(self.height - 1) * self.width + x.min(self.width - 1)]
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn sample_corners() {
+        let sprite = Sprite::from_fn(2, 2, |x, y| (Color::new(x as f64, y as f64, 0.0), 0.5));
+        assert_eq!(sprite.sample(0.0, 1.0), (Color::new(0.0, 0.0, 0.0), 0.5));
+        assert_eq!(sprite.sample(1.0, 1.0), (Color::new(1.0, 0.0, 0.0), 0.5));
+        assert_eq!(sprite.sample(0.0, 0.0), (Color::new(0.0, 1.0, 0.0), 0.5));
+        assert_eq!(sprite.sample(0.75, 0.25), (Color::new(1.0, 1.0, 0.0), 0.5));
+    }
+
+    #[test]
+    fn sprite_from_png() {
+        let png = include_bytes!("../../resources/fixtures/rgba16-interlaced.png");
+        let sprite = Sprite::from_png(png).unwrap();
+        let (canvas, alpha) = Canvas::from_png_with_alpha(png).unwrap();
+        assert_eq!((sprite.width, sprite.height), (canvas.width, canvas.height));
+        assert_eq!(sprite.sample(0.0, 1.0), (canvas[(0, 0)], alpha[0]));
+    }
+
+    #[test]
+    fn sprite_from_canvas() {
+        let canvas = Canvas::from_fn(2, 1, |x, _| Color::new(x as f64, 0.0, 0.0));
+        let sprite = Sprite::from_canvas(&canvas);
+        assert_eq!(sprite.sample(0.75, 0.5), (Color::new(1.0, 0.0, 0.0), 1.0));
+    }
+}
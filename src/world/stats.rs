@@ -0,0 +1,187 @@
+use std::{
+    fmt::{self, Display, Formatter},
+    sync::{
+        atomic::{AtomicU64, Ordering},
+        Arc,
+    },
+    time::Duration,
+};
+
+use crate::world::World;
+
+/// counts how many rays are tested against each object of a world, how many of them
+/// hit, and how long the tests take, so that the objects which are slowing a render
+/// down can be found. the counters are shared between the threads of a render.
+#[derive(Debug, Default)]
+pub struct Stats {
+    objects: Vec<Counters>,
+}
+
+#[derive(Debug, Default)]
+struct Counters {
+    tests: AtomicU64,
+    hits: AtomicU64,
+    nanoseconds: AtomicU64,
+}
+
+/// what was counted for one object.
+#[derive(Clone, Debug, PartialEq)]
+pub struct ObjectStats {
+    /// the index of the object in the world.
+    pub object: usize,
+    /// the name of the object, if it has one and the report was given it.
+    pub name: Option<Arc<str>>,
+    pub tests: u64,
+    pub hits: u64,
+    pub time: Duration,
+}
+
+/// the counts for every object which was tested, costliest first.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Report {
+    pub objects: Vec<ObjectStats>,
+}
+
+impl Stats {
+    /// counts the first `objects` objects of a world.
+    pub fn new(objects: usize) -> Stats {
+        Stats {
+            objects: (0..objects).map(|_| Counters::default()).collect(),
+        }
+    }
+
+    /// records that a ray was tested against the object at index `object`. objects
+    /// beyond those which are being counted are ignored.
+    pub fn record(&self, object: usize, hit: bool, elapsed: Duration) {
+        if let Some(counters) = self.objects.get(object) {
+            counters.tests.fetch_add(1, Ordering::Relaxed);
+            if hit {
+                counters.hits.fetch_add(1, Ordering::Relaxed);
+            }
+            counters
+                .nanoseconds
+                .fetch_add(elapsed.as_nanos() as u64, Ordering::Relaxed);
+        }
+    }
+
+    /// sets every count back to zero.
+    pub fn reset(&self) {
+        for counters in self.objects.iter() {
+            counters.tests.store(0, Ordering::Relaxed);
+            counters.hits.store(0, Ordering::Relaxed);
+            counters.nanoseconds.store(0, Ordering::Relaxed);
+        }
+    }
+
+    pub fn report(&self) -> Report {
+        let mut objects: Vec<ObjectStats> = self
+            .objects
+            .iter()
+            .enumerate()
+            .map(|(object, counters)| ObjectStats {
+                object,
+                name: None,
+                tests: counters.tests.load(Ordering::Relaxed),
+                hits: counters.hits.load(Ordering::Relaxed),
+                time: Duration::from_nanos(counters.nanoseconds.load(Ordering::Relaxed)),
+            })
+            .filter(|stats| stats.tests > 0)
+            .collect();
+        objects.sort_by(|a, b| b.time.cmp(&a.time).then(b.tests.cmp(&a.tests)));
+
+        Report { objects }
+    }
+}
+
+impl Report {
+    /// the report, with the name of each object taken from `world`.
+    pub fn with_names(mut self, world: &World) -> Report {
+        for stats in self.objects.iter_mut() {
+            stats.name = world.objects.get(stats.object).and_then(|o| o.name.clone());
+        }
+        self
+    }
+}
+
+impl Display for Report {
+    fn fmt(&self, f: &mut Formatter) -> fmt::Result {
+        writeln!(
+            f,
+            "{:>8} {:<16} {:>12} {:>12} {:>12}",
+            "object", "name", "tests", "hits", "time (ms)"
+        )?;
+        for stats in self.objects.iter() {
+            writeln!(
+                f,
+                "{:>8} {:<16} {:>12} {:>12} {:>12.3}",
+                stats.object,
+                stats.name.as_deref().unwrap_or("-"),
+                stats.tests,
+                stats.hits,
+                stats.time.as_secs_f64() * 1000.0
+            )?;
+        }
+        Ok(())
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn report_is_sorted_by_time() {
+        let stats = Stats::new(3);
+        stats.record(0, true, Duration::from_micros(1));
+        stats.record(1, false, Duration::from_micros(5));
+        stats.record(1, true, Duration::from_micros(5));
+        stats.record(7, true, Duration::from_micros(100));
+
+        let report = stats.report();
+        assert_eq!(
+            report.objects,
+            vec![
+                ObjectStats {
+                    object: 1,
+                    name: None,
+                    tests: 2,
+                    hits: 1,
+                    time: Duration::from_micros(10),
+                },
+                ObjectStats {
+                    object: 0,
+                    name: None,
+                    tests: 1,
+                    hits: 1,
+                    time: Duration::from_micros(1),
+                },
+            ]
+        );
+    }
+
+    #[test]
+    fn report_names_objects() {
+        let mut world = World::default();
+        world.objects[1] = world.objects[1].clone().with_name("inner");
+        let stats = Stats::new(2);
+        stats.record(0, true, Duration::from_micros(2));
+        stats.record(1, true, Duration::from_micros(1));
+
+        let report = stats.report().with_names(&world);
+        let names: Vec<_> = report
+            .objects
+            .iter()
+            .map(|stats| stats.name.as_deref())
+            .collect();
+        assert_eq!(names, [None, Some("inner")]);
+        assert!(report.to_string().contains(" inner "));
+    }
+
+    #[test]
+    fn reset_clears_counts() {
+        let stats = Stats::new(1);
+        stats.record(0, true, Duration::from_micros(1));
+        stats.reset();
+        assert!(stats.report().objects.is_empty());
+    }
+}
@@ -1,34 +1,52 @@
 use crate::{
     math::{Matrix, Point, Transformable},
-    world::{Color, Pattern},
+    world::{Color, Pattern, Sprite},
 };
 
 pub trait Textured {
     fn color_at(&self, point: Point) -> Color;
 }
 
-#[derive(Copy, Clone, Debug, PartialEq)]
+#[derive(Clone, Debug, PartialEq)]
 pub enum Texture {
     Pattern(Pattern),
+    /// an image wrapped around the object using its surface coordinates.
+    Image(Sprite),
 }
 
 impl Texture {
     pub fn pattern(pattern: Pattern) -> Texture {
         Texture::Pattern(pattern)
     }
+
+    pub fn image(sprite: Sprite) -> Texture {
+        Texture::Image(sprite)
+    }
+
+    /// like `color_at`, but images are looked up by the surface coordinates `uv`
+    /// rather than by the point.
+    pub fn color_at_uv(&self, point: Point, uv: Option<(f64, f64)>) -> Color {
+        match (self, uv) {
+            (Texture::Image(sprite), Some((u, v))) => sprite.sample(u, v).0,
+            _ => self.color_at(point),
+        }
+    }
 }
 
 impl Transformable for Texture {
+    /// images follow the surface coordinates of the object, so they are not
+    /// transformed.
     fn transformed(self, transform: Matrix) -> Texture {
         match self {
             Texture::Pattern(pattern) => Texture::pattern(pattern.transformed(transform)),
+            Texture::Image(sprite) => Texture::image(sprite),
         }
     }
 
     fn transform(&mut self, transform: Matrix) -> &mut Texture {
-        *self = match self {
-            Texture::Pattern(pattern) => Texture::pattern(pattern.transformed(transform)),
-        };
+        if let Texture::Pattern(pattern) = self {
+            pattern.transform(transform);
+        }
         self
     }
 }
@@ -37,6 +55,9 @@ impl Textured for Texture {
     fn color_at(&self, object_space_point: Point) -> Color {
         match self {
             Texture::Pattern(pattern) => pattern.color_at(object_space_point),
+            // without surface coordinates, there is no way to tell where on the image
+            // the point is, so use its center.
+            Texture::Image(sprite) => sprite.sample(0.5, 0.5).0,
         }
     }
 }